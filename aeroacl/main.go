@@ -0,0 +1,101 @@
+package main
+
+// The entrypoint for aeroacl, managing the members of shared folders from a
+// desired state file
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	acl "github.com/aerofs/aerofs-sdk-golang/aerofsacl"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+// Global logger
+var logger = log.New(os.Stderr, "", log.LstdFlags)
+
+const USAGE = `Usage : AEROFS_TOKEN=<admin token> ./aeroacl <command> -host <appliance> [options]
+
+Commands :
+  plan   -state <acl.yaml> [-out <plan.json>]  print the changes, or save them
+  apply  -state <acl.yaml>                     plan and apply the changes
+  apply  -plan <plan.json>                     apply a saved plan`
+
+func exit(err error) {
+	fmt.Println(err)
+	os.Exit(1)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println(USAGE)
+		os.Exit(1)
+	}
+
+	flags := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	host := flags.String("host", "", "hostname of the AeroFS Appliance")
+	stateFile := flags.String("state", "", "desired state of the shared folders, YAML or JSON")
+	planFile := flags.String("plan", "", "saved plan to apply")
+	outFile := flags.String("out", "", "file the plan is saved to as JSON")
+	flags.Parse(os.Args[2:])
+
+	token := os.Getenv("AEROFS_TOKEN")
+	if *host == "" || token == "" || (*stateFile == "") == (*planFile == "") {
+		fmt.Println(USAGE)
+		os.Exit(1)
+	}
+	c, _ := api.NewClient(token, *host)
+
+	var plan *acl.Plan
+	if *planFile != "" {
+		f, err := os.Open(*planFile)
+		if err != nil {
+			exit(err)
+		}
+		plan, err = acl.LoadPlan(f)
+		f.Close()
+		if err != nil {
+			exit(err)
+		}
+	} else {
+		state, err := acl.LoadState(*stateFile)
+		if err != nil {
+			exit(err)
+		}
+		plan, err = acl.MakePlan(c, state)
+		if err != nil {
+			exit(err)
+		}
+	}
+
+	switch os.Args[1] {
+	case "plan":
+		if *outFile == "" {
+			plan.WriteText(os.Stdout)
+			return
+		}
+		data, _ := json.MarshalIndent(plan, "", "  ")
+		err := ioutil.WriteFile(*outFile, data, 0600)
+		if err != nil {
+			exit(err)
+		}
+
+	case "apply":
+		plan.WriteText(os.Stdout)
+		report := acl.Apply(c, plan, acl.ApplyOptions{Log: logger.Printf})
+		fmt.Printf("Applied %d changes, skipped %d, %d failed.\n",
+			len(report.Applied), len(report.Skipped), len(report.Failures))
+		if len(report.Failures) > 0 {
+			data, _ := json.MarshalIndent(report.Failures, "", "  ")
+			fmt.Println(string(data))
+			os.Exit(2)
+		}
+
+	default:
+		fmt.Println(USAGE)
+		os.Exit(1)
+	}
+}
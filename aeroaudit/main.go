@@ -0,0 +1,86 @@
+package main
+
+// The entrypoint for aeroaudit, reporting who can access which AeroFS shared
+// folder
+
+import (
+	"flag"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	audit "github.com/aerofs/aerofs-sdk-golang/aerofsaudit"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// Global logger
+var logger = log.New(os.Stderr, "", log.LstdFlags)
+
+const USAGE = `Usage :
+  AEROFS_TOKEN=<admin token> ./aeroaudit -host <appliance> [-domains <a.com,b.com>] [-format csv|json|html]
+  AEROFS_TOKEN=<admin token> ./aeroaudit -host <appliance> [-domains <a.com,b.com>] -out <prefix>`
+
+func exit(err error) {
+	fmt.Println(err)
+	os.Exit(1)
+}
+
+func write(report *audit.Report, format string, w io.Writer) error {
+	switch format {
+	case "csv":
+		return report.WriteCSV(w)
+	case "json":
+		return report.WriteJSON(w)
+	case "html":
+		return report.WriteHTML(w)
+	}
+	return fmt.Errorf("Unknown format %s", format)
+}
+
+func main() {
+	host := flag.String("host", "", "hostname of the AeroFS Appliance")
+	domains := flag.String("domains", "", "comma-separated domains users are expected to belong to")
+	format := flag.String("format", "csv", "output format : csv, json or html")
+	out := flag.String("out", "", "write <prefix>.csv, <prefix>.json and <prefix>.html")
+	flag.Parse()
+
+	token := os.Getenv("AEROFS_TOKEN")
+	if *host == "" || token == "" {
+		fmt.Println(USAGE)
+		os.Exit(1)
+	}
+	c, _ := api.NewClient(token, *host)
+
+	opts := audit.Options{Log: logger.Printf}
+	for _, d := range strings.Split(*domains, ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			opts.AllowedDomains = append(opts.AllowedDomains, d)
+		}
+	}
+
+	report, err := audit.Audit(c, opts)
+	if err != nil {
+		exit(err)
+	}
+
+	if *out == "" {
+		err = write(report, *format, os.Stdout)
+		if err != nil {
+			exit(err)
+		}
+		return
+	}
+	for _, f := range []string{"csv", "json", "html"} {
+		file, err := os.Create(*out + "." + f)
+		if err != nil {
+			exit(err)
+		}
+		err = write(report, f, file)
+		file.Close()
+		if err != nil {
+			exit(err)
+		}
+		logger.Printf("Wrote %s.%s", *out, f)
+	}
+}
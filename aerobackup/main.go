@@ -0,0 +1,125 @@
+package main
+
+// The entrypoint for aerobackup, backing up an AeroFS organization into a
+// local repository and restoring it onto an Appliance
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	backup "github.com/aerofs/aerofs-sdk-golang/aerofsbackup"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+// Global logger
+var logger = log.New(os.Stderr, "", log.LstdFlags)
+
+const USAGE = `Usage : AEROFS_TOKEN=<admin token> ./aerobackup <command> [options]
+
+Commands :
+  backup   -host <appliance> -repo <dir> [-tokens <tokens.json>]
+  restore  -host <appliance> -repo <dir> [-catalog <name>] [-tokens <tokens.json>] [-dry-run]
+  list     -repo <dir>
+
+The tokens file maps user emails to OAuth tokens for backing up or restoring
+root folders, ie. {"user@example.com": "<token>"}`
+
+// Read the user tokens file, if given
+func loadTokens(fileName string) (map[string]string, error) {
+	tokens := map[string]string{}
+	if fileName == "" {
+		return tokens, nil
+	}
+
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &tokens)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to unmarshal tokens : %s", err)
+	}
+	return tokens, nil
+}
+
+func exit(err error) {
+	fmt.Println(err)
+	os.Exit(1)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println(USAGE)
+		os.Exit(1)
+	}
+
+	flags := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	host := flags.String("host", "", "hostname of the AeroFS Appliance")
+	repoDir := flags.String("repo", "", "directory of the backup repository")
+	tokensFile := flags.String("tokens", "", "JSON file of user OAuth tokens by email")
+	catalogName := flags.String("catalog", "", "catalog to restore, the latest if empty")
+	dryRun := flags.Bool("dry-run", false, "report what a restore would do")
+	flags.Parse(os.Args[2:])
+
+	if *repoDir == "" {
+		fmt.Println(USAGE)
+		os.Exit(1)
+	}
+	repo, err := backup.OpenRepository(*repoDir)
+	if err != nil {
+		exit(err)
+	}
+
+	if os.Args[1] == "list" {
+		names, err := repo.Catalogs()
+		if err != nil {
+			exit(err)
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return
+	}
+
+	token := os.Getenv("AEROFS_TOKEN")
+	if *host == "" || token == "" {
+		fmt.Println(USAGE)
+		os.Exit(1)
+	}
+	c, _ := api.NewClient(token, *host)
+	tokens, err := loadTokens(*tokensFile)
+	if err != nil {
+		exit(err)
+	}
+
+	switch os.Args[1] {
+	case "backup":
+		catalog, name, err := backup.Backup(c, repo, backup.BackupOptions{
+			UserTokens: tokens, Log: logger.Printf})
+		if err != nil {
+			exit(err)
+		}
+		fmt.Printf("Wrote catalog %s : %d users, %d groups, %d shared folders, %d failures\n",
+			name, len(catalog.Users), len(catalog.Groups), len(catalog.Shares), len(catalog.Failures))
+
+	case "restore":
+		catalog, err := repo.LoadCatalog(*catalogName)
+		if err != nil {
+			exit(err)
+		}
+		report, err := backup.Restore(c, repo, catalog, backup.RestoreOptions{
+			UserTokens: tokens, DryRun: *dryRun, Log: logger.Printf})
+		if err != nil {
+			exit(err)
+		}
+		data, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(data))
+
+	default:
+		fmt.Println(USAGE)
+		os.Exit(1)
+	}
+}
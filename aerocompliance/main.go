@@ -0,0 +1,104 @@
+package main
+
+// The entrypoint for aerocompliance, reporting the users lacking two-factor
+// authentication and what changed since the previous scan
+
+import (
+	"flag"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	compliance "github.com/aerofs/aerofs-sdk-golang/aerofscompliance"
+	"log"
+	"os"
+	"strings"
+)
+
+// Global logger
+var logger = log.New(os.Stderr, "", log.LstdFlags)
+
+const USAGE = `Usage : AEROFS_TOKEN=<admin token> ./aerocompliance -host <appliance> [options]
+
+Options :
+  -state <scan.json>      the previous scan, replaced by this scan
+  -format json|csv        the format of the report written to stdout, json by default
+  -exclude <emails>       users left out, separated by commas
+  -disable-password       disable password login of users lacking two-factor
+  -exec <command>         run a command for every user lacking two-factor
+  -only-new               only remediate users who lacked two-factor since the previous scan
+  -dry-run                report remediations without running them
+  -concurrency <n>        the number of users checked at once`
+
+func exit(err error) {
+	fmt.Println(err)
+	os.Exit(1)
+}
+
+func main() {
+	host := flag.String("host", "", "hostname of the AeroFS Appliance")
+	stateFile := flag.String("state", "", "previous scan, replaced by this scan")
+	format := flag.String("format", "json", "json or csv")
+	exclude := flag.String("exclude", "", "emails left out, separated by commas")
+	disablePassword := flag.Bool("disable-password", false, "disable password login of users lacking two-factor")
+	command := flag.String("exec", "", "command run for every user lacking two-factor")
+	onlyNew := flag.Bool("only-new", false, "only remediate new findings")
+	dryRun := flag.Bool("dry-run", false, "report remediations without running them")
+	concurrency := flag.Int("concurrency", compliance.DEFAULT_CONCURRENCY, "number of users checked at once")
+	flag.Parse()
+
+	token := os.Getenv("AEROFS_TOKEN")
+	if *host == "" || token == "" || (*format != "json" && *format != "csv") {
+		fmt.Println(USAGE)
+		os.Exit(1)
+	}
+	c, _ := api.NewClient(token, *host)
+
+	opts := compliance.Options{OnlyNew: *onlyNew, DryRun: *dryRun, Concurrency: *concurrency,
+		Log: logger.Printf}
+	if *exclude != "" {
+		opts.Exclude = strings.Split(*exclude, ",")
+	}
+	if *disablePassword {
+		opts.Remediations = append(opts.Remediations, compliance.DisablePasswords(c))
+	}
+	if *command != "" {
+		opts.Remediations = append(opts.Remediations, compliance.Command("sh", "-c", *command))
+	}
+	if *stateFile != "" {
+		f, err := os.Open(*stateFile)
+		if err == nil {
+			opts.Previous, err = compliance.ReadReport(f)
+			f.Close()
+		}
+		if err != nil && !os.IsNotExist(err) {
+			exit(err)
+		}
+	}
+
+	report, err := compliance.Scan(c, opts)
+	if err != nil {
+		exit(err)
+	}
+	logger.Println(report.Summary())
+
+	if *format == "csv" {
+		err = compliance.WriteCSV(os.Stdout, report)
+	} else {
+		err = compliance.WriteJSON(os.Stdout, report)
+	}
+	if err != nil {
+		exit(err)
+	}
+
+	// A dry run leaves the state as it was, so remediations run next time
+	if *stateFile != "" && !*dryRun {
+		f, err := os.Create(*stateFile)
+		if err != nil {
+			exit(err)
+		}
+		err = compliance.WriteJSON(f, report)
+		f.Close()
+		if err != nil {
+			exit(err)
+		}
+	}
+}
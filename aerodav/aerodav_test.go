@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	"golang.org/x/net/webdav"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// An Appliance storing files in memory, in the root folder and folders below
+type fakeAppliance struct {
+	mu      sync.Mutex
+	folders map[string]api.Folder
+	files   map[string]*api.File
+	content map[string]string
+	uploads map[string]string
+	ids     int
+}
+
+func newFakeAppliance() *fakeAppliance {
+	return &fakeAppliance{folders: map[string]api.Folder{"root": {Id: "root"}},
+		files: map[string]*api.File{}, content: map[string]string{}, uploads: map[string]string{}}
+}
+
+func (f *fakeAppliance) nextId() string {
+	f.ids++
+	return fmt.Sprint(f.ids)
+}
+
+// Write a file's metadata with its ETag
+func (f *fakeAppliance) replyFile(w http.ResponseWriter, status int, file *api.File) {
+	w.Header().Set("ETag", file.Etag)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(file)
+}
+
+func (f *fakeAppliance) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1.3/"), "/")
+	ifMatch := r.Header.Get("If-Match")
+
+	if parts[0] == "folders" {
+		folder, ok := f.folders[parts[1]]
+		switch {
+		case !ok:
+			w.WriteHeader(http.StatusNotFound)
+		case len(parts) == 3:
+			children := api.Children{Folders: []api.Folder{}, Files: []api.File{}}
+			for _, file := range f.files {
+				if file.Parent == folder.Id {
+					children.Files = append(children.Files, *file)
+				}
+			}
+			json.NewEncoder(w).Encode(children)
+		default:
+			w.Header().Set("ETag", `"folder`+folder.Id+`"`)
+			json.NewEncoder(w).Encode(folder)
+		}
+		return
+	}
+
+	if r.Method == "POST" {
+		file := api.File{}
+		json.NewDecoder(r.Body).Decode(&file)
+		file.Id, file.Etag = f.nextId(), `"empty"`
+		f.files[file.Id] = &file
+		f.replyFile(w, http.StatusCreated, &file)
+		return
+	}
+
+	file, ok := f.files[parts[1]]
+	switch {
+	case !ok:
+		w.WriteHeader(http.StatusNotFound)
+
+	case r.Method == "GET" && len(parts) == 3:
+		content := f.content[file.Id]
+		start, end := 0, len(content)-1
+		if r.Header.Get("If-Range") == file.Etag {
+			fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end)
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(content)))
+		}
+		w.Write([]byte(content[start : end+1]))
+
+	case r.Method == "GET":
+		f.replyFile(w, http.StatusOK, file)
+
+	case ifMatch != "" && ifMatch != file.Etag:
+		w.WriteHeader(http.StatusPreconditionFailed)
+
+	case r.Method == "DELETE":
+		delete(f.files, file.Id)
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == "PUT" && len(parts) == 2:
+		json.NewDecoder(r.Body).Decode(file)
+		f.replyFile(w, http.StatusOK, file)
+
+	case r.Header.Get("Upload-ID") == "":
+		uploadId := f.nextId()
+		f.uploads[uploadId] = ""
+		w.Header().Set("Upload-ID", uploadId)
+
+	default:
+		uploadId := r.Header.Get("Upload-ID")
+		chunk, _ := ioutil.ReadAll(r.Body)
+		f.uploads[uploadId] += string(chunk)
+		if !strings.HasSuffix(r.Header.Get("Content-Range"), "/*") {
+			f.content[file.Id], file.Size = f.uploads[uploadId], len(f.uploads[uploadId])
+			file.Etag = fmt.Sprintf(`"%s"`, f.nextId())
+			delete(f.uploads, uploadId)
+		}
+	}
+}
+
+// Return the WebDAV handler serving a fake Appliance
+func setup(t *testing.T) (*fakeAppliance, http.Handler) {
+	fake := newFakeAppliance()
+	ts := httptest.NewTLSServer(fake)
+	t.Cleanup(ts.Close)
+	c, _ := api.NewClient("token", strings.TrimPrefix(ts.URL, "https://"))
+	c.SetHTTPClient(ts.Client())
+
+	fs := newFileSystem(c)
+	return fake, checkPreconditions(fs, &webdav.Handler{FileSystem: fs, LockSystem: webdav.NewMemLS()})
+}
+
+func serve(h http.Handler, method, target string, body io.Reader, header map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, body)
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// A request body failing after some bytes, as when a client disconnects
+type brokenBody struct {
+	content string
+}
+
+func (b *brokenBody) Read(p []byte) (int, error) {
+	if b.content == "" {
+		return 0, errors.New("connection reset")
+	}
+	n := copy(p, b.content)
+	b.content = b.content[n:]
+	return n, nil
+}
+
+func TestPutGet(t *testing.T) {
+	_, h := setup(t)
+	if w := serve(h, "PUT", "/ring.txt", strings.NewReader("One ring"), nil); w.Code != http.StatusCreated {
+		t.Fatalf("Unable to put a file : %d %s", w.Code, w.Body)
+	}
+	w := serve(h, "GET", "/ring.txt", nil, nil)
+	if w.Code != http.StatusOK || w.Body.String() != "One ring" || w.Header().Get("ETag") == "" {
+		t.Fatalf("Unexpected response %d %q %v", w.Code, w.Body, w.Header())
+	}
+
+	w = serve(h, "GET", "/ring.txt", nil, map[string]string{"Range": "bytes=4-7"})
+	if w.Code != http.StatusPartialContent || w.Body.String() != "ring" {
+		t.Errorf("Unexpected range %d %q", w.Code, w.Body)
+	}
+
+	// A stale ETag does not overwrite the file
+	w = serve(h, "PUT", "/ring.txt", strings.NewReader("Two rings"), map[string]string{"If-Match": `"stale"`})
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected a precondition failure, got %d", w.Code)
+	}
+}
+
+func TestPutAborted(t *testing.T) {
+	fake, h := setup(t)
+	serve(h, "PUT", "/ring.txt", strings.NewReader("One ring"), nil)
+
+	w := serve(h, "PUT", "/ring.txt", &brokenBody{"Two"}, nil)
+	if w.Code == http.StatusCreated {
+		t.Errorf("Expected a truncated upload to fail")
+	}
+	if w = serve(h, "GET", "/ring.txt", nil, nil); w.Body.String() != "One ring" {
+		t.Errorf("A truncated upload replaced the content with %q", w.Body)
+	}
+	if len(fake.uploads) != 1 {
+		t.Errorf("Expected the upload to be left unfinished, got %v", fake.uploads)
+	}
+}
+
+func TestConditionalMove(t *testing.T) {
+	_, h := setup(t)
+	serve(h, "PUT", "/ring.txt", strings.NewReader("One ring"), nil)
+	serve(h, "PUT", "/copy.txt", strings.NewReader("Fake ring"), nil)
+	etag := serve(h, "GET", "/ring.txt", nil, nil).Header().Get("ETag")
+
+	move := map[string]string{"Destination": "/copy.txt", "Overwrite": "T", "If-Match": `"stale"`}
+	if w := serve(h, "MOVE", "/ring.txt", nil, move); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected a precondition failure, got %d", w.Code)
+	}
+
+	// The ETag guards the source, not the overwritten destination
+	move["If-Match"] = etag
+	if w := serve(h, "MOVE", "/ring.txt", nil, move); w.Code != http.StatusNoContent {
+		t.Fatalf("Unable to move over an existing file : %d %s", w.Code, w.Body)
+	}
+	if w := serve(h, "GET", "/copy.txt", nil, nil); w.Body.String() != "One ring" {
+		t.Errorf("Unexpected content %q", w.Body)
+	}
+	if w := serve(h, "GET", "/ring.txt", nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected the source to be moved, got %d", w.Code)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"golang.org/x/net/webdav"
+	"io"
+	"mime"
+	"os"
+	"path"
+)
+
+// Implements os.FileInfo along with the webdav ETager and ContentTyper
+// interfaces so PROPFIND and conditional requests use AeroFS metadata
+type fileInfo struct {
+	sdk.NodeInfo
+}
+
+func newFileInfo(n *sdk.Node) *fileInfo {
+	return &fileInfo{sdk.NodeInfo{Node: n}}
+}
+
+func (fi *fileInfo) ETag(ctx context.Context) (string, error) {
+	if fi.Node.Dir || fi.Node.File.Etag == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return fi.Node.File.Etag, nil
+}
+
+func (fi *fileInfo) ContentType(ctx context.Context) (string, error) {
+	if fi.Node.File.Mime != "" {
+		return fi.Node.File.Mime, nil
+	}
+	return "", webdav.ErrNotImplemented
+}
+
+// A handle to an open folder, only Readdir and Stat are supported
+type folderHandle struct {
+	fs     *fileSystem
+	node   *sdk.Node
+	listed []os.FileInfo
+	offset int
+}
+
+func (h *folderHandle) Readdir(count int) ([]os.FileInfo, error) {
+	if h.listed == nil {
+		children, err := h.fs.children(h.node.Folder.Id)
+		if err != nil {
+			return nil, sdk.OSError(err)
+		}
+
+		h.listed = []os.FileInfo{}
+		for _, f := range children.Folders {
+			h.listed = append(h.listed, newFileInfo(&sdk.Node{Dir: true,
+				ParentId: h.node.Folder.Id, Folder: sdk.Folder(f)}))
+		}
+		for _, f := range children.Files {
+			h.listed = append(h.listed, newFileInfo(&sdk.Node{
+				ParentId: h.node.Folder.Id, File: sdk.File(f)}))
+		}
+	}
+
+	remaining := h.listed[h.offset:]
+	if count <= 0 {
+		h.offset = len(h.listed)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(remaining) {
+		count = len(remaining)
+	}
+	h.offset += count
+	return remaining[:count], nil
+}
+
+func (h *folderHandle) Stat() (os.FileInfo, error)                { return newFileInfo(h.node), nil }
+func (h *folderHandle) Read(p []byte) (int, error)                { return 0, os.ErrInvalid }
+func (h *folderHandle) Seek(off int64, whence int) (int64, error) { return 0, os.ErrInvalid }
+func (h *folderHandle) Write(p []byte) (int, error)               { return 0, os.ErrPermission }
+func (h *folderHandle) Close() error                              { return nil }
+
+// A handle for reading a file, content is retrieved in CHUNKSIZE byte-ranges
+// as it is read so seeking, ie. for an HTTP Range request, only downloads the
+// requested bytes
+type readHandle struct {
+	fs     *fileSystem
+	node   *sdk.Node
+	offset int64
+
+	// The most recently retrieved range
+	buffer      []byte
+	bufferStart int64
+}
+
+func (h *readHandle) Read(p []byte) (int, error) {
+	size := int64(h.node.File.Size)
+	if h.offset >= size {
+		return 0, io.EOF
+	}
+
+	bufferEnd := h.bufferStart + int64(len(h.buffer))
+	if h.offset < h.bufferStart || h.offset >= bufferEnd {
+		err := h.fill()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, h.buffer[h.offset-h.bufferStart:])
+	h.offset += int64(n)
+	return n, nil
+}
+
+// Retrieve the range starting at the current offset
+func (h *readHandle) fill() error {
+	size := int64(h.node.File.Size)
+	end := h.offset + api.CHUNKSIZE - 1
+	if end >= size {
+		end = size - 1
+	}
+
+	f := sdk.FileClient{APIClient: h.fs.client, Desc: h.node.File}
+	body, err := f.ReadRange(int(h.offset), int(end))
+	if err != nil {
+		return sdk.OSError(err)
+	}
+
+	h.buffer = body
+	h.bufferStart = h.offset
+	return nil
+}
+
+func (h *readHandle) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += h.offset
+	case io.SeekEnd:
+		offset += int64(h.node.File.Size)
+	default:
+		return 0, os.ErrInvalid
+	}
+	if offset < 0 {
+		return 0, os.ErrInvalid
+	}
+	h.offset = offset
+	return offset, nil
+}
+
+func (h *readHandle) Readdir(count int) ([]os.FileInfo, error) { return nil, os.ErrInvalid }
+func (h *readHandle) Stat() (os.FileInfo, error)               { return newFileInfo(h.node), nil }
+func (h *readHandle) Write(p []byte) (int, error)              { return 0, os.ErrPermission }
+func (h *readHandle) Close() error                             { return nil }
+
+// A handle for replacing the content of a file
+// Written bytes are streamed through a pipe into a chunked upload guarded by
+// the ETag the file was opened with. Close waits for the upload to complete
+// and updates the metadata returned by Stat with the new ETag. If the request
+// body failed to be read, Close aborts the upload so the content is unchanged
+type writeHandle struct {
+	ctx    context.Context
+	fs     *fileSystem
+	node   *sdk.Node
+	writer *io.PipeWriter
+	done   chan error
+}
+
+func newWriteHandle(ctx context.Context, fs *fileSystem, n *sdk.Node, etag string) *writeHandle {
+	reader, writer := io.Pipe()
+	h := writeHandle{ctx: ctx, fs: fs, node: n, writer: writer, done: make(chan error, 1)}
+
+	mimeType := mime.TypeByExtension(path.Ext(n.File.Name))
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	go func() {
+		uploadId, err := fs.client.GetFileUploadId(n.File.Id, []string{etag})
+		if err == nil {
+			err = fs.client.UploadFileWithType(n.File.Id, uploadId, mimeType,
+				reader, []string{etag})
+		}
+		// Unblock the writer if the upload stopped reading early
+		reader.CloseWithError(err)
+		h.done <- err
+	}()
+	return &h
+}
+
+func (h *writeHandle) Write(p []byte) (int, error) {
+	return h.writer.Write(p)
+}
+
+func (h *writeHandle) Close() error {
+	// The last chunk is only sent on EOF, an error leaves the upload unfinished
+	if err := bodyError(h.ctx); err != nil {
+		h.writer.CloseWithError(err)
+		<-h.done
+		h.fs.invalidate(h.node.ParentId)
+		return err
+	}
+	h.writer.Close()
+	err := <-h.done
+	h.fs.invalidate(h.node.ParentId)
+	if err != nil {
+		return sdk.OSError(err)
+	}
+
+	f := sdk.FileClient{APIClient: h.fs.client, Desc: h.node.File}
+	err = f.LoadMetadata()
+	if err == nil {
+		h.node.File = f.Desc
+	}
+	return sdk.OSError(err)
+}
+
+func (h *writeHandle) Stat() (os.FileInfo, error)                { return newFileInfo(h.node), nil }
+func (h *writeHandle) Read(p []byte) (int, error)                { return 0, os.ErrInvalid }
+func (h *writeHandle) Seek(off int64, whence int) (int64, error) { return 0, os.ErrInvalid }
+func (h *writeHandle) Readdir(count int) ([]os.FileInfo, error)  { return nil, os.ErrInvalid }
@@ -0,0 +1,263 @@
+package main
+
+// A webdav.FileSystem backed by the folders and files of an AeroFS user
+// Paths are resolved from the user's root folder one component at a time,
+// folder listings are cached briefly as a single PROPFIND stats every child
+
+import (
+	"context"
+	"errors"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"golang.org/x/net/webdav"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// How long a folder listing is reused before it is retrieved again
+const CHILDREN_TTL = 2 * time.Second
+
+type cachedChildren struct {
+	retrieved time.Time
+	children  api.Children
+}
+
+// Implements webdav.FileSystem
+type fileSystem struct {
+	client *api.Client
+
+	mu    sync.Mutex
+	cache map[string]cachedChildren
+}
+
+func newFileSystem(c *api.Client) *fileSystem {
+	return &fileSystem{client: c, cache: map[string]cachedChildren{}}
+}
+
+// Return the children of a folder, from the cache if recently retrieved
+func (fs *fileSystem) children(folderId string) (api.Children, error) {
+	fs.mu.Lock()
+	cached, ok := fs.cache[folderId]
+	fs.mu.Unlock()
+	if ok && time.Since(cached.retrieved) < CHILDREN_TTL {
+		return cached.children, nil
+	}
+
+	folder := sdk.FolderClient{APIClient: fs.client, Desc: sdk.Folder{Id: folderId}}
+	err := folder.LoadChildren()
+	if err != nil {
+		return api.Children{}, err
+	}
+
+	fs.mu.Lock()
+	fs.cache[folderId] = cachedChildren{time.Now(), folder.Desc.ChildList}
+	fs.mu.Unlock()
+	return folder.Desc.ChildList, nil
+}
+
+// Drop the cached listings of folders whose children were modified
+func (fs *fileSystem) invalidate(folderIds ...string) {
+	fs.mu.Lock()
+	for _, id := range folderIds {
+		delete(fs.cache, id)
+	}
+	fs.mu.Unlock()
+}
+
+// Resolve a WebDAV path, os.ErrNotExist is returned if any component is missing
+func (fs *fileSystem) lookup(name string) (*sdk.Node, error) {
+	name = path.Clean("/" + name)
+	if name == "/" {
+		return &sdk.Node{Dir: true, Folder: sdk.Folder{Id: "root"}}, nil
+	}
+
+	dir, base := path.Split(name)
+	parent, err := fs.lookup(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !parent.Dir {
+		return nil, os.ErrNotExist
+	}
+
+	children, err := fs.children(parent.Folder.Id)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range children.Folders {
+		if f.Name == base {
+			return &sdk.Node{Dir: true, ParentId: parent.Folder.Id, Folder: sdk.Folder(f)}, nil
+		}
+	}
+	for _, f := range children.Files {
+		if f.Name == base {
+			return &sdk.Node{ParentId: parent.Folder.Id, File: sdk.File(f)}, nil
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+// Return the ETag guarding a modification of the node at a path, the If-Match
+// header of the request if it applies to the path, otherwise the current ETag
+// of the node
+func (fs *fileSystem) etag(ctx context.Context, name string, n *sdk.Node) (string, error) {
+	if etag := ifMatch(ctx, name); etag != "" {
+		return etag, nil
+	}
+	if !n.Dir {
+		return n.File.Etag, nil
+	}
+
+	// Folder ETags are not part of the list of children
+	folder := sdk.FolderClient{APIClient: fs.client, Desc: n.Folder}
+	err := folder.LoadMetadata()
+	return folder.Desc.Etag, err
+}
+
+func (fs *fileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	if _, err := fs.lookup(name); err == nil {
+		return os.ErrExist
+	}
+
+	dir, base := path.Split(path.Clean("/" + name))
+	parent, err := fs.lookup(dir)
+	if err != nil {
+		return err
+	}
+	if !parent.Dir {
+		return os.ErrNotExist
+	}
+
+	_, err = sdk.CreateFolderClient(fs.client, parent.Folder.Id, base)
+	fs.invalidate(parent.Folder.Id)
+	return sdk.OSError(err)
+}
+
+func (fs *fileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	n, err := fs.lookup(name)
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+
+	switch {
+	case err == os.ErrNotExist && flag&os.O_CREATE != 0:
+		n, err = fs.create(name)
+		if err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	case flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, os.ErrExist
+	}
+
+	switch {
+	case n.Dir && writable:
+		return nil, os.ErrPermission
+	case n.Dir:
+		return &folderHandle{fs: fs, node: n}, nil
+	case writable:
+		etag, err := fs.etag(ctx, name, n)
+		if err != nil {
+			return nil, sdk.OSError(err)
+		}
+		return newWriteHandle(ctx, fs, n, etag), nil
+	}
+	return &readHandle{fs: fs, node: n}, nil
+}
+
+// Create an empty file at a WebDAV path
+func (fs *fileSystem) create(name string) (*sdk.Node, error) {
+	dir, base := path.Split(path.Clean("/" + name))
+	parent, err := fs.lookup(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !parent.Dir {
+		return nil, os.ErrNotExist
+	}
+
+	f, err := sdk.CreateFileClient(fs.client, parent.Folder.Id, base)
+	if err != nil {
+		return nil, sdk.OSError(err)
+	}
+	if f.Desc.Etag == "" {
+		if err = f.LoadMetadata(); err != nil {
+			return nil, sdk.OSError(err)
+		}
+	}
+
+	fs.invalidate(parent.Folder.Id)
+	return &sdk.Node{ParentId: parent.Folder.Id, File: f.Desc}, nil
+}
+
+// Delete a file or folder, guarded by its ETag
+// The API deletes the contents of a folder along with it
+func (fs *fileSystem) RemoveAll(ctx context.Context, name string) error {
+	n, err := fs.lookup(name)
+	if err != nil {
+		return err
+	}
+	if n.ParentId == "" {
+		return errors.New("The root folder cannot be deleted")
+	}
+
+	etag, err := fs.etag(ctx, name, n)
+	if err != nil {
+		return sdk.OSError(err)
+	}
+
+	if n.Dir {
+		err = fs.client.DeleteFolder(n.Folder.Id, []string{etag})
+		fs.invalidate(n.ParentId, n.Folder.Id)
+	} else {
+		err = fs.client.DeleteFile(n.File.Id, []string{etag})
+		fs.invalidate(n.ParentId)
+	}
+	return sdk.OSError(err)
+}
+
+// Move a file or folder, the webdav package removes an existing destination
+// beforehand when the request allows overwriting it
+func (fs *fileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	n, err := fs.lookup(oldName)
+	if err != nil {
+		return err
+	}
+	if n.ParentId == "" {
+		return os.ErrPermission
+	}
+	if _, err = fs.lookup(newName); err == nil {
+		return os.ErrExist
+	}
+
+	dir, base := path.Split(path.Clean("/" + newName))
+	parent, err := fs.lookup(dir)
+	if err != nil {
+		return err
+	}
+	if !parent.Dir {
+		return os.ErrNotExist
+	}
+
+	etag, err := fs.etag(ctx, oldName, n)
+	if err != nil {
+		return sdk.OSError(err)
+	}
+
+	if n.Dir {
+		_, _, err = fs.client.MoveFolder(n.Id(), parent.Folder.Id, base, []string{etag})
+	} else {
+		_, _, err = fs.client.MoveFile(n.Id(), parent.Folder.Id, base, []string{etag})
+	}
+	fs.invalidate(n.ParentId, parent.Folder.Id)
+	return sdk.OSError(err)
+}
+
+func (fs *fileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	n, err := fs.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return newFileInfo(n), nil
+}
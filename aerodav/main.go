@@ -0,0 +1,152 @@
+package main
+
+// The entrypoint for aerodav, serving the files of an AeroFS user over WebDAV
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	"golang.org/x/net/webdav"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// Global logger
+var logger = log.New(os.Stderr, "", log.LstdFlags|log.Lshortfile)
+
+func main() {
+	host := flag.String("host", "", "hostname of the AeroFS Appliance")
+	listen := flag.String("listen", "localhost:8080", "<host>:<port> to serve WebDAV on")
+	flag.Parse()
+
+	// The token is read from the environment so it does not appear in the
+	// process list
+	token := os.Getenv("AEROFS_TOKEN")
+	if *host == "" || token == "" {
+		fmt.Println("Usage : AEROFS_TOKEN=<token> ./aerodav -host <appliance> [-listen <host>:<port>]")
+		os.Exit(1)
+	}
+
+	c, err := api.NewClient(token, *host)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	fs := newFileSystem(c)
+	handler := &webdav.Handler{
+		FileSystem: fs,
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				logger.Printf("%s %s : %s", r.Method, r.URL.Path, err)
+			}
+		},
+	}
+
+	logger.Printf("Serving AeroFS Appliance %s over WebDAV at %s", *host, *listen)
+	logger.Fatal(http.ListenAndServe(*listen, checkPreconditions(fs, handler)))
+}
+
+type contextKey int
+
+const (
+	ifMatchKey contextKey = iota
+	bodyKey
+)
+
+// The ETag a request expects for the resource at its path
+type precondition struct {
+	path string
+	etag string
+}
+
+// Return the ETag a modifying request expects for the resource at a path,
+// empty if none was given. The ETag only applies to the path of the request,
+// not to the destination of a MOVE or COPY
+func ifMatch(ctx context.Context, name string) string {
+	p, ok := ctx.Value(ifMatchKey).(precondition)
+	if !ok || p.path != path.Clean("/"+name) {
+		return ""
+	}
+	return p.etag
+}
+
+// A request body recording whether it failed to be read, ie. when the client
+// disconnected before sending all of it
+type trackedBody struct {
+	io.ReadCloser
+	err error
+}
+
+func (b *trackedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
+
+// Return the error reading the body of a request, nil if none occurred
+func bodyError(ctx context.Context) error {
+	if b, ok := ctx.Value(bodyKey).(*trackedBody); ok {
+		return b.err
+	}
+	return nil
+}
+
+// The webdav package does not evaluate If-Match. Requests which modify a
+// resource are rejected with "412 Precondition Failed" if the ETag does not
+// match, otherwise the ETag is passed on so it guards the API request
+func checkPreconditions(fs *fileSystem, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The webdav package stops copying the body of a PUT on a read error
+		// but still closes the file, the upload is aborted instead of committed
+		if r.Method == "PUT" {
+			body := &trackedBody{ReadCloser: r.Body}
+			r.Body = body
+			r = r.WithContext(context.WithValue(r.Context(), bodyKey, body))
+		}
+
+		etag := r.Header.Get("If-Match")
+		switch r.Method {
+		case "PUT", "DELETE", "MOVE":
+		default:
+			etag = ""
+		}
+		if etag == "" || etag == "*" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		n, err := fs.lookup(r.URL.Path)
+		if err != nil {
+			http.Error(w, "Precondition Failed", http.StatusPreconditionFailed)
+			return
+		}
+
+		current, err := fs.etag(r.Context(), r.URL.Path, n)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		matched := false
+		for _, v := range strings.Split(etag, ",") {
+			if strings.TrimSpace(v) == current {
+				matched = true
+			}
+		}
+		if !matched {
+			http.Error(w, "Precondition Failed", http.StatusPreconditionFailed)
+			return
+		}
+
+		p := precondition{path: path.Clean("/" + r.URL.Path), etag: current}
+		ctx := context.WithValue(r.Context(), ifMatchKey, p)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,118 @@
+package main
+
+// The entrypoint for aerodu, reporting the storage used by AeroFS folders
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	usage "github.com/aerofs/aerofs-sdk-golang/aerofsusage"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+)
+
+// Global logger
+var logger = log.New(os.Stderr, "", log.LstdFlags)
+
+const USAGE = `Usage :
+  AEROFS_TOKEN=<token> ./aerodu -host <appliance> [-folder <id or /path>] [options]
+  AEROFS_TOKEN=<admin token> ./aerodu -host <appliance> -all [-tokens <tokens.json>] [options]
+  ./aerodu -catalog <catalog.json> [options]
+
+Options :
+  -format text|json|csv  output format, text by default
+  -table <name>          table written as CSV : ` + "folders, shares, owners, mime_types, largest, oldest, empty_folders"
+
+func exit(err error) {
+	fmt.Println(err)
+	os.Exit(1)
+}
+
+func readJSON(fileName string, v interface{}) error {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return fmt.Errorf("Unable to unmarshal %s : %s", fileName, err)
+	}
+	return nil
+}
+
+func main() {
+	host := flag.String("host", "", "hostname of the AeroFS Appliance")
+	folder := flag.String("folder", "root", "identifier or path of the folder to analyze")
+	all := flag.Bool("all", false, "analyze every shared folder of the organization")
+	tokensFile := flag.String("tokens", "", "JSON file of user OAuth tokens by email")
+	catalogFile := flag.String("catalog", "", "analyze a backup catalog instead of an Appliance")
+	format := flag.String("format", "text", "output format : text, json or csv")
+	table := flag.String("table", "folders", "table written as CSV")
+	top := flag.Int("top", usage.DEFAULT_TOP, "number of largest and oldest files, and folders in text")
+	depth := flag.Int("depth", 0, "maximum depth of the reported folders, 0 for all")
+	flag.Parse()
+
+	opts := usage.Options{Top: *top, MaxDepth: *depth, Log: logger.Printf}
+	var report *usage.Report
+
+	if *catalogFile != "" {
+		catalog := sdk.Catalog{}
+		err := readJSON(*catalogFile, &catalog)
+		if err != nil {
+			exit(err)
+		}
+		report = usage.AnalyzeCatalog(&catalog, opts)
+	} else {
+		token := os.Getenv("AEROFS_TOKEN")
+		if *host == "" || token == "" {
+			fmt.Println(USAGE)
+			os.Exit(1)
+		}
+		c, _ := api.NewClient(token, *host)
+
+		if *all {
+			if *tokensFile != "" {
+				err := readJSON(*tokensFile, &opts.UserTokens)
+				if err != nil {
+					exit(err)
+				}
+			}
+			var err error
+			report, err = usage.Analyze(c, opts)
+			if err != nil {
+				exit(err)
+			}
+		} else {
+			folderId := *folder
+			if strings.HasPrefix(folderId, "/") {
+				root := sdk.FolderClient{APIClient: c, Desc: sdk.Folder{Id: "root"}}
+				f, err := root.Subfolder(folderId)
+				if err != nil {
+					exit(err)
+				}
+				folderId = f.Desc.Id
+			}
+			report = usage.AnalyzeFolder(c, folderId, opts)
+		}
+	}
+
+	var err error
+	switch *format {
+	case "text":
+		err = report.WriteText(os.Stdout, *top)
+	case "json":
+		err = report.WriteJSON(os.Stdout)
+	case "csv":
+		err = report.WriteCSV(os.Stdout, *table)
+	default:
+		fmt.Println(USAGE)
+		os.Exit(1)
+	}
+	if err != nil {
+		exit(err)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+// The entrypoint for aerodupes, finding files with identical contents across
+// AeroFS folders
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	dedup "github.com/aerofs/aerofs-sdk-golang/aerofsdedup"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+)
+
+// Global logger
+var logger = log.New(os.Stderr, "", log.LstdFlags)
+
+const USAGE = `Usage :
+  AEROFS_TOKEN=<token> ./aerodupes -host <appliance> -folder <id or /path> [-folder ...] [options]
+  AEROFS_TOKEN=<admin token> ./aerodupes -host <appliance> -all [-tokens <tokens.json>] [options]`
+
+// A flag which may be repeated
+type folderList []string
+
+func (l *folderList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *folderList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func exit(err error) {
+	fmt.Println(err)
+	os.Exit(1)
+}
+
+func main() {
+	folders := folderList{}
+	host := flag.String("host", "", "hostname of the AeroFS Appliance")
+	flag.Var(&folders, "folder", "identifier or path of a folder to search, may be repeated")
+	all := flag.Bool("all", false, "search every shared folder of the organization")
+	tokensFile := flag.String("tokens", "", "JSON file of user OAuth tokens by email")
+	cacheFile := flag.String("cache", "aerodupes-cache.json", "file caching content hashes, none if empty")
+	minSize := flag.Int("min-size", 1, "ignore files smaller than this many bytes")
+	concurrency := flag.Int("concurrency", dedup.DEFAULT_CONCURRENCY, "number of files hashed at once")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	token := os.Getenv("AEROFS_TOKEN")
+	if *host == "" || token == "" || (len(folders) == 0 && !*all) {
+		fmt.Println(USAGE)
+		os.Exit(1)
+	}
+	c, _ := api.NewClient(token, *host)
+
+	trees := []dedup.Tree{}
+	failures := []sdk.Failure{}
+	if *all {
+		tokens := map[string]string{}
+		if *tokensFile != "" {
+			data, err := ioutil.ReadFile(*tokensFile)
+			if err != nil {
+				exit(err)
+			}
+			err = json.Unmarshal(data, &tokens)
+			if err != nil {
+				exit(fmt.Errorf("Unable to unmarshal tokens : %s", err))
+			}
+		}
+		catalog, err := sdk.Inventory(c, sdk.InventoryOptions{UserTokens: tokens, Log: logger.Printf})
+		if err != nil {
+			exit(err)
+		}
+		trees = dedup.CatalogTrees(c, catalog, tokens)
+		failures = append(failures, catalog.Failures...)
+	}
+
+	for _, folder := range folders {
+		folderId := folder
+		if strings.HasPrefix(folder, "/") {
+			root := sdk.FolderClient{APIClient: c, Desc: sdk.Folder{Id: "root"}}
+			f, err := root.Subfolder(folder)
+			if err != nil {
+				exit(err)
+			}
+			folderId = f.Desc.Id
+		}
+		tree, treeFailures := dedup.WalkTree(c, folderId, folder, nil)
+		trees = append(trees, tree)
+		failures = append(failures, treeFailures...)
+	}
+
+	cache, err := dedup.OpenHashCache(*cacheFile)
+	if err != nil {
+		exit(err)
+	}
+	report := dedup.Find(trees, cache, dedup.Options{MinSize: *minSize,
+		Concurrency: *concurrency, Log: logger.Printf})
+	report.Failures = append(failures, report.Failures...)
+
+	err = cache.Save()
+	if err != nil {
+		logger.Printf("Unable to save the hash cache : %s", err)
+	}
+
+	if *asJSON {
+		err = report.WriteJSON(os.Stdout)
+	} else {
+		err = report.WriteText(os.Stdout)
+	}
+	if err != nil {
+		exit(err)
+	}
+}
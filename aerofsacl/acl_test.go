@@ -0,0 +1,181 @@
+package aerofsacl
+
+import (
+	"bytes"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testYAML = `
+shares:
+  - name: Maps
+    members:
+      - email: Frodo@shire.org
+        permissions: [write, MANAGE]
+      - email: sam@shire.org
+        permissions: [WRITE, MANAGE]
+      - email: merry@shire.org
+        permissions: [WRITE]
+    groups:
+      - name: Fellowship
+        permissions: [WRITE]
+    pending:
+      - email: gandalf@istari.org
+        permissions: [WRITE]
+        note: Fly, you fools
+`
+
+const testJSON = `{"shares": [{"sid": "abc", "keep_unlisted": true,
+  "members": [{"email": "frodo@shire.org", "permissions": ["WRITE"]}]}]}`
+
+func TestParseState(t *testing.T) {
+	state, err := ParseState([]byte(testYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Shares) != 1 || len(state.Shares[0].Members) != 3 ||
+		state.Shares[0].Pending[0].Note != "Fly, you fools" {
+		t.Errorf("Unexpected state %+v", state)
+	}
+
+	state, err = ParseState([]byte(testJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Shares[0].Sid != "abc" || !state.Shares[0].KeepUnlisted {
+		t.Errorf("Unexpected state %+v", state)
+	}
+
+	invalid := []string{
+		"shares:\n  - members: []\n",
+		"shares:\n  - name: a\n  - name: a\n",
+		"shares:\n  - name: a\n    members:\n      - email: x@y\n      - email: X@y\n",
+		"shares:\n  - name: a\n    owners: []\n",
+		"shares:\n  - name: a\n    members:\n      - email: x@y\n        permissions: [READ]\n",
+	}
+	for _, data := range invalid {
+		if _, err := ParseState([]byte(data)); err == nil {
+			t.Errorf("Expected an error for %q", data)
+		}
+	}
+}
+
+func testCurrent() *current {
+	return &current{
+		Name: "Maps",
+		Members: []api.SFMember{
+			{Email: "frodo@shire.org", Permissions: api.PermissionSet{"MANAGE", "WRITE"}},
+			{Email: "sam@shire.org", Permissions: api.PermissionSet{"WRITE"}},
+			{Email: "gollum@misty.org", Permissions: api.PermissionSet{"WRITE"}},
+		},
+		Groups: []api.SFGroupMember{
+			{Id: "g2", Name: "Orcs", Permissions: api.PermissionSet{"WRITE"}},
+		},
+		Pending: []api.SFPendingMember{
+			{Email: "saruman@istari.org", Permissions: api.PermissionSet{"WRITE"}},
+		},
+	}
+}
+
+func TestDiffShare(t *testing.T) {
+	state, err := ParseState([]byte(testYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups := map[string]string{"Fellowship": "g1", "Orcs": "g2"}
+	changes, err := diffShare(state.Shares[0], "sid", testCurrent(), groups)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"+ member merry@shire.org [WRITE]",
+		"+ group Fellowship [WRITE]",
+		"+ pending gandalf@istari.org [WRITE]",
+		"~ member sam@shire.org [WRITE] -> [MANAGE WRITE]",
+		"- member gollum@misty.org [WRITE]",
+		"- group Orcs [WRITE]",
+		"- pending saruman@istari.org [WRITE]",
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %d changes, got %v", len(expected), changes)
+	}
+	for i := range expected {
+		if changes[i].String() != expected[i] {
+			t.Errorf("Expected %q, got %q", expected[i], changes[i])
+		}
+	}
+	if changes[1].GroupId != "g1" || changes[5].GroupId != "g2" {
+		t.Errorf("Unexpected group identifiers in %v", changes)
+	}
+
+	// Nothing is removed when unlisted entries are kept
+	state.Shares[0].KeepUnlisted = true
+	changes, _ = diffShare(state.Shares[0], "sid", testCurrent(), groups)
+	for _, c := range changes {
+		if c.Action == REMOVE {
+			t.Errorf("Unexpected removal %s", c)
+		}
+	}
+
+	if _, err = diffShare(state.Shares[0], "sid", testCurrent(), map[string]string{}); err == nil {
+		t.Errorf("Expected an error for an unknown group")
+	}
+}
+
+func TestPlanText(t *testing.T) {
+	plan := Plan{Changes: []Change{
+		{Action: ADD, Kind: MEMBER, Share: "Maps", Sid: "s1", Subject: "merry@shire.org", After: api.PermissionSet{"WRITE"}},
+		{Action: REMOVE, Kind: GROUP, Share: "Maps", Sid: "s1", Subject: "Orcs", Before: api.PermissionSet{"WRITE"}},
+		{Action: UPDATE, Kind: MEMBER, Share: "Songs", Sid: "s2", Subject: "sam@shire.org",
+			Before: api.PermissionSet{"WRITE"}, After: api.PermissionSet{"WRITE", "MANAGE"}},
+	}}
+	out := bytes.Buffer{}
+	plan.WriteText(&out)
+	for _, line := range []string{"Maps (s1)\n", "Songs (s2)\n", "  - group Orcs [WRITE]\n",
+		"Plan: 1 to add, 1 to change, 1 to remove.\n"} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Expected %q in\n%s", line, out.String())
+		}
+	}
+
+	out.Reset()
+	(&Plan{}).WriteText(&out)
+	if !strings.HasPrefix(out.String(), "No changes") {
+		t.Errorf("Unexpected text for an empty plan %q", out.String())
+	}
+}
+
+// Group updates and removals are guarded by the ETag of the group when planned
+func TestApplyGroupEtags(t *testing.T) {
+	ifMatch := map[string]string{}
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ifMatch[r.Method+" "+strings.TrimPrefix(r.URL.Path, "/api/v1.3/")] = r.Header.Get("If-Match")
+		if r.Header.Get("If-Match") == `"stale"` {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer ts.Close()
+	c, _ := api.NewClient("token", strings.TrimPrefix(ts.URL, "https://"))
+	c.SetHTTPClient(ts.Client())
+
+	plan := Plan{ShareEtags: map[string]string{}, Changes: []Change{
+		{Action: UPDATE, Kind: GROUP, Share: "Maps", Sid: "s1", Subject: "Fellowship", GroupId: "g1",
+			Before: api.PermissionSet{"WRITE"}, After: api.PermissionSet{"WRITE", "MANAGE"}, Etag: `"e1"`},
+		{Action: REMOVE, Kind: GROUP, Share: "Maps", Sid: "s1", Subject: "Orcs", GroupId: "g2",
+			Before: api.PermissionSet{"WRITE"}, Etag: `"stale"`},
+	}}
+	report := Apply(c, &plan, ApplyOptions{})
+	if ifMatch["PUT shares/s1/groups/g1"] != `"e1"` || ifMatch["DELETE shares/s1/groups/g2"] != `"stale"` {
+		t.Errorf("Unexpected If-Match headers %v", ifMatch)
+	}
+	if len(report.Applied) != 1 || len(report.Failures) != 1 ||
+		!strings.Contains(report.Failures[0].Error, "Conflict") {
+		t.Errorf("Unexpected report %+v", report)
+	}
+}
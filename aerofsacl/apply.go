@@ -0,0 +1,125 @@
+package aerofsacl
+
+// Applying a plan
+// The changes of a shared folder are only applied if its member list is
+// unchanged since the plan, and every member or group is updated or removed
+// only if its ETag is unchanged, so concurrent edits are not overwritten
+
+import (
+	"errors"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"net/http"
+)
+
+// Options for Apply
+type ApplyOptions struct {
+	// Called with progress messages, may be nil
+	Log func(format string, args ...interface{})
+}
+
+// What applying a plan did
+type Report struct {
+	Applied  []Change
+	Skipped  []Change
+	Failures []sdk.Failure
+}
+
+var errChanged = errors.New("The shared folder changed since the plan, plan again")
+
+// Apply the changes of a plan, the changes of a shared folder which changed
+// since the plan are skipped
+func Apply(c *api.Client, plan *Plan, opts ApplyOptions) *Report {
+	report := Report{Applied: []Change{}, Skipped: []Change{}, Failures: []sdk.Failure{}}
+	log := func(format string, args ...interface{}) {
+		if opts.Log != nil {
+			opts.Log(format, args...)
+		}
+	}
+	fail := func(item string, err error) {
+		log("%s : %s", item, err)
+		report.Failures = append(report.Failures, sdk.Failure{Item: item, Error: err.Error()})
+	}
+
+	checked := map[string]error{}
+	for _, change := range plan.Changes {
+		err, ok := checked[change.Sid]
+		if !ok {
+			err = checkUnchanged(c, change.Sid, plan.ShareEtags[change.Sid])
+			checked[change.Sid] = err
+			if err != nil {
+				fail(change.Share, err)
+			}
+		}
+		if err != nil {
+			report.Skipped = append(report.Skipped, change)
+			continue
+		}
+
+		err = applyChange(c, change)
+		if api.IsStatus(err, http.StatusPreconditionFailed) {
+			err = fmt.Errorf("Conflict, the %s changed since the plan", change.Kind)
+		}
+		if err != nil {
+			fail(fmt.Sprintf("%s : %s", change.Share, change), err)
+			continue
+		}
+		log("%s : %s", change.Share, change)
+		report.Applied = append(report.Applied, change)
+	}
+	return &report
+}
+
+// Return errChanged unless the member list of a shared folder still has the
+// given ETag
+func checkUnchanged(c *api.Client, sid, etag string) error {
+	if etag == "" {
+		return nil
+	}
+	_, _, err := c.ListSFMembers(sid, []string{etag})
+	switch {
+	case api.IsStatus(err, http.StatusNotModified):
+		return nil
+	case err == nil:
+		return errChanged
+	}
+	return err
+}
+
+func applyChange(c *api.Client, change Change) error {
+	var err error
+	switch change.Kind + " " + change.Action {
+	case MEMBER + " " + ADD:
+		_, _, err = c.AddSFMember(change.Sid, change.Subject, change.After)
+	case MEMBER + " " + UPDATE:
+		_, _, err = c.SetSFMemberPermissions(change.Sid, change.Subject, change.After, etags(change))
+	case MEMBER + " " + REMOVE:
+		_, _, err = c.RemoveSFMember(change.Sid, change.Subject, etags(change))
+	case GROUP + " " + ADD:
+		_, _, err = c.AddGroupToSharedFolder(change.Sid, change.GroupId, change.After)
+	case GROUP + " " + UPDATE:
+		_, _, err = c.SetSFGroupPermissions(change.Sid, change.GroupId, change.After, etags(change))
+	case GROUP + " " + REMOVE:
+		err = c.RemoveSFGroup(change.Sid, change.GroupId, etags(change))
+	case PENDING + " " + ADD:
+		_, _, err = c.InviteSFMember(change.Sid, change.Subject, change.After, change.Note)
+	case PENDING + " " + UPDATE:
+		err = c.RemoveSFPendingMember(change.Sid, change.Subject, nil)
+		if err == nil {
+			_, _, err = c.InviteSFMember(change.Sid, change.Subject, change.After, change.Note)
+		}
+	case PENDING + " " + REMOVE:
+		err = c.RemoveSFPendingMember(change.Sid, change.Subject, nil)
+	default:
+		err = fmt.Errorf("Unknown change %s %s", change.Action, change.Kind)
+	}
+	return err
+}
+
+func etags(change Change) []string {
+	if change.Etag == "" {
+		return []string{}
+	}
+	return []string{change.Etag}
+}
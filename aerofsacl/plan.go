@@ -0,0 +1,355 @@
+package aerofsacl
+
+// Planning the changes which bring shared folders to their desired state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Actions
+const (
+	ADD    = "add"
+	UPDATE = "update"
+	REMOVE = "remove"
+)
+
+// Kinds of subjects
+const (
+	MEMBER  = "member"
+	GROUP   = "group"
+	PENDING = "pending"
+)
+
+// A single change of the ACL of a shared folder
+type Change struct {
+	Action string `json:"action"`
+	Kind   string `json:"kind"`
+	Share  string `json:"share"`
+	Sid    string `json:"sid"`
+
+	// The email of a member or invitee, or the name of a group
+	Subject string `json:"subject"`
+	GroupId string `json:"group_id,omitempty"`
+
+	Before api.PermissionSet `json:"before,omitempty"`
+	After  api.PermissionSet `json:"after,omitempty"`
+	Note   string            `json:"note,omitempty"`
+
+	// The ETag of the member or group when planned, updates and removals fail
+	// if it changed since
+	Etag string `json:"etag,omitempty"`
+}
+
+func (c Change) String() string {
+	symbol := map[string]string{ADD: "+", UPDATE: "~", REMOVE: "-"}[c.Action]
+	perms := func(p api.PermissionSet) string {
+		return "[" + strings.Join(p.Strings(), " ") + "]"
+	}
+	switch c.Action {
+	case ADD:
+		return fmt.Sprintf("%s %s %s %s", symbol, c.Kind, c.Subject, perms(c.After))
+	case UPDATE:
+		return fmt.Sprintf("%s %s %s %s -> %s", symbol, c.Kind, c.Subject, perms(c.Before), perms(c.After))
+	default:
+		return fmt.Sprintf("%s %s %s %s", symbol, c.Kind, c.Subject, perms(c.Before))
+	}
+}
+
+// The changes to apply, with the ETag of the member list of every shared
+// folder when planned
+type Plan struct {
+	Changes    []Change          `json:"changes"`
+	ShareEtags map[string]string `json:"share_etags"`
+}
+
+// Read a plan saved as JSON
+func LoadPlan(r io.Reader) (*Plan, error) {
+	plan := Plan{}
+	err := json.NewDecoder(r).Decode(&plan)
+	if err != nil {
+		return nil, errors.New("Unable to unmarshal the plan")
+	}
+	return &plan, nil
+}
+
+// Return the number of additions, updates and removals
+func (p *Plan) Counts() (int, int, int) {
+	counts := map[string]int{}
+	for _, c := range p.Changes {
+		counts[c.Action]++
+	}
+	return counts[ADD], counts[UPDATE], counts[REMOVE]
+}
+
+// Write the changes grouped by shared folder, followed by a summary
+func (p *Plan) WriteText(w io.Writer) {
+	share := ""
+	for _, c := range p.Changes {
+		if c.Sid != share {
+			share = c.Sid
+			fmt.Fprintf(w, "%s (%s)\n", c.Share, c.Sid)
+		}
+		fmt.Fprintf(w, "  %s\n", c)
+	}
+	if len(p.Changes) == 0 {
+		fmt.Fprintln(w, "No changes, the shared folders match the desired state.")
+		return
+	}
+	added, updated, removed := p.Counts()
+	fmt.Fprintf(w, "\nPlan: %d to add, %d to change, %d to remove.\n", added, updated, removed)
+}
+
+// The current ACL of a shared folder
+type current struct {
+	Name    string
+	Etag    string
+	Members []api.SFMember
+	Groups  []api.SFGroupMember
+	Pending []api.SFPendingMember
+}
+
+// Compute the changes of every shared folder of the desired state
+func MakePlan(c *api.Client, state *State) (*Plan, error) {
+	sids, err := resolveShares(c, state.Shares)
+	if err != nil {
+		return nil, err
+	}
+	groupIds, err := groupsByName(c, state.Shares)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := Plan{Changes: []Change{}, ShareEtags: map[string]string{}}
+	for i, spec := range state.Shares {
+		cur, err := loadCurrent(c, sids[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s : %s", spec, err)
+		}
+		changes, err := diffShare(spec, sids[i], cur, groupIds)
+		if err != nil {
+			return nil, err
+		}
+
+		// Updates and removals of members and groups are conditional on their
+		// ETag
+		for j, change := range changes {
+			if change.Action == ADD {
+				continue
+			}
+			switch change.Kind {
+			case MEMBER:
+				member, err := sdk.GetSFMemberClient(c, change.Sid, change.Subject, nil)
+				if err != nil {
+					return nil, fmt.Errorf("%s : %s : %s", spec, change.Subject, err)
+				}
+				changes[j].Etag = member.Etag
+			case GROUP:
+				group, err := sdk.GetSFGroupMemberClient(c, change.Sid, change.GroupId, nil)
+				if err != nil {
+					return nil, fmt.Errorf("%s : %s : %s", spec, change.Subject, err)
+				}
+				changes[j].Etag = group.Etag
+			}
+		}
+		plan.Changes = append(plan.Changes, changes...)
+		plan.ShareEtags[sids[i]] = cur.Etag
+	}
+	return &plan, nil
+}
+
+// Return the SID of every shared folder, shared folders given by name are
+// looked up among the shared folders of every user
+func resolveShares(c *api.Client, specs []ShareSpec) ([]string, error) {
+	sids := make([]string, len(specs))
+	names := []string{}
+	for i, spec := range specs {
+		sids[i] = spec.Sid
+		if spec.Sid == "" {
+			names = append(names, spec.Name)
+		}
+	}
+	if len(names) == 0 {
+		return sids, nil
+	}
+
+	found, err := sdk.FindSharedFolders(c, names)
+	if err != nil {
+		return nil, err
+	}
+	for i, spec := range specs {
+		if spec.Sid != "" {
+			continue
+		}
+		switch len(found[spec.Name]) {
+		case 0:
+			return nil, fmt.Errorf("No shared folder is named %s", spec.Name)
+		case 1:
+			sids[i] = found[spec.Name][0]
+		default:
+			return nil, fmt.Errorf("Several shared folders are named %s, use their SID", spec.Name)
+		}
+	}
+	return sids, nil
+}
+
+// Return the identifiers of the groups referenced by name
+func groupsByName(c *api.Client, specs []ShareSpec) (map[string]string, error) {
+	needed := false
+	for _, spec := range specs {
+		for _, g := range spec.Groups {
+			needed = needed || g.Id == ""
+		}
+	}
+	ids := map[string]string{}
+	if !needed {
+		return ids, nil
+	}
+
+	groups, err := sdk.ListAllGroups(c, sdk.DEFAULT_PAGE_SIZE)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		if _, ok := ids[g.Name]; ok {
+			return nil, fmt.Errorf("Several groups are named %s, use their identifier", g.Name)
+		}
+		ids[g.Name] = g.Id
+	}
+	return ids, nil
+}
+
+func loadCurrent(c *api.Client, sid string) (*current, error) {
+	sf, err := sdk.GetSharedFolderClient(c, sid, nil)
+	if err != nil {
+		return nil, err
+	}
+	cur := current{Name: sf.Desc.Name, Pending: sf.Desc.Pending}
+
+	body, header, err := c.ListSFMembers(sid, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(body, &cur.Members)
+	if err != nil {
+		return nil, errors.New("Unable to unmarshal the list of shared folder members")
+	}
+	cur.Etag = header.Get("ETag")
+
+	body, _, err = c.ListSFGroups(sid)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(body, &cur.Groups)
+	if err != nil {
+		return nil, errors.New("Unable to unmarshal the list of shared folder groups")
+	}
+	return &cur, nil
+}
+
+// Compare the desired and current ACL of a shared folder
+// Additions come first and removals last, so a shared folder never loses its
+// managers midway
+func diffShare(spec ShareSpec, sid string, cur *current, groupIds map[string]string) ([]Change, error) {
+	name := cur.Name
+	if name == "" {
+		name = spec.String()
+	}
+	changes := []Change{}
+	change := func(action, kind, subject string, before, after api.PermissionSet) *Change {
+		changes = append(changes, Change{Action: action, Kind: kind, Share: name, Sid: sid,
+			Subject: subject, Before: before, After: after})
+		return &changes[len(changes)-1]
+	}
+
+	members := map[string]api.SFMember{}
+	for _, m := range cur.Members {
+		members[strings.ToLower(m.Email)] = m
+	}
+	for _, m := range spec.Members {
+		existing, ok := members[strings.ToLower(m.Email)]
+		switch {
+		case !ok:
+			change(ADD, MEMBER, m.Email, nil, m.Permissions)
+		case !existing.Permissions.Equal(m.Permissions):
+			change(UPDATE, MEMBER, existing.Email, existing.Permissions, m.Permissions)
+		}
+		delete(members, strings.ToLower(m.Email))
+	}
+
+	groups := map[string]api.SFGroupMember{}
+	for _, g := range cur.Groups {
+		groups[g.Id] = g
+	}
+	for _, g := range spec.Groups {
+		id := g.Id
+		if id == "" {
+			id = groupIds[g.Name]
+		}
+		if id == "" {
+			return nil, fmt.Errorf("%s : no group is named %s", spec, g.Name)
+		}
+		groupName := g.Name
+		if groupName == "" {
+			groupName = id
+		}
+		existing, ok := groups[id]
+		switch {
+		case !ok:
+			change(ADD, GROUP, groupName, nil, g.Permissions).GroupId = id
+		case !existing.Permissions.Equal(g.Permissions):
+			change(UPDATE, GROUP, groupName, existing.Permissions,
+				g.Permissions).GroupId = id
+		}
+		delete(groups, id)
+	}
+
+	// Invitations cannot be modified, they are updated by inviting again
+	pending := map[string]api.SFPendingMember{}
+	for _, p := range cur.Pending {
+		pending[strings.ToLower(p.Email)] = p
+	}
+	for _, p := range spec.Pending {
+		existing, ok := pending[strings.ToLower(p.Email)]
+		switch {
+		case !ok:
+			change(ADD, PENDING, p.Email, nil, p.Permissions).Note = p.Note
+		case !existing.Permissions.Equal(p.Permissions):
+			change(UPDATE, PENDING, existing.Email, existing.Permissions,
+				p.Permissions).Note = p.Note
+		}
+		delete(pending, strings.ToLower(p.Email))
+	}
+
+	if !spec.KeepUnlisted {
+		for _, m := range members {
+			change(REMOVE, MEMBER, m.Email, m.Permissions, nil)
+		}
+		for _, g := range groups {
+			change(REMOVE, GROUP, g.Name, g.Permissions, nil).GroupId = g.Id
+		}
+		for _, p := range pending {
+			change(REMOVE, PENDING, p.Email, p.Permissions, nil)
+		}
+	}
+
+	order := map[string]int{ADD: 0, UPDATE: 1, REMOVE: 2}
+	kinds := map[string]int{MEMBER: 0, GROUP: 1, PENDING: 2}
+	sort.SliceStable(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if a.Action != b.Action {
+			return order[a.Action] < order[b.Action]
+		}
+		if a.Kind != b.Kind {
+			return kinds[a.Kind] < kinds[b.Kind]
+		}
+		return a.Subject < b.Subject
+	})
+	return changes, nil
+}
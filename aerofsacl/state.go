@@ -0,0 +1,151 @@
+package aerofsacl
+
+// The desired state of shared folder ACLs, read from YAML or JSON
+//
+//   shares:
+//     - name: Engineering
+//       members:
+//         - email: frodo@example.com
+//           permissions: [WRITE, MANAGE]
+//       groups:
+//         - name: Developers
+//           permissions: [WRITE]
+//       pending:
+//         - email: gandalf@example.org
+//           permissions: [WRITE]
+//           note: Welcome
+
+import (
+	"errors"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"strings"
+)
+
+type MemberSpec struct {
+	Email       string            `yaml:"email" json:"email"`
+	Permissions api.PermissionSet `yaml:"permissions" json:"permissions"`
+}
+
+// A group, identified by name or identifier
+type GroupSpec struct {
+	Name        string            `yaml:"name,omitempty" json:"name,omitempty"`
+	Id          string            `yaml:"id,omitempty" json:"id,omitempty"`
+	Permissions api.PermissionSet `yaml:"permissions" json:"permissions"`
+}
+
+type PendingSpec struct {
+	Email       string            `yaml:"email" json:"email"`
+	Permissions api.PermissionSet `yaml:"permissions" json:"permissions"`
+	Note        string            `yaml:"note,omitempty" json:"note,omitempty"`
+}
+
+// The ACL of a shared folder, identified by name or SID
+type ShareSpec struct {
+	Name    string        `yaml:"name,omitempty" json:"name,omitempty"`
+	Sid     string        `yaml:"sid,omitempty" json:"sid,omitempty"`
+	Members []MemberSpec  `yaml:"members" json:"members"`
+	Groups  []GroupSpec   `yaml:"groups" json:"groups"`
+	Pending []PendingSpec `yaml:"pending" json:"pending"`
+
+	// Leave members, groups and invitations which are not listed in place,
+	// otherwise they are removed
+	KeepUnlisted bool `yaml:"keep_unlisted,omitempty" json:"keep_unlisted,omitempty"`
+}
+
+func (s ShareSpec) String() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.Sid
+}
+
+type State struct {
+	Shares []ShareSpec `yaml:"shares" json:"shares"`
+}
+
+// Read a desired state file, JSON being a subset of YAML either is accepted
+func LoadState(fileName string) (*State, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return ParseState(data)
+}
+
+func ParseState(data []byte) (*State, error) {
+	state := State{}
+	err := yaml.UnmarshalStrict(data, &state)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse the desired state : %s", err)
+	}
+	return &state, state.validate()
+}
+
+// Reject states which cannot be planned unambiguously, and parse permissions
+// regardless of case
+func (s *State) validate() error {
+	shares := map[string]bool{}
+	for i := range s.Shares {
+		share := &s.Shares[i]
+		if share.Name == "" && share.Sid == "" {
+			return errors.New("A shared folder has neither a name nor a SID")
+		}
+		if shares[share.String()] {
+			return fmt.Errorf("The shared folder %s is listed twice", share)
+		}
+		shares[share.String()] = true
+
+		emails := map[string]bool{}
+		for j, m := range share.Members {
+			email := strings.ToLower(m.Email)
+			if email == "" || emails[email] {
+				return fmt.Errorf("%s : missing or duplicate member %q", share, m.Email)
+			}
+			emails[email] = true
+			err := parsePermissions(&share.Members[j].Permissions)
+			if err != nil {
+				return fmt.Errorf("%s : %s : %s", share, m.Email, err)
+			}
+		}
+		for j, p := range share.Pending {
+			email := strings.ToLower(p.Email)
+			if email == "" || emails[email] {
+				return fmt.Errorf("%s : missing or duplicate invitation %q", share, p.Email)
+			}
+			emails[email] = true
+			err := parsePermissions(&share.Pending[j].Permissions)
+			if err != nil {
+				return fmt.Errorf("%s : %s : %s", share, p.Email, err)
+			}
+		}
+
+		groups := map[string]bool{}
+		for j, g := range share.Groups {
+			key := g.Id
+			if key == "" {
+				key = g.Name
+			}
+			if key == "" || groups[key] {
+				return fmt.Errorf("%s : missing or duplicate group %q", share, key)
+			}
+			groups[key] = true
+			err := parsePermissions(&share.Groups[j].Permissions)
+			if err != nil {
+				return fmt.Errorf("%s : %s : %s", share, key, err)
+			}
+		}
+	}
+	return nil
+}
+
+func parsePermissions(permissions *api.PermissionSet) error {
+	parsed, err := api.ParsePermissions(permissions.Strings())
+	if err != nil {
+		return err
+	}
+	*permissions = parsed
+	return nil
+}
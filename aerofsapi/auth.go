@@ -52,6 +52,21 @@ type AccessResponse struct {
 	Scopes string `json:"scope"`
 }
 
+// The user and scopes an OAuth token was issued for
+type TokenInfo struct {
+	Scopes     []string `json:"scopes"`
+	ExpireTime int      `json:"expires_in"`
+	Principal  struct {
+		Name       string            `json:"name"`
+		Attributes map[string]string `json:"attributes"`
+	} `json:"principal"`
+}
+
+// Return the email of the user the token was issued for
+func (t *TokenInfo) Email() string {
+	return t.Principal.Attributes["userid"]
+}
+
 // Create a new AuthClient from an AeroFS appconfig.json file
 // The appconfig.json only contains the AeroURL and client_{id,secret}
 func NewAuthClient(fileName, redirectUri, state string, scopes []string) (*AuthClient, error) {
@@ -125,3 +140,39 @@ func (auth *AuthClient) GetAccessToken(code string) (string, []string, error) {
 	grantedScopes := strings.Split(accessResponse.Scopes, ",")
 	return accessResponse.Token, grantedScopes, err
 }
+
+// Retrieve the user and scopes of a token from the Appliance, authenticating
+// as the third-party application. Unlike an email entered by the user, the
+// email returned can be trusted to identify them
+func (auth *AuthClient) GetTokenInfo(token string) (*TokenInfo, error) {
+	link := url.URL{Scheme: "https",
+		Host:     auth.AeroUrl,
+		Path:     strings.Join([]string{"auth", "tokeninfo"}, "/"),
+		RawQuery: url.Values{"access_token": {token}}.Encode(),
+	}
+	req, err := http.NewRequest("GET", link.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(auth.Id, auth.Secret)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, _, err := unpackageResponse(res)
+	if err != nil {
+		return nil, err
+	}
+	info := TokenInfo{}
+	err = json.Unmarshal(body, &info)
+	if err != nil {
+		return nil, errors.New("Unable to unmarshal the token information")
+	}
+	if info.Email() == "" {
+		return nil, errors.New("The token information does not include a user")
+	}
+	return &info, nil
+}
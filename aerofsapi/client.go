@@ -63,12 +63,30 @@ func unpackageResponse(res *http.Response) ([]byte, *http.Header, error) {
 	// For each API call, unpackage the HTTP response and return an error if a non
 	// 2XX status code is retrieved
 	if res.StatusCode >= 300 {
-		err := errors.New(res.Status)
+		err := &ResponseError{Status: res.Status, StatusCode: res.StatusCode, Body: body}
 		return body, &header, err
 	}
 	return body, &header, nil
 }
 
+// The error returned when an AeroFS Appliance responds with a non-2XX status
+// code. The message is the HTTP status line, ie. "412 Precondition Failed"
+type ResponseError struct {
+	Status     string
+	StatusCode int
+	Body       []byte
+}
+
+func (e *ResponseError) Error() string {
+	return e.Status
+}
+
+// Return true if the error was caused by a response with the given status code
+func IsStatus(err error, statusCode int) bool {
+	resErr, ok := err.(*ResponseError)
+	return ok && resErr.StatusCode == statusCode
+}
+
 // Construct a URL given a route and query parameters
 func (c *Client) getURL(route, query string) string {
 	link := url.URL{Scheme: "https",
@@ -90,6 +108,20 @@ func (c *Client) SetToken(token string) {
 	c.Header.Set("Authorization", "Bearer "+token)
 }
 
+// Replace the HTTP client requests are sent with, ie. to set timeouts, a proxy
+// or the certificates an Appliance is trusted with
+func (c *Client) SetHTTPClient(hClient *http.Client) {
+	c.hClient = *hClient
+}
+
+// Return a client for the same Appliance authenticated with another token,
+// sending requests with the same HTTP client
+func (c *Client) WithToken(token string) *Client {
+	n, _ := NewClient(token, c.Host)
+	n.hClient = c.hClient
+	return n
+}
+
 //
 // Wrappers for basic HTTP functions
 //
@@ -101,7 +133,7 @@ func (c *Client) get(url string) (*http.Response, error) {
 		return nil, errors.New("Unable to create HTTP GET Request")
 	}
 
-	request.Header = c.Header
+	request.Header = cloneHeader(c.Header)
 	return c.hClient.Do(request)
 }
 
@@ -112,7 +144,7 @@ func (c *Client) post(url string, buffer io.Reader) (*http.Response, error) {
 		return nil, errors.New("Unable to create HTTP POST request")
 	}
 
-	request.Header = c.Header
+	request.Header = cloneHeader(c.Header)
 	if buffer == nil {
 		request.Header.Del("Content-Type")
 	}
@@ -127,7 +159,7 @@ func (c *Client) put(url string, buffer io.Reader) (*http.Response, error) {
 		return nil, errors.New("Unable to create HTTP PUT request")
 	}
 
-	request.Header = c.Header
+	request.Header = cloneHeader(c.Header)
 
 	if buffer == nil {
 		request.Header.Del("Content-Type")
@@ -143,7 +175,7 @@ func (c *Client) del(url string) (*http.Response, error) {
 		return nil, errors.New("Unable to create HTTP DELETE Request")
 	}
 
-	request.Header = c.Header
+	request.Header = cloneHeader(c.Header)
 	return c.hClient.Do(request)
 }
 
@@ -156,7 +188,9 @@ func (c *Client) request(req, url string, options *http.Header, buffer io.Reader
 	}
 
 	// If header map passed in , add additional KV pairs
-	request.Header = c.Header
+	// The default header is copied so per-request values such as If-Match are
+	// not retained by the Client
+	request.Header = cloneHeader(c.Header)
 	if options != nil && len(*options) > 0 {
 		for k, v := range *options {
 			for _, el := range v {
@@ -180,6 +214,15 @@ func (c *Client) request(req, url string, options *http.Header, buffer io.Reader
 	return c.hClient.Do(request)
 }
 
+// Return a deep copy of an HTTP header
+func cloneHeader(header http.Header) http.Header {
+	newHeader := http.Header{}
+	for k, v := range header {
+		newHeader[k] = append([]string{}, v...)
+	}
+	return newHeader
+}
+
 // Unmarshalls data from an HTTP Response into a given entity
 func GetEntity(res *http.Response, entity interface{}) error {
 	data, err := ioutil.ReadAll(res.Body)
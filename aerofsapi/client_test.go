@@ -186,3 +186,38 @@ func TestAPI_CreateGroup(t *testing.T) {
 	}
 	t.Log(string(body))
 }
+
+// Parse permissions and roles, and combine permission sets
+func TestAPI_PermissionSet(t *testing.T) {
+	s, err := ParsePermissionSet("manage, write,WRITE")
+	if err != nil || s.String() != "MANAGE,WRITE" {
+		t.Fatalf("Unexpected permissions %v : %v", s, err)
+	}
+	if _, err = ParsePermissionSet("WRITE,READ"); err == nil {
+		t.Errorf("Expected an error for an unknown permission")
+	}
+
+	editor, err := ParsePermissionSet("Editor")
+	if err != nil || !editor.Equal(PermissionSet{PermissionWrite}) || editor.Role() != RoleEditor {
+		t.Errorf("Unexpected editor permissions %v : %v", editor, err)
+	}
+	viewer, _ := RoleViewer.Permissions()
+	if len(viewer) != 0 || viewer.Role() != RoleViewer || s.Role() != RoleOwner {
+		t.Errorf("Unexpected roles")
+	}
+
+	manage := NewPermissionSet(PermissionManage)
+	if !editor.Union(manage).Equal(s) || !s.Diff(editor).Equal(manage) || len(editor.Diff(s)) != 0 {
+		t.Errorf("Unexpected union or difference")
+	}
+
+	data, _ := json.Marshal(map[string]PermissionSet{"a": nil, "b": {"WRITE", "MANAGE"}})
+	if string(data) != `{"a":[],"b":["MANAGE","WRITE"]}` {
+		t.Errorf("Unexpected JSON %s", data)
+	}
+	member := SFMember{}
+	json.Unmarshal([]byte(`{"email":"a@b.c","permissions":["write","MANAGE","WRITE"]}`), &member)
+	if member.Permissions.String() != "MANAGE,WRITE" || member.Permissions.Validate() != nil {
+		t.Errorf("Unexpected permissions %v", member.Permissions)
+	}
+}
@@ -26,10 +26,10 @@ func (c *Client) GetFileMetadata(fileId string, fields []string) ([]byte,
 	newHeader.Set("Content-Type", "application/octet-stream")
 
 	res, err := c.request("GET", link, &newHeader, nil)
-	defer res.Body.Close()
 	if err != nil {
 		return nil, nil, err
 	}
+	defer res.Body.Close()
 
 	return unpackageResponse(res)
 }
@@ -122,7 +122,6 @@ func (c *Client) GetFileUploadId(fileId string, etags []string) (string, error)
 		return "", err
 	}
 
-	fmt.Println(h)
 	return h.Get("Upload-ID"), nil
 }
 
@@ -164,10 +163,29 @@ func (c *Client) UploadFileChunk(fileId, uploadId string, chunks []byte, startIn
 	newHeader.Set("Content-Length", "0")
 
 	res, err := c.request("PUT", link, &newHeader, bytes.NewBuffer(chunks))
+	if err != nil {
+		return nil, err
+	}
 	defer res.Body.Close()
+
+	_, h, e := unpackageResponse(res)
+	return h, e
+}
+
+// Complete an upload whose chunks were sent with UploadFileChunk by declaring
+// the total length of the content
+func (c *Client) FinishFileUpload(fileId, uploadId string, totalSize int, etags []string) (*http.Header, error) {
+	route := strings.Join([]string{FILE_ROUTE, fileId, "content"}, "/")
+	link := c.getURL(route, "")
+	newHeader := http.Header{"If-Match": etags}
+	newHeader.Set("Content-Range", fmt.Sprintf("bytes */%d", totalSize))
+	newHeader.Set("Upload-ID", uploadId)
+
+	res, err := c.request("PUT", link, &newHeader, bytes.NewReader([]byte{}))
 	if err != nil {
 		return nil, err
 	}
+	defer res.Body.Close()
 
 	_, h, e := unpackageResponse(res)
 	return h, e
@@ -175,11 +193,17 @@ func (c *Client) UploadFileChunk(fileId, uploadId string, chunks []byte, startIn
 
 // Upload a file
 func (c *Client) UploadFile(fileId, uploadId string, file io.Reader, etags []string) error {
+	return c.UploadFileWithType(fileId, uploadId, "application/octet-stream", file, etags)
+}
+
+// Upload a file with a given MIME type
+func (c *Client) UploadFileWithType(fileId, uploadId, mimeType string, file io.Reader, etags []string) error {
 	route := strings.Join([]string{FILE_ROUTE, fileId, "content"}, "/")
 	link := c.getURL(route, "")
 	newHeader := http.Header{
-		"If-Match":  etags,
-		"Upload-ID": []string{uploadId},
+		"If-Match":     etags,
+		"Upload-ID":    []string{uploadId},
+		"Content-Type": []string{mimeType},
 	}
 
 	err := c.uploadFileChunks(link, &newHeader, file)
@@ -188,45 +212,53 @@ func (c *Client) UploadFile(fileId, uploadId string, file io.Reader, etags []str
 
 // Helper function to upload sequential chunks of a file
 func (c *Client) uploadFileChunks(link string, header *http.Header, file io.Reader) error {
-	// Indices for file byte-ranges
+	// Index of the first byte of the current chunk
 	startIndex := 0
-	endIndex := 0
 
 	chunk := make([]byte, CHUNKSIZE)
 
 	// Iterate over the file in CHUNKSIZE pieces until EOF occurs
 	// Do not set "Instance-Length" of "Content-Range" until we hit EOF and use
 	// the format "bytes <startIndex>-<endIndex>/* for intermediary uploads
-
 	for {
-		size, fileErr := file.Read(chunk)
-		endIndex += size - 1
+		size, fileErr := io.ReadFull(file, chunk)
+		lastChunk := fileErr == io.EOF || fileErr == io.ErrUnexpectedEOF
+		if fileErr != nil && !lastChunk {
+			return fileErr
+		}
 
+		endIndex := startIndex + size - 1
 		switch {
+		// The previous chunk ended exactly on EOF, only the length remains
+		case lastChunk && size == 0:
+			byteRange := fmt.Sprintf("bytes */%d", startIndex)
+			header.Set("Content-Range", byteRange)
 		// If we have read all chunks, set Content-Range instance-Length
-		case fileErr == io.EOF:
-			byteRange := fmt.Sprintf("bytes %d-%d/%d", startIndex, endIndex, endIndex)
+		case lastChunk:
+			byteRange := fmt.Sprintf("bytes %d-%d/%d", startIndex, endIndex, endIndex+1)
 			header.Set("Content-Range", byteRange)
-		case fileErr != nil:
-			return fileErr
-		case fileErr == nil:
+		default:
 			byteRange := fmt.Sprintf("bytes %d-%d/*", startIndex, endIndex)
 			header.Set("Content-Range", byteRange)
 		}
 
-		res, httpErr := c.request("PUT", link, header, bytes.NewBuffer(chunk))
+		res, httpErr := c.request("PUT", link, header, bytes.NewReader(chunk[:size]))
+		if httpErr != nil {
+			return httpErr
+		}
+		_, _, httpErr = unpackageResponse(res)
+		res.Body.Close()
 		if httpErr != nil {
 			return httpErr
 		}
-		defer res.Body.Close()
-		if fileErr == io.EOF {
-			break
+		if lastChunk {
+			return nil
 		}
 
 		startIndex += size
 	}
-	return nil
 }
+
 func (c *Client) MoveFile(fileId, parentId, name string, etags []string) ([]byte, *http.Header, error) {
 	route := strings.Join([]string{FILE_ROUTE, fileId}, "/")
 	link := c.getURL(route, "")
@@ -249,6 +281,10 @@ func (c *Client) MoveFile(fileId, parentId, name string, etags []string) ([]byte
 	}
 
 	res, err := c.request("PUT", link, &newHeader, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
 	return unpackageResponse(res)
 }
 
@@ -262,11 +298,11 @@ func (c *Client) DeleteFile(fileid string, etags []string) error {
 	link := c.getURL(route, "")
 	newHeader := http.Header{"If-Match": etags}
 
-	res, err := c.request("DEL", link, &newHeader, nil)
-	defer res.Body.Close()
+	res, err := c.request("DELETE", link, &newHeader, nil)
 	if err != nil {
 		return err
 	}
+	defer res.Body.Close()
 	_, _, err = unpackageResponse(res)
 	return err
 }
@@ -14,6 +14,12 @@ const (
 )
 
 func (c *Client) GetFolderMetadata(folderId string, fields []string) ([]byte, *http.Header, error) {
+	return c.GetFolderMetadataIfNoneMatch(folderId, fields, []string{})
+}
+
+// Retrieve folder metadata only if its ETag differs from those given
+// A ResponseError with the status "304 Not Modified" is returned otherwise
+func (c *Client) GetFolderMetadataIfNoneMatch(folderId string, fields, etags []string) ([]byte, *http.Header, error) {
 	route := strings.Join([]string{FOLDER_ROUTE, folderId}, "/")
 	query := ""
 	if len(fields) > 0 {
@@ -21,12 +27,16 @@ func (c *Client) GetFolderMetadata(folderId string, fields []string) ([]byte, *h
 		query = v.Encode()
 	}
 	link := c.getURL(route, query)
+	newHeader := http.Header{}
+	for _, v := range etags {
+		newHeader.Add("If-None-Match", v)
+	}
 
-	res, err := c.get(link)
-	defer res.Body.Close()
+	res, err := c.request("GET", link, &newHeader, nil)
 	if err != nil {
 		return nil, nil, err
 	}
+	defer res.Body.Close()
 
 	return unpackageResponse(res)
 }
@@ -88,10 +98,16 @@ func (c *Client) MoveFolder(folderId, newParentId, newFolderName string, etags [
 		return nil, nil, errors.New("Unable to marshal JSON for moving folder")
 	}
 
-	res, err := c.put(link, bytes.NewBuffer(data))
+	newHeader := http.Header{}
+	for _, v := range etags {
+		newHeader.Add("If-Match", v)
+	}
+
+	res, err := c.request("PUT", link, &newHeader, bytes.NewBuffer(data))
 	if err != nil {
 		return nil, nil, err
 	}
+	defer res.Body.Close()
 
 	return unpackageResponse(res)
 }
@@ -102,11 +118,12 @@ func (c *Client) DeleteFolder(folderId string, etags []string) error {
 	link := c.getURL(route, "")
 
 	res, err := c.request("DELETE", link, &newHeader, nil)
-	defer res.Body.Close()
 	if err != nil {
-		_, _, err = unpackageResponse(res)
+		return err
 	}
+	defer res.Body.Close()
 
+	_, _, err = unpackageResponse(res)
 	return err
 }
 
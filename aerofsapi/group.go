@@ -2,7 +2,8 @@ package aerofsapi
 
 import (
 	"bytes"
-	"fmt"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -20,38 +21,39 @@ func (c *Client) ListGroups(offset, results int) ([]byte, *http.Header, error) {
 	link := c.getURL(GROUP_ROUTE, query.Encode())
 
 	res, err := c.get(link)
-	defer res.Body.Close()
 	if err != nil {
 		return nil, nil, err
 	}
+	defer res.Body.Close()
 
 	return unpackageResponse(res)
 }
 
 func (c *Client) CreateGroup(groupName string) ([]byte, *http.Header, error) {
 	link := c.getURL(GROUP_ROUTE, "")
-	// TODO : Is this preferred to constructing a map, then marshalling?
-	// robust vs. bootstrap
-	newGroup := []byte(fmt.Sprintf(`{"name" : %s}`, groupName))
+	newGroup, err := json.Marshal(map[string]string{"name": groupName})
+	if err != nil {
+		return nil, nil, errors.New("Unable to marshal new group")
+	}
 
 	res, err := c.post(link, bytes.NewBuffer(newGroup))
-	defer res.Body.Close()
 	if err != nil {
 		return nil, nil, err
 	}
+	defer res.Body.Close()
 
 	return unpackageResponse(res)
 }
 
 func (c *Client) GetGroup(groupId string) ([]byte, *http.Header, error) {
-	route := strings.Join([]string{"request", groupId}, "/")
+	route := strings.Join([]string{GROUP_ROUTE, groupId}, "/")
 	link := c.getURL(route, "")
 
-	res, err := c.post(link, nil)
-	defer res.Body.Close()
+	res, err := c.get(link)
 	if err != nil {
 		return nil, nil, err
 	}
+	defer res.Body.Close()
 
 	return unpackageResponse(res)
 }
@@ -61,6 +63,11 @@ func (c *Client) DeleteGroup(groupId string) error {
 	link := c.getURL(route, "")
 
 	res, err := c.del(link)
+	if err != nil {
+		return err
+	}
 	defer res.Body.Close()
+
+	_, _, err = unpackageResponse(res)
 	return err
 }
@@ -17,19 +17,19 @@ func (c *Client) ListGroupMembers(groupId string) ([]byte, *http.Header, error)
 	link := c.getURL(route, "")
 
 	res, err := c.get(link)
-	defer res.Body.Close()
 	if err != nil {
 		return nil, nil, err
 	}
+	defer res.Body.Close()
 
 	return unpackageResponse(res)
 }
 
-func (c *Client) AddGroupMember(groupId, name string) ([]byte, *http.Header, error) {
+func (c *Client) AddGroupMember(groupId, email string) ([]byte, *http.Header, error) {
 	route := strings.Join([]string{GROUPMEMBER_ROUTE, groupId, "members"}, "/")
 	link := c.getURL(route, "")
 	newMember := map[string]string{
-		"name": name,
+		"email": email,
 	}
 	data, err := json.Marshal(newMember)
 	if err != nil {
@@ -40,6 +40,7 @@ func (c *Client) AddGroupMember(groupId, name string) ([]byte, *http.Header, err
 	if err != nil {
 		return nil, nil, err
 	}
+	defer res.Body.Close()
 
 	return unpackageResponse(res)
 }
@@ -49,10 +50,10 @@ func (c *Client) GetGroupMember(groupId, email string) ([]byte, *http.Header, er
 	link := c.getURL(route, "")
 
 	res, err := c.get(link)
-	defer res.Body.Close()
 	if err != nil {
 		return nil, nil, err
 	}
+	defer res.Body.Close()
 
 	return unpackageResponse(res)
 }
@@ -62,10 +63,10 @@ func (c *Client) RemoveMember(groupId, email string) error {
 	link := c.getURL(route, "")
 
 	res, err := c.del(link)
-	defer res.Body.Close()
 	if err != nil {
 		return err
 	}
+	defer res.Body.Close()
 
 	_, _, err = unpackageResponse(res)
 	return err
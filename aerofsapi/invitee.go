@@ -17,10 +17,10 @@ func (c *Client) GetInvitee(email string) ([]byte, *http.Header, error) {
 	link := c.getURL(route, "")
 
 	res, err := c.get(link)
-	defer res.Body.Close()
 	if err != nil {
 		return nil, nil, err
 	}
+	defer res.Body.Close()
 
 	return unpackageResponse(res)
 }
@@ -39,10 +39,10 @@ func (c *Client) CreateInvitee(email_to, email_from string) ([]byte,
 	}
 
 	res, err := c.post(link, bytes.NewBuffer(data))
-	defer res.Body.Close()
 	if err != nil {
 		return nil, nil, err
 	}
+	defer res.Body.Close()
 
 	return unpackageResponse(res)
 }
@@ -52,6 +52,9 @@ func (c *Client) DeleteInvitee(email string) error {
 	route := strings.Join([]string{INVITEE_ROUTE, email}, "/")
 	link := c.getURL(route, "")
 	res, err := c.del(link)
+	if err != nil {
+		return err
+	}
 	defer res.Body.Close()
 	_, _, err = unpackageResponse(res)
 	return err
@@ -49,30 +49,32 @@ type SharedFolder struct {
 	Members    []SFMember        `json:"members,omitempty"`
 	Groups     []SFGroupMember   `json:"groups,omitempty"`
 	Pending    []SFPendingMember `json:"pending,omitempty"`
-	Permission []string          `json:"caller_effective_permissions,omitempty"`
+	Permission PermissionSet     `json:"caller_effective_permissions,omitempty"`
 }
 
 type SFMember struct {
-	Sid         string   `json:"-"`
-	Email       string   `json:"email"`
-	FirstName   string   `json:"first_name"`
-	LastName    string   `json:"last_name"`
-	Permissions []string `json:"permissions"`
+	Sid         string        `json:"-"`
+	Email       string        `json:"email"`
+	FirstName   string        `json:"first_name"`
+	LastName    string        `json:"last_name"`
+	Permissions PermissionSet `json:"permissions"`
 }
 
 type SFGroupMember struct {
-	Id          string   `json:"id"`
-	Name        string   `json:"name"`
-	Permissions []string `json:"permissions"`
+	Sid         string        `json:"-"`
+	Id          string        `json:"id"`
+	Name        string        `json:"name"`
+	Permissions PermissionSet `json:"permissions"`
 }
 
 type SFPendingMember struct {
-	Email       string   `json:"email"`
-	FirstName   string   `json:"first_name,omitempty"`
-	LastName    string   `json:"last_name,omitempty"`
-	Inviter     string   `json:"invited_by,omitempty"`
-	Permissions []string `json:"permissions"`
-	Note        string   `json:"note"`
+	Sid         string        `json:"-"`
+	Email       string        `json:"email"`
+	FirstName   string        `json:"first_name,omitempty"`
+	LastName    string        `json:"last_name,omitempty"`
+	Inviter     string        `json:"invited_by,omitempty"`
+	Permissions PermissionSet `json:"permissions"`
+	Note        string        `json:"note"`
 }
 
 type Group struct {
@@ -88,6 +90,11 @@ type GroupMember struct {
 	LastName  string `json:"last_name"`
 }
 
+// Whether two-factor authentication is enforced for a user
+type TwoFactorStatus struct {
+	Enforce bool `json:"enforce"`
+}
+
 type Invitee struct {
 	EmailTo    string `json:"email_to"`
 	EmailFrom  string `json:"email_from"`
@@ -95,10 +102,10 @@ type Invitee struct {
 }
 
 type Invitation struct {
-	Sid         string   `json:"share_id"`
-	Name        string   `json:"share_name"`
-	Inviter     string   `json:"invited_by"`
-	Permissions []string `json:"permissions"`
+	Sid         string        `json:"share_id"`
+	Name        string        `json:"share_name"`
+	Inviter     string        `json:"invited_by"`
+	Permissions PermissionSet `json:"permissions"`
 }
 
 type Device struct {
@@ -110,7 +117,7 @@ type Device struct {
 }
 
 type PermissionList struct {
-	Permissions []string `json:"permissions"`
+	Permissions PermissionSet `json:"permissions"`
 }
 
 type DeviceStatus struct {
@@ -0,0 +1,189 @@
+package aerofsapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A permission a user or group holds on a shared folder
+// Every member can read a shared folder, permissions grant more
+type Permission string
+
+const (
+	// Modify the contents of the shared folder
+	PermissionWrite Permission = "WRITE"
+	// Manage the members of the shared folder
+	PermissionManage Permission = "MANAGE"
+)
+
+// Every known permission
+var Permissions = []Permission{PermissionWrite, PermissionManage}
+
+// Parse a permission, regardless of case
+func ParsePermission(s string) (Permission, error) {
+	p := Permission(strings.ToUpper(strings.TrimSpace(s)))
+	if !p.Valid() {
+		return "", fmt.Errorf("Unknown permission %q", s)
+	}
+	return p, nil
+}
+
+// Return whether a permission is known
+func (p Permission) Valid() bool {
+	for _, known := range Permissions {
+		if p == known {
+			return true
+		}
+	}
+	return false
+}
+
+// A named set of permissions
+type Role string
+
+const (
+	RoleViewer Role = "viewer"
+	RoleEditor Role = "editor"
+	RoleOwner  Role = "owner"
+)
+
+// Every role, from the least to the most privileged
+var Roles = []Role{RoleViewer, RoleEditor, RoleOwner}
+
+// Return the permissions of a role
+func (r Role) Permissions() (PermissionSet, error) {
+	switch Role(strings.ToLower(string(r))) {
+	case RoleViewer:
+		return PermissionSet{}, nil
+	case RoleEditor:
+		return NewPermissionSet(PermissionWrite), nil
+	case RoleOwner:
+		return NewPermissionSet(PermissionWrite, PermissionManage), nil
+	}
+	return nil, fmt.Errorf("Unknown role %q", string(r))
+}
+
+// A set of permissions, kept sorted and without duplicates
+// It is marshalled as a JSON list of permissions, never null
+type PermissionSet []Permission
+
+// Return the set of the given permissions
+func NewPermissionSet(permissions ...Permission) PermissionSet {
+	s := PermissionSet{}
+	for _, p := range permissions {
+		if !s.Contains(p) {
+			s = append(s, p)
+		}
+	}
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	return s
+}
+
+// Parse a list of permissions, regardless of case
+func ParsePermissions(list []string) (PermissionSet, error) {
+	permissions := []Permission{}
+	for _, s := range list {
+		p, err := ParsePermission(s)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, p)
+	}
+	return NewPermissionSet(permissions...), nil
+}
+
+// Parse a role name, or permissions separated by commas or spaces, ie.
+// "editor" or "WRITE,MANAGE"
+func ParsePermissionSet(s string) (PermissionSet, error) {
+	if permissions, err := Role(strings.TrimSpace(s)).Permissions(); err == nil {
+		return permissions, nil
+	}
+	return ParsePermissions(strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' '
+	}))
+}
+
+// Return an error naming the first unknown permission of the set
+func (s PermissionSet) Validate() error {
+	for _, p := range s {
+		if !p.Valid() {
+			return fmt.Errorf("Unknown permission %q", string(p))
+		}
+	}
+	return nil
+}
+
+func (s PermissionSet) Contains(p Permission) bool {
+	for _, q := range s {
+		if q == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the permissions in either set
+func (s PermissionSet) Union(other PermissionSet) PermissionSet {
+	return NewPermissionSet(append(append([]Permission{}, s...), other...)...)
+}
+
+// Return the permissions of the set which are not in the other set
+func (s PermissionSet) Diff(other PermissionSet) PermissionSet {
+	diff := []Permission{}
+	for _, p := range s {
+		if !other.Contains(p) {
+			diff = append(diff, p)
+		}
+	}
+	return NewPermissionSet(diff...)
+}
+
+// Return whether both sets hold the same permissions, regardless of order
+func (s PermissionSet) Equal(other PermissionSet) bool {
+	return len(s.Diff(other)) == 0 && len(other.Diff(s)) == 0
+}
+
+// Return the least privileged role granting every permission of the set
+func (s PermissionSet) Role() Role {
+	for _, r := range Roles {
+		permissions, _ := r.Permissions()
+		if len(s.Diff(permissions)) == 0 {
+			return r
+		}
+	}
+	return RoleOwner
+}
+
+func (s PermissionSet) Strings() []string {
+	list := []string{}
+	for _, p := range s {
+		list = append(list, string(p))
+	}
+	return list
+}
+
+func (s PermissionSet) String() string {
+	return strings.Join(s.Strings(), ",")
+}
+
+func (s PermissionSet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(NewPermissionSet(s...).Strings())
+}
+
+// Permissions unknown to this package are kept, so newer Appliances can be
+// listed, but are rejected by Validate
+func (s *PermissionSet) UnmarshalJSON(data []byte) error {
+	list := []string{}
+	err := json.Unmarshal(data, &list)
+	if err != nil {
+		return err
+	}
+	permissions := []Permission{}
+	for _, p := range list {
+		permissions = append(permissions, Permission(strings.ToUpper(p)))
+	}
+	*s = NewPermissionSet(permissions...)
+	return nil
+}
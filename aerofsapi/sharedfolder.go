@@ -2,7 +2,8 @@ package aerofsapi
 
 import (
 	"bytes"
-	"fmt"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 )
@@ -17,10 +18,10 @@ func (c *Client) ListSharedFolders(email string, etags []string) ([]byte, *http.
 	newHeader := http.Header{"If-None-Match": etags}
 
 	res, err := c.request("GET", link, &newHeader, nil)
-	defer res.Body.Close()
 	if err != nil {
 		return nil, nil, err
 	}
+	defer res.Body.Close()
 
 	return unpackageResponse(res)
 }
@@ -34,19 +35,23 @@ func (c *Client) ListSharedFolderMetadata(sid string, etags []string) ([]byte, *
 	if err != nil {
 		return nil, nil, err
 	}
+	defer res.Body.Close()
 	return unpackageResponse(res)
 }
 
 func (c *Client) CreateSharedFolder(name string) ([]byte, *http.Header, error) {
 	route := strings.Join([]string{SF_ROUTE}, "/")
 	link := c.getURL(route, "")
-	data := []byte(fmt.Sprintf(`{"name" : %s"}`, name))
+	data, err := json.Marshal(map[string]string{"name": name})
+	if err != nil {
+		return nil, nil, errors.New("Unable to marshal new shared folder")
+	}
 
 	res, err := c.post(link, bytes.NewBuffer(data))
-
 	if err != nil {
 		return nil, nil, err
 	}
+	defer res.Body.Close()
 
 	return unpackageResponse(res)
 }
@@ -14,36 +14,41 @@ func (c *Client) ListSFGroups(sid string) ([]byte, *http.Header, error) {
 	link := c.getURL(path, "")
 
 	res, err := c.get(link)
-	defer res.Body.Close()
 	if err != nil {
 		return nil, nil, err
 	}
+	defer res.Body.Close()
 
 	return unpackageResponse(res)
 }
 
-// Retrieve information for a group associated with a shared folder
-// As of now, this only returns the new permissions associated with each group
-// and the two argument
-func (c *Client) GetSFGroups(sid, gid string) ([]byte, *http.Header, error) {
-	path := strings.Join([]string{SF_ROUTE, sid, "members", gid}, "/")
+// Retrieve the permissions of a group associated with a shared folder
+func (c *Client) GetSFGroups(sid, gid string, etags []string) ([]byte, *http.Header, error) {
+	path := strings.Join([]string{SF_ROUTE, sid, "groups", gid}, "/")
 	link := c.getURL(path, "")
+	newHeader := http.Header{}
+	if len(etags) > 0 {
+		newHeader = http.Header{"If-None-Match": etags}
+	}
 
-	res, err := c.get(link)
-	defer res.Body.Close()
+	res, err := c.request("GET", link, &newHeader, nil)
 	if err != nil {
 		return nil, nil, err
 	}
+	defer res.Body.Close()
 
 	return unpackageResponse(res)
 }
 
-// Construct a new group for an existing Shared Folder
-func (c *Client) AddGroupToSharedFolder(sid string, permissions []string) ([]byte, *http.Header, error) {
+// Add an existing group to a Shared Folder with the given permissions
+func (c *Client) AddGroupToSharedFolder(sid, gid string, permissions PermissionSet) ([]byte, *http.Header, error) {
+	if err := permissions.Validate(); err != nil {
+		return nil, nil, err
+	}
 	path := strings.Join([]string{SF_ROUTE, sid, "groups"}, "/")
 	link := c.getURL(path, "")
 	reqBody := map[string]interface{}{
-		"id":          sid,
+		"id":          gid,
 		"permissions": permissions,
 	}
 	data, err := json.Marshal(reqBody)
@@ -54,16 +59,22 @@ func (c *Client) AddGroupToSharedFolder(sid string, permissions []string) ([]byt
 	if err != nil {
 		return nil, nil, err
 	}
+	defer res.Body.Close()
 
 	return unpackageResponse(res)
 }
 
 // Modify the existing permissions of a group for an existing shared folder
-func (c *Client) SetSFGroupPermissions(sid, gid string, permissions []string) ([]byte, *http.Header, error) {
+// The change only applies if the group still matches one of the given ETags,
+// if any
+func (c *Client) SetSFGroupPermissions(sid, gid string, permissions PermissionSet, etags []string) ([]byte, *http.Header, error) {
+	if err := permissions.Validate(); err != nil {
+		return nil, nil, err
+	}
 	path := strings.Join([]string{SF_ROUTE, sid, "groups", gid}, "/")
 	link := c.getURL(path, "")
 
-	permsList := map[string][]string{
+	permsList := map[string]PermissionSet{
 		"permissions": permissions,
 	}
 	data, err := json.Marshal(permsList)
@@ -71,22 +82,35 @@ func (c *Client) SetSFGroupPermissions(sid, gid string, permissions []string) ([
 		return nil, nil, errors.New("Unable to marshal given list of permissions")
 	}
 
-	res, err := c.put(link, bytes.NewBuffer(data))
+	newHeader := http.Header{}
+	if len(etags) > 0 {
+		newHeader = http.Header{"If-Match": etags}
+	}
+	res, err := c.request("PUT", link, &newHeader, bytes.NewBuffer(data))
 	if err != nil {
 		return nil, nil, err
 	}
+	defer res.Body.Close()
 
 	return unpackageResponse(res)
 }
 
-// Remove an existing group from its associated shared folder
-func (c *Client) RemoveSFGroup(sid, gid string) error {
+// Remove an existing group from its associated shared folder, only if it still
+// matches one of the given ETags, if any
+func (c *Client) RemoveSFGroup(sid, gid string, etags []string) error {
 	path := strings.Join([]string{SF_ROUTE, sid, "groups", gid}, "/")
 	link := c.getURL(path, "")
+	newHeader := http.Header{}
+	if len(etags) > 0 {
+		newHeader = http.Header{"If-Match": etags}
+	}
 
-	res, err := c.del(link)
-	if err == nil {
-		_, _, err = unpackageResponse(res)
+	res, err := c.request("DELETE", link, &newHeader, nil)
+	if err != nil {
+		return err
 	}
+	defer res.Body.Close()
+
+	_, _, err = unpackageResponse(res)
 	return err
 }
@@ -7,6 +7,7 @@ import (
 	"strings"
 )
 
+// List the pending invitations of a user to shared folders
 func (c *Client) ListSFInvitations(email string) ([]byte, *http.Header, error) {
 	route := strings.Join([]string{"users", email, "invitations"}, "/")
 	link := c.getURL(route, "")
@@ -15,23 +16,27 @@ func (c *Client) ListSFInvitations(email string) ([]byte, *http.Header, error) {
 	if err != nil {
 		return nil, nil, err
 	}
+	defer res.Body.Close()
 
 	return unpackageResponse(res)
 }
 
+// Retrieve a pending invitation of a user to a shared folder
 func (c *Client) ViewPendingSFInvitation(email, sid string) ([]byte, *http.Header, error) {
 	route := strings.Join([]string{"users", email, "invitations", sid}, "/")
 	link := c.getURL(route, "")
 
 	res, err := c.get(link)
-	defer res.Body.Close()
 	if err != nil {
 		return nil, nil, err
 	}
+	defer res.Body.Close()
 
 	return unpackageResponse(res)
 }
 
+// Accept an invitation to a shared folder, with external set to 1 the shared
+// folder is synced outside of the root folder of the user
 func (c *Client) AcceptSFInvitation(email, sid string, external int) ([]byte, *http.Header, error) {
 	route := strings.Join([]string{"users", email, "invitations", sid}, "/")
 	query := url.Values{}
@@ -39,10 +44,10 @@ func (c *Client) AcceptSFInvitation(email, sid string, external int) ([]byte, *h
 	link := c.getURL(route, query.Encode())
 
 	res, err := c.post(link, nil)
-	defer res.Body.Close()
 	if err != nil {
 		return nil, nil, err
 	}
+	defer res.Body.Close()
 
 	return unpackageResponse(res)
 }
@@ -53,6 +58,11 @@ func (c *Client) IgnoreSFInvitation(email, sid string) error {
 	link := c.getURL(route, "")
 
 	res, err := c.del(link)
+	if err != nil {
+		return err
+	}
 	defer res.Body.Close()
+
+	_, _, err = unpackageResponse(res)
 	return err
 }
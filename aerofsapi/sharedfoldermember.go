@@ -20,6 +20,7 @@ func (c *Client) ListSFMembers(id string, etags []string) ([]byte, *http.Header,
 	if err != nil {
 		return nil, nil, err
 	}
+	defer res.Body.Close()
 
 	return unpackageResponse(res)
 }
@@ -36,11 +37,15 @@ func (c *Client) GetSFMember(id, email string, etags []string) ([]byte, *http.He
 	if err != nil {
 		return nil, nil, err
 	}
+	defer res.Body.Close()
 
 	return unpackageResponse(res)
 }
 
-func (c *Client) AddSFMember(id, email string, permissions []string) ([]byte, *http.Header, error) {
+func (c *Client) AddSFMember(id, email string, permissions PermissionSet) ([]byte, *http.Header, error) {
+	if err := permissions.Validate(); err != nil {
+		return nil, nil, err
+	}
 	route := strings.Join([]string{SF_ROUTE, id, "members"}, "/")
 	link := c.getURL(route, "")
 
@@ -57,11 +62,99 @@ func (c *Client) AddSFMember(id, email string, permissions []string) ([]byte, *h
 	if err != nil {
 		return nil, nil, err
 	}
+	defer res.Body.Close()
+
+	return unpackageResponse(res)
+}
+
+// Invite a user to a shared folder, the invitation stays pending until the
+// user accepts it
+func (c *Client) InviteSFMember(id, email string, permissions PermissionSet, note string) ([]byte, *http.Header, error) {
+	if err := permissions.Validate(); err != nil {
+		return nil, nil, err
+	}
+	route := strings.Join([]string{SF_ROUTE, id, "pending"}, "/")
+	link := c.getURL(route, "")
+
+	invitation := map[string]interface{}{
+		"email":       email,
+		"permissions": permissions,
+		"note":        note,
+	}
+	data, err := json.Marshal(invitation)
+	if err != nil {
+		return nil, nil, errors.New("Unable to marshal new ShareFolder invitation")
+	}
+
+	res, err := c.post(link, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+
+	return unpackageResponse(res)
+}
+
+// List the users invited to a shared folder who have not accepted yet
+func (c *Client) ListSFPendingMembers(id string, etags []string) ([]byte, *http.Header, error) {
+	route := strings.Join([]string{SF_ROUTE, id, "pending"}, "/")
+	newHeader := http.Header{}
+	if len(etags) > 0 {
+		newHeader = http.Header{"If-None-Match": etags}
+	}
+	link := c.getURL(route, "")
+
+	res, err := c.request("GET", link, &newHeader, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+
+	return unpackageResponse(res)
+}
+
+// Retrieve the pending invitation of a user to a shared folder
+func (c *Client) GetSFPendingMember(id, email string, etags []string) ([]byte, *http.Header, error) {
+	route := strings.Join([]string{SF_ROUTE, id, "pending", email}, "/")
+	newHeader := http.Header{}
+	if len(etags) > 0 {
+		newHeader = http.Header{"If-None-Match": etags}
+	}
+	link := c.getURL(route, "")
+
+	res, err := c.request("GET", link, &newHeader, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
 
 	return unpackageResponse(res)
 }
 
-func (c *Client) SetSFMemberPermissions(id, email string, permissions, etags []string) ([]byte, *http.Header, error) {
+// Revoke the pending invitation of a user to a shared folder, only if it still
+// matches one of the given ETags, if any
+func (c *Client) RemoveSFPendingMember(id, email string, etags []string) error {
+	route := strings.Join([]string{SF_ROUTE, id, "pending", email}, "/")
+	link := c.getURL(route, "")
+	newHeader := http.Header{}
+	if len(etags) > 0 {
+		newHeader = http.Header{"If-Match": etags}
+	}
+
+	res, err := c.request("DELETE", link, &newHeader, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	_, _, err = unpackageResponse(res)
+	return err
+}
+
+func (c *Client) SetSFMemberPermissions(id, email string, permissions PermissionSet, etags []string) ([]byte, *http.Header, error) {
+	if err := permissions.Validate(); err != nil {
+		return nil, nil, err
+	}
 	route := strings.Join([]string{SF_ROUTE, id, "members", email}, "/")
 	newHeader := http.Header{"If-Match": etags}
 	link := c.getURL(route, "")
@@ -78,6 +171,7 @@ func (c *Client) SetSFMemberPermissions(id, email string, permissions, etags []s
 	if err != nil {
 		return nil, nil, err
 	}
+	defer res.Body.Close()
 
 	return unpackageResponse(res)
 }
@@ -87,10 +181,11 @@ func (c *Client) RemoveSFMember(id, email string, etags []string) ([]byte, *http
 	newHeader := http.Header{"If-Match": etags}
 	link := c.getURL(route, "")
 
-	res, err := c.request("DEL", link, &newHeader, nil)
+	res, err := c.request("DELETE", link, &newHeader, nil)
 	if err != nil {
 		return nil, nil, err
 	}
+	defer res.Body.Close()
 
 	return unpackageResponse(res)
 }
@@ -26,10 +26,10 @@ func (c *Client) ListUsers(limit int, after, before *string) ([]byte, *http.Head
 
 	link := c.getURL(USERS_ROUTE, query.Encode())
 	res, err := c.get(link)
-	defer res.Body.Close()
 	if err != nil {
 		return nil, nil, err
 	}
+	defer res.Body.Close()
 
 	return unpackageResponse(res)
 }
@@ -39,10 +39,10 @@ func (c *Client) GetUser(email string) ([]byte, *http.Header, error) {
 	link := c.getURL(route, "")
 
 	res, err := c.get(link)
-	defer res.Body.Close()
 	if err != nil {
 		return nil, nil, err
 	}
+	defer res.Body.Close()
 
 	return unpackageResponse(res)
 }
@@ -62,6 +62,11 @@ func (c *Client) CreateUser(email, firstName, lastName string) ([]byte,
 	}
 
 	res, err := c.post(link, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+
 	return unpackageResponse(res)
 }
 
@@ -81,6 +86,9 @@ func (c *Client) UpdateUser(email, firstName, lastName string) ([]byte,
 	}
 
 	res, err := c.put(link, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, nil, err
+	}
 	defer res.Body.Close()
 
 	return unpackageResponse(res)
@@ -91,8 +99,12 @@ func (c *Client) DeleteUser(email string) error {
 	link := c.getURL(route, "")
 
 	res, err := c.del(link)
-	res.Body.Close()
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
 
+	_, _, err = unpackageResponse(res)
 	return err
 }
 
@@ -101,7 +113,13 @@ func (c *Client) ChangePassword(email, password string) error {
 	link := c.getURL(route, "")
 	data := []byte(`"` + password + `"`)
 
-	_, err := c.put(link, bytes.NewBuffer(data))
+	res, err := c.put(link, bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	_, _, err = unpackageResponse(res)
 	return err
 }
 
@@ -109,22 +127,49 @@ func (c *Client) DisablePassword(email string) error {
 	route := strings.Join([]string{USERS_ROUTE, email, "password"}, "/")
 	link := c.getURL(route, "")
 
-	_, err := c.del(link)
+	res, err := c.del(link)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	_, _, err = unpackageResponse(res)
 	return err
 }
 
-func (c *Client) CheckTwoFactorAuth(email string) error {
+// Return whether two-factor authentication is enforced for a user
+func (c *Client) CheckTwoFactorAuth(email string) (*TwoFactorStatus, error) {
 	route := strings.Join([]string{USERS_ROUTE, email, "two_factor"}, "/")
 	link := c.getURL(route, "")
 
-	_, err := c.get(link)
-	return err
+	res, err := c.get(link)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, _, err := unpackageResponse(res)
+	if err != nil {
+		return nil, err
+	}
+	status := TwoFactorStatus{}
+	err = json.Unmarshal(body, &status)
+	if err != nil {
+		return nil, errors.New("Unable to unmarshal the two-factor authentication status")
+	}
+	return &status, nil
 }
 
 func (c *Client) DisableTwoFactorAuth(email string) error {
 	route := strings.Join([]string{USERS_ROUTE, email, "two_factor"}, "/")
 	link := c.getURL(route, "")
 
-	_, err := c.del(link)
+	res, err := c.del(link)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	_, _, err = unpackageResponse(res)
 	return err
 }
@@ -0,0 +1,304 @@
+package aerofsaudit
+
+// An organization-wide report of who can access which shared folder
+// The effective permissions of a user on a shared folder are the union of the
+// permissions granted to them directly and through every group they are in
+
+import (
+	"encoding/json"
+	"errors"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Options for Audit
+type Options struct {
+	// Domains users are expected to belong to, users with an email in another
+	// domain are flagged, nobody is flagged if empty
+	AllowedDomains []string
+
+	// Called with progress messages, may be nil
+	Log func(format string, args ...interface{})
+}
+
+// The access of one user to one shared folder
+type Access struct {
+	Sid   string `json:"sid"`
+	Share string `json:"share"`
+	Email string `json:"email"`
+
+	// The effective permissions, and how they are granted
+	Permissions api.PermissionSet `json:"permissions"`
+	Direct      api.PermissionSet `json:"direct_permissions,omitempty"`
+	Groups      []string          `json:"groups,omitempty"`
+
+	// An invitation which is not accepted yet
+	Pending bool `json:"pending"`
+
+	// The shared folder is synced outside of the root folder of the user
+	External bool `json:"external"`
+
+	Manager       bool `json:"manager"`
+	OutsideDomain bool `json:"outside_domain"`
+}
+
+// The members of a shared folder at a glance
+type ShareSummary struct {
+	Sid      string   `json:"sid"`
+	Name     string   `json:"name"`
+	Members  int      `json:"members"`
+	Pending  int      `json:"pending"`
+	Groups   []string `json:"groups"`
+	Managers []string `json:"managers"`
+	Outside  []string `json:"outside_domain"`
+
+	// Some groups could not be listed, their members are missing from the
+	// counts and access of the shared folder
+	GroupsIncomplete bool `json:"groups_incomplete,omitempty"`
+}
+
+type Report struct {
+	Generated      string         `json:"generated"`
+	AllowedDomains []string       `json:"allowed_domains"`
+	Users          int            `json:"users"`
+	Shares         []ShareSummary `json:"shares"`
+	Access         []Access       `json:"access"`
+	Failures       []sdk.Failure  `json:"failures"`
+}
+
+// Return the users flagged as outside the allowed domains, sorted
+func (r *Report) OutsideUsers() []string {
+	users := map[string]bool{}
+	for _, a := range r.Access {
+		if a.OutsideDomain {
+			users[a.Email] = true
+		}
+	}
+	return sortedKeys(users)
+}
+
+// The ACL of a shared folder as listed by the API
+type shareACL struct {
+	Sid     string
+	Name    string
+	Members []api.SFMember
+	Groups  []api.SFGroupMember
+	Pending []api.SFPendingMember
+
+	// Users for whom the shared folder is external
+	External map[string]bool
+
+	// The groups, or the members of some of them, could not be listed
+	GroupsIncomplete bool
+}
+
+// Enumerate the shared folders of every user and compute who can access them
+func Audit(c *api.Client, opts Options) (*Report, error) {
+	report := Report{Generated: time.Now().UTC().Format(time.RFC3339),
+		AllowedDomains: opts.AllowedDomains, Shares: []ShareSummary{}, Access: []Access{},
+		Failures: []sdk.Failure{}}
+	fail := func(item string, err error) {
+		if opts.Log != nil {
+			opts.Log("%s : %s", item, err)
+		}
+		report.Failures = append(report.Failures, sdk.Failure{Item: item, Error: err.Error()})
+	}
+
+	users, err := sdk.ListAllUsers(c, sdk.DEFAULT_PAGE_SIZE)
+	if err != nil {
+		return nil, err
+	}
+	report.Users = len(users)
+
+	shares := map[string]*shareACL{}
+	sids := []string{}
+	for _, u := range users {
+		sfs, err := sdk.ListSharedFolders(c, u.Email, nil)
+		if err != nil {
+			fail(u.Email, err)
+			continue
+		}
+		for _, sf := range sfs {
+			share, ok := shares[sf.Id]
+			if !ok {
+				share = &shareACL{Sid: sf.Id, Name: sf.Name, Members: sf.Members,
+					Pending: sf.Pending, External: map[string]bool{}}
+				shares[sf.Id] = share
+				sids = append(sids, sf.Id)
+			}
+			if sf.External {
+				share.External[u.Email] = true
+			}
+		}
+	}
+	if opts.Log != nil {
+		opts.Log("%d users, %d shared folders", len(users), len(sids))
+	}
+
+	groupMembers := map[string][]string{}
+	for _, sid := range sids {
+		share := shares[sid]
+		// The direct members and invitations are still reported when the
+		// groups cannot be expanded
+		groups, err := listSFGroups(c, sid)
+		if err != nil {
+			fail(share.Name, err)
+			share.GroupsIncomplete = true
+		}
+		share.Groups = groups
+
+		for _, g := range groups {
+			if _, ok := groupMembers[g.Id]; ok {
+				continue
+			}
+			members, err := sdk.ListGroupMembers(c, g.Id)
+			if err != nil {
+				fail(share.Name+" : "+g.Name, err)
+				share.GroupsIncomplete = true
+				continue
+			}
+			emails := []string{}
+			for _, m := range members {
+				emails = append(emails, m.Email)
+			}
+			groupMembers[g.Id] = emails
+		}
+
+		access := effectiveAccess(share, groupMembers, opts.AllowedDomains)
+		report.Access = append(report.Access, access...)
+		report.Shares = append(report.Shares, summarize(share, access))
+	}
+
+	sort.Slice(report.Shares, func(i, j int) bool {
+		if report.Shares[i].Name != report.Shares[j].Name {
+			return report.Shares[i].Name < report.Shares[j].Name
+		}
+		return report.Shares[i].Sid < report.Shares[j].Sid
+	})
+	sort.SliceStable(report.Access, func(i, j int) bool {
+		a, b := report.Access[i], report.Access[j]
+		if a.Share != b.Share {
+			return a.Share < b.Share
+		}
+		if a.Sid != b.Sid {
+			return a.Sid < b.Sid
+		}
+		return a.Email < b.Email
+	})
+	return &report, nil
+}
+
+func listSFGroups(c *api.Client, sid string) ([]api.SFGroupMember, error) {
+	body, _, err := c.ListSFGroups(sid)
+	if err != nil {
+		return nil, err
+	}
+	groups := []api.SFGroupMember{}
+	err = json.Unmarshal(body, &groups)
+	if err != nil {
+		return nil, errors.New("Unable to unmarshal the list of shared folder groups")
+	}
+	return groups, nil
+}
+
+// Merge the direct and group permissions of every user of a shared folder,
+// group members whose group could not be listed are missing
+func effectiveAccess(share *shareACL, groupMembers map[string][]string, allowed []string) []Access {
+	byEmail := map[string]*Access{}
+	order := []string{}
+	get := func(email string) *Access {
+		key := strings.ToLower(email)
+		a, ok := byEmail[key]
+		if !ok {
+			a = &Access{Sid: share.Sid, Share: share.Name, Email: email,
+				External: share.External[email]}
+			byEmail[key] = a
+			order = append(order, key)
+		}
+		return a
+	}
+
+	for _, m := range share.Members {
+		a := get(m.Email)
+		a.Direct = m.Permissions
+		a.Permissions = a.Permissions.Union(m.Permissions)
+	}
+	for _, g := range share.Groups {
+		for _, email := range groupMembers[g.Id] {
+			a := get(email)
+			a.Groups = append(a.Groups, g.Name)
+			a.Permissions = a.Permissions.Union(g.Permissions)
+		}
+	}
+
+	access := []Access{}
+	for _, key := range order {
+		a := byEmail[key]
+		a.Permissions = a.Permissions.Union(nil)
+		a.Manager = a.Permissions.Contains(api.PermissionManage)
+		a.OutsideDomain = outsideDomains(a.Email, allowed)
+		access = append(access, *a)
+	}
+
+	// Invitees have no access yet, but will once they accept
+	for _, p := range share.Pending {
+		access = append(access, Access{Sid: share.Sid, Share: share.Name, Email: p.Email,
+			Permissions: p.Permissions.Union(nil), Direct: p.Permissions, Pending: true,
+			Manager: p.Permissions.Contains(api.PermissionManage), OutsideDomain: outsideDomains(p.Email, allowed)})
+	}
+	return access
+}
+
+func summarize(share *shareACL, access []Access) ShareSummary {
+	s := ShareSummary{Sid: share.Sid, Name: share.Name, Groups: []string{},
+		Managers: []string{}, Outside: []string{}, GroupsIncomplete: share.GroupsIncomplete}
+	for _, g := range share.Groups {
+		s.Groups = append(s.Groups, g.Name)
+	}
+	for _, a := range access {
+		if a.Pending {
+			s.Pending++
+		} else {
+			s.Members++
+		}
+		if a.Manager && !a.Pending {
+			s.Managers = append(s.Managers, a.Email)
+		}
+		if a.OutsideDomain {
+			s.Outside = append(s.Outside, a.Email)
+		}
+	}
+	sort.Strings(s.Groups)
+	sort.Strings(s.Managers)
+	sort.Strings(s.Outside)
+	return s
+}
+
+// Return whether an email is outside every allowed domain, subdomains of an
+// allowed domain are allowed
+func outsideDomains(email string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return false
+	}
+	at := strings.LastIndex(email, "@")
+	domain := strings.ToLower(email[at+1:])
+	for _, d := range allowed {
+		d = strings.ToLower(strings.TrimPrefix(d, "@"))
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := []string{}
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,166 @@
+package aerofsaudit
+
+import (
+	"bytes"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func testShare() *shareACL {
+	return &shareACL{
+		Sid:  "s1",
+		Name: "Maps",
+		Members: []api.SFMember{
+			{Email: "frodo@shire.org", Permissions: api.PermissionSet{"WRITE", "MANAGE"}},
+			{Email: "sam@shire.org", Permissions: api.PermissionSet{}},
+		},
+		Groups: []api.SFGroupMember{
+			{Id: "g1", Name: "Fellowship", Permissions: api.PermissionSet{"WRITE"}},
+			{Id: "g2", Name: "Wizards", Permissions: api.PermissionSet{"WRITE", "MANAGE"}},
+		},
+		Pending: []api.SFPendingMember{
+			{Email: "gollum@misty.org", Permissions: api.PermissionSet{"WRITE"}},
+		},
+		External: map[string]bool{"sam@shire.org": true},
+	}
+}
+
+func find(access []Access, email string) *Access {
+	for i := range access {
+		if access[i].Email == email {
+			return &access[i]
+		}
+	}
+	return nil
+}
+
+func TestEffectiveAccess(t *testing.T) {
+	groups := map[string][]string{
+		"g1": {"sam@shire.org", "aragorn@gondor.org"},
+		"g2": {"gandalf@istari.org"},
+	}
+	access := effectiveAccess(testShare(), groups, []string{"shire.org", "gondor.org"})
+	if len(access) != 5 {
+		t.Fatalf("Expected 5 entries, got %v", access)
+	}
+
+	cases := []struct {
+		email       string
+		permissions string
+		groups      string
+		manager     bool
+		outside     bool
+		pending     bool
+	}{
+		{"frodo@shire.org", "MANAGE WRITE", "", true, false, false},
+		{"sam@shire.org", "WRITE", "Fellowship", false, false, false},
+		{"aragorn@gondor.org", "WRITE", "Fellowship", false, false, false},
+		{"gandalf@istari.org", "MANAGE WRITE", "Wizards", true, true, false},
+		{"gollum@misty.org", "WRITE", "", false, true, true},
+	}
+	for _, c := range cases {
+		a := find(access, c.email)
+		if a == nil {
+			t.Errorf("%s is missing", c.email)
+			continue
+		}
+		if strings.Join(a.Permissions.Strings(), " ") != c.permissions || strings.Join(a.Groups, " ") != c.groups ||
+			a.Manager != c.manager || a.OutsideDomain != c.outside || a.Pending != c.pending {
+			t.Errorf("Unexpected access %+v for %+v", *a, c)
+		}
+	}
+	if !find(access, "sam@shire.org").External {
+		t.Errorf("sam@shire.org must be external")
+	}
+
+	s := summarize(testShare(), access)
+	if s.Members != 4 || s.Pending != 1 || strings.Join(s.Managers, " ") != "frodo@shire.org gandalf@istari.org" ||
+		len(s.Outside) != 2 {
+		t.Errorf("Unexpected summary %+v", s)
+	}
+}
+
+func TestOutsideDomains(t *testing.T) {
+	allowed := []string{"example.com", "@Example.org"}
+	cases := map[string]bool{
+		"a@example.com":      false,
+		"a@EXAMPLE.ORG":      false,
+		"a@eu.example.com":   false,
+		"a@badexample.com":   true,
+		"a@example.com.evil": true,
+	}
+	for email, expected := range cases {
+		if outsideDomains(email, allowed) != expected {
+			t.Errorf("%s : expected %v", email, expected)
+		}
+	}
+	if outsideDomains("a@anywhere.net", nil) {
+		t.Errorf("Nobody is outside when no domain is allowed")
+	}
+}
+
+func TestOutput(t *testing.T) {
+	access := effectiveAccess(testShare(), map[string][]string{}, []string{"shire.org"})
+	r := Report{Generated: "2015-01-01T00:00:00Z", Users: 2, Access: access,
+		Shares: []ShareSummary{summarize(testShare(), access)}}
+
+	out := bytes.Buffer{}
+	err := r.WriteCSV(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[1], "s1,Maps,frodo@shire.org,MANAGE WRITE,") {
+		t.Errorf("Unexpected CSV\n%s", out.String())
+	}
+
+	out.Reset()
+	err = r.WriteHTML(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "<li>gollum@misty.org</li>") {
+		t.Errorf("The users outside the allowed domains are not listed\n%s", out.String())
+	}
+}
+
+// A shared folder whose groups cannot be listed keeps its direct members and
+// invitations, and is flagged as incomplete
+func TestAuditGroupsUnlisted(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1.3/users":
+			w.Write([]byte(`{"has_more":false,"data":[{"email":"frodo@shire.org"}]}`))
+		case "/api/v1.3/users/frodo@shire.org/shares":
+			w.Write([]byte(`[{"id":"s1","name":"Maps",
+				"members":[{"email":"frodo@shire.org","permissions":["WRITE","MANAGE"]}],
+				"pending":[{"email":"gollum@misty.org","permissions":["WRITE"]}]}]`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+	c, _ := api.NewClient("token", strings.TrimPrefix(ts.URL, "https://"))
+	c.SetHTTPClient(ts.Client())
+
+	report, err := Audit(c, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Failures) != 1 || report.Failures[0].Item != "Maps" {
+		t.Errorf("Unexpected failures %v", report.Failures)
+	}
+	if len(report.Shares) != 1 || !report.Shares[0].GroupsIncomplete ||
+		report.Shares[0].Members != 1 || report.Shares[0].Pending != 1 {
+		t.Fatalf("Unexpected shares %+v", report.Shares)
+	}
+	if a := find(report.Access, "frodo@shire.org"); a == nil || !a.Manager {
+		t.Errorf("The direct member is missing %+v", report.Access)
+	}
+	if a := find(report.Access, "gollum@misty.org"); a == nil || !a.Pending {
+		t.Errorf("The invitation is missing %+v", report.Access)
+	}
+}
@@ -0,0 +1,93 @@
+package aerofsaudit
+
+// CSV, JSON and HTML output of a report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// Write one row per user and shared folder, with a header row
+func (r *Report) WriteCSV(w io.Writer) error {
+	rows := [][]string{{"sid", "share", "email", "permissions", "direct_permissions", "groups",
+		"pending", "external", "manager", "outside_domain"}}
+	for _, a := range r.Access {
+		rows = append(rows, []string{a.Sid, a.Share, a.Email, strings.Join(a.Permissions.Strings(), " "),
+			strings.Join(a.Direct.Strings(), " "), strings.Join(a.Groups, "; "), fmt.Sprint(a.Pending),
+			fmt.Sprint(a.External), fmt.Sprint(a.Manager), fmt.Sprint(a.OutsideDomain)})
+	}
+
+	cw := csv.NewWriter(w)
+	cw.WriteAll(rows)
+	return cw.Error()
+}
+
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{
+	"join": strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>AeroFS access audit {{.Generated}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #eee; }
+.flag { color: #b00; }
+</style>
+</head>
+<body>
+<h1>Access audit</h1>
+<p>Generated {{.Generated}} : {{.Users}} users, {{len .Shares}} shared folders,
+{{len .Access}} memberships and invitations.</p>
+{{if .AllowedDomains}}<p>Allowed domains : {{join .AllowedDomains ", "}}</p>{{end}}
+
+{{with .OutsideUsers}}
+<h2 class="flag">Users outside the allowed domains</h2>
+<ul>{{range .}}<li>{{.}}</li>{{end}}</ul>
+{{end}}
+
+<h2>Shared folders</h2>
+<table>
+<tr><th>Name</th><th>Members</th><th>Pending</th><th>Groups</th><th>Managers</th><th>Outside domains</th></tr>
+{{range .Shares}}<tr>
+<td>{{.Name}}</td><td>{{.Members}}</td><td>{{.Pending}}</td><td>{{join .Groups ", "}}{{if .GroupsIncomplete}} <span class="flag">incomplete</span>{{end}}</td>
+<td>{{join .Managers ", "}}</td><td class="flag">{{join .Outside ", "}}</td>
+</tr>
+{{end}}</table>
+
+<h2>Access</h2>
+<table>
+<tr><th>Shared folder</th><th>User</th><th>Permissions</th><th>Through groups</th><th></th></tr>
+{{range .Access}}<tr>
+<td>{{.Share}}</td><td>{{.Email}}</td><td>{{join .Permissions.Strings " "}}</td><td>{{join .Groups ", "}}</td>
+<td>{{if .Pending}}pending {{end}}{{if .External}}external {{end}}{{if .Manager}}manager {{end}}{{if .OutsideDomain}}<span class="flag">outside domains</span>{{end}}</td>
+</tr>
+{{end}}</table>
+
+{{with .Failures}}
+<h2 class="flag">Incomplete</h2>
+<ul>{{range .}}<li>{{.Item}} : {{.Error}}</li>{{end}}</ul>
+{{end}}
+</body>
+</html>
+`))
+
+// Write a standalone HTML summary of the report
+func (r *Report) WriteHTML(w io.Writer) error {
+	return htmlReport.Execute(w, r)
+}
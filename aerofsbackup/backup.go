@@ -0,0 +1,102 @@
+package aerofsbackup
+
+// Backup of an organization into a repository
+
+import (
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"io"
+)
+
+// Options for Backup
+type BackupOptions struct {
+	// OAuth tokens of the users whose root folders are backed up, by email.
+	// An admin token can read shared folders but not users' root folders
+	UserTokens map[string]string
+
+	// Users and groups are listed in pages of this size,
+	// sdk.DEFAULT_PAGE_SIZE if 0
+	PageSize int
+
+	// Called with progress messages, may be nil
+	Log func(format string, args ...interface{})
+}
+
+type backup struct {
+	repo *Repository
+
+	// The hashes of the previous backup, by file identifier and ETag, so
+	// unchanged files are not downloaded again
+	previous map[string]string
+
+	// Statistics for the log
+	downloaded, reused int
+}
+
+// Back up the users, groups, shared folders with their ACLs and contents,
+// and the root folders of users with a token, using an admin token
+// Contents unchanged since the previous backup in the repository are not
+// downloaded again. Items which fail are recorded in the catalog, an error is
+// only returned if the backup could not proceed
+func Backup(c *api.Client, repo *Repository, opts BackupOptions) (*Catalog, string, error) {
+	b := backup{repo: repo, previous: map[string]string{}}
+	previous, err := repo.LoadCatalog("")
+	if err == nil {
+		b.index(previous)
+	} else if err != ErrNoCatalog {
+		return nil, "", err
+	}
+
+	inventory, err := sdk.Inventory(c, sdk.InventoryOptions{UserTokens: opts.UserTokens,
+		PageSize: opts.PageSize, File: b.file, Log: opts.Log})
+	if err != nil {
+		return nil, "", err
+	}
+
+	if opts.Log != nil {
+		opts.Log("Downloaded %d files, %d unchanged", b.downloaded, b.reused)
+	}
+	catalog := &Catalog{Version: CATALOG_VERSION, Catalog: *inventory}
+	name, err := repo.SaveCatalog(catalog)
+	return catalog, name, err
+}
+
+func fileKey(id, etag string) string {
+	return id + "\x00" + etag
+}
+
+// Index the file contents of a previous catalog
+func (b *backup) index(previous *Catalog) {
+	add := func(files []sdk.FileRecord) {
+		for _, f := range files {
+			if f.Hash != "" && f.Etag != "" && b.repo.HasObject(f.Hash) {
+				b.previous[fileKey(f.Id, f.Etag)] = f.Hash
+			}
+		}
+	}
+	for _, s := range previous.Shares {
+		add(s.Files)
+	}
+	for _, r := range previous.Roots {
+		add(r.Files)
+	}
+}
+
+// Store the content of a file unless the previous backup has it
+func (b *backup) file(f *sdk.FileClient, record *sdk.FileRecord) error {
+	if hash, ok := b.previous[fileKey(record.Id, record.Etag)]; ok {
+		record.Hash = hash
+		b.reused++
+		return nil
+	}
+
+	hash, _, err := b.repo.Store(func(w io.Writer) error {
+		return f.Download(w)
+	})
+	if err != nil {
+		return err
+	}
+	record.Hash = hash
+	b.downloaded++
+	return nil
+}
@@ -0,0 +1,90 @@
+package aerofsbackup
+
+import (
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func newTestRepository(t *testing.T) *Repository {
+	dir, err := ioutil.TempDir("", "aerofsbackup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := OpenRepository(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func store(t *testing.T, repo *Repository, content string) string {
+	hash, size, err := repo.Store(func(w io.Writer) error {
+		_, err := io.Copy(w, strings.NewReader(content))
+		return err
+	})
+	if err != nil || size != int64(len(content)) {
+		t.Fatalf("Unable to store content : %d bytes, %v", size, err)
+	}
+	return hash
+}
+
+func TestStoreDeduplicates(t *testing.T) {
+	repo := newTestRepository(t)
+	defer os.RemoveAll(repo.Dir)
+
+	first := store(t, repo, "Mellon")
+	second := store(t, repo, "Mellon")
+	if first != second || !repo.HasObject(first) {
+		t.Fatalf("Identical content stored as %s and %s", first, second)
+	}
+
+	r, err := repo.Open(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(r)
+	r.Close()
+	if string(data) != "Mellon" {
+		t.Errorf("Unexpected content %q", data)
+	}
+
+	tmp, _ := ioutil.ReadDir(repo.Dir + "/tmp")
+	if len(tmp) != 0 {
+		t.Errorf("Temporary files left behind : %d", len(tmp))
+	}
+}
+
+func TestLatestCatalog(t *testing.T) {
+	repo := newTestRepository(t)
+	defer os.RemoveAll(repo.Dir)
+
+	if _, err := repo.LoadCatalog(""); err != ErrNoCatalog {
+		t.Fatalf("Expected ErrNoCatalog, got %v", err)
+	}
+
+	hash := store(t, repo, "content")
+	for _, created := range []string{"2016-01-02T03:04:05Z", "2016-02-02T03:04:05Z"} {
+		catalog := Catalog{Version: CATALOG_VERSION, Catalog: sdk.Catalog{Created: created,
+			Shares: []sdk.ShareRecord{{Id: "sid", Files: []sdk.FileRecord{
+				{Path: "a.txt", Id: "file", Etag: created, Hash: hash}}}}}}
+		if _, err := repo.SaveCatalog(&catalog); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	latest, err := repo.LoadCatalog("")
+	if err != nil || latest.Created != "2016-02-02T03:04:05Z" {
+		t.Fatalf("Unexpected latest catalog %v, %v", latest, err)
+	}
+
+	// Only the contents of the latest catalog are reused
+	b := backup{repo: repo, previous: map[string]string{}}
+	b.index(latest)
+	if b.previous[fileKey("file", "2016-02-02T03:04:05Z")] != hash || len(b.previous) != 1 {
+		t.Errorf("Unexpected index %v", b.previous)
+	}
+}
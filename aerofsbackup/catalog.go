@@ -0,0 +1,17 @@
+package aerofsbackup
+
+// The metadata catalog written for every backup
+
+import (
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+)
+
+// The catalog format written by this package
+const CATALOG_VERSION = 1
+
+// Everything recorded by one backup
+// File contents are stored separately in the repository, keyed by hash
+type Catalog struct {
+	Version int `json:"version"`
+	sdk.Catalog
+}
@@ -0,0 +1,159 @@
+package aerofsbackup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Returned by LoadCatalog when the repository holds no catalog
+var ErrNoCatalog = errors.New("The repository contains no catalog")
+
+// A backup repository on local disk
+// Contents are stored once under objects/<2 hex>/<SHA-256> whichever file or
+// backup they belong to, each backup adds a catalog under catalogs/
+type Repository struct {
+	Dir string
+}
+
+// Open a repository, creating its layout if needed
+func OpenRepository(dir string) (*Repository, error) {
+	for _, sub := range []string{"objects", "catalogs", "tmp"} {
+		err := os.MkdirAll(filepath.Join(dir, sub), 0700)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &Repository{Dir: dir}, nil
+}
+
+func (r *Repository) objectPath(hash string) string {
+	return filepath.Join(r.Dir, "objects", hash[:2], hash)
+}
+
+// Return whether the repository holds the content with a given hash
+func (r *Repository) HasObject(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := os.Stat(r.objectPath(hash))
+	return err == nil
+}
+
+// Store the content produced by a function, returning its hash and size
+// Content already in the repository is not stored twice
+func (r *Repository) Store(write func(io.Writer) error) (string, int64, error) {
+	tmp, err := ioutil.TempFile(filepath.Join(r.Dir, "tmp"), "object-")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(tmp, h)}
+	err = write(counter)
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	hash := hex.EncodeToString(h.Sum(nil))
+	if r.HasObject(hash) {
+		return hash, counter.n, nil
+	}
+	err = os.MkdirAll(filepath.Dir(r.objectPath(hash)), 0700)
+	if err == nil {
+		err = os.Rename(tmp.Name(), r.objectPath(hash))
+	}
+	return hash, counter.n, err
+}
+
+// Open the content with a given hash
+func (r *Repository) Open(hash string) (io.ReadCloser, error) {
+	if !r.HasObject(hash) {
+		return nil, fmt.Errorf("Object %q is missing from the repository", hash)
+	}
+	return os.Open(r.objectPath(hash))
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Write a catalog, named after its creation time
+func (r *Repository) SaveCatalog(catalog *Catalog) (string, error) {
+	data, err := json.MarshalIndent(catalog, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	name := strings.NewReplacer(":", "", "-", "").Replace(catalog.Created) + ".json"
+	tmp := filepath.Join(r.Dir, "tmp", name)
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return "", err
+	}
+	return name, os.Rename(tmp, filepath.Join(r.Dir, "catalogs", name))
+}
+
+// Return the names of the catalogs, oldest first
+func (r *Repository) Catalogs() ([]string, error) {
+	infos, err := ioutil.ReadDir(filepath.Join(r.Dir, "catalogs"))
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, info := range infos {
+		if strings.HasSuffix(info.Name(), ".json") {
+			names = append(names, info.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Read a catalog, the most recent one if the name is empty
+func (r *Repository) LoadCatalog(name string) (*Catalog, error) {
+	if name == "" {
+		names, err := r.Catalogs()
+		if err != nil {
+			return nil, err
+		}
+		if len(names) == 0 {
+			return nil, ErrNoCatalog
+		}
+		name = names[len(names)-1]
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(r.Dir, "catalogs", filepath.Base(name)))
+	if err != nil {
+		return nil, err
+	}
+	catalog := Catalog{}
+	err = json.Unmarshal(data, &catalog)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to unmarshal catalog %s : %s", name, err)
+	}
+	if catalog.Version > CATALOG_VERSION {
+		return nil, fmt.Errorf("Catalog %s has unsupported version %d", name, catalog.Version)
+	}
+	return &catalog, nil
+}
@@ -0,0 +1,342 @@
+package aerofsbackup
+
+// Recreation of a backup onto an Appliance, possibly not the one backed up
+
+import (
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"path"
+	"strings"
+)
+
+// Options for Restore
+type RestoreOptions struct {
+	// OAuth tokens on the target Appliance of the users whose root folders
+	// are restored, by email
+	UserTokens map[string]string
+
+	// Groups are listed in pages of this size, sdk.DEFAULT_PAGE_SIZE if 0
+	PageSize int
+
+	// Only count what would be restored, without modifying the Appliance
+	DryRun bool
+
+	// Called with progress messages, may be nil
+	Log func(format string, args ...interface{})
+}
+
+// What a restore did, or would do for a dry run
+type RestoreReport struct {
+	UsersCreated    int
+	GroupsCreated   int
+	SharesCreated   int
+	MembersAdded    int
+	InvitationsSent int
+	FilesRestored   int
+
+	// Files which already existed and were left in place
+	FilesSkipped int
+
+	Failures []sdk.Failure
+}
+
+type restore struct {
+	client  *api.Client
+	repo    *Repository
+	opts    RestoreOptions
+	catalog *Catalog
+	report  RestoreReport
+
+	// Identifiers on the target Appliance of the backed up groups and shares
+	groupIds map[string]string
+	shareIds map[string]string
+}
+
+func (r *restore) log(format string, args ...interface{}) {
+	if r.opts.Log != nil {
+		r.opts.Log(format, args...)
+	}
+}
+
+func (r *restore) fail(item string, err error) {
+	r.log("%s : %s", item, err)
+	r.report.Failures = append(r.report.Failures, sdk.Failure{Item: item, Error: err.Error()})
+}
+
+// Recreate the users, groups, shared folders with their ACLs and contents,
+// and the root folders of users with a token, using an admin token
+// Existing users, groups and files are left in place, so a restore can be
+// repeated after a partial failure. Shared folders are reused when the target
+// is the Appliance which was backed up, otherwise they are created as the
+// admin and backed up members are added. Passwords and modification times
+// cannot be restored
+func Restore(c *api.Client, repo *Repository, catalog *Catalog, opts RestoreOptions) (*RestoreReport, error) {
+	if opts.PageSize <= 0 {
+		opts.PageSize = sdk.DEFAULT_PAGE_SIZE
+	}
+	r := restore{client: c, repo: repo, opts: opts, catalog: catalog,
+		groupIds: map[string]string{}, shareIds: map[string]string{},
+		report: RestoreReport{Failures: []sdk.Failure{}}}
+
+	err := r.users()
+	if err != nil {
+		return nil, err
+	}
+	err = r.groups()
+	if err != nil {
+		return nil, err
+	}
+	r.shares()
+	r.roots()
+	return &r.report, nil
+}
+
+func (r *restore) users() error {
+	users, err := sdk.ListAllUsers(r.client, r.opts.PageSize)
+	if err != nil {
+		return err
+	}
+	existing := map[string]bool{}
+	for _, u := range users {
+		existing[u.Email] = true
+	}
+
+	for _, u := range r.catalog.Users {
+		if existing[u.Email] {
+			continue
+		}
+		if !r.opts.DryRun {
+			_, err := sdk.CreateUserClient(r.client, u.Email, u.FirstName, u.LastName)
+			if err != nil {
+				r.fail("user "+u.Email, err)
+				continue
+			}
+		}
+		r.report.UsersCreated++
+	}
+	return nil
+}
+
+// Groups are matched by name, their identifiers differ across Appliances
+func (r *restore) groups() error {
+	groups, err := sdk.ListAllGroups(r.client, r.opts.PageSize)
+	if err != nil {
+		return err
+	}
+	existing := map[string]sdk.Group{}
+	for _, g := range groups {
+		existing[g.Name] = g
+	}
+
+	for _, record := range r.catalog.Groups {
+		g, ok := existing[record.Name]
+		if !ok {
+			r.report.GroupsCreated++
+			if r.opts.DryRun {
+				r.report.MembersAdded += len(record.Members)
+				continue
+			}
+
+			gc, err := sdk.CreateGroupClient(r.client, record.Name)
+			if err != nil {
+				r.fail("group "+record.Name, err)
+				continue
+			}
+			g = gc.Desc
+		}
+		r.groupIds[record.Id] = g.Id
+
+		members := map[string]bool{}
+		for _, m := range g.Members {
+			members[m.Email] = true
+		}
+		for _, email := range record.Members {
+			if members[email] {
+				continue
+			}
+			if !r.opts.DryRun {
+				_, _, err := r.client.AddGroupMember(g.Id, email)
+				if err != nil {
+					r.fail(fmt.Sprintf("group %s: member %s", record.Name, email), err)
+					continue
+				}
+			}
+			r.report.MembersAdded++
+		}
+	}
+	return nil
+}
+
+func (r *restore) shares() {
+	for _, record := range r.catalog.Shares {
+		item := "share " + record.Name
+		sf, err := sdk.GetSharedFolderClient(r.client, record.Id, []string{})
+		if err != nil && !api.IsStatus(err, 404) {
+			r.fail(item, err)
+			continue
+		}
+		if err != nil {
+			r.report.SharesCreated++
+			if r.opts.DryRun {
+				r.report.MembersAdded += len(record.Members) + len(record.Groups)
+				r.report.InvitationsSent += len(record.Pending)
+				r.restoreTree(r.client, "", record.Files, item)
+				continue
+			}
+
+			sf, err = sdk.CreateSharedFolderClient(r.client, record.Name)
+			if err != nil {
+				r.fail(item, err)
+				continue
+			}
+		}
+		r.shareIds[record.Id] = sf.Desc.Id
+		r.log("Restoring shared folder %s", record.Name)
+		r.acl(sf, record)
+		r.restoreTree(r.client, sdk.ShareRootFolderId(sf.Desc.Id), record.Files, item)
+	}
+}
+
+// Add the backed up members, groups and invitations missing from a share
+func (r *restore) acl(sf *sdk.SharedFolderClient, record sdk.ShareRecord) {
+	sid := sf.Desc.Id
+	present := map[string]bool{}
+	for _, m := range sf.Desc.Members {
+		present[strings.ToLower(m.Email)] = true
+	}
+	for _, m := range sf.Desc.Pending {
+		present[strings.ToLower(m.Email)] = true
+	}
+	for _, g := range sf.Desc.Groups {
+		present[g.Id] = true
+	}
+
+	for _, m := range record.Members {
+		if present[strings.ToLower(m.Email)] {
+			continue
+		}
+		if !r.opts.DryRun {
+			_, _, err := r.client.AddSFMember(sid, m.Email, m.Permissions)
+			if err != nil {
+				r.fail(fmt.Sprintf("share %s: member %s", record.Name, m.Email), err)
+				continue
+			}
+		}
+		r.report.MembersAdded++
+	}
+
+	for _, g := range record.Groups {
+		gid, ok := r.groupIds[g.Id]
+		if !ok {
+			r.fail(fmt.Sprintf("share %s: group %s", record.Name, g.Name),
+				fmt.Errorf("The group was not restored"))
+			continue
+		}
+		if present[gid] {
+			continue
+		}
+		if !r.opts.DryRun {
+			_, _, err := r.client.AddGroupToSharedFolder(sid, gid, g.Permissions)
+			if err != nil {
+				r.fail(fmt.Sprintf("share %s: group %s", record.Name, g.Name), err)
+				continue
+			}
+		}
+		r.report.MembersAdded++
+	}
+
+	for _, p := range record.Pending {
+		if present[strings.ToLower(p.Email)] {
+			continue
+		}
+		if !r.opts.DryRun {
+			_, _, err := r.client.InviteSFMember(sid, p.Email, p.Permissions, p.Note)
+			if err != nil {
+				r.fail(fmt.Sprintf("share %s: invitation of %s", record.Name, p.Email), err)
+				continue
+			}
+		}
+		r.report.InvitationsSent++
+	}
+}
+
+// Restore the root folders of the users with a token
+func (r *restore) roots() {
+	for _, record := range r.catalog.Roots {
+		token, ok := r.opts.UserTokens[record.Email]
+		if !ok {
+			continue
+		}
+
+		c, err := api.NewClient(token, r.client.Host)
+		if err != nil {
+			r.fail("root of "+record.Email, err)
+			continue
+		}
+		r.log("Restoring root folder of %s", record.Email)
+		r.restoreTree(c, "root", record.Files, "root of "+record.Email)
+	}
+}
+
+// Recreate the folders and files of a tree, existing files are skipped
+// Records are in walk order so folders precede their contents
+func (r *restore) restoreTree(c *api.Client, rootId string, files []sdk.FileRecord, item string) {
+	root := &sdk.FolderClient{APIClient: c, Desc: sdk.Folder{Id: rootId}}
+	folders := map[string]*sdk.FolderClient{"": root}
+	folder := func(dir string) (*sdk.FolderClient, error) {
+		if f, ok := folders[dir]; ok {
+			return f, nil
+		}
+		f, err := root.MkdirAll(dir)
+		if err == nil {
+			folders[dir] = f
+		}
+		return f, err
+	}
+
+	for _, f := range files {
+		if r.opts.DryRun {
+			if !f.IsDir {
+				r.report.FilesRestored++
+			}
+			continue
+		}
+
+		if f.IsDir {
+			_, err := folder(f.Path)
+			if err != nil {
+				r.fail(fmt.Sprintf("%s: %s", item, f.Path), err)
+			}
+			continue
+		}
+
+		err := r.restoreFile(c, folder, f)
+		switch {
+		case err == sdk.ErrFileExists:
+			r.report.FilesSkipped++
+		case err != nil:
+			r.fail(fmt.Sprintf("%s: %s", item, f.Path), err)
+		default:
+			r.report.FilesRestored++
+		}
+	}
+}
+
+func (r *restore) restoreFile(c *api.Client, folder func(string) (*sdk.FolderClient, error), f sdk.FileRecord) error {
+	dir, name := path.Split(f.Path)
+	parent, err := folder(strings.TrimSuffix(dir, "/"))
+	if err != nil {
+		return err
+	}
+
+	content, err := r.repo.Open(f.Hash)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	_, err = sdk.PutFile(c, parent.Desc.Id, name, content,
+		sdk.PutOptions{Overwrite: sdk.FailIfExists, MimeType: f.Mime})
+	return err
+}
@@ -0,0 +1,165 @@
+package aerofscompliance
+
+import (
+	"bytes"
+	"encoding/json"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// An Appliance with users whose two-factor authentication is enforced or not
+type fakeAppliance struct {
+	mu        sync.Mutex
+	twoFactor map[string]bool
+	disabled  []string
+}
+
+func (f *fakeAppliance) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1.3/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "users":
+		users := []api.User{}
+		for email := range f.twoFactor {
+			users = append(users, api.User{Email: email})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"has_more": false, "data": users})
+	case len(parts) == 3 && parts[2] == "two_factor":
+		enforce, ok := f.twoFactor[parts[1]]
+		if !ok || parts[1] == "broken@shire.org" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(api.TwoFactorStatus{Enforce: enforce})
+	case len(parts) == 3 && parts[2] == "password" && r.Method == "DELETE":
+		f.disabled = append(f.disabled, parts[1])
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func setup(t *testing.T, twoFactor map[string]bool) (*fakeAppliance, *api.Client) {
+	fake := &fakeAppliance{twoFactor: twoFactor}
+	ts := httptest.NewTLSServer(fake)
+	t.Cleanup(ts.Close)
+	c, _ := api.NewClient("token", strings.TrimPrefix(ts.URL, "https://"))
+	c.SetHTTPClient(ts.Client())
+	return fake, c
+}
+
+func TestScan(t *testing.T) {
+	fake, c := setup(t, map[string]bool{
+		"frodo@shire.org":   true,
+		"sam@shire.org":     false,
+		"broken@shire.org":  false,
+		"service@shire.org": false,
+	})
+	report, err := Scan(c, Options{Exclude: []string{"SERVICE@shire.org"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Users) != 3 || report.Users[0].Email != "broken@shire.org" || report.Users[0].TwoFactor != UNKNOWN ||
+		report.Users[0].Error == "" || report.Users[1].TwoFactor != ENFORCED || report.Users[2].TwoFactor != NOT_ENFORCED {
+		t.Fatalf("Unexpected users %+v", report.Users)
+	}
+	if len(report.WithoutTwoFactor()) != 1 || len(report.Changes) != 4 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+
+	// Sam is remediated once, as only new findings are remediated
+	notified := []string{}
+	notify := Remediation{Name: "notify", Apply: func(u UserStatus) error {
+		notified = append(notified, u.Email)
+		return nil
+	}}
+	fake.twoFactor["frodo@shire.org"] = false
+	exclude := []string{"service@shire.org"}
+	opts := Options{Previous: report, OnlyNew: true, Exclude: exclude, Remediations: []Remediation{DisablePasswords(c), notify}}
+	second, err := Scan(c, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(notified, " ") != "frodo@shire.org" || strings.Join(fake.disabled, " ") != "frodo@shire.org" {
+		t.Errorf("Unexpected remediations %v %v", notified, fake.disabled)
+	}
+	kinds := []string{}
+	for _, c := range second.Changes {
+		kinds = append(kinds, c.Email+" "+c.Kind)
+	}
+	expected := "frodo@shire.org two_factor_disabled,frodo@shire.org newly_non_compliant,frodo@shire.org password_disabled"
+	if strings.Join(kinds, ",") != expected {
+		t.Errorf("Expected changes %s, got %s", expected, strings.Join(kinds, ","))
+	}
+
+	// Password login stays known to be disabled in later scans
+	delete(fake.twoFactor, "sam@shire.org")
+	opts = Options{Previous: second, DryRun: true, Exclude: exclude, Remediations: []Remediation{notify}}
+	third, err := Scan(c, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(third.PasswordDisabled()) != 1 || len(notified) != 1 || len(third.Remediations) != 1 ||
+		!third.Remediations[0].DryRun {
+		t.Errorf("Unexpected report %+v", third)
+	}
+	if last := third.Changes[len(third.Changes)-1]; last.Kind != REMOVED_USER || last.Email != "sam@shire.org" {
+		t.Errorf("Unexpected changes %+v", third.Changes)
+	}
+}
+
+func TestOutput(t *testing.T) {
+	report := &Report{Scanned: "2026-01-01T00:00:00Z",
+		Users: []UserStatus{
+			{Email: "frodo@shire.org", FirstName: "Frodo", TwoFactor: NOT_ENFORCED, PasswordDisabled: true},
+			{Email: "sam@shire.org", TwoFactor: ENFORCED},
+		},
+		Changes: []Change{{Email: "frodo@shire.org", Kind: NEWLY_NON_COMPLIANT},
+			{Email: "frodo@shire.org", Kind: PASSWORD_DISABLED}, {Email: "gollum@misty.org", Kind: REMOVED_USER}},
+		Remediations: []RemediationResult{{Email: "frodo@shire.org", Remediation: "disable_password"},
+			{Email: "frodo@shire.org", Remediation: "notify", Error: "unreachable"}},
+	}
+
+	out := bytes.Buffer{}
+	if err := WriteCSV(&out, report); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"frodo@shire.org,Frodo,,not_enforced,true,newly_non_compliant;password_disabled,disable_password;notify (failed),\n",
+		"sam@shire.org,,,enforced,false,,,\n",
+		"gollum@misty.org,,,,,removed_user,,\n",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Expected %q in\n%s", line, out.String())
+		}
+	}
+
+	out.Reset()
+	if err := WriteJSON(&out, report); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadReport(&out)
+	if err != nil || len(read.Users) != 2 || !read.Users[0].PasswordDisabled {
+		t.Errorf("Unexpected report %+v : %v", read, err)
+	}
+	if !strings.Contains(report.Summary(), "2 users : 1 with two-factor, 1 without") {
+		t.Errorf("Unexpected summary %s", report.Summary())
+	}
+}
+
+func TestCommand(t *testing.T) {
+	err := Command("sh", "-c", `test "$AEROFS_EMAIL" = frodo@shire.org && grep -q not_enforced`).Apply(
+		UserStatus{Email: "frodo@shire.org", TwoFactor: NOT_ENFORCED})
+	if err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+	err = Command("sh", "-c", "echo nope; exit 3").Apply(UserStatus{Email: "sam@shire.org"})
+	if err == nil || !strings.Contains(err.Error(), "nope") {
+		t.Errorf("Expected the output of the failed command, got %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package aerofscompliance
+
+// Writing and reading scan reports
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+func WriteJSON(w io.Writer, report *Report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// Read a report written by WriteJSON, ie. the previous scan
+func ReadReport(r io.Reader) (*Report, error) {
+	report := Report{}
+	err := json.NewDecoder(r).Decode(&report)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to unmarshal the report : %s", err)
+	}
+	return &report, nil
+}
+
+// Write a row by user, with its changes and remediations separated by ";"
+func WriteCSV(w io.Writer, report *Report) error {
+	changes := map[string][]string{}
+	for _, c := range report.Changes {
+		changes[c.Email] = append(changes[c.Email], c.Kind)
+	}
+	remediations := map[string][]string{}
+	for _, r := range report.Remediations {
+		entry := r.Remediation
+		if r.Error != "" {
+			entry += " (failed)"
+		} else if r.DryRun {
+			entry += " (dry run)"
+		}
+		remediations[r.Email] = append(remediations[r.Email], entry)
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"email", "first_name", "last_name", "two_factor", "password_disabled",
+		"changes", "remediations", "error"})
+	for _, u := range report.Users {
+		cw.Write([]string{u.Email, u.FirstName, u.LastName, u.TwoFactor,
+			strconv.FormatBool(u.PasswordDisabled), strings.Join(changes[u.Email], ";"),
+			strings.Join(remediations[u.Email], ";"), u.Error})
+	}
+	// Removed users have no status left
+	for _, c := range report.Changes {
+		if c.Kind == REMOVED_USER {
+			cw.Write([]string{c.Email, "", "", "", "", REMOVED_USER, "", ""})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,53 @@
+package aerofscompliance
+
+// Remediations run against the users lacking two-factor authentication
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// A remediation hook
+type Remediation struct {
+	Name  string
+	Apply func(u UserStatus) error
+
+	// Whether a successful remediation disables the password login of the
+	// user, which is then recorded in the report
+	DisablesPassword bool
+}
+
+// Disable the password login of the user, so they can only sign in through
+// an identity provider
+func DisablePasswords(c *api.Client) Remediation {
+	return Remediation{Name: "disable_password", DisablesPassword: true,
+		Apply: func(u UserStatus) error {
+			if u.PasswordDisabled {
+				return nil
+			}
+			return c.DisablePassword(u.Email)
+		}}
+}
+
+// Run a command for the user, ie. to notify them or open a ticket
+// The status of the user is written to the standard input of the command as
+// JSON, and its email is in the AEROFS_EMAIL environment variable
+func Command(name string, args ...string) Remediation {
+	return Remediation{Name: "command " + name,
+		Apply: func(u UserStatus) error {
+			data, _ := json.Marshal(u)
+			cmd := exec.Command(name, args...)
+			cmd.Env = append(os.Environ(), "AEROFS_EMAIL="+u.Email)
+			cmd.Stdin = bytes.NewReader(data)
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				return fmt.Errorf("%s : %s", err, strings.TrimSpace(string(out)))
+			}
+			return nil
+		}}
+}
@@ -0,0 +1,296 @@
+package aerofscompliance
+
+// Scanning the two-factor authentication and password login of every user,
+// and what changed since the previous scan
+// The API cannot read whether password login is disabled, so it is only
+// known for users whose password a remediation disabled, during this scan or
+// an earlier one
+
+import (
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DEFAULT_CONCURRENCY = 4
+
+// Two-factor authentication statuses
+const (
+	ENFORCED     = "enforced"
+	NOT_ENFORCED = "not_enforced"
+	UNKNOWN      = "unknown"
+)
+
+// Kinds of changes since the previous scan
+const (
+	NEW_USER            = "new_user"
+	REMOVED_USER        = "removed_user"
+	TWO_FACTOR_ENABLED  = "two_factor_enabled"
+	TWO_FACTOR_DISABLED = "two_factor_disabled"
+	PASSWORD_DISABLED   = "password_disabled"
+	NEWLY_NON_COMPLIANT = "newly_non_compliant"
+	COMPLIANT_AGAIN     = "compliant_again"
+)
+
+// Options for Scan
+type Options struct {
+	// The report of the previous scan, nil for a first scan
+	Previous *Report
+
+	// Users left out of the scan, ie. service accounts, by email
+	Exclude []string
+
+	// Run against users lacking two-factor authentication, in order
+	Remediations []Remediation
+
+	// Only remediate users who were compliant, or unknown, in the previous scan
+	OnlyNew bool
+
+	// Record remediations without running them
+	DryRun bool
+
+	// The number of users checked at once, DEFAULT_CONCURRENCY if 0
+	Concurrency int
+
+	// Called with progress messages, may be nil
+	Log func(format string, args ...interface{})
+}
+
+// The status of a user
+type UserStatus struct {
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+
+	// ENFORCED, NOT_ENFORCED or UNKNOWN if it could not be checked
+	TwoFactor string `json:"two_factor"`
+
+	// Whether password login is known to be disabled
+	PasswordDisabled bool `json:"password_disabled"`
+
+	// Why the status could not be checked
+	Error string `json:"error,omitempty"`
+}
+
+// Whether the user lacks two-factor authentication
+func (u UserStatus) NonCompliant() bool {
+	return u.TwoFactor == NOT_ENFORCED
+}
+
+// A change since the previous scan
+type Change struct {
+	Email string `json:"email"`
+	Kind  string `json:"kind"`
+}
+
+// The outcome of a remediation for a user
+type RemediationResult struct {
+	Email       string `json:"email"`
+	Remediation string `json:"remediation"`
+	DryRun      bool   `json:"dry_run,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// The outcome of a scan, users are sorted by email
+type Report struct {
+	Scanned      string              `json:"scanned"`
+	Previous     string              `json:"previous,omitempty"`
+	Users        []UserStatus        `json:"users"`
+	Changes      []Change            `json:"changes"`
+	Remediations []RemediationResult `json:"remediations"`
+}
+
+// Return the users lacking two-factor authentication
+func (r *Report) WithoutTwoFactor() []UserStatus {
+	users := []UserStatus{}
+	for _, u := range r.Users {
+		if u.NonCompliant() {
+			users = append(users, u)
+		}
+	}
+	return users
+}
+
+// Return the users whose password login is known to be disabled
+func (r *Report) PasswordDisabled() []UserStatus {
+	users := []UserStatus{}
+	for _, u := range r.Users {
+		if u.PasswordDisabled {
+			users = append(users, u)
+		}
+	}
+	return users
+}
+
+// Return the number of users by two-factor status
+func (r *Report) Counts() map[string]int {
+	counts := map[string]int{ENFORCED: 0, NOT_ENFORCED: 0, UNKNOWN: 0}
+	for _, u := range r.Users {
+		counts[u.TwoFactor]++
+	}
+	return counts
+}
+
+// Check every user, compare with the previous scan and remediate the users
+// lacking two-factor authentication
+func Scan(c *api.Client, opts Options) (*Report, error) {
+	users, err := sdk.ListAllUsers(c, sdk.DEFAULT_PAGE_SIZE)
+	if err != nil {
+		return nil, err
+	}
+	excluded := map[string]bool{}
+	for _, email := range opts.Exclude {
+		excluded[strings.ToLower(email)] = true
+	}
+	statuses := []UserStatus{}
+	for _, u := range users {
+		if !excluded[strings.ToLower(u.Email)] {
+			statuses = append(statuses, UserStatus{Email: u.Email, FirstName: u.FirstName, LastName: u.LastName})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Email < statuses[j].Email })
+
+	check(c, statuses, opts)
+	previous := map[string]UserStatus{}
+	if opts.Previous != nil {
+		for _, u := range opts.Previous.Users {
+			previous[u.Email] = u
+		}
+	}
+	for i := range statuses {
+		statuses[i].PasswordDisabled = previous[statuses[i].Email].PasswordDisabled
+	}
+
+	report := Report{Scanned: time.Now().UTC().Format(time.RFC3339), Users: statuses,
+		Remediations: []RemediationResult{}}
+	if opts.Previous != nil {
+		report.Previous = opts.Previous.Scanned
+	}
+	remediate(&report, previous, opts)
+	report.Changes = Diff(opts.Previous, &report)
+	return &report, nil
+}
+
+// Check the two-factor authentication of users concurrently
+func check(c *api.Client, statuses []UserStatus, opts Options) {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DEFAULT_CONCURRENCY
+	}
+	indexes := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				u := &statuses[i]
+				status, err := c.CheckTwoFactorAuth(u.Email)
+				switch {
+				case err != nil:
+					u.TwoFactor, u.Error = UNKNOWN, err.Error()
+					if opts.Log != nil {
+						opts.Log("%s : %s", u.Email, err)
+					}
+				case status.Enforce:
+					u.TwoFactor = ENFORCED
+				default:
+					u.TwoFactor = NOT_ENFORCED
+				}
+			}
+		}()
+	}
+	for i := range statuses {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+// Run the remediations against the users lacking two-factor authentication
+func remediate(report *Report, previous map[string]UserStatus, opts Options) {
+	for i := range report.Users {
+		u := &report.Users[i]
+		if !u.NonCompliant() {
+			continue
+		}
+		if before, ok := previous[u.Email]; opts.OnlyNew && ok && before.NonCompliant() {
+			continue
+		}
+		for _, r := range opts.Remediations {
+			result := RemediationResult{Email: u.Email, Remediation: r.Name, DryRun: opts.DryRun}
+			if !opts.DryRun {
+				err := r.Apply(*u)
+				if err != nil {
+					result.Error = err.Error()
+				} else if r.DisablesPassword {
+					u.PasswordDisabled = true
+				}
+			}
+			if opts.Log != nil && result.Error != "" {
+				opts.Log("%s : %s failed : %s", u.Email, r.Name, result.Error)
+			} else if opts.Log != nil {
+				opts.Log("%s : %s", u.Email, r.Name)
+			}
+			report.Remediations = append(report.Remediations, result)
+		}
+	}
+}
+
+// Return what changed between two scans, by email
+// Every user is new if there is no previous scan
+func Diff(previous, current *Report) []Change {
+	changes := []Change{}
+	before := map[string]UserStatus{}
+	if previous != nil {
+		for _, u := range previous.Users {
+			before[u.Email] = u
+		}
+	}
+	for _, u := range current.Users {
+		old, ok := before[u.Email]
+		delete(before, u.Email)
+		if !ok {
+			changes = append(changes, Change{Email: u.Email, Kind: NEW_USER})
+			if u.NonCompliant() {
+				changes = append(changes, Change{Email: u.Email, Kind: NEWLY_NON_COMPLIANT})
+			}
+			continue
+		}
+		switch {
+		case old.TwoFactor != ENFORCED && u.TwoFactor == ENFORCED:
+			changes = append(changes, Change{Email: u.Email, Kind: TWO_FACTOR_ENABLED})
+		case old.TwoFactor == ENFORCED && u.TwoFactor == NOT_ENFORCED:
+			changes = append(changes, Change{Email: u.Email, Kind: TWO_FACTOR_DISABLED})
+		}
+		switch {
+		case !old.NonCompliant() && u.NonCompliant():
+			changes = append(changes, Change{Email: u.Email, Kind: NEWLY_NON_COMPLIANT})
+		case old.NonCompliant() && u.TwoFactor == ENFORCED:
+			changes = append(changes, Change{Email: u.Email, Kind: COMPLIANT_AGAIN})
+		}
+		if !old.PasswordDisabled && u.PasswordDisabled {
+			changes = append(changes, Change{Email: u.Email, Kind: PASSWORD_DISABLED})
+		}
+	}
+	removed := []string{}
+	for email := range before {
+		removed = append(removed, email)
+	}
+	sort.Strings(removed)
+	for _, email := range removed {
+		changes = append(changes, Change{Email: email, Kind: REMOVED_USER})
+	}
+	return changes
+}
+
+// Return a one line summary of a report
+func (r *Report) Summary() string {
+	counts := r.Counts()
+	return fmt.Sprintf("%d users : %d with two-factor, %d without, %d unknown, %d without password login, %d changes",
+		len(r.Users), counts[ENFORCED], counts[NOT_ENFORCED], counts[UNKNOWN], len(r.PasswordDisabled()), len(r.Changes))
+}
@@ -0,0 +1,85 @@
+package aerofsdedup
+
+// A local cache of content hashes, so unchanged files are not downloaded again
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// SHA-256 hashes of file contents keyed by file ID and ETag, a new ETag
+// means new content so stale entries are never returned
+type HashCache struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]string
+}
+
+// Open the cache stored in a file, which is created by Save if missing
+// The cache is only kept in memory if the path is empty
+func OpenHashCache(path string) (*HashCache, error) {
+	cache := HashCache{path: path, entries: map[string]string{}}
+	if path == "" {
+		return &cache, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &cache, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &cache.entries)
+	if err != nil {
+		return nil, err
+	}
+	return &cache, nil
+}
+
+func cacheKey(id, etag string) string {
+	return id + "\x00" + etag
+}
+
+// Return the hash of a file with the given ETag, if known
+func (c *HashCache) Get(id, etag string) (string, bool) {
+	if etag == "" {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	hash, ok := c.entries[cacheKey(id, etag)]
+	return hash, ok
+}
+
+func (c *HashCache) Put(id, etag, hash string) {
+	if etag == "" {
+		return
+	}
+	c.mu.Lock()
+	c.entries[cacheKey(id, etag)] = hash
+	c.mu.Unlock()
+}
+
+// Write the cache to its file through a temporary file
+func (c *HashCache) Save() error {
+	if c.path == "" {
+		return nil
+	}
+
+	c.mu.Lock()
+	data, err := json.Marshal(c.entries)
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := c.path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
@@ -0,0 +1,265 @@
+package aerofsdedup
+
+// Detection of files with identical contents across AeroFS folder trees
+// Files are grouped by size first, only files sharing their size with another
+// file are downloaded and hashed
+
+import (
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"io/ioutil"
+	"sort"
+	"sync"
+)
+
+const DEFAULT_CONCURRENCY = 4
+
+// A folder tree and the client able to read it
+type Tree struct {
+	Name   string
+	Client *api.Client
+
+	// The users the tree belongs to, reported alongside duplicates
+	Owners []string
+	Files  []sdk.FileRecord
+}
+
+// Options for Find
+type Options struct {
+	// Files smaller than this are ignored, 1 if 0 so empty files are ignored
+	MinSize int
+
+	// The number of files hashed at once, DEFAULT_CONCURRENCY if 0
+	Concurrency int
+
+	// Called with progress messages, may be nil
+	Log func(format string, args ...interface{})
+}
+
+// A file with the same content as others
+type Duplicate struct {
+	Tree         string   `json:"tree"`
+	Path         string   `json:"path"`
+	Id           string   `json:"id"`
+	Owners       []string `json:"owners"`
+	LastModified string   `json:"last_modified"`
+}
+
+// Files with identical contents
+type DuplicateSet struct {
+	Hash  string      `json:"sha256"`
+	Size  int         `json:"size"`
+	Files []Duplicate `json:"files"`
+
+	// The bytes freed by keeping a single copy
+	Reclaimable int64 `json:"reclaimable"`
+}
+
+// The result of Find, sets are sorted by decreasing reclaimable bytes
+type Report struct {
+	Sets        []DuplicateSet `json:"sets"`
+	Reclaimable int64          `json:"reclaimable"`
+
+	// Files compared, downloaded and found in the hash cache
+	Files  int `json:"files"`
+	Hashed int `json:"hashed"`
+	Cached int `json:"cached"`
+
+	Failures []sdk.Failure `json:"failures"`
+}
+
+// A file considered for duplicates
+type candidate struct {
+	tree   *Tree
+	record sdk.FileRecord
+	hash   string
+}
+
+// Return the files of a tree walked from a folder
+// Folders which cannot be listed are returned as failures
+func WalkTree(c *api.Client, folderId, name string, owners []string) (Tree, []sdk.Failure) {
+	tree := Tree{Name: name, Client: c, Owners: owners, Files: []sdk.FileRecord{}}
+	failures := []sdk.Failure{}
+	root := sdk.FolderClient{APIClient: c, Desc: sdk.Folder{Id: folderId}}
+	err := root.Walk(func(entry sdk.TreeEntry, err error) error {
+		switch {
+		case err != nil:
+			failures = append(failures, sdk.Failure{Item: name + ": " + entry.Path, Error: err.Error()})
+		case !entry.IsDir:
+			tree.Files = append(tree.Files, sdk.FileRecord{Path: entry.Path, Id: entry.File.Id,
+				Etag: entry.File.Etag, Size: entry.File.Size, LastModified: entry.File.LastModified,
+				Mime: entry.File.Mime})
+		}
+		return nil
+	})
+	if err != nil {
+		failures = append(failures, sdk.Failure{Item: name, Error: err.Error()})
+	}
+	return tree, failures
+}
+
+// Return the trees of a catalog from an inventory or a backup, shares are read
+// with the admin client and root folders with the tokens of their users
+func CatalogTrees(c *api.Client, catalog *sdk.Catalog, userTokens map[string]string) []Tree {
+	trees := []Tree{}
+	for _, s := range catalog.Shares {
+		owners := []string{}
+		for _, m := range s.Members {
+			owners = append(owners, m.Email)
+		}
+		trees = append(trees, Tree{Name: "share:" + s.Name, Client: c, Owners: owners, Files: s.Files})
+	}
+	for _, r := range catalog.Roots {
+		token, ok := userTokens[r.Email]
+		if !ok {
+			continue
+		}
+		uc, _ := api.NewClient(token, c.Host)
+		trees = append(trees, Tree{Name: "root:" + r.Email, Client: uc,
+			Owners: []string{r.Email}, Files: r.Files})
+	}
+	return trees
+}
+
+// Find the files with identical contents across trees
+// Hashes are read from the cache when the ETag of a file is unchanged, the
+// cache is updated with the files hashed but not saved
+func Find(trees []Tree, cache *HashCache, opts Options) *Report {
+	if opts.MinSize <= 0 {
+		opts.MinSize = 1
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DEFAULT_CONCURRENCY
+	}
+	report := Report{Sets: []DuplicateSet{}, Failures: []sdk.Failure{}}
+
+	// A file reachable from several trees is only considered once
+	seen := map[string]bool{}
+	bySize := map[int][]*candidate{}
+	for i := range trees {
+		for _, f := range trees[i].Files {
+			if f.IsDir || f.Size < opts.MinSize || seen[f.Id] {
+				continue
+			}
+			seen[f.Id] = true
+			report.Files++
+			bySize[f.Size] = append(bySize[f.Size], &candidate{tree: &trees[i], record: f})
+		}
+	}
+
+	pending := []*candidate{}
+	for _, group := range bySize {
+		if len(group) < 2 {
+			continue
+		}
+		for _, c := range group {
+			if hash, ok := cache.Get(c.record.Id, c.record.Etag); ok {
+				c.hash = hash
+				report.Cached++
+				continue
+			}
+			pending = append(pending, c)
+		}
+	}
+
+	hashAll(pending, cache, opts, &report)
+
+	byHash := map[string][]*candidate{}
+	for _, group := range bySize {
+		for _, c := range group {
+			if c.hash != "" {
+				byHash[c.hash] = append(byHash[c.hash], c)
+			}
+		}
+	}
+
+	for hash, group := range byHash {
+		if len(group) < 2 {
+			continue
+		}
+		set := DuplicateSet{Hash: hash, Size: group[0].record.Size, Files: []Duplicate{},
+			Reclaimable: int64(group[0].record.Size) * int64(len(group)-1)}
+		for _, c := range group {
+			set.Files = append(set.Files, Duplicate{Tree: c.tree.Name, Path: c.record.Path,
+				Id: c.record.Id, Owners: c.tree.Owners, LastModified: c.record.LastModified})
+		}
+		sort.Slice(set.Files, func(i, j int) bool {
+			if set.Files[i].Tree != set.Files[j].Tree {
+				return set.Files[i].Tree < set.Files[j].Tree
+			}
+			return set.Files[i].Path < set.Files[j].Path
+		})
+		report.Sets = append(report.Sets, set)
+		report.Reclaimable += set.Reclaimable
+	}
+	sort.Slice(report.Sets, func(i, j int) bool {
+		if report.Sets[i].Reclaimable != report.Sets[j].Reclaimable {
+			return report.Sets[i].Reclaimable > report.Sets[j].Reclaimable
+		}
+		return report.Sets[i].Hash < report.Sets[j].Hash
+	})
+	return &report
+}
+
+// Hash the contents of files with concurrent ranged downloads
+func hashAll(pending []*candidate, cache *HashCache, opts Options, report *Report) {
+	mu := sync.Mutex{}
+	candidates := make(chan *candidate)
+	wg := sync.WaitGroup{}
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range candidates {
+				cached, err := hashFile(c, cache)
+
+				mu.Lock()
+				switch {
+				case err != nil:
+					item := fmt.Sprintf("%s: %s", c.tree.Name, c.record.Path)
+					if opts.Log != nil {
+						opts.Log("%s : %s", item, err)
+					}
+					report.Failures = append(report.Failures, sdk.Failure{Item: item, Error: err.Error()})
+				case cached:
+					report.Cached++
+				default:
+					report.Hashed++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, c := range pending {
+		candidates <- c
+	}
+	close(candidates)
+	wg.Wait()
+}
+
+// Set the hash of a candidate, from the cache if its ETag was missing from the
+// listing and is found to be unchanged
+func hashFile(c *candidate, cache *HashCache) (bool, error) {
+	f := sdk.FileClient{APIClient: c.tree.Client, Desc: sdk.File{Id: c.record.Id,
+		Etag: c.record.Etag, Size: c.record.Size}}
+	if f.Desc.Etag == "" {
+		err := f.LoadMetadata()
+		if err != nil {
+			return false, err
+		}
+		if hash, ok := cache.Get(f.Desc.Id, f.Desc.Etag); ok {
+			c.hash = hash
+			return true, nil
+		}
+	}
+
+	digest, err := f.DownloadVerified(ioutil.Discard, sdk.VerifyOptions{})
+	if err != nil {
+		return false, err
+	}
+	c.hash = digest.SHA256
+	cache.Put(f.Desc.Id, f.Desc.Etag, c.hash)
+	return false, nil
+}
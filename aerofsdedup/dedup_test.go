@@ -0,0 +1,124 @@
+package aerofsdedup
+
+import (
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Trees with a nil client, so a download attempt panics
+func testTrees() []Tree {
+	return []Tree{
+		{Name: "share:Maps", Owners: []string{"frodo@shire.me"}, Files: []sdk.FileRecord{
+			{Path: "Mordor", IsDir: true, Id: "d1"},
+			{Path: "Mordor/route.png", Id: "f1", Etag: "e1", Size: 3000},
+			{Path: "gate.txt", Id: "f2", Etag: "e2", Size: 100},
+			{Path: "unique.txt", Id: "f3", Etag: "e3", Size: 77},
+			{Path: "empty.txt", Id: "f4", Etag: "e4", Size: 0},
+		}},
+		{Name: "root:sam@shire.me", Owners: []string{"sam@shire.me"}, Files: []sdk.FileRecord{
+			{Path: "route copy.png", Id: "f5", Etag: "e5", Size: 3000},
+			{Path: "backup/route.png", Id: "f6", Etag: "e6", Size: 3000},
+			{Path: "other.txt", Id: "f7", Etag: "e7", Size: 100},
+			{Path: "empty.txt", Id: "f8", Etag: "e8", Size: 0},
+		}},
+	}
+}
+
+func testCache() *HashCache {
+	cache, _ := OpenHashCache("")
+	cache.Put("f1", "e1", "aaaa")
+	cache.Put("f5", "e5", "aaaa")
+	cache.Put("f6", "e6", "aaaa")
+	cache.Put("f2", "e2", "bbbb")
+	cache.Put("f7", "e7", "cccc")
+	return cache
+}
+
+func TestFind(t *testing.T) {
+	report := Find(testTrees(), testCache(), Options{})
+
+	if report.Files != 6 || report.Cached != 5 || report.Hashed != 0 {
+		t.Errorf("Unexpected counts %+v", report)
+	}
+	if len(report.Sets) != 1 {
+		t.Fatalf("Expected one set of duplicates, got %+v", report.Sets)
+	}
+
+	set := report.Sets[0]
+	if set.Hash != "aaaa" || set.Size != 3000 || set.Reclaimable != 6000 || report.Reclaimable != 6000 {
+		t.Errorf("Unexpected set %+v", set)
+	}
+	expected := []string{"root:sam@shire.me/backup/route.png", "root:sam@shire.me/route copy.png",
+		"share:Maps/Mordor/route.png"}
+	for i, f := range set.Files {
+		if f.Tree+"/"+f.Path != expected[i] {
+			t.Errorf("Expected %s, got %s/%s", expected[i], f.Tree, f.Path)
+		}
+	}
+	if set.Files[2].Owners[0] != "frodo@shire.me" {
+		t.Errorf("Expected the owners of the tree, got %v", set.Files[2].Owners)
+	}
+}
+
+func TestFindEmptyFiles(t *testing.T) {
+	cache := testCache()
+	cache.Put("f4", "e4", "empty")
+	cache.Put("f8", "e8", "empty")
+
+	report := Find(testTrees(), cache, Options{})
+	if len(report.Sets) != 1 {
+		t.Errorf("Empty files must be ignored by default")
+	}
+
+	report = Find(testTrees(), cache, Options{MinSize: -1})
+	if len(report.Sets) != 1 {
+		t.Errorf("A negative minimum size must not include empty files")
+	}
+}
+
+func TestFindSameFileTwice(t *testing.T) {
+	trees := testTrees()
+	trees = append(trees, Tree{Name: "root:frodo@shire.me", Files: trees[0].Files})
+
+	report := Find(trees, testCache(), Options{})
+	if len(report.Sets) != 1 || len(report.Sets[0].Files) != 3 {
+		t.Errorf("A file reachable from two trees is not a duplicate : %+v", report.Sets)
+	}
+}
+
+func TestHashCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aerofsdedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "hashes.json")
+
+	cache, err := OpenHashCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.Put("f1", "e1", "aaaa")
+	cache.Put("f2", "", "bbbb")
+	err = cache.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := OpenHashCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash, ok := loaded.Get("f1", "e1"); !ok || hash != "aaaa" {
+		t.Errorf("Expected the saved hash, got %q", hash)
+	}
+	if _, ok := loaded.Get("f1", "e2"); ok {
+		t.Errorf("A hash must not be returned for another ETag")
+	}
+	if _, ok := loaded.Get("f2", ""); ok {
+		t.Errorf("A hash must not be cached without an ETag")
+	}
+}
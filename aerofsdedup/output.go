@@ -0,0 +1,37 @@
+package aerofsdedup
+
+// Text and JSON output of a report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// Write each set of duplicates followed by a summary
+func (r *Report) WriteText(w io.Writer) error {
+	for _, set := range r.Sets {
+		fmt.Fprintf(w, "%d copies of %d bytes, %d reclaimable (sha256 %s)\n",
+			len(set.Files), set.Size, set.Reclaimable, set.Hash)
+		for _, f := range set.Files {
+			fmt.Fprintf(w, "  %s/%s  [%s]\n", f.Tree, f.Path, strings.Join(f.Owners, ", "))
+		}
+	}
+	for _, f := range r.Failures {
+		fmt.Fprintf(w, "unable to hash %s : %s\n", f.Item, f.Error)
+	}
+	_, err := fmt.Fprintf(w, "%d sets of duplicates, %d bytes reclaimable : %d files, "+
+		"%d hashed, %d from the cache, %d failures\n", len(r.Sets), r.Reclaimable,
+		r.Files, r.Hashed, r.Cached, len(r.Failures))
+	return err
+}
@@ -0,0 +1,95 @@
+package aerofsgroupsync
+
+// Applying a plan
+
+import (
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"net/http"
+)
+
+// Options for Apply
+type ApplyOptions struct {
+	// The share of current members a plan may remove, in percent,
+	// DEFAULT_MAX_REMOVE_PERCENT if zero. 100 lifts the limit
+	MaxRemovePercent float64
+
+	// Called with progress messages, may be nil
+	Log func(format string, args ...interface{})
+}
+
+// What applying a plan did
+type Report struct {
+	Applied  []Change      `json:"applied"`
+	Failures []sdk.Failure `json:"failures"`
+}
+
+// Apply the changes of a plan, nothing is applied if the plan removes more
+// members than allowed
+// Adding a member who already is one, or removing one who no longer is, is
+// not a failure
+func Apply(c *api.Client, plan *Plan, opts ApplyOptions) (*Report, error) {
+	limit := opts.MaxRemovePercent
+	if limit == 0 {
+		limit = DEFAULT_MAX_REMOVE_PERCENT
+	}
+	if err := plan.CheckLimit(limit); err != nil {
+		return nil, err
+	}
+
+	report := Report{Applied: []Change{}, Failures: []sdk.Failure{}}
+	log := func(format string, args ...interface{}) {
+		if opts.Log != nil {
+			opts.Log(format, args...)
+		}
+	}
+
+	// The identifiers of the groups created, empty for those which could not be
+	created := map[string]string{}
+	for _, change := range plan.Changes {
+		if change.GroupId == "" && change.Action != CREATE_GROUP {
+			id, ok := created[change.Group]
+			if !ok || id == "" {
+				report.Failures = append(report.Failures, sdk.Failure{Item: change.String(),
+					Error: "The group could not be created"})
+				continue
+			}
+			change.GroupId = id
+		}
+
+		var err error
+		switch change.Action {
+		case CREATE_GROUP:
+			var g *sdk.GroupClient
+			g, err = sdk.CreateGroupClient(c, change.Group)
+			created[change.Group] = ""
+			if err == nil {
+				created[change.Group] = g.Desc.Id
+				change.GroupId = g.Desc.Id
+			}
+		case ADD_MEMBER:
+			_, _, err = c.AddGroupMember(change.GroupId, change.Email)
+			if api.IsStatus(err, http.StatusConflict) {
+				err = nil
+			}
+		case REMOVE_MEMBER:
+			err = c.RemoveMember(change.GroupId, change.Email)
+			if api.IsStatus(err, http.StatusNotFound) {
+				err = nil
+			}
+		case DELETE_GROUP:
+			err = c.DeleteGroup(change.GroupId)
+		default:
+			err = fmt.Errorf("Unknown action %s", change.Action)
+		}
+		if err != nil {
+			log("%s : %s", change, err)
+			report.Failures = append(report.Failures, sdk.Failure{Item: change.String(), Error: err.Error()})
+			continue
+		}
+		log("%s", change)
+		report.Applied = append(report.Applied, change)
+	}
+	return &report, nil
+}
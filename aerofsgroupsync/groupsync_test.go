@@ -0,0 +1,154 @@
+package aerofsgroupsync
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const testLDIF = `version: 1
+
+# People
+dn: uid=frodo,ou=people,dc=shire,dc=org
+objectClass: inetOrgPerson
+uid: frodo
+mail: Frodo@Shire.org
+
+dn: uid=sam,ou=people,dc=shire,dc=org
+objectClass: inetOrgPerson
+uid: sam
+mail:: c2FtQHNoaXJlLm9yZw==
+
+dn: uid=gollum,ou=people,dc=shire,dc=org
+objectClass: inetOrgPerson
+uid: gollum
+
+dn: cn=Hobbits,ou=groups,dc=shire,dc=org
+objectClass: groupOfNames
+cn: Hobbits
+member: uid=frodo, ou=people,dc=shire,dc=org
+member: uid=sam,ou=people,dc=shire,
+ dc=org
+member: uid=gollum,ou=people,dc=shire,dc=org
+
+dn: cn=Fellowship,ou=groups,dc=shire,dc=org
+objectClass: groupOfUniqueNames
+cn: Fellowship
+uniqueMember: cn=Hobbits,ou=groups,dc=shire,dc=org
+uniqueMember: aragorn@gondor.org
+uniqueMember: cn=Fellowship,ou=groups,dc=shire,dc=org
+
+dn: cn=Ringbearers,ou=groups,dc=shire,dc=org
+objectClass: posixGroup
+cn: Ringbearers
+memberUid: frodo
+memberUid: bilbo
+`
+
+func TestReadLDIF(t *testing.T) {
+	source, err := ReadLDIF(strings.NewReader(testLDIF))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"Hobbits":     "frodo@shire.org sam@shire.org",
+		"Fellowship":  "aragorn@gondor.org frodo@shire.org sam@shire.org",
+		"Ringbearers": "frodo@shire.org",
+	}
+	if len(source.Groups) != len(expected) {
+		t.Errorf("Unexpected groups %v", source.Groups)
+	}
+	for name, members := range expected {
+		if strings.Join(source.Groups[name], " ") != members {
+			t.Errorf("%s : expected %s, got %v", name, members, source.Groups[name])
+		}
+	}
+	// gollum has no mail, bilbo no entry and the fellowship includes itself
+	if len(source.Warnings) != 3 {
+		t.Errorf("Unexpected warnings %v", source.Warnings)
+	}
+
+	for _, data := range []string{"cn: orphan\n", "dn: cn=a\nbroken\n", "dn: cn=a\nmail:: ***\n"} {
+		if _, err := ReadLDIF(strings.NewReader(data)); err == nil {
+			t.Errorf("Expected an error for %q", data)
+		}
+	}
+}
+
+func TestReadCSVAndJSON(t *testing.T) {
+	source, err := ReadCSV(strings.NewReader("Email,Group\nfrodo@shire.org,Hobbits\nSAM@shire.org,Hobbits\n,Orcs\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(source.Groups["Hobbits"], " ") != "frodo@shire.org sam@shire.org" ||
+		len(source.Groups["Orcs"]) != 0 || source.Members() != 2 {
+		t.Errorf("Unexpected groups %v", source.Groups)
+	}
+	if _, err = ReadCSV(strings.NewReader("email,group,role\n")); err == nil {
+		t.Errorf("Expected an error for an unknown column")
+	}
+
+	source, err = ReadJSON(strings.NewReader(`[{"name": "Hobbits", "members": ["frodo@shire.org", "Frodo@shire.org"]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(source.Groups["Hobbits"]) != 1 {
+		t.Errorf("Unexpected groups %v", source.Groups)
+	}
+	if _, err = ReadJSON(strings.NewReader(`[{"members": []}]`)); err == nil {
+		t.Errorf("Expected an error for a group without name")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	source := &Source{Groups: map[string][]string{
+		"Hobbits":    {"frodo@shire.org", "merry@shire.org"},
+		"Fellowship": {"frodo@shire.org"},
+	}}
+	groups := []current{
+		{Id: "g1", Name: "Hobbits", Members: []string{"Frodo@shire.org", "sam@shire.org", "pippin@shire.org"}},
+		{Id: "g2", Name: "Orcs", Members: []string{"azog@moria.org"}},
+	}
+
+	plan := diff(source, groups, Options{})
+	expected := []string{
+		"+ group Fellowship",
+		"+ Fellowship : frodo@shire.org",
+		"+ Hobbits : merry@shire.org",
+		"- Hobbits : pippin@shire.org",
+		"- Hobbits : sam@shire.org",
+	}
+	if len(plan.Changes) != len(expected) {
+		t.Fatalf("Expected %d changes, got %v", len(expected), plan.Changes)
+	}
+	for i := range expected {
+		if plan.Changes[i].String() != expected[i] {
+			t.Errorf("Expected %q, got %q", expected[i], plan.Changes[i])
+		}
+	}
+	if plan.Changes[2].GroupId != "g1" || plan.Members != 4 || plan.Removed() != 2 {
+		t.Errorf("Unexpected plan %+v", plan)
+	}
+
+	plan = diff(source, groups, Options{DeleteOrphans: true})
+	last := plan.Changes[len(plan.Changes)-1]
+	if last.Action != DELETE_GROUP || last.GroupId != "g2" || plan.Removed() != 3 {
+		t.Errorf("Unexpected plan %+v", plan)
+	}
+
+	if err := plan.CheckLimit(75); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+	if err := plan.CheckLimit(DEFAULT_MAX_REMOVE_PERCENT); err == nil {
+		t.Errorf("Expected removing 75%% of the members to exceed the limit")
+	}
+	if _, err := Apply(nil, plan, ApplyOptions{}); err == nil {
+		t.Errorf("Expected Apply to refuse the plan")
+	}
+
+	out := bytes.Buffer{}
+	plan.WriteText(&out)
+	if !strings.Contains(out.String(), "3 of 4 current members (75.0%) are removed") {
+		t.Errorf("Unexpected text\n%s", out.String())
+	}
+}
@@ -0,0 +1,209 @@
+package aerofsgroupsync
+
+// Planning the changes which bring the groups of an Appliance in line with a
+// directory
+
+import (
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Actions
+const (
+	CREATE_GROUP  = "create_group"
+	ADD_MEMBER    = "add_member"
+	REMOVE_MEMBER = "remove_member"
+	DELETE_GROUP  = "delete_group"
+)
+
+// The share of current members a run removes by default, in percent
+const DEFAULT_MAX_REMOVE_PERCENT = 10
+
+type Change struct {
+	Action  string `json:"action"`
+	Group   string `json:"group"`
+	GroupId string `json:"group_id,omitempty"`
+	Email   string `json:"email,omitempty"`
+
+	// The number of members of a deleted group
+	Members int `json:"members,omitempty"`
+}
+
+func (c Change) String() string {
+	switch c.Action {
+	case CREATE_GROUP:
+		return fmt.Sprintf("+ group %s", c.Group)
+	case ADD_MEMBER:
+		return fmt.Sprintf("+ %s : %s", c.Group, c.Email)
+	case REMOVE_MEMBER:
+		return fmt.Sprintf("- %s : %s", c.Group, c.Email)
+	}
+	return fmt.Sprintf("- group %s (%d members)", c.Group, c.Members)
+}
+
+// The changes to apply, with the number of members of the Appliance groups
+// when planned
+type Plan struct {
+	Changes []Change `json:"changes"`
+	Members int      `json:"members"`
+}
+
+type Options struct {
+	// Delete the groups of the Appliance which are not in the directory
+	DeleteOrphans bool
+}
+
+// Return the number of memberships removed, including the members of deleted
+// groups
+func (p *Plan) Removed() int {
+	n := 0
+	for _, c := range p.Changes {
+		switch c.Action {
+		case REMOVE_MEMBER:
+			n++
+		case DELETE_GROUP:
+			n += c.Members
+		}
+	}
+	return n
+}
+
+// Return the share of the current members the plan removes, in percent
+func (p *Plan) RemovedPercent() float64 {
+	if p.Members == 0 {
+		return 0
+	}
+	return float64(p.Removed()) * 100 / float64(p.Members)
+}
+
+// Return an error if the plan removes more than the given share of the
+// current members, in percent
+func (p *Plan) CheckLimit(maxPercent float64) error {
+	if percent := p.RemovedPercent(); percent > maxPercent {
+		return fmt.Errorf("The plan removes %d of %d members (%.1f%%), more than the limit of %.1f%%",
+			p.Removed(), p.Members, percent, maxPercent)
+	}
+	return nil
+}
+
+// Write the changes, followed by a summary
+func (p *Plan) WriteText(w io.Writer) {
+	for _, c := range p.Changes {
+		fmt.Fprintf(w, "  %s\n", c)
+	}
+	if len(p.Changes) == 0 {
+		fmt.Fprintln(w, "No changes, the groups match the directory.")
+		return
+	}
+	counts := map[string]int{}
+	for _, c := range p.Changes {
+		counts[c.Action]++
+	}
+	fmt.Fprintf(w, "\nPlan: %d groups to create, %d members to add, %d members to remove, %d groups to delete.\n",
+		counts[CREATE_GROUP], counts[ADD_MEMBER], counts[REMOVE_MEMBER], counts[DELETE_GROUP])
+	fmt.Fprintf(w, "%d of %d current members (%.1f%%) are removed.\n", p.Removed(), p.Members, p.RemovedPercent())
+}
+
+// A group of the Appliance with its members
+type current struct {
+	Id      string
+	Name    string
+	Members []string
+}
+
+// Compute the changes bringing the groups of the Appliance in line with the
+// directory
+func MakePlan(c *api.Client, source *Source, opts Options) (*Plan, error) {
+	groups, err := loadGroups(c)
+	if err != nil {
+		return nil, err
+	}
+	return diff(source, groups, opts), nil
+}
+
+// List every group of the Appliance with its members
+// Groups are matched by name, so names must be unique
+func loadGroups(c *api.Client) ([]current, error) {
+	list, err := sdk.ListAllGroups(c, sdk.DEFAULT_PAGE_SIZE)
+	if err != nil {
+		return nil, err
+	}
+	groups := []current{}
+	names := map[string]bool{}
+	for _, g := range list {
+		if names[g.Name] {
+			return nil, fmt.Errorf("Several groups are named %s, unable to match them", g.Name)
+		}
+		names[g.Name] = true
+		members, err := sdk.ListGroupMembers(c, g.Id)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to list the members of %s : %s", g.Name, err)
+		}
+		group := current{Id: g.Id, Name: g.Name, Members: []string{}}
+		for _, m := range members {
+			group.Members = append(group.Members, m.Email)
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// Compare the directory and the groups of the Appliance
+// Groups are created and members added before anything is removed
+func diff(source *Source, groups []current, opts Options) *Plan {
+	plan := Plan{Changes: []Change{}}
+	byName := map[string]current{}
+	for _, g := range groups {
+		byName[g.Name] = g
+		plan.Members += len(g.Members)
+	}
+
+	removals := []Change{}
+	names := []string{}
+	for name := range source.Groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		g, ok := byName[name]
+		if !ok {
+			plan.Changes = append(plan.Changes, Change{Action: CREATE_GROUP, Group: name})
+		}
+		existing := map[string]string{}
+		for _, email := range g.Members {
+			existing[strings.ToLower(email)] = email
+		}
+		wanted := map[string]bool{}
+		for _, email := range source.Groups[name] {
+			wanted[email] = true
+			if _, ok := existing[email]; !ok {
+				plan.Changes = append(plan.Changes, Change{Action: ADD_MEMBER, Group: name, GroupId: g.Id, Email: email})
+			}
+		}
+		removed := []string{}
+		for _, email := range g.Members {
+			if !wanted[strings.ToLower(email)] {
+				removed = append(removed, email)
+			}
+		}
+		sort.Strings(removed)
+		for _, email := range removed {
+			removals = append(removals, Change{Action: REMOVE_MEMBER, Group: name, GroupId: g.Id, Email: email})
+		}
+	}
+	plan.Changes = append(plan.Changes, removals...)
+
+	if opts.DeleteOrphans {
+		for _, g := range groups {
+			if _, ok := source.Groups[g.Name]; !ok {
+				plan.Changes = append(plan.Changes, Change{Action: DELETE_GROUP, Group: g.Name,
+					GroupId: g.Id, Members: len(g.Members)})
+			}
+		}
+	}
+	return &plan
+}
@@ -0,0 +1,344 @@
+package aerofsgroupsync
+
+// Reading the authoritative group memberships from a directory export
+//
+// LDIF exports are read for groups (groupOfNames, groupOfUniqueNames,
+// posixGroup and Active Directory groups), named by their cn. Members are
+// resolved to the mail of the entries they reference, nested groups are
+// expanded. CSV files have a header row and one membership a row :
+//   group,email
+//   Fellowship,frodo@example.com
+// A row without email lists a group without members. JSON files hold a list
+// of groups :
+//   [{"name": "Fellowship", "members": ["frodo@example.com"]}]
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The members of every group, by group name
+// Emails are lower case, sorted and listed once
+type Source struct {
+	Groups map[string][]string
+
+	// Members which could not be resolved to an email, and other entries
+	// which were skipped
+	Warnings []string
+}
+
+// Return the number of memberships
+func (s *Source) Members() int {
+	n := 0
+	for _, members := range s.Groups {
+		n += len(members)
+	}
+	return n
+}
+
+// Read memberships from an LDIF, CSV or JSON file, depending on its extension
+func ReadFile(fileName string) (*Source, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".ldif":
+		return ReadLDIF(f)
+	case ".csv":
+		return ReadCSV(f)
+	case ".json":
+		return ReadJSON(f)
+	}
+	return nil, errors.New("Unknown format, use a .ldif, .csv or .json file")
+}
+
+// Collects memberships, normalizing emails
+type builder map[string]map[string]bool
+
+func (b builder) add(group string, emails ...string) {
+	if b[group] == nil {
+		b[group] = map[string]bool{}
+	}
+	for _, email := range emails {
+		if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+			b[group][email] = true
+		}
+	}
+}
+
+func (b builder) source(warnings []string) *Source {
+	s := Source{Groups: map[string][]string{}, Warnings: warnings}
+	for group, emails := range b {
+		s.Groups[group] = []string{}
+		for email := range emails {
+			s.Groups[group] = append(s.Groups[group], email)
+		}
+		sort.Strings(s.Groups[group])
+	}
+	if s.Warnings == nil {
+		s.Warnings = []string{}
+	}
+	return &s
+}
+
+// Read memberships from CSV, with a group and an email column
+func ReadCSV(r io.Reader) (*Source, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the CSV header : %s", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	groupColumn, ok := columns["group"]
+	emailColumn, ok2 := columns["email"]
+	if !ok || !ok2 || len(columns) != 2 {
+		return nil, errors.New("The CSV header must name a group and an email column")
+	}
+
+	b := builder{}
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return b.source(nil), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		group := strings.TrimSpace(record[groupColumn])
+		if group == "" {
+			return nil, fmt.Errorf("Line %d : missing group", line)
+		}
+		b.add(group, record[emailColumn])
+	}
+}
+
+// Read memberships from a JSON list of groups
+func ReadJSON(r io.Reader) (*Source, error) {
+	groups := []struct {
+		Name    string   `json:"name"`
+		Members []string `json:"members"`
+	}{}
+	err := json.NewDecoder(r).Decode(&groups)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to unmarshal the groups : %s", err)
+	}
+	b := builder{}
+	for i, g := range groups {
+		if strings.TrimSpace(g.Name) == "" {
+			return nil, fmt.Errorf("Group %d has no name", i+1)
+		}
+		b.add(strings.TrimSpace(g.Name), g.Members...)
+	}
+	return b.source(nil), nil
+}
+
+// An LDIF entry, attribute names are lower case and without options
+type entry struct {
+	dn    string
+	attrs map[string][]string
+}
+
+func (e *entry) first(attr string) string {
+	if values := e.attrs[attr]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (e *entry) isGroup() bool {
+	for _, class := range e.attrs["objectclass"] {
+		switch strings.ToLower(class) {
+		case "group", "groupofnames", "groupofuniquenames", "posixgroup":
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize a DN for comparison
+func normalizeDN(dn string) string {
+	parts := strings.Split(dn, ",")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	return strings.ToLower(strings.Join(parts, ","))
+}
+
+// Read memberships from an LDIF export holding the groups and the entries of
+// their members
+func ReadLDIF(r io.Reader) (*Source, error) {
+	entries, err := parseLDIF(r)
+	if err != nil {
+		return nil, err
+	}
+
+	byDN := map[string]*entry{}
+	byUid := map[string]*entry{}
+	for _, e := range entries {
+		byDN[normalizeDN(e.dn)] = e
+		if uid := e.first("uid"); uid != "" {
+			byUid[strings.ToLower(uid)] = e
+		}
+	}
+
+	warnings := []string{}
+	warned := map[string]bool{}
+	warn := func(format string, args ...interface{}) {
+		w := fmt.Sprintf(format, args...)
+		if !warned[w] {
+			warned[w] = true
+			warnings = append(warnings, w)
+		}
+	}
+
+	// Return the emails of the members of a group, expanding nested groups
+	var members func(group *entry, visiting map[string]bool) []string
+	members = func(group *entry, visiting map[string]bool) []string {
+		visiting[normalizeDN(group.dn)] = true
+		defer delete(visiting, normalizeDN(group.dn))
+
+		emails := []string{}
+		refs := append(append([]string{}, group.attrs["member"]...), group.attrs["uniquemember"]...)
+		for _, ref := range refs {
+			// uniqueMember may be followed by an optional unique identifier
+			if i := strings.LastIndex(ref, "#"); i > 0 && strings.HasPrefix(ref[i:], "#'") {
+				ref = ref[:i]
+			}
+			e, ok := byDN[normalizeDN(ref)]
+			switch {
+			case ok && e.isGroup():
+				if visiting[normalizeDN(e.dn)] {
+					warn("%s : the nested group %s includes itself", group.first("cn"), e.dn)
+					continue
+				}
+				emails = append(emails, members(e, visiting)...)
+			case ok && e.first("mail") != "":
+				emails = append(emails, e.first("mail"))
+			case !strings.Contains(ref, "=") && strings.Contains(ref, "@"):
+				emails = append(emails, ref)
+			default:
+				warn("%s : unable to resolve the member %s to an email", group.first("cn"), ref)
+			}
+		}
+		for _, uid := range group.attrs["memberuid"] {
+			if e, ok := byUid[strings.ToLower(uid)]; ok && e.first("mail") != "" {
+				emails = append(emails, e.first("mail"))
+			} else {
+				warn("%s : unable to resolve the member %s to an email", group.first("cn"), uid)
+			}
+		}
+		return emails
+	}
+
+	b := builder{}
+	for _, e := range entries {
+		if !e.isGroup() {
+			continue
+		}
+		name := e.first("cn")
+		if name == "" {
+			warn("Skipped the group %s, it has no cn", e.dn)
+			continue
+		}
+		if _, ok := b[name]; ok {
+			return nil, fmt.Errorf("Several groups are named %s", name)
+		}
+		b.add(name, members(e, map[string]bool{})...)
+	}
+	return b.source(warnings), nil
+}
+
+// Parse the entries of an LDIF file, folded lines are joined and base64
+// values decoded
+func parseLDIF(r io.Reader) ([]*entry, error) {
+	entries := []*entry{}
+	var current *entry
+	lines := []string{}
+
+	// Add the attribute of the last unfolded line to the current entry
+	flush := func(lineNumber int) error {
+		if len(lines) == 0 {
+			return nil
+		}
+		line := strings.Join(lines, "")
+		lines = lines[:0]
+		i := strings.Index(line, ":")
+		if i <= 0 {
+			return fmt.Errorf("Line %d : invalid LDIF line %q", lineNumber, line)
+		}
+		attr, value := strings.ToLower(line[:i]), line[i+1:]
+		if j := strings.Index(attr, ";"); j > 0 {
+			attr = attr[:j]
+		}
+		switch {
+		case strings.HasPrefix(value, ":"):
+			decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value[1:]))
+			if err != nil {
+				return fmt.Errorf("Line %d : invalid base64 value of %s", lineNumber, attr)
+			}
+			value = string(decoded)
+		case strings.HasPrefix(value, "<"):
+			return fmt.Errorf("Line %d : values read from URLs are not supported", lineNumber)
+		default:
+			value = strings.TrimSpace(value)
+		}
+
+		switch {
+		case current == nil && attr == "version":
+		case current == nil && attr == "dn":
+			current = &entry{dn: value, attrs: map[string][]string{}}
+			entries = append(entries, current)
+		case current == nil:
+			return fmt.Errorf("Line %d : expected a dn", lineNumber)
+		default:
+			current.attrs[attr] = append(current.attrs[attr], value)
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case strings.HasPrefix(line, " ") && len(lines) > 0:
+			lines = append(lines, line[1:])
+			continue
+		case strings.HasPrefix(line, "#"):
+			continue
+		}
+		if err := flush(lineNumber - 1); err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(line) == "" {
+			current = nil
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(lineNumber); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,222 @@
+package aerofsinvite
+
+// Inviting people to sign up in bulk, and re-sending or expiring the
+// invitations nobody acted on
+
+import (
+	"bufio"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Actions
+const (
+	INVITED   = "invited"
+	IMPORTED  = "imported"
+	RESENT    = "resent"
+	REVOKED   = "revoked"
+	SIGNED_UP = "signed_up"
+	SKIPPED   = "skipped"
+	FAILED    = "failed"
+)
+
+// What was done for an email
+type Result struct {
+	Email  string `json:"email"`
+	Action string `json:"action"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Read emails, one a line or as the first field of CSV lines
+// Blank lines, comments starting with "#" and an "email" header are skipped
+func ReadList(r io.Reader) ([]string, error) {
+	emails := []string{}
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(line, ","); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		line = strings.Trim(line, `"`)
+		if line == "" || strings.HasPrefix(line, "#") || strings.EqualFold(line, "email") {
+			continue
+		}
+		if !strings.Contains(line, "@") {
+			return nil, fmt.Errorf("Invalid email %q", line)
+		}
+		if !seen[strings.ToLower(line)] {
+			seen[strings.ToLower(line)] = true
+			emails = append(emails, line)
+		}
+	}
+	return emails, scanner.Err()
+}
+
+// Options for Invite and Maintain
+type Options struct {
+	// The email invitations are sent from, which must be a user's
+	Inviter string
+
+	// Only report what would be done
+	DryRun bool
+
+	// Called with progress messages, may be nil
+	Log func(format string, args ...interface{})
+
+	// The current time, time.Now if nil
+	Now func() time.Time
+}
+
+func (o Options) now() time.Time {
+	if o.Now != nil {
+		return o.Now().UTC()
+	}
+	return time.Now().UTC()
+}
+
+func (o Options) result(results *[]Result, email, action, detail string) {
+	if o.Log != nil {
+		o.Log("%s : %s", email, strings.TrimSpace(action+" "+detail))
+	}
+	*results = append(*results, Result{Email: email, Action: action, Detail: detail})
+}
+
+// Invite people to sign up and record their invitations in the store
+// People who already are users, or were already invited, are skipped;
+// invitations found on the Appliance but not in the store are imported
+func Invite(c *api.Client, store *Store, emails []string, opts Options) []Result {
+	results := []Result{}
+	for _, email := range emails {
+		if r := store.Get(email); r != nil && r.Status == PENDING {
+			opts.result(&results, email, SKIPPED, "already invited")
+			continue
+		}
+		_, err := sdk.GetUserClient(c, email)
+		if err == nil {
+			opts.result(&results, email, SKIPPED, "already a user")
+			continue
+		}
+		if !api.IsStatus(err, http.StatusNotFound) {
+			opts.result(&results, email, FAILED, err.Error())
+			continue
+		}
+
+		invitee, err := sdk.GetInviteeClient(c, email)
+		switch {
+		case err == nil:
+			now := opts.now()
+			store.Put(&Record{Email: email, Inviter: invitee.Desc.EmailFrom, SignupCode: invitee.Desc.SignupCode,
+				Status: PENDING, Created: now, LastSent: now, Sent: 1})
+			opts.result(&results, email, IMPORTED, "invited before, recorded as of now")
+		case !api.IsStatus(err, http.StatusNotFound):
+			opts.result(&results, email, FAILED, err.Error())
+		case opts.DryRun:
+			opts.result(&results, email, INVITED, "dry run")
+		default:
+			invitee, err = sdk.CreateInviteeClient(c, email, opts.Inviter)
+			if err != nil {
+				opts.result(&results, email, FAILED, err.Error())
+				continue
+			}
+			now := opts.now()
+			store.Put(&Record{Email: email, Inviter: opts.Inviter, SignupCode: invitee.Desc.SignupCode,
+				Status: PENDING, Created: now, LastSent: now, Sent: 1})
+			opts.result(&results, email, INVITED, "")
+		}
+	}
+	return results
+}
+
+// Policy for stale invitations
+type MaintainOptions struct {
+	Options
+
+	// Invitations last sent longer ago are sent again, never if zero
+	ResendAfter time.Duration
+
+	// The number of times an invitation is sent at most, including the first
+	MaxSends int
+
+	// Invitations first sent longer ago are revoked, never if zero
+	ExpireAfter time.Duration
+}
+
+// Mark the invitations of people who signed up as converted, then re-send or
+// expire the stale pending invitations
+func Maintain(c *api.Client, store *Store, opts MaintainOptions) ([]Result, error) {
+	results, err := Convert(c, store, opts.Options)
+	if err != nil {
+		return nil, err
+	}
+	now := opts.now()
+	for _, r := range store.List() {
+		if r.Status != PENDING {
+			continue
+		}
+		invitee := sdk.InviteeClient{APIClient: c, Desc: sdk.Invitee{EmailTo: r.Email, EmailFrom: r.Inviter}}
+		switch {
+		case opts.ExpireAfter > 0 && now.Sub(r.Created) > opts.ExpireAfter:
+			if !opts.DryRun {
+				err := invitee.Delete()
+				if err != nil && !api.IsStatus(err, http.StatusNotFound) {
+					opts.result(&results, r.Email, FAILED, err.Error())
+					continue
+				}
+				r.Status, r.Closed = EXPIRED, now
+			}
+			opts.result(&results, r.Email, REVOKED, fmt.Sprintf("invited %s ago", days(now.Sub(r.Created))))
+
+		case opts.ResendAfter > 0 && r.Age(now) > opts.ResendAfter && (opts.MaxSends == 0 || r.Sent < opts.MaxSends):
+			detail := fmt.Sprintf("last sent %s ago", days(r.Age(now)))
+			if !opts.DryRun {
+				err := invitee.Resend()
+				if err != nil {
+					opts.result(&results, r.Email, FAILED, err.Error())
+					continue
+				}
+				r.SignupCode, r.LastSent = invitee.Desc.SignupCode, now
+				r.Sent++
+			}
+			opts.result(&results, r.Email, RESENT, detail)
+		}
+	}
+	return results, nil
+}
+
+// Format a duration in whole days
+func days(d time.Duration) string {
+	n := int(d.Hours() / 24)
+	if n == 1 {
+		return "1 day"
+	}
+	return fmt.Sprintf("%d days", n)
+}
+
+// Mark the pending invitations of people who are now users as converted
+func Convert(c *api.Client, store *Store, opts Options) ([]Result, error) {
+	users, err := sdk.ListAllUsers(c, sdk.DEFAULT_PAGE_SIZE)
+	if err != nil {
+		return nil, err
+	}
+	registered := map[string]bool{}
+	for _, u := range users {
+		registered[strings.ToLower(u.Email)] = true
+	}
+	results := []Result{}
+	now := opts.now()
+	for _, r := range store.List() {
+		if r.Status != CONVERTED && registered[strings.ToLower(r.Email)] {
+			if !opts.DryRun {
+				r.Status, r.Closed = CONVERTED, now
+			}
+			opts.result(&results, r.Email, SIGNED_UP, "")
+		}
+	}
+	return results, nil
+}
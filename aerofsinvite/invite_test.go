@@ -0,0 +1,188 @@
+package aerofsinvite
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// An Appliance with users and invitees
+type fakeAppliance struct {
+	mu       sync.Mutex
+	users    map[string]bool
+	invitees map[string]api.Invitee
+	codes    int
+}
+
+func (f *fakeAppliance) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1.3/"), "/")
+	reply := func(status int, v interface{}) {
+		w.WriteHeader(status)
+		if v != nil {
+			json.NewEncoder(w).Encode(v)
+		}
+	}
+	switch {
+	case parts[0] == "users" && len(parts) == 1:
+		users := []api.User{}
+		for email := range f.users {
+			users = append(users, api.User{Email: email})
+		}
+		reply(http.StatusOK, map[string]interface{}{"has_more": false, "data": users})
+	case parts[0] == "users" && f.users[parts[1]]:
+		reply(http.StatusOK, api.User{Email: parts[1]})
+	case parts[0] == "users":
+		reply(http.StatusNotFound, nil)
+	case parts[0] == "invitees" && r.Method == "POST":
+		invitee := api.Invitee{}
+		json.NewDecoder(r.Body).Decode(&invitee)
+		f.codes++
+		invitee.SignupCode = fmt.Sprintf("code%d", f.codes)
+		f.invitees[invitee.EmailTo] = invitee
+		reply(http.StatusCreated, invitee)
+	case parts[0] == "invitees":
+		invitee, ok := f.invitees[parts[1]]
+		switch {
+		case !ok:
+			reply(http.StatusNotFound, nil)
+		case r.Method == "DELETE":
+			delete(f.invitees, parts[1])
+			reply(http.StatusNoContent, nil)
+		default:
+			reply(http.StatusOK, invitee)
+		}
+	default:
+		reply(http.StatusNotFound, nil)
+	}
+}
+
+func setup(t *testing.T) (*fakeAppliance, *api.Client, *Store) {
+	fake := &fakeAppliance{users: map[string]bool{"frodo@shire.org": true}, invitees: map[string]api.Invitee{
+		"bilbo@shire.org": {EmailTo: "bilbo@shire.org", EmailFrom: "gandalf@istari.org", SignupCode: "old"}}}
+	ts := httptest.NewTLSServer(fake)
+	t.Cleanup(ts.Close)
+	c, _ := api.NewClient("token", strings.TrimPrefix(ts.URL, "https://"))
+	c.SetHTTPClient(ts.Client())
+
+	dir, err := ioutil.TempDir("", "aerofsinvite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	store, err := OpenStore(filepath.Join(dir, "invites.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fake, c, store
+}
+
+func actions(results []Result) string {
+	list := []string{}
+	for _, r := range results {
+		list = append(list, r.Email+" "+r.Action)
+	}
+	return strings.Join(list, ", ")
+}
+
+func TestReadList(t *testing.T) {
+	emails, err := ReadList(strings.NewReader("email,name\n# staff\nsam@shire.org,Sam\n\n\"merry@shire.org\"\nSAM@shire.org\n"))
+	if err != nil || strings.Join(emails, " ") != "sam@shire.org merry@shire.org" {
+		t.Errorf("Unexpected emails %v : %v", emails, err)
+	}
+	if _, err = ReadList(strings.NewReader("not an email\n")); err == nil {
+		t.Errorf("Expected an error for an invalid email")
+	}
+}
+
+func TestInviteMaintainAndReport(t *testing.T) {
+	fake, c, store := setup(t)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	opts := Options{Inviter: "gandalf@istari.org", Now: func() time.Time { return now }}
+
+	emails := []string{"frodo@shire.org", "bilbo@shire.org", "sam@shire.org", "merry@shire.org"}
+	results := Invite(c, store, emails, opts)
+	expected := "frodo@shire.org skipped, bilbo@shire.org imported, sam@shire.org invited, merry@shire.org invited"
+	if actions(results) != expected {
+		t.Errorf("Expected %s, got %s", expected, actions(results))
+	}
+	if store.Get("SAM@shire.org").SignupCode != fake.invitees["sam@shire.org"].SignupCode {
+		t.Errorf("Unexpected record %+v", store.Get("sam@shire.org"))
+	}
+	if actions(Invite(c, store, []string{"sam@shire.org"}, opts)) != "sam@shire.org skipped" {
+		t.Errorf("Expected an invited email to be skipped")
+	}
+
+	// The store survives a reopening
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+	store, err := OpenStore(store.path)
+	if err != nil || len(store.List()) != 3 {
+		t.Fatalf("Unexpected store %v : %v", store.List(), err)
+	}
+
+	// Ten days later sam signed up, the others are sent their invitation again
+	now = now.Add(10 * 24 * time.Hour)
+	fake.users["sam@shire.org"] = true
+	mopts := MaintainOptions{Options: opts, ResendAfter: 7 * 24 * time.Hour, MaxSends: 2, ExpireAfter: 30 * 24 * time.Hour}
+	results, err = Maintain(c, store, mopts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = "sam@shire.org signed_up, bilbo@shire.org resent, merry@shire.org resent"
+	if actions(results) != expected {
+		t.Errorf("Expected %s, got %s", expected, actions(results))
+	}
+	if r := store.Get("bilbo@shire.org"); r.Sent != 2 || r.SignupCode == "old" || fake.invitees["bilbo@shire.org"].SignupCode != r.SignupCode {
+		t.Errorf("Unexpected record %+v", r)
+	}
+
+	// Invitations are not sent more than twice, and expire after a month
+	now = now.Add(10 * 24 * time.Hour)
+	if results, _ = Maintain(c, store, mopts); len(results) != 0 {
+		t.Errorf("Unexpected results %s", actions(results))
+	}
+	now = now.Add(11 * 24 * time.Hour)
+	mopts.DryRun = true
+	results, _ = Maintain(c, store, mopts)
+	if actions(results) != "bilbo@shire.org revoked, merry@shire.org revoked" || store.Get("merry@shire.org").Status != PENDING {
+		t.Errorf("Unexpected dry run %s", actions(results))
+	}
+	mopts.DryRun = false
+	Maintain(c, store, mopts)
+	if _, ok := fake.invitees["merry@shire.org"]; ok || store.Get("merry@shire.org").Status != EXPIRED {
+		t.Errorf("Expected merry's invitation to be revoked")
+	}
+
+	report, err := Conversions(c, store, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Invited != 3 || report.Converted != 1 || report.Expired != 2 || report.MedianDays != 10 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	out := bytes.Buffer{}
+	report.WriteText(&out)
+	if !strings.HasPrefix(out.String(), "3 invited : 1 converted (33.3%), 0 pending, 2 expired\n") {
+		t.Errorf("Unexpected text %q", out.String())
+	}
+	out.Reset()
+	if err = report.WriteCSV(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "sam@shire.org,gandalf@istari.org,converted,2026-01-01T00:00:00Z,2026-01-01T00:00:00Z,1,2026-01-11T00:00:00Z,10\n") {
+		t.Errorf("Unexpected CSV\n%s", out.String())
+	}
+}
@@ -0,0 +1,102 @@
+package aerofsinvite
+
+// Reporting how many invitations turned into users
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type ConversionReport struct {
+	Generated time.Time `json:"generated"`
+	Invited   int       `json:"invited"`
+	Pending   int       `json:"pending"`
+	Converted int       `json:"converted"`
+	Expired   int       `json:"expired"`
+
+	// The share of invitations converted, and the median number of days
+	// people took to sign up, as of the scan which noticed them
+	Rate       float64 `json:"rate"`
+	MedianDays float64 `json:"median_days"`
+
+	// The people found to have signed up since the previous report
+	SignedUp []Result `json:"signed_up"`
+	Records  []Record `json:"records"`
+}
+
+// Cross-check the invitations with the users of the Appliance, and report
+// the conversions
+func Conversions(c *api.Client, store *Store, opts Options) (*ConversionReport, error) {
+	signedUp, err := Convert(c, store, opts)
+	if err != nil {
+		return nil, err
+	}
+	report := ConversionReport{Generated: opts.now(), SignedUp: signedUp, Records: []Record{}}
+	durations := []float64{}
+	for _, r := range store.List() {
+		report.Records = append(report.Records, *r)
+		report.Invited++
+		switch r.Status {
+		case PENDING:
+			report.Pending++
+		case EXPIRED:
+			report.Expired++
+		case CONVERTED:
+			report.Converted++
+			durations = append(durations, r.Closed.Sub(r.Created).Hours()/24)
+		}
+	}
+	if report.Invited > 0 {
+		report.Rate = float64(report.Converted) / float64(report.Invited)
+	}
+	sort.Float64s(durations)
+	if n := len(durations); n > 0 {
+		report.MedianDays = durations[n/2]
+		if n%2 == 0 {
+			report.MedianDays = (durations[n/2-1] + durations[n/2]) / 2
+		}
+	}
+	return &report, nil
+}
+
+func (r *ConversionReport) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "%d invited : %d converted (%.1f%%), %d pending, %d expired\n",
+		r.Invited, r.Converted, r.Rate*100, r.Pending, r.Expired)
+	if r.Converted > 0 {
+		fmt.Fprintf(w, "Median time to sign up : %.1f days\n", r.MedianDays)
+	}
+	for _, s := range r.SignedUp {
+		fmt.Fprintf(w, "  signed up : %s\n", s.Email)
+	}
+}
+
+func (r *ConversionReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// Write a row by invitation
+func (r *ConversionReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"email", "inviter", "status", "created", "last_sent", "sent", "closed", "age_days"})
+	for _, rec := range r.Records {
+		closed := ""
+		end := r.Generated
+		if !rec.Closed.IsZero() {
+			closed = rec.Closed.Format(time.RFC3339)
+			end = rec.Closed
+		}
+		cw.Write([]string{rec.Email, rec.Inviter, rec.Status, rec.Created.Format(time.RFC3339),
+			rec.LastSent.Format(time.RFC3339), strconv.Itoa(rec.Sent), closed,
+			strconv.Itoa(int(end.Sub(rec.Created).Hours() / 24))})
+	}
+	cw.Flush()
+	return cw.Error()
+}
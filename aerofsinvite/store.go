@@ -0,0 +1,103 @@
+package aerofsinvite
+
+// A local record of the sign up invitations sent, as the Appliance does not
+// say when an invitation was sent
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Statuses of an invitation
+const (
+	PENDING   = "pending"
+	CONVERTED = "converted"
+	EXPIRED   = "expired"
+)
+
+// An invitation to sign up
+type Record struct {
+	Email      string `json:"email"`
+	Inviter    string `json:"inviter"`
+	SignupCode string `json:"signup_code,omitempty"`
+	Status     string `json:"status"`
+
+	// When the person was first invited, when the invitation was last sent,
+	// and how many times it was sent
+	Created  time.Time `json:"created"`
+	LastSent time.Time `json:"last_sent"`
+	Sent     int       `json:"sent"`
+
+	// When the person was found to have signed up, or the invitation expired
+	Closed time.Time `json:"closed"`
+}
+
+// Return how long ago the invitation was last sent
+func (r *Record) Age(now time.Time) time.Duration {
+	return now.Sub(r.LastSent)
+}
+
+// The invitations, by lower case email
+type Store struct {
+	path    string
+	records map[string]*Record
+}
+
+// Open the store kept in a file, which is created by Save if missing
+func OpenStore(path string) (*Store, error) {
+	s := Store{path: path, records: map[string]*Record{}}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	records := []*Record{}
+	err = json.Unmarshal(data, &records)
+	if err != nil {
+		return nil, errors.New("Unable to unmarshal the invitation store")
+	}
+	for _, r := range records {
+		s.records[strings.ToLower(r.Email)] = r
+	}
+	return &s, nil
+}
+
+// Return the invitation of an email, nil if there is none
+func (s *Store) Get(email string) *Record {
+	return s.records[strings.ToLower(email)]
+}
+
+func (s *Store) Put(r *Record) {
+	s.records[strings.ToLower(r.Email)] = r
+}
+
+// Return every invitation, sorted by email
+func (s *Store) List() []*Record {
+	records := []*Record{}
+	for _, r := range s.records {
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Email < records[j].Email })
+	return records
+}
+
+// Write the store to its file through a temporary file
+func (s *Store) Save() error {
+	data, err := json.MarshalIndent(s.List(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,99 @@
+package aerofsmigrate
+
+// Progress of a migration, persisted so it can be resumed
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+type checkpoint struct {
+	// Keys of the completed steps
+	Done map[string]bool `json:"done"`
+
+	// Identifiers on the destination of the shares created, by source sid
+	Shares map[string]string `json:"shares"`
+
+	path   string
+	mu     sync.Mutex
+	saveMu sync.Mutex
+}
+
+// Load a checkpoint, an empty one is returned if the file does not exist
+func loadCheckpoint(path string) (*checkpoint, error) {
+	cp := checkpoint{Done: map[string]bool{}, Shares: map[string]string{}, path: path}
+	if path == "" {
+		return &cp, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &cp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &cp)
+	if err != nil {
+		return nil, err
+	}
+	if cp.Done == nil {
+		cp.Done = map[string]bool{}
+	}
+	if cp.Shares == nil {
+		cp.Shares = map[string]string{}
+	}
+	return &cp, nil
+}
+
+func (cp *checkpoint) isDone(s Step) bool {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return cp.Done[s.Key()]
+}
+
+func (cp *checkpoint) markDone(s Step) {
+	cp.mu.Lock()
+	cp.Done[s.Key()] = true
+	cp.mu.Unlock()
+}
+
+func (cp *checkpoint) share(sid string) (string, bool) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	id, ok := cp.Shares[sid]
+	return id, ok
+}
+
+func (cp *checkpoint) setShare(sid, id string) {
+	cp.mu.Lock()
+	cp.Shares[sid] = id
+	cp.mu.Unlock()
+}
+
+// Write the checkpoint through a temporary file so an interruption never
+// leaves it truncated
+func (cp *checkpoint) save() error {
+	if cp.path == "" {
+		return nil
+	}
+
+	cp.saveMu.Lock()
+	defer cp.saveMu.Unlock()
+
+	cp.mu.Lock()
+	data, err := json.Marshal(cp)
+	cp.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := cp.path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, cp.path)
+}
@@ -0,0 +1,130 @@
+package aerofsmigrate
+
+import (
+	"bytes"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testCatalog() *sdk.Catalog {
+	return &sdk.Catalog{
+		Users: []sdk.UserRecord{
+			{Email: "frodo@shire.me", FirstName: "Frodo", LastName: "Baggins"},
+			{Email: "sam@shire.me", FirstName: "Samwise", LastName: "Gamgee"},
+		},
+		Groups: []sdk.GroupRecord{
+			{Id: "g1", Name: "Fellowship", Members: []string{"frodo@shire.me", "sam@shire.me"}},
+		},
+		Shares: []sdk.ShareRecord{{
+			Id:      "s1",
+			Name:    "Maps",
+			Members: []api.SFMember{{Email: "frodo@shire.me", Permissions: api.PermissionSet{"WRITE", "MANAGE"}}},
+			Groups:  []api.SFGroupMember{{Id: "g1", Name: "Fellowship", Permissions: api.PermissionSet{"WRITE"}}},
+			Pending: []api.SFPendingMember{{Email: "gandalf@istari.me", Permissions: api.PermissionSet{"WRITE"}}},
+			Files: []sdk.FileRecord{
+				{Path: "Mordor", IsDir: true, Id: "d1"},
+				{Path: "Mordor/route.txt", Id: "f1", Etag: "e1", Size: 42},
+			},
+		}},
+		Roots: []sdk.RootRecord{{Email: "frodo@shire.me",
+			Files: []sdk.FileRecord{{Path: "ring.txt", Id: "f2", Etag: "e2", Size: 8}}}},
+	}
+}
+
+func TestBuildPlan(t *testing.T) {
+	m := NewMigrator(nil, nil, Options{EmailMap: map[string]string{"sam@shire.me": "samwise@gondor.me"}})
+	state := &destinationState{
+		users:  map[string]bool{"frodo@shire.me": true},
+		groups: map[string]map[string]bool{"Fellowship": {"frodo@shire.me": true}},
+	}
+	plan := m.buildPlan(testCatalog(), state)
+
+	expected := []string{
+		"create user samwise@gondor.me",
+		"add samwise@gondor.me to group Fellowship",
+		"create shared folder Maps",
+		"add frodo@shire.me to share:s1 with WRITE,MANAGE",
+		"add Fellowship to share:s1 with WRITE",
+		"invite gandalf@istari.me to share:s1 with WRITE",
+		"create folder Mordor in share:s1",
+		"copy Mordor/route.txt in share:s1 (42 bytes)",
+		"copy ring.txt in root:frodo@shire.me (8 bytes)",
+	}
+	if len(plan.Steps) != len(expected) {
+		t.Fatalf("Expected %d steps, got %v", len(expected), plan.Steps)
+	}
+	for i, s := range plan.Steps {
+		if s.String() != expected[i] {
+			t.Errorf("Step %d : expected %q, got %q", i, expected[i], s)
+		}
+	}
+	if plan.Bytes() != 50 {
+		t.Errorf("Expected 50 bytes to copy, got %d", plan.Bytes())
+	}
+	if plan.Steps[7].SourceId != "f1" || plan.Steps[7].Etag != "e1" {
+		t.Errorf("The copy does not refer to the source file : %+v", plan.Steps[7])
+	}
+
+	buffer := bytes.Buffer{}
+	plan.WriteText(&buffer)
+	if !strings.Contains(buffer.String(), "2 files (50 bytes)") {
+		t.Errorf("Unexpected summary : %s", buffer.String())
+	}
+}
+
+func TestStepKeys(t *testing.T) {
+	steps := []Step{
+		{Type: AddShareMember, Tree: "share:s1", Target: "Maps", Member: "frodo@shire.me"},
+		{Type: InviteMember, Tree: "share:s1", Target: "Maps", Member: "frodo@shire.me"},
+		{Type: AddShareMember, Tree: "share:s2", Target: "Maps", Member: "frodo@shire.me"},
+		{Type: CopyFile, Tree: "share:s1", Target: "Maps"},
+	}
+	keys := map[string]bool{}
+	for _, s := range steps {
+		keys[s.Key()] = true
+	}
+	if len(keys) != len(steps) {
+		t.Errorf("Distinct steps share a key")
+	}
+}
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aerofsmigrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint.json")
+
+	cp, err := loadCheckpoint(path)
+	if err != nil || len(cp.Done) != 0 {
+		t.Fatalf("Expected an empty checkpoint : %v", err)
+	}
+
+	step := Step{Type: CopyFile, Tree: "share:s1", Target: "Mordor/route.txt"}
+	cp.markDone(step)
+	cp.setShare("s1", "d1")
+	err = cp.save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.isDone(step) {
+		t.Errorf("The completed step was not saved")
+	}
+	if loaded.isDone(Step{Type: CopyFile, Tree: "share:s1", Target: "Mordor/map.txt"}) {
+		t.Errorf("An incomplete step is recorded as done")
+	}
+	if id, ok := loaded.share("s1"); !ok || id != "d1" {
+		t.Errorf("Expected share d1, got %q", id)
+	}
+}
@@ -0,0 +1,307 @@
+package aerofsmigrate
+
+// Planning of a migration from a source Appliance to a destination Appliance
+// The source is enumerated into a catalog, which is compared with the users
+// and groups already on the destination to produce an ordered list of steps
+
+import (
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"io"
+	"strings"
+)
+
+const DEFAULT_CONCURRENCY = 4
+
+type StepType string
+
+const (
+	CreateUser     StepType = "create_user"
+	CreateGroup    StepType = "create_group"
+	AddGroupMember StepType = "add_group_member"
+	CreateShare    StepType = "create_share"
+	AddShareMember StepType = "add_share_member"
+	AddShareGroup  StepType = "add_share_group"
+	InviteMember   StepType = "invite_member"
+	CreateFolder   StepType = "create_folder"
+	CopyFile       StepType = "copy_file"
+)
+
+// One operation on the destination
+type Step struct {
+	Type StepType `json:"type"`
+
+	// The tree a folder or file belongs to, "share:<source sid>" or
+	// "root:<source email>", and the share members are added to
+	Tree string `json:"tree,omitempty"`
+
+	// The destination email, the group or share name, or the path within
+	// the tree the step applies to
+	Target string `json:"target"`
+
+	// The destination email or group name added to a group or share
+	Member string `json:"member,omitempty"`
+
+	FirstName   string            `json:"first_name,omitempty"`
+	LastName    string            `json:"last_name,omitempty"`
+	Permissions api.PermissionSet `json:"permissions,omitempty"`
+	Note        string            `json:"note,omitempty"`
+
+	// The source file of a copy
+	SourceId string `json:"source_id,omitempty"`
+	Etag     string `json:"etag,omitempty"`
+	Size     int    `json:"size,omitempty"`
+	Mime     string `json:"mime_type,omitempty"`
+}
+
+// Identifies a step in checkpoints
+func (s Step) Key() string {
+	return strings.Join([]string{string(s.Type), s.Tree, s.Target, s.Member}, "\x00")
+}
+
+func (s Step) String() string {
+	switch s.Type {
+	case CreateUser:
+		return fmt.Sprintf("create user %s", s.Target)
+	case CreateGroup:
+		return fmt.Sprintf("create group %s", s.Target)
+	case AddGroupMember:
+		return fmt.Sprintf("add %s to group %s", s.Member, s.Target)
+	case CreateShare:
+		return fmt.Sprintf("create shared folder %s", s.Target)
+	case AddShareMember, AddShareGroup:
+		return fmt.Sprintf("add %s to %s with %s", s.Member, s.Tree, s.Permissions)
+	case InviteMember:
+		return fmt.Sprintf("invite %s to %s with %s", s.Member, s.Tree, s.Permissions)
+	case CreateFolder:
+		return fmt.Sprintf("create folder %s in %s", s.Target, s.Tree)
+	}
+	return fmt.Sprintf("copy %s in %s (%d bytes)", s.Target, s.Tree, s.Size)
+}
+
+// The steps of a migration, in the order they are applied
+type Plan struct {
+	Steps []Step `json:"steps"`
+
+	// Source items which could not be enumerated
+	Failures []sdk.Failure `json:"failures"`
+}
+
+// Return the total size of the files to copy
+func (p *Plan) Bytes() int64 {
+	var total int64
+	for _, s := range p.Steps {
+		if s.Type == CopyFile {
+			total += int64(s.Size)
+		}
+	}
+	return total
+}
+
+// Write one line per step followed by a summary
+func (p *Plan) WriteText(w io.Writer) error {
+	counts := map[StepType]int{}
+	for _, s := range p.Steps {
+		counts[s.Type]++
+		_, err := fmt.Fprintln(w, s)
+		if err != nil {
+			return err
+		}
+	}
+	for _, f := range p.Failures {
+		fmt.Fprintf(w, "unable to enumerate %s : %s\n", f.Item, f.Error)
+	}
+
+	_, err := fmt.Fprintf(w, "%d users, %d groups, %d shared folders, %d folders, "+
+		"%d files (%d bytes), %d failures\n", counts[CreateUser], counts[CreateGroup],
+		counts[CreateShare], counts[CreateFolder], counts[CopyFile], p.Bytes(), len(p.Failures))
+	return err
+}
+
+// The OAuth tokens of a user on both Appliances
+type UserTokens struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+}
+
+// Options for a migration
+type Options struct {
+	// Destination emails by source email, unmapped emails are kept
+	EmailMap map[string]string
+
+	// Tokens of the users whose root folders are migrated, by source email
+	UserTokens map[string]UserTokens
+
+	// The number of files transferred or verified at once,
+	// DEFAULT_CONCURRENCY if 0
+	Concurrency int
+
+	// The file recording completed steps, so an interrupted migration
+	// resumes where it stopped. Progress is only kept in memory if empty
+	CheckpointPath string
+
+	// Called with progress messages, may be nil
+	Log func(format string, args ...interface{})
+}
+
+// Migrates from a source to a destination Appliance with admin tokens
+type Migrator struct {
+	Source      *api.Client
+	Destination *api.Client
+	Options     Options
+
+	cp *checkpoint
+}
+
+func NewMigrator(source, destination *api.Client, opts Options) *Migrator {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DEFAULT_CONCURRENCY
+	}
+	return &Migrator{Source: source, Destination: destination, Options: opts}
+}
+
+func (m *Migrator) log(format string, args ...interface{}) {
+	if m.Options.Log != nil {
+		m.Options.Log(format, args...)
+	}
+}
+
+// Return the destination email of a source email
+func (m *Migrator) mapEmail(email string) string {
+	if mapped, ok := m.Options.EmailMap[email]; ok {
+		return mapped
+	}
+	return email
+}
+
+// What already exists on the destination
+type destinationState struct {
+	users  map[string]bool
+	groups map[string]map[string]bool
+}
+
+// Enumerate the source and compute the steps to migrate it, the destination
+// is not modified
+func (m *Migrator) Plan() (*Plan, error) {
+	tokens := map[string]string{}
+	for email, t := range m.Options.UserTokens {
+		tokens[email] = t.Source
+	}
+
+	m.log("Enumerating the source Appliance")
+	catalog, err := sdk.Inventory(m.Source, sdk.InventoryOptions{UserTokens: tokens, Log: m.Options.Log})
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := m.destinationState()
+	if err != nil {
+		return nil, err
+	}
+	return m.buildPlan(catalog, state), nil
+}
+
+func (m *Migrator) destinationState() (*destinationState, error) {
+	state := destinationState{users: map[string]bool{}, groups: map[string]map[string]bool{}}
+	users, err := sdk.ListAllUsers(m.Destination, sdk.DEFAULT_PAGE_SIZE)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		state.users[strings.ToLower(u.Email)] = true
+	}
+
+	groups, err := sdk.ListAllGroups(m.Destination, sdk.DEFAULT_PAGE_SIZE)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		members := map[string]bool{}
+		for _, member := range g.Members {
+			members[strings.ToLower(member.Email)] = true
+		}
+		state.groups[g.Name] = members
+	}
+	return &state, nil
+}
+
+func shareTree(sid string) string {
+	return "share:" + sid
+}
+
+func rootTree(email string) string {
+	return "root:" + email
+}
+
+// Order the steps so users exist before they are added to groups and
+// shares, and folders before their contents
+func (m *Migrator) buildPlan(catalog *sdk.Catalog, state *destinationState) *Plan {
+	plan := Plan{Steps: []Step{}, Failures: catalog.Failures}
+	add := func(s Step) {
+		plan.Steps = append(plan.Steps, s)
+	}
+
+	for _, u := range catalog.Users {
+		email := m.mapEmail(u.Email)
+		if !state.users[strings.ToLower(email)] {
+			add(Step{Type: CreateUser, Target: email, FirstName: u.FirstName, LastName: u.LastName})
+		}
+	}
+
+	for _, g := range catalog.Groups {
+		members, exists := state.groups[g.Name]
+		if !exists {
+			add(Step{Type: CreateGroup, Target: g.Name})
+		}
+		for _, email := range g.Members {
+			email = m.mapEmail(email)
+			if !members[strings.ToLower(email)] {
+				add(Step{Type: AddGroupMember, Target: g.Name, Member: email})
+			}
+		}
+	}
+
+	groupNames := map[string]string{}
+	for _, g := range catalog.Groups {
+		groupNames[g.Id] = g.Name
+	}
+
+	for _, s := range catalog.Shares {
+		tree := shareTree(s.Id)
+		add(Step{Type: CreateShare, Tree: tree, Target: s.Name})
+		for _, member := range s.Members {
+			add(Step{Type: AddShareMember, Tree: tree, Target: s.Name,
+				Member: m.mapEmail(member.Email), Permissions: member.Permissions})
+		}
+		for _, g := range s.Groups {
+			name, ok := groupNames[g.Id]
+			if !ok {
+				name = g.Name
+			}
+			add(Step{Type: AddShareGroup, Tree: tree, Target: s.Name, Member: name,
+				Permissions: g.Permissions})
+		}
+		for _, p := range s.Pending {
+			add(Step{Type: InviteMember, Tree: tree, Target: s.Name,
+				Member: m.mapEmail(p.Email), Permissions: p.Permissions, Note: p.Note})
+		}
+		addTree(add, tree, s.Files)
+	}
+
+	for _, r := range catalog.Roots {
+		addTree(add, rootTree(r.Email), r.Files)
+	}
+	return &plan
+}
+
+func addTree(add func(Step), tree string, files []sdk.FileRecord) {
+	for _, f := range files {
+		if f.IsDir {
+			add(Step{Type: CreateFolder, Tree: tree, Target: f.Path})
+		} else {
+			add(Step{Type: CopyFile, Tree: tree, Target: f.Path, SourceId: f.Id,
+				Etag: f.Etag, Size: f.Size, Mime: f.Mime})
+		}
+	}
+}
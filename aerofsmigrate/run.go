@@ -0,0 +1,356 @@
+package aerofsmigrate
+
+// Application of a plan to the destination
+// Users, groups, shares and folders are created in order, then files are
+// streamed from the source to the destination by concurrent workers
+
+import (
+	"errors"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"io"
+	"path"
+	"strings"
+	"sync"
+)
+
+// The checkpoint is saved after this many files are copied
+const CHECKPOINT_INTERVAL = 50
+
+// What a migration did
+type Report struct {
+	// Steps applied, and steps skipped as already done or already present
+	Done    int
+	Skipped int
+
+	// Bytes of file content transferred
+	Bytes int64
+
+	Failures []sdk.Failure
+}
+
+// The clients and root folders of a tree on both Appliances
+type treeClients struct {
+	source      *api.Client
+	destination *api.Client
+	sourceRoot  string
+	destRoot    string
+}
+
+type migration struct {
+	m      *Migrator
+	cp     *checkpoint
+	groups map[string]string
+
+	mu      sync.Mutex
+	report  Report
+	folders map[string]string
+	copied  int
+}
+
+// Load the checkpoint once, so Verify after Run finds the shares created
+// even when progress is only kept in memory
+func (m *Migrator) checkpoint() (*checkpoint, error) {
+	if m.cp != nil {
+		return m.cp, nil
+	}
+	cp, err := loadCheckpoint(m.Options.CheckpointPath)
+	if err == nil {
+		m.cp = cp
+	}
+	return cp, err
+}
+
+// Return the clients and root folders of a tree
+func (m *Migrator) treeClients(tree string) (*treeClients, error) {
+	switch {
+	case strings.HasPrefix(tree, "share:"):
+		sid := strings.TrimPrefix(tree, "share:")
+		id, ok := m.cp.share(sid)
+		if !ok {
+			return nil, errors.New("The shared folder was not created on the destination")
+		}
+		return &treeClients{m.Source, m.Destination,
+			sdk.ShareRootFolderId(sid), sdk.ShareRootFolderId(id)}, nil
+
+	case strings.HasPrefix(tree, "root:"):
+		email := strings.TrimPrefix(tree, "root:")
+		tokens, ok := m.Options.UserTokens[email]
+		if !ok {
+			return nil, errors.New("No tokens for " + email)
+		}
+		source, err := api.NewClient(tokens.Source, m.Source.Host)
+		if err != nil {
+			return nil, err
+		}
+		destination, err := api.NewClient(tokens.Destination, m.Destination.Host)
+		if err != nil {
+			return nil, err
+		}
+		return &treeClients{source, destination, "root", "root"}, nil
+	}
+	return nil, errors.New("Unknown tree " + tree)
+}
+
+// Apply the steps of a plan which are not recorded as done in the checkpoint
+// Failed steps are reported and left out of the checkpoint, so running the
+// same plan again retries them
+func (m *Migrator) Run(plan *Plan) (*Report, error) {
+	cp, err := m.checkpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := sdk.ListAllGroups(m.Destination, sdk.DEFAULT_PAGE_SIZE)
+	if err != nil {
+		return nil, err
+	}
+	r := migration{m: m, cp: cp, groups: map[string]string{}, folders: map[string]string{},
+		report: Report{Failures: []sdk.Failure{}}}
+	for _, g := range groups {
+		r.groups[g.Name] = g.Id
+	}
+
+	files := []Step{}
+	for _, s := range plan.Steps {
+		if cp.isDone(s) {
+			r.report.Skipped++
+			continue
+		}
+		if s.Type == CopyFile {
+			files = append(files, s)
+			continue
+		}
+
+		r.finish(s, r.apply(s))
+		err = cp.save()
+		if err != nil {
+			return &r.report, err
+		}
+	}
+
+	r.copyFiles(files)
+	return &r.report, cp.save()
+}
+
+// Record the outcome of a step, errExists counts as done
+func (r *migration) finish(s Step, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch {
+	case err == errExists:
+		r.report.Skipped++
+	case err != nil:
+		r.m.log("%s : %s", s, err)
+		r.report.Failures = append(r.report.Failures, sdk.Failure{Item: s.String(), Error: err.Error()})
+		return
+	default:
+		r.m.log("%s", s)
+		r.report.Done++
+	}
+	r.cp.markDone(s)
+}
+
+// Returned by steps whose result is already present on the destination
+var errExists = errors.New("Already exists")
+
+// Adding a member who already has access fails with a conflict
+func conflict(err error) error {
+	if api.IsStatus(err, 409) {
+		return errExists
+	}
+	return err
+}
+
+func (r *migration) apply(s Step) error {
+	dst := r.m.Destination
+	switch s.Type {
+	case CreateUser:
+		_, err := sdk.CreateUserClient(dst, s.Target, s.FirstName, s.LastName)
+		return conflict(err)
+
+	case CreateGroup:
+		if _, ok := r.groups[s.Target]; ok {
+			return errExists
+		}
+		g, err := sdk.CreateGroupClient(dst, s.Target)
+		if err != nil {
+			return err
+		}
+		r.groups[s.Target] = g.Desc.Id
+		return nil
+
+	case AddGroupMember:
+		gid, ok := r.groups[s.Target]
+		if !ok {
+			return errors.New("The group does not exist on the destination")
+		}
+		_, _, err := dst.AddGroupMember(gid, s.Member)
+		return conflict(err)
+
+	case CreateShare:
+		sid := strings.TrimPrefix(s.Tree, "share:")
+		if _, ok := r.cp.share(sid); ok {
+			return errExists
+		}
+		sf, err := sdk.CreateSharedFolderClient(dst, s.Target)
+		if err != nil {
+			return err
+		}
+		r.cp.setShare(sid, sf.Desc.Id)
+		return nil
+
+	case CreateFolder:
+		_, err := r.folder(s.Tree, s.Target)
+		return err
+	}
+
+	sid, ok := r.cp.share(strings.TrimPrefix(s.Tree, "share:"))
+	if !ok {
+		return errors.New("The shared folder was not created on the destination")
+	}
+	switch s.Type {
+	case AddShareMember:
+		_, _, err := dst.AddSFMember(sid, s.Member, s.Permissions)
+		return conflict(err)
+
+	case AddShareGroup:
+		gid, ok := r.groups[s.Member]
+		if !ok {
+			return errors.New("The group does not exist on the destination")
+		}
+		_, _, err := dst.AddGroupToSharedFolder(sid, gid, s.Permissions)
+		return conflict(err)
+
+	case InviteMember:
+		_, _, err := dst.InviteSFMember(sid, s.Member, s.Permissions, s.Note)
+		return conflict(err)
+	}
+	return fmt.Errorf("Unknown step %s", s.Type)
+}
+
+// Return the destination identifier of a folder of a tree, creating it and
+// its parents if needed
+func (r *migration) folder(tree, dir string) (string, error) {
+	key := tree + "\x00" + dir
+	r.mu.Lock()
+	id, ok := r.folders[key]
+	r.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	clients, err := r.m.treeClients(tree)
+	if err != nil {
+		return "", err
+	}
+	root := &sdk.FolderClient{APIClient: clients.destination, Desc: sdk.Folder{Id: clients.destRoot}}
+	if dir != "" {
+		root, err = root.MkdirAll(dir)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	r.mu.Lock()
+	r.folders[key] = root.Desc.Id
+	r.mu.Unlock()
+	return root.Desc.Id, nil
+}
+
+func (r *migration) copyFiles(files []Step) {
+	steps := make(chan Step)
+	wg := sync.WaitGroup{}
+	for i := 0; i < r.m.Options.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range steps {
+				r.finish(s, r.copyFile(s))
+				r.progress()
+			}
+		}()
+	}
+
+	for _, s := range files {
+		steps <- s
+	}
+	close(steps)
+	wg.Wait()
+}
+
+// Save the checkpoint every CHECKPOINT_INTERVAL files
+func (r *migration) progress() {
+	r.mu.Lock()
+	r.copied++
+	save := r.copied%CHECKPOINT_INTERVAL == 0
+	r.mu.Unlock()
+
+	if save {
+		err := r.cp.save()
+		if err != nil {
+			r.m.log("Unable to save the checkpoint : %s", err)
+		}
+	}
+}
+
+// Stream a file from the source to the destination
+// A file left by an interrupted copy has a different size and is replaced,
+// a file of the expected size is assumed to be complete
+func (r *migration) copyFile(s Step) error {
+	clients, err := r.m.treeClients(s.Tree)
+	if err != nil {
+		return err
+	}
+	dir, name := path.Split(s.Target)
+	parentId, err := r.folder(s.Tree, strings.TrimSuffix(dir, "/"))
+	if err != nil {
+		return err
+	}
+
+	opts := sdk.PutOptions{Overwrite: sdk.FailIfExists, MimeType: s.Mime}
+	err = r.transfer(clients, s, parentId, name, opts)
+	if err != sdk.ErrFileExists {
+		return err
+	}
+
+	parent := sdk.FolderClient{APIClient: clients.destination, Desc: sdk.Folder{Id: parentId}}
+	err = parent.LoadChildren()
+	if err != nil {
+		return err
+	}
+	for _, f := range parent.Desc.ChildList.Files {
+		if f.Name != name {
+			continue
+		}
+		if f.Size == s.Size {
+			return errExists
+		}
+		opts.Overwrite, opts.IfMatch = sdk.OverwriteIfMatch, f.Etag
+		return r.transfer(clients, s, parentId, name, opts)
+	}
+	return sdk.ErrFileExists
+}
+
+func (r *migration) transfer(clients *treeClients, s Step, parentId, name string, opts sdk.PutOptions) error {
+	source := sdk.FileClient{APIClient: clients.source,
+		Desc: sdk.File{Id: s.SourceId, Etag: s.Etag, Size: s.Size}}
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(source.Download(writer))
+	}()
+
+	_, err := sdk.PutFile(clients.destination, parentId, name, reader, opts)
+	reader.CloseWithError(errors.New("Upload ended"))
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.report.Bytes += int64(s.Size)
+	r.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,158 @@
+package aerofsmigrate
+
+// Verification that the files of a plan arrived intact on the destination
+
+import (
+	"fmt"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"io/ioutil"
+	"sync"
+)
+
+// A file which differs between the source and the destination
+type Mismatch struct {
+	Tree string `json:"tree"`
+	Path string `json:"path"`
+
+	// "missing", "size", "sha256" or "error"
+	Property    string `json:"property"`
+	Source      string `json:"source,omitempty"`
+	Destination string `json:"destination,omitempty"`
+}
+
+// The result of Verify
+type VerifyReport struct {
+	Compared   int        `json:"compared"`
+	Mismatches []Mismatch `json:"mismatches"`
+}
+
+// Compare the files of a plan on both Appliances, first by size and then by
+// the SHA-256 of their content, which downloads every file from both
+func (m *Migrator) Verify(plan *Plan) (*VerifyReport, error) {
+	_, err := m.checkpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	report := VerifyReport{Mismatches: []Mismatch{}}
+	mu := sync.Mutex{}
+	mismatch := func(mm Mismatch) {
+		mu.Lock()
+		report.Mismatches = append(report.Mismatches, mm)
+		mu.Unlock()
+	}
+
+	type comparison struct {
+		step Step
+		file sdk.File
+	}
+
+	trees := map[string]map[string]sdk.File{}
+	comparisons := make(chan comparison)
+	wg := sync.WaitGroup{}
+	for i := 0; i < m.Options.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range comparisons {
+				mm := m.compare(c.step, c.file)
+				if mm != nil {
+					mismatch(*mm)
+				}
+			}
+		}()
+	}
+
+	for _, s := range plan.Steps {
+		if s.Type != CopyFile {
+			continue
+		}
+		if _, ok := trees[s.Tree]; !ok {
+			files, err := m.destinationFiles(s.Tree)
+			if err != nil {
+				m.log("%s : %s", s.Tree, err)
+			}
+			trees[s.Tree] = files
+		}
+
+		report.Compared++
+		file, ok := trees[s.Tree][s.Target]
+		if !ok {
+			mismatch(Mismatch{Tree: s.Tree, Path: s.Target, Property: "missing"})
+			continue
+		}
+		comparisons <- comparison{s, file}
+	}
+	close(comparisons)
+	wg.Wait()
+	return &report, nil
+}
+
+// Return the files of a tree on the destination by path
+func (m *Migrator) destinationFiles(tree string) (map[string]sdk.File, error) {
+	files := map[string]sdk.File{}
+	clients, err := m.treeClients(tree)
+	if err != nil {
+		return files, err
+	}
+
+	root := sdk.FolderClient{APIClient: clients.destination, Desc: sdk.Folder{Id: clients.destRoot}}
+	err = root.Walk(func(entry sdk.TreeEntry, err error) error {
+		switch {
+		case err != nil:
+			m.log("%s: %s : %s", tree, entry.Path, err)
+		case entry.IsDir && entry.Folder.IsShared:
+			return sdk.SkipFolder
+		case !entry.IsDir:
+			files[entry.Path] = entry.File
+		}
+		return nil
+	})
+	return files, err
+}
+
+func (m *Migrator) compare(s Step, dst sdk.File) *Mismatch {
+	clients, err := m.treeClients(s.Tree)
+	if err != nil {
+		return &Mismatch{Tree: s.Tree, Path: s.Target, Property: "error", Source: err.Error()}
+	}
+
+	source, err := sdk.NewFileClient(clients.source, s.SourceId, []string{})
+	if err != nil {
+		return &Mismatch{Tree: s.Tree, Path: s.Target, Property: "error", Source: err.Error()}
+	}
+	destination := sdk.FileClient{APIClient: clients.destination, Desc: dst}
+	if destination.Desc.Etag == "" {
+		err = destination.LoadMetadata()
+		if err != nil {
+			return &Mismatch{Tree: s.Tree, Path: s.Target, Property: "error", Destination: err.Error()}
+		}
+	}
+
+	if source.Desc.Size != destination.Desc.Size {
+		return &Mismatch{Tree: s.Tree, Path: s.Target, Property: "size",
+			Source: fmt.Sprint(source.Desc.Size), Destination: fmt.Sprint(destination.Desc.Size)}
+	}
+
+	sourceHash, err := hash(source)
+	if err != nil {
+		return &Mismatch{Tree: s.Tree, Path: s.Target, Property: "error", Source: err.Error()}
+	}
+	destHash, err := hash(&destination)
+	if err != nil {
+		return &Mismatch{Tree: s.Tree, Path: s.Target, Property: "error", Destination: err.Error()}
+	}
+	if sourceHash != destHash {
+		return &Mismatch{Tree: s.Tree, Path: s.Target, Property: "sha256",
+			Source: sourceHash, Destination: destHash}
+	}
+	return nil
+}
+
+func hash(f *sdk.FileClient) (string, error) {
+	digest, err := f.DownloadVerified(ioutil.Discard, sdk.VerifyOptions{})
+	if err != nil {
+		return "", err
+	}
+	return digest.SHA256, nil
+}
@@ -0,0 +1,63 @@
+package aerofsprovision
+
+import (
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	"net/http"
+)
+
+// Kinds of errors
+const (
+	// The row is invalid, fix it before running again
+	INVALID = "invalid"
+	// A group or shared folder does not exist
+	NOT_FOUND = "not_found"
+	// The token lacks a scope or the admin privileges
+	FORBIDDEN = "forbidden"
+	// The user or membership changed concurrently
+	CONFLICT = "conflict"
+	// The Appliance failed or could not be reached, running again may succeed
+	SERVER  = "server"
+	NETWORK = "network"
+)
+
+// Why a step of a row failed
+type RowError struct {
+	Kind    string `json:"kind"`
+	Step    string `json:"step"`
+	Message string `json:"message"`
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("%s : %s : %s", e.Step, e.Kind, e.Message)
+}
+
+// Return whether running again may succeed without changing the row
+func (e RowError) Temporary() bool {
+	return e.Kind == SERVER || e.Kind == NETWORK || e.Kind == CONFLICT
+}
+
+// Classify the error of a step by the status code of the response, if any
+func classify(step string, err error) RowError {
+	resErr, ok := err.(*api.ResponseError)
+	if !ok {
+		return RowError{Kind: NETWORK, Step: step, Message: err.Error()}
+	}
+
+	kind := SERVER
+	switch code := resErr.StatusCode; {
+	case code == http.StatusBadRequest:
+		kind = INVALID
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		kind = FORBIDDEN
+	case code == http.StatusNotFound:
+		kind = NOT_FOUND
+	case code == http.StatusConflict || code == http.StatusPreconditionFailed:
+		kind = CONFLICT
+	}
+	message := resErr.Status
+	if len(resErr.Body) > 0 {
+		message += " " + string(resErr.Body)
+	}
+	return RowError{Kind: kind, Step: step, Message: message}
+}
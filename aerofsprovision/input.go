@@ -0,0 +1,212 @@
+package aerofsprovision
+
+// Reading the rows to provision from CSV or JSON
+//
+// CSV files have a header row naming the columns, in any order :
+//   email,first_name,last_name,groups,shares,invite
+//   frodo@example.com,Frodo,Baggins,Fellowship;Hobbits,Maps:editor;Songs:WRITE,true
+// Groups are separated by ";", as are shared folders, each followed by ":" and
+// a role or permissions. JSON files hold a list of rows :
+//   [{"email": "frodo@example.com", "first_name": "Frodo", "last_name": "Baggins",
+//     "groups": ["Fellowship"], "shares": [{"share": "Maps", "permissions": ["WRITE"]}]}]
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	"io"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Membership of a shared folder, given by name or SID
+type ShareGrant struct {
+	Share       string            `json:"share"`
+	Permissions api.PermissionSet `json:"permissions"`
+}
+
+// A user to provision
+type Row struct {
+	// The line of the row in a CSV file, or its position in a JSON list
+	Line int `json:"line"`
+
+	Email     string       `json:"email"`
+	FirstName string       `json:"first_name"`
+	LastName  string       `json:"last_name"`
+	Groups    []string     `json:"groups,omitempty"`
+	Shares    []ShareGrant `json:"shares,omitempty"`
+
+	// Users who do not exist yet are invited to sign up rather than created,
+	// and invited to their shared folders
+	Invite bool `json:"invite,omitempty"`
+
+	// Why the row could not be parsed, if it could not
+	invalid string
+}
+
+var csvColumns = []string{"email", "first_name", "last_name", "groups", "shares", "invite"}
+
+// Read rows from a CSV or JSON file, depending on its extension
+func ReadFile(fileName string) ([]Row, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".csv":
+		return ReadCSV(f)
+	case ".json":
+		return ReadJSON(f)
+	}
+	return nil, errors.New("Unknown format, use a .csv or .json file")
+}
+
+// Read rows from CSV, with a header row
+// Rows with invalid values are returned and reported as invalid by Validate
+func ReadCSV(r io.Reader) ([]Row, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the CSV header : %s", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		known := false
+		for _, c := range csvColumns {
+			known = known || c == name
+		}
+		if !known {
+			return nil, fmt.Errorf("Unknown CSV column %q", name)
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["email"]; !ok {
+		return nil, errors.New("The CSV header has no email column")
+	}
+
+	rows := []Row{}
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		field := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		row := Row{Line: line, Email: field("email"), FirstName: field("first_name"),
+			LastName: field("last_name"), Groups: splitList(field("groups"))}
+		for _, s := range splitList(field("shares")) {
+			grant, err := parseGrant(s)
+			if err != nil {
+				row.invalid = err.Error()
+			}
+			row.Shares = append(row.Shares, grant)
+		}
+		if invite := field("invite"); invite != "" {
+			row.Invite, err = strconv.ParseBool(invite)
+			if err != nil {
+				row.invalid = fmt.Sprintf("Invalid invite value %q", invite)
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+// Split a list separated by ";", without empty entries
+func splitList(s string) []string {
+	list := []string{}
+	for _, item := range strings.Split(s, ";") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// Parse "<share>:<role or permissions>", a share without permissions is joined
+// as a viewer
+func parseGrant(s string) (ShareGrant, error) {
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		return ShareGrant{Share: s, Permissions: api.PermissionSet{}}, nil
+	}
+	permissions, err := api.ParsePermissionSet(s[i+1:])
+	if err != nil {
+		return ShareGrant{Share: s[:i]}, fmt.Errorf("%s : %s", s[:i], err)
+	}
+	return ShareGrant{Share: strings.TrimSpace(s[:i]), Permissions: permissions}, nil
+}
+
+// Read rows from a JSON list
+func ReadJSON(r io.Reader) ([]Row, error) {
+	rows := []Row{}
+	err := json.NewDecoder(r).Decode(&rows)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to unmarshal the rows : %s", err)
+	}
+	for i := range rows {
+		if rows[i].Line == 0 {
+			rows[i].Line = i + 1
+		}
+	}
+	return rows, nil
+}
+
+// Return why every invalid row is invalid, by line
+// Emails listed twice are invalid on every line after the first
+func Validate(rows []Row) map[int]string {
+	invalid := map[int]string{}
+	seen := map[string]int{}
+	for _, row := range rows {
+		email := strings.ToLower(row.Email)
+		switch {
+		case row.invalid != "":
+			invalid[row.Line] = row.invalid
+		case row.Email == "":
+			invalid[row.Line] = "Missing email"
+		case !validEmail(row.Email):
+			invalid[row.Line] = fmt.Sprintf("Invalid email %q", row.Email)
+		case seen[email] != 0:
+			invalid[row.Line] = fmt.Sprintf("%s is already listed on line %d", row.Email, seen[email])
+		case !row.Invite && (row.FirstName == "" || row.LastName == ""):
+			invalid[row.Line] = "Users need a first and last name"
+		case row.Invite && len(row.Groups) > 0:
+			invalid[row.Line] = "Invitees cannot join groups before they sign up"
+		}
+		for _, grant := range row.Shares {
+			if err := grant.Permissions.Validate(); err != nil && invalid[row.Line] == "" {
+				invalid[row.Line] = fmt.Sprintf("%s : %s", grant.Share, err)
+			}
+			if grant.Share == "" && invalid[row.Line] == "" {
+				invalid[row.Line] = "Missing shared folder name"
+			}
+		}
+		if seen[email] == 0 {
+			seen[email] = row.Line
+		}
+	}
+	return invalid
+}
+
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
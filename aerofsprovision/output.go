@@ -0,0 +1,48 @@
+package aerofsprovision
+
+// JSON and CSV output of a report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// Write one row per provisioned row, with a header row
+func (r *Report) WriteCSV(w io.Writer) error {
+	rows := [][]string{{"line", "email", "status", "actions", "error_kinds", "errors"}}
+	for _, result := range r.Results {
+		kinds, messages := []string{}, []string{}
+		for _, e := range result.Errors {
+			kinds = append(kinds, e.Kind)
+			messages = append(messages, e.Error())
+		}
+		rows = append(rows, []string{fmt.Sprint(result.Line), result.Email, result.Status,
+			strings.Join(result.Actions, "; "), strings.Join(kinds, ";"), strings.Join(messages, "; ")})
+	}
+
+	cw := csv.NewWriter(w)
+	cw.WriteAll(rows)
+	return cw.Error()
+}
+
+// Read a report written as JSON
+func ReadReport(r io.Reader) (*Report, error) {
+	report := Report{}
+	err := json.NewDecoder(r).Decode(&report)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to unmarshal the report : %s", err)
+	}
+	return &report, nil
+}
@@ -0,0 +1,398 @@
+package aerofsprovision
+
+// Creating and updating users, their groups and shared folders
+// Every step first checks the current state, so running the same rows again
+// only performs what is missing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The number of rows provisioned at once by default
+const DEFAULT_CONCURRENCY = 4
+
+// Statuses of a row
+const (
+	CREATED   = "created"
+	UPDATED   = "updated"
+	UNCHANGED = "unchanged"
+	INVITED   = "invited"
+	FAILED    = "failed"
+)
+
+// Options for Provision
+type Options struct {
+	// The number of rows provisioned at once, DEFAULT_CONCURRENCY if 0
+	Concurrency int
+
+	// The email sign up invitations are sent from, required to invite
+	Inviter string
+
+	// Called with progress messages, may be nil
+	Log func(format string, args ...interface{})
+}
+
+// The outcome of a row
+// A failed row may have been partially provisioned, the actions list what was
+// done
+type Result struct {
+	Line    int        `json:"line"`
+	Email   string     `json:"email"`
+	Status  string     `json:"status"`
+	Actions []string   `json:"actions"`
+	Errors  []RowError `json:"errors,omitempty"`
+}
+
+type Report struct {
+	Results []Result `json:"results"`
+}
+
+// Return the number of rows with every status
+func (r *Report) Counts() map[string]int {
+	counts := map[string]int{}
+	for _, result := range r.Results {
+		counts[result.Status]++
+	}
+	return counts
+}
+
+// Return the rows which did not fail in a previous report, so only failed and
+// new rows are provisioned again
+func Retry(rows []Row, previous *Report) []Row {
+	done := map[string]bool{}
+	for _, result := range previous.Results {
+		if result.Status != FAILED {
+			done[strings.ToLower(result.Email)] = true
+		}
+	}
+	retry := []Row{}
+	for _, row := range rows {
+		if !done[strings.ToLower(row.Email)] {
+			retry = append(retry, row)
+		}
+	}
+	return retry
+}
+
+var sidPattern = regexp.MustCompile("^[0-9a-f]{32}$")
+
+// The groups and shared folders rows refer to, resolved once
+type provisioner struct {
+	client *api.Client
+	opts   Options
+
+	groupIds map[string]string
+	sids     map[string][]string
+
+	mu      sync.Mutex
+	members map[string]*groupMembers
+}
+
+// The members of a group, listed once
+type groupMembers struct {
+	once   sync.Once
+	emails map[string]bool
+	err    error
+}
+
+// Provision every row, invalid rows are reported as failed without any change
+func Provision(c *api.Client, rows []Row, opts Options) (*Report, error) {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DEFAULT_CONCURRENCY
+	}
+	invalid := Validate(rows)
+	for _, row := range rows {
+		if row.Invite && opts.Inviter == "" && invalid[row.Line] == "" {
+			return nil, errors.New("An inviter email is required to invite users")
+		}
+	}
+
+	p := provisioner{client: c, opts: opts, members: map[string]*groupMembers{}}
+	err := p.resolve(rows, invalid)
+	if err != nil {
+		return nil, err
+	}
+
+	report := Report{Results: make([]Result, len(rows))}
+	indexes := make(chan int)
+	wg := sync.WaitGroup{}
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				row := rows[i]
+				if reason, ok := invalid[row.Line]; ok {
+					report.Results[i] = Result{Line: row.Line, Email: row.Email, Status: FAILED,
+						Actions: []string{}, Errors: []RowError{{Kind: INVALID, Step: "validate", Message: reason}}}
+				} else {
+					report.Results[i] = p.provision(row)
+				}
+				p.log(report.Results[i])
+			}
+		}()
+	}
+	for i := range rows {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return &report, nil
+}
+
+func (p *provisioner) log(result Result) {
+	if p.opts.Log == nil {
+		return
+	}
+	p.opts.Log("line %d : %s : %s", result.Line, result.Email, result.Status)
+	for _, e := range result.Errors {
+		p.opts.Log("line %d : %s : %s", result.Line, result.Email, e)
+	}
+}
+
+// Look up the groups by name, and the shared folders which are not given by
+// SID
+func (p *provisioner) resolve(rows []Row, invalid map[int]string) error {
+	groups := false
+	names := map[string]bool{}
+	for _, row := range rows {
+		if invalid[row.Line] != "" {
+			continue
+		}
+		groups = groups || len(row.Groups) > 0
+		for _, grant := range row.Shares {
+			if !sidPattern.MatchString(grant.Share) {
+				names[grant.Share] = true
+			}
+		}
+	}
+
+	p.groupIds = map[string]string{}
+	if groups {
+		list, err := sdk.ListAllGroups(p.client, sdk.DEFAULT_PAGE_SIZE)
+		if err != nil {
+			return err
+		}
+		for _, g := range list {
+			p.groupIds[g.Name] = g.Id
+		}
+	}
+
+	p.sids = map[string][]string{}
+	if len(names) == 0 {
+		return nil
+	}
+	list := []string{}
+	for name := range names {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	var err error
+	p.sids, err = sdk.FindSharedFolders(p.client, list)
+	return err
+}
+
+func (p *provisioner) provision(row Row) Result {
+	result := Result{Line: row.Line, Email: row.Email, Actions: []string{}}
+	fail := func(step string, err error) {
+		result.Errors = append(result.Errors, classify(step, err))
+	}
+
+	status, exists, err := p.provisionUser(row)
+	if err != nil {
+		fail("user", err)
+		result.Status = FAILED
+		return result
+	}
+	result.Status = status
+	if status != UNCHANGED {
+		result.Actions = append(result.Actions, status+" "+row.Email)
+	}
+
+	for _, name := range row.Groups {
+		added, err := p.joinGroup(row.Email, name)
+		switch {
+		case err != nil:
+			result.Errors = append(result.Errors, err.(RowError))
+		case added:
+			result.Actions = append(result.Actions, "joined group "+name)
+		}
+	}
+
+	for _, grant := range row.Shares {
+		action, err := p.joinShare(row.Email, grant, exists)
+		switch {
+		case err != nil:
+			result.Errors = append(result.Errors, err.(RowError))
+		case action != "":
+			result.Actions = append(result.Actions, action)
+		}
+	}
+
+	if len(result.Errors) > 0 {
+		result.Status = FAILED
+	} else if status == UNCHANGED && len(result.Actions) > 0 {
+		result.Status = UPDATED
+	}
+	return result
+}
+
+// Create, update or invite the user, returning whether the user exists
+func (p *provisioner) provisionUser(row Row) (string, bool, error) {
+	body, _, err := p.client.GetUser(row.Email)
+	switch {
+	case err == nil:
+		user := sdk.User{}
+		err = json.Unmarshal(body, &user)
+		if err != nil {
+			return "", false, errors.New("Unable to unmarshal retrieved User")
+		}
+		if (row.FirstName == "" || row.FirstName == user.FirstName) &&
+			(row.LastName == "" || row.LastName == user.LastName) {
+			return UNCHANGED, true, nil
+		}
+		// An empty name keeps the stored one, as the update replaces both
+		firstName, lastName := row.FirstName, row.LastName
+		if firstName == "" {
+			firstName = user.FirstName
+		}
+		if lastName == "" {
+			lastName = user.LastName
+		}
+		_, _, err = p.client.UpdateUser(row.Email, firstName, lastName)
+		return UPDATED, true, err
+
+	case !api.IsStatus(err, http.StatusNotFound):
+		return "", false, err
+
+	case !row.Invite:
+		_, _, err = p.client.CreateUser(row.Email, row.FirstName, row.LastName)
+		return CREATED, err == nil, err
+	}
+
+	_, _, err = p.client.GetInvitee(row.Email)
+	if err == nil {
+		return UNCHANGED, false, nil
+	}
+	if !api.IsStatus(err, http.StatusNotFound) {
+		return "", false, err
+	}
+	_, _, err = p.client.CreateInvitee(row.Email, p.opts.Inviter)
+	return INVITED, false, err
+}
+
+// Add a user to a group unless already a member, returning whether it was
+// added
+func (p *provisioner) joinGroup(email, name string) (bool, error) {
+	step := "group " + name
+	id, ok := p.groupIds[name]
+	if !ok {
+		return false, RowError{Kind: NOT_FOUND, Step: step, Message: "No group is named " + name}
+	}
+
+	p.mu.Lock()
+	members, ok := p.members[id]
+	if !ok {
+		members = &groupMembers{}
+		p.members[id] = members
+	}
+	p.mu.Unlock()
+
+	members.once.Do(func() {
+		list, err := sdk.ListGroupMembers(p.client, id)
+		members.emails, members.err = map[string]bool{}, err
+		for _, m := range list {
+			members.emails[strings.ToLower(m.Email)] = true
+		}
+	})
+	if members.err != nil {
+		return false, classify(step, members.err)
+	}
+
+	p.mu.Lock()
+	member := members.emails[strings.ToLower(email)]
+	p.mu.Unlock()
+	if member {
+		return false, nil
+	}
+
+	_, _, err := p.client.AddGroupMember(id, email)
+	if api.IsStatus(err, http.StatusConflict) {
+		return false, nil
+	}
+	if err != nil {
+		return false, classify(step, err)
+	}
+	p.mu.Lock()
+	members.emails[strings.ToLower(email)] = true
+	p.mu.Unlock()
+	return true, nil
+}
+
+// Add a user to a shared folder, or invite them if they do not exist yet, or
+// change their permissions, returning what was done
+func (p *provisioner) joinShare(email string, grant ShareGrant, exists bool) (string, error) {
+	step := "share " + grant.Share
+	sid := grant.Share
+	if !sidPattern.MatchString(sid) {
+		switch sids := p.sids[grant.Share]; len(sids) {
+		case 0:
+			return "", RowError{Kind: NOT_FOUND, Step: step, Message: "No shared folder is named " + grant.Share}
+		case 1:
+			sid = sids[0]
+		default:
+			return "", RowError{Kind: INVALID, Step: step,
+				Message: "Several shared folders are named " + grant.Share + ", use its SID"}
+		}
+	}
+
+	var err error
+	var current api.PermissionSet
+	var update func(api.PermissionSet) error
+	if exists {
+		var member *sdk.SFMemberClient
+		member, err = sdk.GetSFMemberClient(p.client, sid, email, nil)
+		if err == nil {
+			current, update = member.Desc.Permissions, member.UpdatePermissions
+		}
+	} else {
+		var pending *sdk.SFPendingMemberClient
+		pending, err = sdk.GetSFPendingMemberClient(p.client, sid, email, nil)
+		if err == nil {
+			current, update = pending.Desc.Permissions, pending.UpdatePermissions
+		}
+	}
+
+	switch {
+	case err == nil && current.Equal(grant.Permissions):
+		return "", nil
+	case err == nil:
+		err = update(grant.Permissions)
+		if err != nil {
+			return "", classify(step, err)
+		}
+		return fmt.Sprintf("set %s permissions on %s", grant.Permissions.Role(), grant.Share), nil
+	case !api.IsStatus(err, http.StatusNotFound):
+		return "", classify(step, err)
+	case exists:
+		_, err = sdk.CreateSFMemberClient(p.client, sid, email, grant.Permissions)
+	default:
+		_, err = sdk.CreateSFPendingMemberClient(p.client, sid, email, grant.Permissions, "")
+	}
+	if err != nil {
+		return "", classify(step, err)
+	}
+	if exists {
+		return fmt.Sprintf("joined %s as %s", grant.Share, grant.Permissions.Role()), nil
+	}
+	return fmt.Sprintf("invited to %s as %s", grant.Share, grant.Permissions.Role()), nil
+}
@@ -0,0 +1,162 @@
+package aerofsprovision
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testCSV = `Email, First_Name, Last_Name, Groups, Shares, Invite
+frodo@shire.org,Frodo,Baggins,Fellowship;Hobbits,"Maps:editor;Songs:WRITE,MANAGE",
+sam@shire.org,Samwise,Gamgee,,Maps,false
+gandalf@istari.org,,,,Maps:owner,true
+bad-email,A,B,,,
+frodo@shire.org,Frodo,Baggins,,,
+gollum@misty.org,,,,,
+saruman@istari.org,,,Wizards,,yes please
+radagast@istari.org,Radagast,Brown,,Maps:READ,
+`
+
+func TestReadCSV(t *testing.T) {
+	rows, err := ReadCSV(strings.NewReader(testCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 8 {
+		t.Fatalf("Expected 8 rows, got %d", len(rows))
+	}
+
+	frodo := rows[0]
+	if frodo.Line != 2 || frodo.FirstName != "Frodo" || len(frodo.Groups) != 2 || len(frodo.Shares) != 2 ||
+		frodo.Shares[0].Share != "Maps" || frodo.Shares[0].Permissions.String() != "WRITE" ||
+		frodo.Shares[1].Permissions.String() != "MANAGE,WRITE" || frodo.Invite {
+		t.Errorf("Unexpected row %+v", frodo)
+	}
+	if len(rows[1].Shares[0].Permissions) != 0 || !rows[2].Invite {
+		t.Errorf("Unexpected rows %+v %+v", rows[1], rows[2])
+	}
+
+	invalid := Validate(rows)
+	expected := map[int]string{
+		5: "Invalid email",
+		6: "already listed on line 2",
+		7: "first and last name",
+		8: "Invalid invite",
+		9: "Unknown permission",
+	}
+	if len(invalid) != len(expected) {
+		t.Errorf("Expected %d invalid rows, got %v", len(expected), invalid)
+	}
+	for line, reason := range expected {
+		if !strings.Contains(invalid[line], reason) {
+			t.Errorf("Line %d : expected %q, got %q", line, reason, invalid[line])
+		}
+	}
+
+	if _, err = ReadCSV(strings.NewReader("email,age\n")); err == nil {
+		t.Errorf("Expected an error for an unknown column")
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+	rows, err := ReadJSON(strings.NewReader(`[
+		{"email": "frodo@shire.org", "first_name": "Frodo", "last_name": "Baggins",
+		 "shares": [{"share": "0123456789abcdef0123456789abcdef", "permissions": ["write"]}]},
+		{"email": "gandalf@istari.org", "invite": true, "groups": ["Wizards"]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows[0].Line != 1 || rows[1].Line != 2 || !rows[0].Shares[0].Permissions.Equal(api.PermissionSet{"WRITE"}) {
+		t.Errorf("Unexpected rows %+v", rows)
+	}
+	invalid := Validate(rows)
+	if len(invalid) != 1 || !strings.Contains(invalid[2], "Invitees cannot join groups") {
+		t.Errorf("Unexpected validation %v", invalid)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		err       error
+		kind      string
+		temporary bool
+	}{
+		{&api.ResponseError{Status: "404 Not Found", StatusCode: 404}, NOT_FOUND, false},
+		{&api.ResponseError{Status: "403 Forbidden", StatusCode: 403}, FORBIDDEN, false},
+		{&api.ResponseError{Status: "409 Conflict", StatusCode: 409}, CONFLICT, true},
+		{&api.ResponseError{Status: "400 Bad Request", StatusCode: 400, Body: []byte("bad")}, INVALID, false},
+		{&api.ResponseError{Status: "503 Service Unavailable", StatusCode: 503}, SERVER, true},
+		{errors.New("connection refused"), NETWORK, true},
+	}
+	for _, c := range cases {
+		e := classify("user", c.err)
+		if e.Kind != c.kind || e.Temporary() != c.temporary || e.Step != "user" {
+			t.Errorf("%s : unexpected %+v", c.err, e)
+		}
+	}
+}
+
+func TestRetryAndReport(t *testing.T) {
+	report := &Report{Results: []Result{
+		{Line: 2, Email: "frodo@shire.org", Status: CREATED, Actions: []string{"created frodo@shire.org"}},
+		{Line: 3, Email: "sam@shire.org", Status: FAILED, Actions: []string{},
+			Errors: []RowError{{Kind: NETWORK, Step: "user", Message: "timeout"}}},
+	}}
+	rows := []Row{{Email: "Frodo@shire.org"}, {Email: "sam@shire.org"}, {Email: "merry@shire.org"}}
+	retry := Retry(rows, report)
+	if len(retry) != 2 || retry[0].Email != "sam@shire.org" || retry[1].Email != "merry@shire.org" {
+		t.Errorf("Unexpected rows to retry %v", retry)
+	}
+
+	out := bytes.Buffer{}
+	err := report.WriteJSON(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadReport(&out)
+	if err != nil || len(read.Results) != 2 || read.Results[1].Errors[0].Kind != NETWORK {
+		t.Errorf("Unexpected report %+v : %v", read, err)
+	}
+
+	out.Reset()
+	report.WriteCSV(&out)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || lines[2] != "3,sam@shire.org,failed,,network,user : network : timeout" {
+		t.Errorf("Unexpected CSV\n%s", out.String())
+	}
+	if report.Counts()[FAILED] != 1 {
+		t.Errorf("Unexpected counts %v", report.Counts())
+	}
+}
+
+// Updating one name of an existing user keeps the other
+func TestProvisionUserKeepsName(t *testing.T) {
+	updated := map[string]string{}
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1.3/users/frodo@shire.org" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == "PUT" {
+			json.NewDecoder(r.Body).Decode(&updated)
+		}
+		w.Write([]byte(`{"email":"frodo@shire.org","first_name":"Frodo","last_name":"Baggins"}`))
+	}))
+	defer ts.Close()
+	c, _ := api.NewClient("token", strings.TrimPrefix(ts.URL, "https://"))
+	c.SetHTTPClient(ts.Client())
+
+	p := provisioner{client: c}
+	status, exists, err := p.provisionUser(Row{Email: "frodo@shire.org", LastName: "Underhill"})
+	if err != nil || status != UPDATED || !exists {
+		t.Fatalf("Unexpected %s %v %v", status, exists, err)
+	}
+	if updated["first_name"] != "Frodo" || updated["last_name"] != "Underhill" {
+		t.Errorf("Unexpected update %v", updated)
+	}
+}
@@ -0,0 +1,62 @@
+package aerofsscim
+
+// Filters of list requests
+// Only equality of a single attribute is supported, ie. userName eq "x",
+// which is what identity providers use to look up a resource before
+// creating it
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var filterPattern = regexp.MustCompile(`(?i)^\s*([a-z][\w.$]*)\s+eq\s+("(?:[^"\\]|\\.)*")\s*$`)
+
+// A parsed filter, the attribute is lower case as attributes are case
+// insensitive
+type filter struct {
+	Attribute string
+	Value     string
+}
+
+// Parse a filter, nil if there is none
+func parseFilter(s string, attributes ...string) (*filter, *Error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	match := filterPattern.FindStringSubmatch(s)
+	if match == nil {
+		return nil, newError(http.StatusBadRequest, "invalidFilter",
+			"Only filters of the form attribute eq \"value\" are supported")
+	}
+	value, err := strconv.Unquote(match[2])
+	if err != nil {
+		return nil, newError(http.StatusBadRequest, "invalidFilter", "Invalid value "+match[2])
+	}
+	attribute := strings.ToLower(match[1])
+	for _, a := range attributes {
+		if attribute == strings.ToLower(a) {
+			return &filter{Attribute: attribute, Value: value}, nil
+		}
+	}
+	return nil, newError(http.StatusBadRequest, "invalidFilter", "Unable to filter on "+match[1])
+}
+
+// Parse the value filter of a path, ie. members[value eq "x"], returning the
+// attribute and the filter
+func parsePath(path string) (string, *filter, *Error) {
+	open := strings.Index(path, "[")
+	if open < 0 {
+		return strings.ToLower(strings.TrimSpace(path)), nil, nil
+	}
+	if !strings.HasSuffix(path, "]") {
+		return "", nil, newError(http.StatusBadRequest, "invalidPath", "Invalid path "+path)
+	}
+	f, err := parseFilter(path[open+1:len(path)-1], "value")
+	if err != nil {
+		return "", nil, newError(http.StatusBadRequest, "invalidPath", "Invalid path "+path)
+	}
+	return strings.ToLower(strings.TrimSpace(path[:open])), f, nil
+}
@@ -0,0 +1,321 @@
+package aerofsscim
+
+// The /Groups endpoint
+// A group is identified by its AeroFS identifier and its members by their
+// email. Groups cannot be renamed
+
+import (
+	"encoding/json"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type MemberRef struct {
+	Value   string `json:"value"`
+	Ref     string `json:"$ref,omitempty"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+}
+
+// A SCIM group
+type Group struct {
+	Schemas     []string    `json:"schemas"`
+	Id          string      `json:"id,omitempty"`
+	ExternalId  string      `json:"externalId,omitempty"`
+	DisplayName string      `json:"displayName"`
+	Members     []MemberRef `json:"members"`
+	Meta        *Meta       `json:"meta,omitempty"`
+}
+
+func (g *Group) location() string {
+	return g.Meta.Location
+}
+
+func (s *Server) toGroup(r *http.Request, g api.Group) *Group {
+	group := Group{
+		Schemas:     []string{GROUP_SCHEMA},
+		Id:          g.Id,
+		DisplayName: g.Name,
+		Members:     []MemberRef{},
+		Meta:        &Meta{ResourceType: "Group", Location: s.endpoint(r, "Groups/"+url.PathEscape(g.Id))},
+	}
+	for _, m := range g.Members {
+		group.Members = append(group.Members, MemberRef{
+			Value:   m.Email,
+			Ref:     s.endpoint(r, "Users/"+url.PathEscape(m.Email)),
+			Display: strings.TrimSpace(m.FirstName + " " + m.LastName),
+			Type:    "User",
+		})
+	}
+	return &group
+}
+
+func (s *Server) serveGroups(r *http.Request, id string) (int, interface{}, *Error) {
+	switch {
+	case id == "" && r.Method == "GET":
+		return s.listGroups(r)
+	case id == "" && r.Method == "POST":
+		return s.createGroup(r)
+	case id == "":
+	case r.Method == "GET":
+		return s.getGroup(r, id)
+	case r.Method == "PUT":
+		return s.replaceGroup(r, id)
+	case r.Method == "PATCH":
+		return s.patchGroup(r, id)
+	case r.Method == "DELETE":
+		return s.deleteGroup(id)
+	}
+	return 0, nil, newError(http.StatusMethodNotAllowed, "", r.Method+" is not supported")
+}
+
+func (s *Server) fetchGroup(id string) (*api.Group, *Error) {
+	body, _, err := s.Client.GetGroup(id)
+	if err != nil {
+		return nil, upstreamError(err)
+	}
+	group := api.Group{}
+	if json.Unmarshal(body, &group) != nil {
+		return nil, newError(http.StatusBadGateway, "", "Unable to unmarshal the group")
+	}
+	members, err := sdk.ListGroupMembers(s.Client, id)
+	if err != nil {
+		return nil, upstreamError(err)
+	}
+	group.Members = []api.GroupMember{}
+	for _, m := range members {
+		group.Members = append(group.Members, api.GroupMember(m))
+	}
+	return &group, nil
+}
+
+func (s *Server) getGroup(r *http.Request, id string) (int, interface{}, *Error) {
+	group, err := s.fetchGroup(id)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, s.toGroup(r, *group), nil
+}
+
+func (s *Server) listGroups(r *http.Request) (int, interface{}, *Error) {
+	start, count, scimErr := pagination(r)
+	if scimErr != nil {
+		return 0, nil, scimErr
+	}
+	f, scimErr := parseFilter(r.URL.Query().Get("filter"), "displayName", "id", "externalId")
+	if scimErr != nil {
+		return 0, nil, scimErr
+	}
+
+	resources := []interface{}{}
+	if f != nil && f.Attribute == "externalid" {
+		return http.StatusOK, page(resources, start, count), nil
+	}
+	groups, err := sdk.ListAllGroups(s.Client, sdk.DEFAULT_PAGE_SIZE)
+	if err != nil {
+		return 0, nil, upstreamError(err)
+	}
+	for _, g := range groups {
+		if f == nil || (f.Attribute == "displayname" && g.Name == f.Value) ||
+			(f.Attribute == "id" && g.Id == f.Value) {
+			resources = append(resources, s.toGroup(r, api.Group(g)))
+		}
+	}
+	return http.StatusOK, page(resources, start, count), nil
+}
+
+// Create a group and add its members, the group is deleted again if a member
+// cannot be added
+func (s *Server) createGroup(r *http.Request) (int, interface{}, *Error) {
+	group := Group{}
+	if err := decode(r, &group); err != nil {
+		return 0, nil, err
+	}
+	if group.DisplayName == "" {
+		return 0, nil, newError(http.StatusBadRequest, "invalidValue", "displayName is required")
+	}
+	body, _, err := s.Client.CreateGroup(group.DisplayName)
+	if err != nil {
+		return 0, nil, upstreamError(err)
+	}
+	created := api.Group{}
+	if json.Unmarshal(body, &created) != nil {
+		return 0, nil, newError(http.StatusBadGateway, "", "Unable to unmarshal the created group")
+	}
+
+	for _, m := range group.Members {
+		_, _, err = s.Client.AddGroupMember(created.Id, m.Value)
+		if err != nil {
+			s.Client.DeleteGroup(created.Id)
+			return 0, nil, upstreamError(err)
+		}
+	}
+	fetched, scimErr := s.fetchGroup(created.Id)
+	if scimErr != nil {
+		return 0, nil, scimErr
+	}
+	return http.StatusCreated, s.toGroup(r, *fetched), nil
+}
+
+// Replace the members of a group
+func (s *Server) replaceGroup(r *http.Request, id string) (int, interface{}, *Error) {
+	group := Group{}
+	if err := decode(r, &group); err != nil {
+		return 0, nil, err
+	}
+	current, scimErr := s.fetchGroup(id)
+	if scimErr != nil {
+		return 0, nil, scimErr
+	}
+	if group.DisplayName != "" && group.DisplayName != current.Name {
+		return 0, nil, newError(http.StatusBadRequest, "mutability", "Groups cannot be renamed")
+	}
+	if scimErr = s.setMembers(current, values(group.Members)); scimErr != nil {
+		return 0, nil, scimErr
+	}
+	return s.getGroup(r, id)
+}
+
+func values(members []MemberRef) []string {
+	emails := []string{}
+	for _, m := range members {
+		emails = append(emails, m.Value)
+	}
+	return emails
+}
+
+// Add and remove members so a group has exactly the given members
+func (s *Server) setMembers(group *api.Group, emails []string) *Error {
+	wanted := map[string]bool{}
+	for _, email := range emails {
+		wanted[strings.ToLower(email)] = true
+	}
+	existing := map[string]bool{}
+	for _, m := range group.Members {
+		existing[strings.ToLower(m.Email)] = true
+		if !wanted[strings.ToLower(m.Email)] {
+			if err := s.removeMembers(group.Id, m.Email); err != nil {
+				return err
+			}
+		}
+	}
+	for _, email := range emails {
+		if !existing[strings.ToLower(email)] {
+			if err := s.addMembers(group.Id, email); err != nil {
+				return err
+			}
+			existing[strings.ToLower(email)] = true
+		}
+	}
+	return nil
+}
+
+// Add members, members of the group already are left alone
+func (s *Server) addMembers(id string, emails ...string) *Error {
+	for _, email := range emails {
+		_, _, err := s.Client.AddGroupMember(id, email)
+		if err != nil && !api.IsStatus(err, http.StatusConflict) {
+			return upstreamError(err)
+		}
+	}
+	return nil
+}
+
+// Remove members, users which are not members are left alone
+func (s *Server) removeMembers(id string, emails ...string) *Error {
+	for _, email := range emails {
+		err := s.Client.RemoveMember(id, email)
+		if err != nil && !api.IsStatus(err, http.StatusNotFound) {
+			return upstreamError(err)
+		}
+	}
+	return nil
+}
+
+// Add, remove or replace the members of a group
+func (s *Server) patchGroup(r *http.Request, id string) (int, interface{}, *Error) {
+	patch := PatchRequest{}
+	if err := decode(r, &patch); err != nil {
+		return 0, nil, err
+	}
+	group, scimErr := s.fetchGroup(id)
+	if scimErr != nil {
+		return 0, nil, scimErr
+	}
+
+	for _, op := range patch.Operations {
+		attribute, f, scimErr := parsePath(op.Path)
+		if scimErr != nil {
+			return 0, nil, scimErr
+		}
+		var members []MemberRef
+		var displayName *string
+		switch attribute {
+		case "":
+			value := struct {
+				DisplayName *string     `json:"displayName"`
+				Members     []MemberRef `json:"members"`
+			}{}
+			if json.Unmarshal(op.Value, &value) != nil {
+				return 0, nil, newError(http.StatusBadRequest, "invalidValue", "The value must be an object")
+			}
+			members, displayName = value.Members, value.DisplayName
+		case "members":
+			if len(op.Value) > 0 && json.Unmarshal(op.Value, &members) != nil {
+				return 0, nil, newError(http.StatusBadRequest, "invalidValue", "The value must be a list of members")
+			}
+		case "displayname":
+			name := ""
+			if json.Unmarshal(op.Value, &name) != nil {
+				return 0, nil, newError(http.StatusBadRequest, "invalidValue", "The value must be a string")
+			}
+			displayName = &name
+		default:
+			return 0, nil, newError(http.StatusBadRequest, "invalidPath", "Unable to patch "+op.Path)
+		}
+		if displayName != nil && *displayName != group.Name {
+			return 0, nil, newError(http.StatusBadRequest, "mutability", "Groups cannot be renamed")
+		}
+		if f != nil {
+			members = append(members, MemberRef{Value: f.Value})
+		}
+
+		switch strings.ToLower(op.Op) {
+		case "add":
+			scimErr = s.addMembers(id, values(members)...)
+		case "remove":
+			// Removing the members attribute removes every member
+			if attribute == "members" && f == nil && len(members) == 0 {
+				for _, m := range group.Members {
+					members = append(members, MemberRef{Value: m.Email})
+				}
+			}
+			scimErr = s.removeMembers(id, values(members)...)
+		case "replace":
+			if attribute == "members" || members != nil {
+				scimErr = s.setMembers(group, values(members))
+			}
+		default:
+			scimErr = newError(http.StatusBadRequest, "invalidSyntax", "Unknown operation "+op.Op)
+		}
+		if scimErr != nil {
+			return 0, nil, scimErr
+		}
+		// Later operations apply to the group as modified
+		if group, scimErr = s.fetchGroup(id); scimErr != nil {
+			return 0, nil, scimErr
+		}
+	}
+	return http.StatusOK, s.toGroup(r, *group), nil
+}
+
+func (s *Server) deleteGroup(id string) (int, interface{}, *Error) {
+	err := s.Client.DeleteGroup(id)
+	if err != nil {
+		return 0, nil, upstreamError(err)
+	}
+	return http.StatusNoContent, nil, nil
+}
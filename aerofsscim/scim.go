@@ -0,0 +1,270 @@
+package aerofsscim
+
+// A SCIM 2.0 service provider (RFC 7643, RFC 7644) backed by an AeroFS
+// Appliance, so identity providers can provision users and groups
+// Users are identified by their email, which is also their userName, and
+// groups by their AeroFS identifier
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Schemas
+const (
+	USER_SCHEMA          = "urn:ietf:params:scim:schemas:core:2.0:User"
+	GROUP_SCHEMA         = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	LIST_SCHEMA          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	PATCH_SCHEMA         = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ERROR_SCHEMA         = "urn:ietf:params:scim:api:messages:2.0:Error"
+	CONFIG_SCHEMA        = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	RESOURCE_TYPE_SCHEMA = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+)
+
+// The content type of every response
+const CONTENT_TYPE = "application/scim+json"
+
+// The number of resources returned by a list when the client asks for none
+// or more
+const MAX_RESULTS = 100
+
+// A SCIM endpoint, to be mounted with http.StripPrefix at its base path
+type Server struct {
+	// The client calls to the Appliance are made with, with an admin token
+	Client *api.Client
+
+	// The bearer token SCIM clients authenticate with
+	Token string
+
+	// The URL the server is reachable at, used in the location of resources,
+	// derived from requests if empty. Ie. "https://scim.example.com/scim/v2"
+	BaseURL string
+
+	// Delete users set inactive, by default they cannot be deactivated
+	DeleteOnDeactivate bool
+
+	// Called with every failed request, may be nil
+	Log func(format string, args ...interface{})
+}
+
+func NewServer(c *api.Client, token string) *Server {
+	return &Server{Client: c, Token: token}
+}
+
+// A SCIM error response
+type Error struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+
+	code int
+}
+
+func (e *Error) Error() string {
+	return e.Status + " " + e.Detail
+}
+
+func newError(code int, scimType, detail string) *Error {
+	return &Error{Schemas: []string{ERROR_SCHEMA}, Status: strconv.Itoa(code),
+		ScimType: scimType, Detail: detail, code: code}
+}
+
+// Translate an error of the Appliance, which is a bad gateway unless it
+// concerns the resource
+func upstreamError(err error) *Error {
+	resErr, ok := err.(*api.ResponseError)
+	if !ok {
+		return newError(http.StatusBadGateway, "", "Unable to reach the AeroFS Appliance : "+err.Error())
+	}
+	switch resErr.StatusCode {
+	case http.StatusNotFound:
+		return newError(http.StatusNotFound, "", "Resource not found")
+	case http.StatusConflict:
+		return newError(http.StatusConflict, "uniqueness", "The resource already exists")
+	case http.StatusBadRequest:
+		return newError(http.StatusBadRequest, "invalidValue", strings.TrimSpace(string(resErr.Body)))
+	}
+	return newError(http.StatusBadGateway, "", "The AeroFS Appliance responded "+resErr.Status)
+}
+
+// Metadata of a resource
+type Meta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location,omitempty"`
+}
+
+type ListResponse struct {
+	Schemas      []string      `json:"schemas"`
+	TotalResults int           `json:"totalResults"`
+	StartIndex   int           `json:"startIndex"`
+	ItemsPerPage int           `json:"itemsPerPage"`
+	Resources    []interface{} `json:"Resources"`
+}
+
+// A PATCH request
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") || s.Token == "" ||
+		subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(s.Token)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="SCIM"`)
+		s.writeError(w, r, newError(http.StatusUnauthorized, "", "A valid bearer token is required"))
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	id := ""
+	if len(parts) == 2 {
+		id = parts[1]
+	}
+	var status int
+	var body interface{}
+	var err *Error
+	switch {
+	case len(parts) > 2:
+		err = newError(http.StatusNotFound, "", "Unknown endpoint")
+	case parts[0] == "Users":
+		status, body, err = s.serveUsers(r, id)
+	case parts[0] == "Groups":
+		status, body, err = s.serveGroups(r, id)
+	case parts[0] == "ServiceProviderConfig" && id == "" && r.Method == "GET":
+		status, body = http.StatusOK, serviceProviderConfig()
+	case parts[0] == "ResourceTypes" && id == "" && r.Method == "GET":
+		status, body = http.StatusOK, s.resourceTypes(r)
+	default:
+		err = newError(http.StatusNotFound, "", "Unknown endpoint")
+	}
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	if loc, ok := body.(interface{ location() string }); ok && status == http.StatusCreated {
+		w.Header().Set("Location", loc.location())
+	}
+	if body == nil {
+		w.WriteHeader(status)
+		return
+	}
+	data, _ := json.Marshal(body)
+	w.Header().Set("Content-Type", CONTENT_TYPE)
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+func (s *Server) writeError(w http.ResponseWriter, r *http.Request, e *Error) {
+	if s.Log != nil {
+		s.Log("%s %s : %s", r.Method, r.URL, e)
+	}
+	data, _ := json.Marshal(e)
+	w.Header().Set("Content-Type", CONTENT_TYPE)
+	w.WriteHeader(e.code)
+	w.Write(data)
+}
+
+// Return the URL of the endpoint of a resource type
+func (s *Server) endpoint(r *http.Request, resource string) string {
+	base := strings.TrimSuffix(s.BaseURL, "/")
+	if base == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		base = fmt.Sprintf("%s://%s", scheme, r.Host)
+	}
+	return base + "/" + resource
+}
+
+func decode(r *http.Request, v interface{}) *Error {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err != nil {
+		return newError(http.StatusBadRequest, "invalidSyntax", "Unable to parse the request : "+err.Error())
+	}
+	return nil
+}
+
+// Parse the 1-based start index and the count of a list request
+func pagination(r *http.Request) (int, int, *Error) {
+	start, count := 1, MAX_RESULTS
+	query := r.URL.Query()
+	if v := query.Get("startIndex"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, 0, newError(http.StatusBadRequest, "invalidValue", "Invalid startIndex "+v)
+		}
+		if n > 1 {
+			start = n
+		}
+	}
+	if v := query.Get("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, 0, newError(http.StatusBadRequest, "invalidValue", "Invalid count "+v)
+		}
+		if n < 0 {
+			n = 0
+		}
+		if n < count {
+			count = n
+		}
+	}
+	return start, count, nil
+}
+
+// Return a page of resources
+func page(resources []interface{}, start, count int) *ListResponse {
+	list := ListResponse{Schemas: []string{LIST_SCHEMA}, TotalResults: len(resources),
+		StartIndex: start, Resources: []interface{}{}}
+	for i := start - 1; i < len(resources) && len(list.Resources) < count; i++ {
+		list.Resources = append(list.Resources, resources[i])
+	}
+	list.ItemsPerPage = len(list.Resources)
+	return &list
+}
+
+func serviceProviderConfig() map[string]interface{} {
+	unsupported := map[string]bool{"supported": false}
+	return map[string]interface{}{
+		"schemas":        []string{CONFIG_SCHEMA},
+		"patch":          map[string]bool{"supported": true},
+		"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]interface{}{"supported": true, "maxResults": MAX_RESULTS},
+		"changePassword": unsupported,
+		"sort":           unsupported,
+		"etag":           unsupported,
+		"authenticationSchemes": []map[string]interface{}{{
+			"type":        "oauthbearertoken",
+			"name":        "OAuth Bearer Token",
+			"description": "Authentication with the bearer token configured on the server",
+			"primary":     true,
+		}},
+	}
+}
+
+func (s *Server) resourceTypes(r *http.Request) *ListResponse {
+	types := []interface{}{
+		map[string]interface{}{"schemas": []string{RESOURCE_TYPE_SCHEMA}, "id": "User", "name": "User",
+			"endpoint": "/Users", "schema": USER_SCHEMA,
+			"meta": Meta{ResourceType: "ResourceType", Location: s.endpoint(r, "ResourceTypes/User")}},
+		map[string]interface{}{"schemas": []string{RESOURCE_TYPE_SCHEMA}, "id": "Group", "name": "Group",
+			"endpoint": "/Groups", "schema": GROUP_SCHEMA,
+			"meta": Meta{ResourceType: "ResourceType", Location: s.endpoint(r, "ResourceTypes/Group")}},
+	}
+	return page(types, 1, len(types))
+}
@@ -0,0 +1,467 @@
+package aerofsscim
+
+// Conformance tests of the SCIM endpoints, against an in-memory Appliance
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testToken = "scim-secret"
+
+// The users and groups routes of an Appliance
+type fakeAppliance struct {
+	mu     sync.Mutex
+	users  map[string]api.User
+	groups map[string]*api.Group
+	nextId int
+}
+
+func (f *fakeAppliance) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	reply := func(status int, v interface{}) {
+		w.WriteHeader(status)
+		if v != nil {
+			json.NewEncoder(w).Encode(v)
+		}
+	}
+	if r.Header.Get("Authorization") != "Bearer aerofs-token" {
+		reply(http.StatusUnauthorized, nil)
+		return
+	}
+	body := map[string]string{}
+	json.NewDecoder(r.Body).Decode(&body)
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1.3/"), "/")
+
+	switch {
+	case parts[0] == "users" && len(parts) == 1 && r.Method == "GET":
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		emails := []string{}
+		for email := range f.users {
+			if email > r.URL.Query().Get("after") {
+				emails = append(emails, email)
+			}
+		}
+		sort.Strings(emails)
+		list := struct {
+			HasMore bool       `json:"has_more"`
+			Data    []api.User `json:"data"`
+		}{Data: []api.User{}}
+		for i, email := range emails {
+			if i == limit {
+				list.HasMore = true
+				break
+			}
+			list.Data = append(list.Data, f.users[email])
+		}
+		reply(http.StatusOK, list)
+	case parts[0] == "users" && len(parts) == 1 && r.Method == "POST":
+		if _, ok := f.users[body["email"]]; ok {
+			reply(http.StatusConflict, nil)
+			return
+		}
+		f.users[body["email"]] = api.User{Email: body["email"], FirstName: body["first_name"], LastName: body["last_name"]}
+		reply(http.StatusCreated, f.users[body["email"]])
+	case parts[0] == "users" && len(parts) == 2:
+		user, ok := f.users[parts[1]]
+		switch {
+		case !ok:
+			reply(http.StatusNotFound, nil)
+		case r.Method == "GET":
+			reply(http.StatusOK, user)
+		case r.Method == "PUT":
+			user.FirstName, user.LastName = body["first_name"], body["last_name"]
+			f.users[user.Email] = user
+			reply(http.StatusOK, user)
+		case r.Method == "DELETE":
+			delete(f.users, user.Email)
+			for _, g := range f.groups {
+				f.removeMember(g, user.Email)
+			}
+			reply(http.StatusNoContent, nil)
+		}
+	case parts[0] == "groups" && len(parts) == 1 && r.Method == "GET":
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		results, _ := strconv.Atoi(r.URL.Query().Get("results"))
+		ids := []string{}
+		for id := range f.groups {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		groups := []api.Group{}
+		for i := offset; i < len(ids) && len(groups) < results; i++ {
+			groups = append(groups, *f.groups[ids[i]])
+		}
+		reply(http.StatusOK, groups)
+	case parts[0] == "groups" && len(parts) == 1 && r.Method == "POST":
+		f.nextId++
+		group := api.Group{Id: fmt.Sprintf("g%02d", f.nextId), Name: body["name"], Members: []api.GroupMember{}}
+		f.groups[group.Id] = &group
+		reply(http.StatusCreated, group)
+	case parts[0] == "groups":
+		group, ok := f.groups[parts[1]]
+		switch {
+		case !ok:
+			reply(http.StatusNotFound, nil)
+		case len(parts) == 2 && r.Method == "GET":
+			reply(http.StatusOK, group)
+		case len(parts) == 2 && r.Method == "DELETE":
+			delete(f.groups, group.Id)
+			reply(http.StatusNoContent, nil)
+		case len(parts) == 3 && r.Method == "GET":
+			reply(http.StatusOK, group.Members)
+		case len(parts) == 3 && r.Method == "POST":
+			user, ok := f.users[body["email"]]
+			if !ok {
+				reply(http.StatusNotFound, nil)
+				return
+			}
+			for _, m := range group.Members {
+				if m.Email == user.Email {
+					reply(http.StatusConflict, nil)
+					return
+				}
+			}
+			member := api.GroupMember{Email: user.Email, FirstName: user.FirstName, LastName: user.LastName}
+			group.Members = append(group.Members, member)
+			reply(http.StatusCreated, member)
+		case len(parts) == 4 && r.Method == "DELETE":
+			if !f.removeMember(group, parts[3]) {
+				reply(http.StatusNotFound, nil)
+				return
+			}
+			reply(http.StatusNoContent, nil)
+		default:
+			reply(http.StatusMethodNotAllowed, nil)
+		}
+	default:
+		reply(http.StatusNotFound, nil)
+	}
+}
+
+func (f *fakeAppliance) removeMember(g *api.Group, email string) bool {
+	for i, m := range g.Members {
+		if m.Email == email {
+			g.Members = append(g.Members[:i], g.Members[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fakeAppliance) members(id string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	emails := []string{}
+	for _, m := range f.groups[id].Members {
+		emails = append(emails, m.Email)
+	}
+	sort.Strings(emails)
+	return emails
+}
+
+// Start an Appliance and a SCIM server backed by it
+func setup(t *testing.T) (*fakeAppliance, *httptest.Server) {
+	fake := &fakeAppliance{users: map[string]api.User{}, groups: map[string]*api.Group{}}
+	appliance := httptest.NewTLSServer(fake)
+	t.Cleanup(appliance.Close)
+
+	c, _ := api.NewClient("aerofs-token", strings.TrimPrefix(appliance.URL, "https://"))
+	c.SetHTTPClient(appliance.Client())
+	server := httptest.NewServer(NewServer(c, testToken))
+	t.Cleanup(server.Close)
+	return fake, server
+}
+
+// Send a SCIM request, decoding the response into v if it is not nil
+func do(t *testing.T, server *httptest.Server, method, path string, body, v interface{}) *http.Response {
+	var data []byte
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+	req, _ := http.NewRequest(method, server.URL+path, bytes.NewReader(data))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	req.Header.Set("Content-Type", CONTENT_TYPE)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if v != nil {
+		if err = json.NewDecoder(res.Body).Decode(v); err != nil {
+			t.Fatalf("%s %s : unable to decode the response : %s", method, path, err)
+		}
+	}
+	return res
+}
+
+func expectStatus(t *testing.T, res *http.Response, status int) {
+	t.Helper()
+	if res.StatusCode != status {
+		t.Errorf("%s %s : expected %d, got %d", res.Request.Method, res.Request.URL.Path, status, res.StatusCode)
+	}
+}
+
+func filterQuery(f string) string {
+	return "?filter=" + url.QueryEscape(f)
+}
+
+func TestAuthentication(t *testing.T) {
+	_, server := setup(t)
+	for _, auth := range []string{"", "Bearer wrong", "Basic " + testToken} {
+		req, _ := http.NewRequest("GET", server.URL+"/Users", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusUnauthorized || res.Header.Get("WWW-Authenticate") == "" {
+			t.Errorf("Expected a challenge for %q, got %d", auth, res.StatusCode)
+		}
+	}
+}
+
+func TestUsers(t *testing.T) {
+	fake, server := setup(t)
+
+	user := User{}
+	res := do(t, server, "POST", "/Users", map[string]interface{}{
+		"schemas":  []string{USER_SCHEMA},
+		"userName": "frodo@shire.org",
+		"name":     map[string]string{"givenName": "Frodo", "familyName": "Baggins"},
+		"active":   true,
+	}, &user)
+	expectStatus(t, res, http.StatusCreated)
+	if user.Id != "frodo@shire.org" || user.Name.FamilyName != "Baggins" || !*user.Active ||
+		user.Meta.ResourceType != "User" || res.Header.Get("Location") != user.Meta.Location {
+		t.Errorf("Unexpected created user %+v", user)
+	}
+	if res.Header.Get("Content-Type") != CONTENT_TYPE {
+		t.Errorf("Unexpected content type %s", res.Header.Get("Content-Type"))
+	}
+
+	scimErr := Error{}
+	res = do(t, server, "POST", "/Users", map[string]string{"userName": "frodo@shire.org"}, &scimErr)
+	expectStatus(t, res, http.StatusConflict)
+	if scimErr.ScimType != "uniqueness" || scimErr.Schemas[0] != ERROR_SCHEMA || scimErr.Status != "409" {
+		t.Errorf("Unexpected error %+v", scimErr)
+	}
+
+	res = do(t, server, "GET", "/Users/frodo@shire.org", nil, &user)
+	expectStatus(t, res, http.StatusOK)
+	res = do(t, server, "GET", "/Users/sauron@mordor.org", nil, &scimErr)
+	expectStatus(t, res, http.StatusNotFound)
+
+	list := ListResponse{}
+	res = do(t, server, "GET", "/Users"+filterQuery(`userName eq "frodo@shire.org"`), nil, &list)
+	expectStatus(t, res, http.StatusOK)
+	if list.TotalResults != 1 || list.Schemas[0] != LIST_SCHEMA {
+		t.Errorf("Unexpected list %+v", list)
+	}
+	do(t, server, "GET", "/Users"+filterQuery(`userName eq "sauron@mordor.org"`), nil, &list)
+	if list.TotalResults != 0 || list.Resources == nil {
+		t.Errorf("Unexpected list %+v", list)
+	}
+	res = do(t, server, "GET", "/Users"+filterQuery(`userName sw "frodo"`), nil, &scimErr)
+	expectStatus(t, res, http.StatusBadRequest)
+	if scimErr.ScimType != "invalidFilter" {
+		t.Errorf("Unexpected error %+v", scimErr)
+	}
+
+	res = do(t, server, "PATCH", "/Users/frodo@shire.org", map[string]interface{}{
+		"schemas": []string{PATCH_SCHEMA},
+		"Operations": []map[string]interface{}{
+			{"op": "Replace", "path": "name.givenName", "value": "Mr. Frodo"},
+			{"op": "replace", "value": map[string]interface{}{"name": map[string]string{"familyName": "Underhill"}}},
+		},
+	}, &user)
+	expectStatus(t, res, http.StatusOK)
+	if fake.users["frodo@shire.org"].FirstName != "Mr. Frodo" || user.Name.FamilyName != "Underhill" {
+		t.Errorf("Unexpected patched user %+v", fake.users["frodo@shire.org"])
+	}
+
+	res = do(t, server, "PUT", "/Users/frodo@shire.org", map[string]interface{}{
+		"userName": "frodo@shire.org",
+		"name":     map[string]string{"givenName": "Frodo", "familyName": "Baggins"},
+	}, &user)
+	expectStatus(t, res, http.StatusOK)
+	if fake.users["frodo@shire.org"].LastName != "Baggins" {
+		t.Errorf("Unexpected replaced user %+v", fake.users["frodo@shire.org"])
+	}
+	res = do(t, server, "PUT", "/Users/frodo@shire.org", map[string]string{"userName": "sam@shire.org"}, &scimErr)
+	expectStatus(t, res, http.StatusBadRequest)
+	if scimErr.ScimType != "mutability" {
+		t.Errorf("Unexpected error %+v", scimErr)
+	}
+
+	// Users cannot be deactivated unless it deletes them
+	deactivate := map[string]interface{}{"Operations": []map[string]interface{}{
+		{"op": "replace", "path": "active", "value": false}}}
+	res = do(t, server, "PATCH", "/Users/frodo@shire.org", deactivate, &scimErr)
+	expectStatus(t, res, http.StatusBadRequest)
+
+	res = do(t, server, "DELETE", "/Users/frodo@shire.org", nil, nil)
+	expectStatus(t, res, http.StatusNoContent)
+	res = do(t, server, "GET", "/Users/frodo@shire.org", nil, &scimErr)
+	expectStatus(t, res, http.StatusNotFound)
+}
+
+func TestDeleteOnDeactivate(t *testing.T) {
+	fake, server := setup(t)
+	server.Config.Handler.(*Server).DeleteOnDeactivate = true
+	fake.users["sam@shire.org"] = api.User{Email: "sam@shire.org"}
+
+	res := do(t, server, "PATCH", "/Users/sam@shire.org", map[string]interface{}{"Operations": []map[string]interface{}{
+		{"op": "replace", "value": map[string]bool{"active": false}}}}, nil)
+	expectStatus(t, res, http.StatusNoContent)
+	if _, ok := fake.users["sam@shire.org"]; ok {
+		t.Errorf("Expected the deactivated user to be deleted")
+	}
+}
+
+func TestPagination(t *testing.T) {
+	fake, server := setup(t)
+	for i := 1; i <= 5; i++ {
+		email := fmt.Sprintf("hobbit%d@shire.org", i)
+		fake.users[email] = api.User{Email: email}
+	}
+
+	list := ListResponse{}
+	res := do(t, server, "GET", "/Users?startIndex=2&count=2", nil, &list)
+	expectStatus(t, res, http.StatusOK)
+	if list.TotalResults != 5 || list.StartIndex != 2 || list.ItemsPerPage != 2 ||
+		list.Resources[0].(map[string]interface{})["id"] != "hobbit2@shire.org" {
+		t.Errorf("Unexpected page %+v", list)
+	}
+	do(t, server, "GET", "/Users?startIndex=5&count=10", nil, &list)
+	if list.ItemsPerPage != 1 {
+		t.Errorf("Unexpected last page %+v", list)
+	}
+	do(t, server, "GET", "/Users?count=0", nil, &list)
+	if list.TotalResults != 5 || list.ItemsPerPage != 0 {
+		t.Errorf("Unexpected empty page %+v", list)
+	}
+	res = do(t, server, "GET", "/Users?count=many", nil, nil)
+	expectStatus(t, res, http.StatusBadRequest)
+}
+
+func TestGroups(t *testing.T) {
+	fake, server := setup(t)
+	for _, email := range []string{"frodo@shire.org", "sam@shire.org", "merry@shire.org", "pippin@shire.org"} {
+		fake.users[email] = api.User{Email: email}
+	}
+
+	group := Group{}
+	res := do(t, server, "POST", "/Groups", map[string]interface{}{
+		"schemas":     []string{GROUP_SCHEMA},
+		"displayName": "Fellowship",
+		"members":     []map[string]string{{"value": "frodo@shire.org"}, {"value": "sam@shire.org"}},
+	}, &group)
+	expectStatus(t, res, http.StatusCreated)
+	if group.Id == "" || len(group.Members) != 2 || res.Header.Get("Location") != group.Meta.Location {
+		t.Fatalf("Unexpected created group %+v", group)
+	}
+	id := group.Id
+
+	// The group is not left behind if a member cannot be added
+	scimErr := Error{}
+	res = do(t, server, "POST", "/Groups", map[string]interface{}{"displayName": "Nazgul",
+		"members": []map[string]string{{"value": "witch-king@angmar.org"}}}, &scimErr)
+	expectStatus(t, res, http.StatusNotFound)
+	if len(fake.groups) != 1 {
+		t.Errorf("Expected the partially created group to be deleted")
+	}
+
+	list := ListResponse{}
+	res = do(t, server, "GET", "/Groups"+filterQuery(`displayName eq "Fellowship"`), nil, &list)
+	expectStatus(t, res, http.StatusOK)
+	if list.TotalResults != 1 {
+		t.Errorf("Unexpected list %+v", list)
+	}
+
+	patch := func(ops ...map[string]interface{}) {
+		t.Helper()
+		res := do(t, server, "PATCH", "/Groups/"+id, map[string]interface{}{
+			"schemas": []string{PATCH_SCHEMA}, "Operations": ops}, &group)
+		expectStatus(t, res, http.StatusOK)
+	}
+	expectMembers := func(expected ...string) {
+		t.Helper()
+		if members := fake.members(id); strings.Join(members, " ") != strings.Join(expected, " ") {
+			t.Errorf("Expected members %v, got %v", expected, members)
+		}
+	}
+	patch(map[string]interface{}{"op": "add", "path": "members",
+		"value": []map[string]string{{"value": "merry@shire.org"}, {"value": "sam@shire.org"}}})
+	expectMembers("frodo@shire.org", "merry@shire.org", "sam@shire.org")
+	patch(map[string]interface{}{"op": "remove", "path": `members[value eq "sam@shire.org"]`})
+	expectMembers("frodo@shire.org", "merry@shire.org")
+	patch(map[string]interface{}{"op": "replace", "path": "members",
+		"value": []map[string]string{{"value": "pippin@shire.org"}, {"value": "frodo@shire.org"}}})
+	expectMembers("frodo@shire.org", "pippin@shire.org")
+	patch(map[string]interface{}{"op": "remove", "path": "members"})
+	expectMembers()
+
+	res = do(t, server, "PUT", "/Groups/"+id, map[string]interface{}{"displayName": "Fellowship",
+		"members": []map[string]string{{"value": "sam@shire.org"}}}, &group)
+	expectStatus(t, res, http.StatusOK)
+	expectMembers("sam@shire.org")
+	res = do(t, server, "PUT", "/Groups/"+id, map[string]interface{}{"displayName": "Company"}, &scimErr)
+	expectStatus(t, res, http.StatusBadRequest)
+	if scimErr.ScimType != "mutability" {
+		t.Errorf("Unexpected error %+v", scimErr)
+	}
+
+	res = do(t, server, "DELETE", "/Groups/"+id, nil, nil)
+	expectStatus(t, res, http.StatusNoContent)
+	res = do(t, server, "GET", "/Groups/"+id, nil, &scimErr)
+	expectStatus(t, res, http.StatusNotFound)
+}
+
+func TestDiscovery(t *testing.T) {
+	_, server := setup(t)
+	config := map[string]interface{}{}
+	res := do(t, server, "GET", "/ServiceProviderConfig", nil, &config)
+	expectStatus(t, res, http.StatusOK)
+	if config["patch"].(map[string]interface{})["supported"] != true {
+		t.Errorf("Unexpected configuration %v", config)
+	}
+	list := ListResponse{}
+	do(t, server, "GET", "/ResourceTypes", nil, &list)
+	if list.TotalResults != 2 {
+		t.Errorf("Unexpected resource types %+v", list)
+	}
+	res = do(t, server, "GET", "/Schemas/x/y", nil, nil)
+	expectStatus(t, res, http.StatusNotFound)
+}
+
+func TestParseFilter(t *testing.T) {
+	f, err := parseFilter(`UserName Eq "a\"b@c"`, "userName")
+	if err != nil || f.Attribute != "username" || f.Value != `a"b@c` {
+		t.Errorf("Unexpected filter %+v %v", f, err)
+	}
+	for _, s := range []string{`userName eq x`, `userName pr`, `title eq "x"`,
+		`userName eq "a" and userName eq "b"`} {
+		if _, err := parseFilter(s, "userName"); err == nil {
+			t.Errorf("Expected an error for %q", s)
+		}
+	}
+	attribute, f, err := parsePath(`members[value eq "x@y"]`)
+	if err != nil || attribute != "members" || f.Value != "x@y" {
+		t.Errorf("Unexpected path %s %+v %v", attribute, f, err)
+	}
+}
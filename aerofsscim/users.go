@@ -0,0 +1,277 @@
+package aerofsscim
+
+// The /Users endpoint
+// A user is identified by its email, which is also its userName, and is
+// always active since AeroFS users cannot be suspended
+
+import (
+	"encoding/json"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName"`
+	FamilyName string `json:"familyName"`
+}
+
+type Email struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// A SCIM user
+type User struct {
+	Schemas     []string `json:"schemas"`
+	Id          string   `json:"id,omitempty"`
+	ExternalId  string   `json:"externalId,omitempty"`
+	UserName    string   `json:"userName"`
+	Name        *Name    `json:"name,omitempty"`
+	DisplayName string   `json:"displayName,omitempty"`
+	Emails      []Email  `json:"emails,omitempty"`
+	Active      *bool    `json:"active,omitempty"`
+	Meta        *Meta    `json:"meta,omitempty"`
+}
+
+func (u *User) location() string {
+	return u.Meta.Location
+}
+
+// Return the names of a user, from its name or its display name
+func (u *User) names() (string, string) {
+	if u.Name != nil {
+		return u.Name.GivenName, u.Name.FamilyName
+	}
+	fields := strings.Fields(u.DisplayName)
+	if len(fields) == 0 {
+		return "", ""
+	}
+	return fields[0], strings.Join(fields[1:], " ")
+}
+
+func (s *Server) toUser(r *http.Request, u api.User) *User {
+	active := true
+	return &User{
+		Schemas:     []string{USER_SCHEMA},
+		Id:          u.Email,
+		UserName:    u.Email,
+		Name:        &Name{Formatted: strings.TrimSpace(u.FirstName + " " + u.LastName), GivenName: u.FirstName, FamilyName: u.LastName},
+		DisplayName: strings.TrimSpace(u.FirstName + " " + u.LastName),
+		Emails:      []Email{{Value: u.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Meta:        &Meta{ResourceType: "User", Location: s.endpoint(r, "Users/"+url.PathEscape(u.Email))},
+	}
+}
+
+func (s *Server) serveUsers(r *http.Request, id string) (int, interface{}, *Error) {
+	switch {
+	case id == "" && r.Method == "GET":
+		return s.listUsers(r)
+	case id == "" && r.Method == "POST":
+		return s.createUser(r)
+	case id == "":
+	case r.Method == "GET":
+		return s.getUser(r, id)
+	case r.Method == "PUT":
+		return s.replaceUser(r, id)
+	case r.Method == "PATCH":
+		return s.patchUser(r, id)
+	case r.Method == "DELETE":
+		return s.deleteUser(id)
+	}
+	return 0, nil, newError(http.StatusMethodNotAllowed, "", r.Method+" is not supported")
+}
+
+func (s *Server) fetchUser(email string) (*api.User, *Error) {
+	body, _, err := s.Client.GetUser(email)
+	if err != nil {
+		return nil, upstreamError(err)
+	}
+	user := api.User{}
+	if json.Unmarshal(body, &user) != nil {
+		return nil, newError(http.StatusBadGateway, "", "Unable to unmarshal the user")
+	}
+	return &user, nil
+}
+
+func (s *Server) getUser(r *http.Request, id string) (int, interface{}, *Error) {
+	user, err := s.fetchUser(id)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, s.toUser(r, *user), nil
+}
+
+func (s *Server) listUsers(r *http.Request) (int, interface{}, *Error) {
+	start, count, scimErr := pagination(r)
+	if scimErr != nil {
+		return 0, nil, scimErr
+	}
+	f, scimErr := parseFilter(r.URL.Query().Get("filter"), "userName", "id", "emails", "emails.value", "externalId")
+	if scimErr != nil {
+		return 0, nil, scimErr
+	}
+
+	resources := []interface{}{}
+	switch {
+	case f == nil:
+		users, err := sdk.ListAllUsers(s.Client, sdk.DEFAULT_PAGE_SIZE)
+		if err != nil {
+			return 0, nil, upstreamError(err)
+		}
+		sort.Slice(users, func(i, j int) bool { return users[i].Email < users[j].Email })
+		for _, u := range users {
+			resources = append(resources, s.toUser(r, api.User(u)))
+		}
+	// External identifiers are not stored, so they never match
+	case f.Attribute == "externalid":
+	default:
+		user, err := s.fetchUser(f.Value)
+		switch {
+		case err == nil:
+			resources = append(resources, s.toUser(r, *user))
+		case err.code != http.StatusNotFound:
+			return 0, nil, err
+		}
+	}
+	return http.StatusOK, page(resources, start, count), nil
+}
+
+func (s *Server) createUser(r *http.Request) (int, interface{}, *Error) {
+	user := User{}
+	if err := decode(r, &user); err != nil {
+		return 0, nil, err
+	}
+	if user.UserName == "" {
+		return 0, nil, newError(http.StatusBadRequest, "invalidValue", "userName is required")
+	}
+	if user.Active != nil && !*user.Active {
+		return 0, nil, newError(http.StatusBadRequest, "invalidValue", "Users cannot be created inactive")
+	}
+	first, last := user.names()
+	body, _, err := s.Client.CreateUser(user.UserName, first, last)
+	if err != nil {
+		return 0, nil, upstreamError(err)
+	}
+	created := api.User{}
+	if json.Unmarshal(body, &created) != nil {
+		return 0, nil, newError(http.StatusBadGateway, "", "Unable to unmarshal the created user")
+	}
+	return http.StatusCreated, s.toUser(r, created), nil
+}
+
+func (s *Server) replaceUser(r *http.Request, id string) (int, interface{}, *Error) {
+	user := User{}
+	if err := decode(r, &user); err != nil {
+		return 0, nil, err
+	}
+	if user.UserName != "" && !strings.EqualFold(user.UserName, id) {
+		return 0, nil, newError(http.StatusBadRequest, "mutability", "userName cannot be changed")
+	}
+	if user.Active != nil && !*user.Active {
+		return s.deactivate(id)
+	}
+	first, last := user.names()
+	return s.updateUser(r, id, first, last)
+}
+
+func (s *Server) updateUser(r *http.Request, id, first, last string) (int, interface{}, *Error) {
+	body, _, err := s.Client.UpdateUser(id, first, last)
+	if err != nil {
+		return 0, nil, upstreamError(err)
+	}
+	updated := api.User{}
+	if json.Unmarshal(body, &updated) != nil {
+		return 0, nil, newError(http.StatusBadGateway, "", "Unable to unmarshal the updated user")
+	}
+	return http.StatusOK, s.toUser(r, updated), nil
+}
+
+// Users cannot be suspended, they are deleted if the server allows it
+func (s *Server) deactivate(id string) (int, interface{}, *Error) {
+	if !s.DeleteOnDeactivate {
+		return 0, nil, newError(http.StatusBadRequest, "mutability",
+			"Users cannot be deactivated, delete them instead")
+	}
+	return s.deleteUser(id)
+}
+
+// Replace or add the names or the active flag of a user, values of other
+// attributes are ignored
+func (s *Server) patchUser(r *http.Request, id string) (int, interface{}, *Error) {
+	patch := PatchRequest{}
+	if err := decode(r, &patch); err != nil {
+		return 0, nil, err
+	}
+	user, scimErr := s.fetchUser(id)
+	if scimErr != nil {
+		return 0, nil, scimErr
+	}
+	first, last := user.FirstName, user.LastName
+
+	for _, op := range patch.Operations {
+		kind := strings.ToLower(op.Op)
+		if kind != "add" && kind != "replace" {
+			return 0, nil, newError(http.StatusBadRequest, "mutability", "Unable to "+op.Op+" user attributes")
+		}
+		values := map[string]json.RawMessage{}
+		if op.Path == "" {
+			if json.Unmarshal(op.Value, &values) != nil {
+				return 0, nil, newError(http.StatusBadRequest, "invalidValue", "The value must be an object")
+			}
+			if name, ok := values["name"]; ok {
+				names := map[string]json.RawMessage{}
+				json.Unmarshal(name, &names)
+				for k, v := range names {
+					values["name."+k] = v
+				}
+			}
+		} else {
+			values[op.Path] = op.Value
+		}
+
+		for path, value := range values {
+			var err error
+			switch strings.ToLower(path) {
+			case "name.givenname":
+				err = json.Unmarshal(value, &first)
+			case "name.familyname":
+				err = json.Unmarshal(value, &last)
+			case "active":
+				active := true
+				err = json.Unmarshal(value, &active)
+				if err == nil && !active {
+					return s.deactivate(id)
+				}
+			case "username":
+				userName := ""
+				err = json.Unmarshal(value, &userName)
+				if err == nil && !strings.EqualFold(userName, id) {
+					return 0, nil, newError(http.StatusBadRequest, "mutability", "userName cannot be changed")
+				}
+			}
+			if err != nil {
+				return 0, nil, newError(http.StatusBadRequest, "invalidValue", "Invalid value of "+path)
+			}
+		}
+	}
+
+	if first == user.FirstName && last == user.LastName {
+		return http.StatusOK, s.toUser(r, *user), nil
+	}
+	return s.updateUser(r, id, first, last)
+}
+
+func (s *Server) deleteUser(id string) (int, interface{}, *Error) {
+	err := s.Client.DeleteUser(id)
+	if err != nil {
+		return 0, nil, upstreamError(err)
+	}
+	return http.StatusNoContent, nil, nil
+}
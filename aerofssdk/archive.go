@@ -0,0 +1,217 @@
+package aerofssdk
+
+// Streaming export of a folder tree as a zip or tar archive
+// Entries are downloaded and written one at a time, nothing is staged to disk
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+type ArchiveFormat int
+
+const (
+	Zip ArchiveFormat = iota
+	Tar
+	TarGzip
+)
+
+// The name of the manifest entry, written last in the archive
+const ARCHIVE_MANIFEST_NAME = ".aerofs-manifest.json"
+
+// Selects the entries of an archive
+// Patterns use the syntax of path.Match and are matched against the path
+// relative to the archived folder, patterns without a slash are also matched
+// against the base name
+type ArchiveOptions struct {
+	// Only files matching one of these patterns are archived, all files if
+	// empty. Folder entries are only written when no patterns are given
+	Include []string
+
+	// Files and folders matching one of these patterns are left out, along
+	// with the contents of excluded folders
+	Exclude []string
+
+	// Do not write the manifest entry
+	NoManifest bool
+}
+
+// A file of an archive as listed in its manifest
+type ManifestFile struct {
+	Path         string `json:"path"`
+	Id           string `json:"id"`
+	Etag         string `json:"etag"`
+	Size         int    `json:"size"`
+	LastModified string `json:"last_modified"`
+}
+
+// The manifest entry of an archive
+type ArchiveManifest struct {
+	FolderId string         `json:"folder_id"`
+	Created  string         `json:"created"`
+	Files    []ManifestFile `json:"files"`
+}
+
+// Return whether a relative path matches any of the patterns
+func matchAny(patterns []string, p string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, path.Base(p)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// The operations common to zip and tar writers
+type archiveWriter interface {
+	addFolder(name string, modTime time.Time) error
+	addFile(name string, size int64, modTime time.Time) (io.Writer, error)
+	Close() error
+}
+
+type zipArchive struct {
+	*zip.Writer
+}
+
+func (z zipArchive) addFolder(name string, modTime time.Time) error {
+	_, err := z.CreateHeader(&zip.FileHeader{Name: name + "/", Modified: modTime})
+	return err
+}
+
+func (z zipArchive) addFile(name string, size int64, modTime time.Time) (io.Writer, error) {
+	return z.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime})
+}
+
+// A tar archive, optionally compressed
+type tarArchive struct {
+	*tar.Writer
+	compressor io.Closer
+}
+
+func (t tarArchive) addFolder(name string, modTime time.Time) error {
+	return t.WriteHeader(&tar.Header{Name: name + "/", Typeflag: tar.TypeDir,
+		Mode: 0755, ModTime: modTime})
+}
+
+func (t tarArchive) addFile(name string, size int64, modTime time.Time) (io.Writer, error) {
+	err := t.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg,
+		Mode: 0644, Size: size, ModTime: modTime})
+	return t.Writer, err
+}
+
+func (t tarArchive) Close() error {
+	err := t.Writer.Close()
+	if t.compressor != nil {
+		if e := t.compressor.Close(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func newArchiveWriter(w io.Writer, format ArchiveFormat) (archiveWriter, error) {
+	switch format {
+	case Zip:
+		return zipArchive{zip.NewWriter(w)}, nil
+	case Tar:
+		return tarArchive{Writer: tar.NewWriter(w)}, nil
+	case TarGzip:
+		gz := gzip.NewWriter(w)
+		return tarArchive{Writer: tar.NewWriter(gz), compressor: gz}, nil
+	}
+	return nil, errors.New("Unknown archive format")
+}
+
+// Stream the folder tree as an archive, with a manifest entry
+func (f *FolderClient) Archive(w io.Writer, format ArchiveFormat) error {
+	return f.ArchiveWithOptions(w, format, ArchiveOptions{})
+}
+
+// Stream the entries of the folder tree selected by the options as an archive
+// Paths are relative to the folder and files keep their modification times.
+// A failure leaves an incomplete archive in the writer
+func (f *FolderClient) ArchiveWithOptions(w io.Writer, format ArchiveFormat, opts ArchiveOptions) error {
+	archive, err := newArchiveWriter(w, format)
+	if err != nil {
+		return err
+	}
+
+	manifest := ArchiveManifest{FolderId: f.Desc.Id, Files: []ManifestFile{},
+		Created: time.Now().UTC().Format(time.RFC3339)}
+	err = f.Walk(func(entry TreeEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if matchAny(opts.Exclude, entry.Path) {
+			if entry.IsDir {
+				return SkipFolder
+			}
+			return nil
+		}
+
+		if entry.IsDir {
+			if len(opts.Include) > 0 {
+				return nil
+			}
+			// AeroFS does not record folder modification times
+			return archive.addFolder(entry.Path, time.Now())
+		}
+		if len(opts.Include) > 0 && !matchAny(opts.Include, entry.Path) {
+			return nil
+		}
+
+		fc := FileClient{APIClient: f.APIClient, Desc: entry.File}
+		if fc.Desc.Etag == "" {
+			err = fc.LoadMetadata()
+			if err != nil {
+				return err
+			}
+		}
+
+		modTime, _ := time.Parse(time.RFC3339, fc.Desc.LastModified)
+		content, err := archive.addFile(entry.Path, int64(fc.Desc.Size), modTime)
+		if err != nil {
+			return err
+		}
+		err = fc.Download(content)
+		if err != nil {
+			return err
+		}
+
+		manifest.Files = append(manifest.Files, ManifestFile{Path: entry.Path,
+			Id: fc.Desc.Id, Etag: fc.Desc.Etag, Size: fc.Desc.Size,
+			LastModified: fc.Desc.LastModified})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if !opts.NoManifest {
+		data, err := json.MarshalIndent(manifest, "", "  ")
+		if err != nil {
+			return err
+		}
+		content, err := archive.addFile(ARCHIVE_MANIFEST_NAME, int64(len(data)), time.Now())
+		if err != nil {
+			return err
+		}
+		_, err = content.Write(data)
+		if err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
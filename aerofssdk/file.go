@@ -34,6 +34,40 @@ func NewFileClient(c *api.Client, fileId string, fields []string) (*FileClient,
 	return &f, nil
 }
 
+// Create a new, empty file under an existing parent folder
+func CreateFileClient(c *api.Client, parentId, name string) (*FileClient, error) {
+	body, header, err := c.CreateFile(parentId, name)
+	if err != nil {
+		return nil, err
+	}
+
+	f := FileClient{APIClient: c}
+	err = json.Unmarshal(body, &f.Desc)
+	if err != nil {
+		return nil, errors.New("Unable to unmarshal created File")
+	}
+	if etag := header.Get("ETag"); etag != "" {
+		f.Desc.Etag = etag
+	}
+	return &f, nil
+}
+
+// Load new File metadata from the server
+func (f *FileClient) LoadMetadata() error {
+	body, header, err := f.APIClient.GetFileMetadata(f.Desc.Id, f.OnDemand)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(body, &f.Desc)
+	if err != nil {
+		return errors.New("Unable to unmarshal retrieved File metadata")
+	}
+
+	f.Desc.Etag = header.Get("ETag")
+	return nil
+}
+
 // Reload the ParentPath of the File
 func (f *FileClient) LoadPath() error {
 	body, header, err := f.APIClient.GetFilePath(f.Desc.Id)
@@ -78,13 +112,71 @@ func (f *FileClient) GetContent() ([]byte, error) {
 	return body, nil
 }
 
+// Stream the file contents into a writer
+// The content is retrieved in CHUNKSIZE byte-ranges, each conditional on the
+// ETag of the file so a concurrent modification is reported as an error
+// rather than producing a mix of old and new content
+func (f *FileClient) Download(w io.Writer) error {
+	for startIndex := 0; startIndex < f.Desc.Size; startIndex += api.CHUNKSIZE {
+		endIndex := startIndex + api.CHUNKSIZE - 1
+		if endIndex >= f.Desc.Size {
+			endIndex = f.Desc.Size - 1
+		}
+
+		body, err := f.ReadRange(startIndex, endIndex)
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(body)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Retrieve the content between two offsets, inclusive, in a single request
+// conditional on the ETag of the file. An error is returned if the file
+// changed since its ETag was retrieved
+func (f *FileClient) ReadRange(start, end int) ([]byte, error) {
+	body, header, err := f.APIClient.GetFileContent(f.Desc.Id, f.Desc.Etag,
+		start, end, []string{})
+	if err != nil {
+		return nil, err
+	}
+
+	// If-Range returns the entire, modified file instead of the range
+	wholeFile := start == 0 && end == f.Desc.Size-1
+	if !wholeFile && header.Get("Content-Range") == "" {
+		return nil, errors.New("File content changed during download")
+	}
+	if len(body) != end-start+1 {
+		return nil, errors.New("Unexpected length of downloaded file content")
+	}
+	return body, nil
+}
+
+// Delete the file
+// The deletion only succeeds if the file has not changed since its ETag was
+// last retrieved
+func (f *FileClient) Delete() error {
+	return f.APIClient.DeleteFile(f.Desc.Id, []string{f.Desc.Etag})
+}
+
 // Update the existing content of a file
 func (f *FileClient) UploadFile(file io.Reader) error {
 	uploadId, err := f.APIClient.GetFileUploadId(f.Desc.Id, []string{f.Desc.Etag})
 	if err != nil {
-		return errors.New("Unable to retrieve UploadId for file")
+		return err
 	}
 
-	return f.APIClient.UploadFile(f.Desc.Id, uploadId, file,
+	err = f.APIClient.UploadFile(f.Desc.Id, uploadId, file,
 		[]string{f.Desc.Etag})
+	if err != nil {
+		return err
+	}
+
+	// Retrieve the ETag, size of the new content
+	return f.LoadMetadata()
 }
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	"net/http"
 )
 
 // An object representing a folder on the AeroFS appliance
@@ -41,6 +42,23 @@ func NewFolderClient(c *api.Client, folderId string, fields []string) (*FolderCl
 	return &f, nil
 }
 
+// Create a new folder under an existing parent folder and return its client
+func CreateFolderClient(c *api.Client, parentId, name string) (*FolderClient, error) {
+	body, header, err := c.CreateFolder(parentId, name)
+	if err != nil {
+		return nil, err
+	}
+
+	f := FolderClient{APIClient: c}
+	err = json.Unmarshal(body, &f.Desc)
+	if err != nil {
+		return nil, errors.New("Unable to unmarshal created Folder")
+	}
+	f.Desc.Etag = header.Get("ETag")
+
+	return &f, nil
+}
+
 // Load the most up to date path from the server
 func (f *FolderClient) LoadPath() error {
 	body, _, err := f.APIClient.GetFolderPath(f.Desc.Id)
@@ -87,6 +105,26 @@ func (f *FolderClient) LoadMetadata() error {
 	return nil
 }
 
+// Load new Folder metadata only if the Folder changed since its ETag was last
+// retrieved. Returns whether the descriptor was updated
+func (f *FolderClient) LoadMetadataIfModified() (bool, error) {
+	body, header, err := f.APIClient.GetFolderMetadataIfNoneMatch(f.Desc.Id,
+		f.OnDemand, []string{f.Desc.Etag})
+	if api.IsStatus(err, http.StatusNotModified) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	err = json.Unmarshal(body, &f.Desc)
+	if err != nil {
+		return false, errors.New("Unable to unmarshal retrieved folder metadata")
+	}
+
+	f.Desc.Etag = header.Get("ETag")
+	return true, nil
+}
+
 // Update all Folder descriptor fields
 func (f *FolderClient) Load() error {
 	// Perform in a single call by retrieving all fields by setting the On-Demand
@@ -30,6 +30,22 @@ func ListGroups(c *api.Client, offset, results int) (*[]Group, error) {
 	return &groups, nil
 }
 
+// List every group, following the pagination of the group list with pages of
+// the given size
+func ListAllGroups(c *api.Client, pageSize int) ([]Group, error) {
+	groups := []Group{}
+	for offset := 0; ; offset += pageSize {
+		page, err := ListGroups(c, offset, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, *page...)
+		if len(*page) < pageSize {
+			return groups, nil
+		}
+	}
+}
+
 // Retrieve an existing group
 func NewGroupClient(c *api.Client, groupId string) (*GroupClient, error) {
 	body, _, err := c.GetGroup(groupId)
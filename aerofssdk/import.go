@@ -0,0 +1,515 @@
+package aerofssdk
+
+// Import of a zip or tar archive into a folder tree, the inverse of Archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// How Import treats a file which already exists in the destination
+type ImportConflictPolicy int
+
+const (
+	// Leave the existing file in place
+	ImportSkip ImportConflictPolicy = iota
+
+	// Replace the existing file, guarded by the ETag it had when listed so a
+	// concurrent modification fails the entry rather than being lost
+	ImportOverwrite
+
+	// Import the entry under a free name, ie. "report (1).pdf"
+	ImportRename
+)
+
+const DEFAULT_IMPORT_CONCURRENCY = 4
+
+// Options for Import
+type ImportOptions struct {
+	Conflict ImportConflictPolicy
+
+	// The number of files uploaded at once, DEFAULT_IMPORT_CONCURRENCY if 0
+	Concurrency int
+}
+
+// What became of an archive entry
+type ImportStatus int
+
+const (
+	ImportCreated ImportStatus = iota
+	ImportOverwritten
+	ImportRenamed
+	ImportSkipped
+	ImportFailed
+)
+
+func (s ImportStatus) String() string {
+	switch s {
+	case ImportCreated:
+		return "created"
+	case ImportOverwritten:
+		return "overwritten"
+	case ImportRenamed:
+		return "renamed"
+	case ImportSkipped:
+		return "skipped"
+	}
+	return "failed"
+}
+
+// The outcome of importing one file entry
+type ImportResult struct {
+	// Path of the entry in the archive
+	Path string
+
+	// Path the content was imported to relative to the destination, which
+	// differs from Path when renamed
+	ImportedPath string
+
+	Status ImportStatus
+	FileId string
+	Etag   string
+	Size   int
+	Err    error
+}
+
+// The outcome of an import, files are listed in archive order
+type ImportReport struct {
+	FoldersCreated int
+	Files          []ImportResult
+}
+
+// Return the entries which could not be imported
+func (r *ImportReport) Failed() []ImportResult {
+	failed := []ImportResult{}
+	for _, f := range r.Files {
+		if f.Status == ImportFailed {
+			failed = append(failed, f)
+		}
+	}
+	return failed
+}
+
+// Return the number of entries with a given status
+func (r *ImportReport) Count(status ImportStatus) int {
+	n := 0
+	for _, f := range r.Files {
+		if f.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// A file entry waiting to be uploaded
+type importEntry struct {
+	index int
+	path  string
+	open  func() (io.ReadCloser, error)
+
+	// Frees what holds the content once the entry is done with, may be nil
+	release func()
+}
+
+// A destination folder and the names of its children
+type importFolder struct {
+	id      string
+	files   map[string]File
+	folders map[string]string
+}
+
+type importer struct {
+	client *api.Client
+	opts   ImportOptions
+
+	// Guards the folders and the report, held while creating folders and
+	// choosing file names
+	mu      sync.Mutex
+	folders map[string]*importFolder
+	report  ImportReport
+}
+
+// Recreate the directory structure and files of an archive in the folder
+// Zip archives are read from the reader directly if it implements io.ReaderAt
+// and Size, ie. *os.File or *bytes.Reader, and otherwise spooled to a
+// temporary file. Failures of individual entries are recorded in the report,
+// an error is only returned if the archive cannot be read
+func (f *FolderClient) Import(r io.Reader, format ArchiveFormat, opts ImportOptions) (*ImportReport, error) {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DEFAULT_IMPORT_CONCURRENCY
+	}
+	imp := importer{client: f.APIClient, opts: opts,
+		folders: map[string]*importFolder{"": &importFolder{id: f.Desc.Id}}}
+
+	entries := make(chan importEntry)
+	wg := sync.WaitGroup{}
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range entries {
+				imp.importFile(e)
+			}
+		}()
+	}
+
+	var err error
+	switch format {
+	case Zip:
+		err = imp.readZip(r, entries)
+	case Tar:
+		err = imp.readTar(r, entries)
+	case TarGzip:
+		var gz *gzip.Reader
+		gz, err = gzip.NewReader(r)
+		if err == nil {
+			err = imp.readTar(gz, entries)
+		}
+	default:
+		err = errors.New("Unknown archive format")
+	}
+	close(entries)
+	wg.Wait()
+	return &imp.report, err
+}
+
+// Return the cleaned path of an archive entry within the destination, empty
+// for the root or the manifest written by Archive
+func entryPath(name string) string {
+	p := strings.TrimPrefix(path.Clean("/"+name), "/")
+	if p == ARCHIVE_MANIFEST_NAME {
+		return ""
+	}
+	return p
+}
+
+// Record a new file entry, returning its index in the report
+func (imp *importer) add(p string) int {
+	imp.mu.Lock()
+	defer imp.mu.Unlock()
+	imp.report.Files = append(imp.report.Files, ImportResult{Path: p, ImportedPath: p})
+	return len(imp.report.Files) - 1
+}
+
+// Record a folder entry, creating it
+func (imp *importer) addFolder(p string) {
+	imp.mu.Lock()
+	defer imp.mu.Unlock()
+
+	_, err := imp.folder(p)
+	if err != nil {
+		imp.report.Files = append(imp.report.Files, ImportResult{Path: p + "/",
+			ImportedPath: p + "/", Status: ImportFailed, Err: err})
+	}
+}
+
+func (imp *importer) readZip(r io.Reader, entries chan<- importEntry) error {
+	type sizedReaderAt interface {
+		io.ReaderAt
+		Size() int64
+	}
+
+	var readerAt io.ReaderAt
+	var size int64
+	switch v := r.(type) {
+	case sizedReaderAt:
+		readerAt, size = v, v.Size()
+	case *os.File:
+		info, err := v.Stat()
+		if err != nil {
+			return err
+		}
+		readerAt, size = v, info.Size()
+	default:
+		spool, err := ioutil.TempFile("", "aerofs-import-")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(spool.Name())
+		defer spool.Close()
+
+		size, err = io.Copy(spool, r)
+		if err != nil {
+			return err
+		}
+		readerAt = spool
+	}
+
+	archive, err := zip.NewReader(readerAt, size)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range archive.File {
+		p := entryPath(file.Name)
+		switch {
+		case p == "":
+		case strings.HasSuffix(file.Name, "/"):
+			imp.addFolder(p)
+		default:
+			entries <- importEntry{index: imp.add(p), path: p, open: file.Open}
+		}
+	}
+	return nil
+}
+
+// Tar entries can only be read in order, the content of each is held in
+// memory or spooled to a temporary file until it is uploaded
+func (imp *importer) readTar(r io.Reader, entries chan<- importEntry) error {
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		p := entryPath(header.Name)
+		switch {
+		case p == "":
+		case header.Typeflag == tar.TypeDir:
+			imp.addFolder(p)
+		case header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA:
+			i := imp.add(p)
+			imp.setResult(i, ImportResult{Status: ImportSkipped,
+				Err: errors.New("Unsupported entry type")})
+		default:
+			open, release, err := bufferEntry(archive, header.Size)
+			if err != nil {
+				return err
+			}
+			entries <- importEntry{index: imp.add(p), path: p, open: open, release: release}
+		}
+	}
+}
+
+// Read the content of the current tar entry, returning a function opening it
+// once and a function freeing it. Contents larger than CHUNKSIZE are spooled
+// to a temporary file, removed when the entry is released
+func bufferEntry(r io.Reader, size int64) (func() (io.ReadCloser, error), func(), error) {
+	if size <= api.CHUNKSIZE {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(data)), nil
+		}, nil, nil
+	}
+
+	spool, err := ioutil.TempFile("", "aerofs-import-")
+	if err != nil {
+		return nil, nil, err
+	}
+	release := func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}
+	_, err = io.Copy(spool, r)
+	if err == nil {
+		_, err = spool.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	return func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(spool), nil
+	}, release, nil
+}
+
+// Fill in the result of a file entry, keeping its paths
+func (imp *importer) setResult(i int, result ImportResult) {
+	imp.mu.Lock()
+	defer imp.mu.Unlock()
+	result.Path = imp.report.Files[i].Path
+	if result.ImportedPath == "" {
+		result.ImportedPath = result.Path
+	}
+	imp.report.Files[i] = result
+}
+
+// Load the children of a folder if they were not listed yet, the lock must be
+// held
+func (imp *importer) list(folder *importFolder) error {
+	if folder.files != nil {
+		return nil
+	}
+
+	fc := FolderClient{APIClient: imp.client, Desc: Folder{Id: folder.id}}
+	err := fc.LoadChildren()
+	if err != nil {
+		return err
+	}
+
+	folder.files = map[string]File{}
+	folder.folders = map[string]string{}
+	for _, file := range fc.Desc.ChildList.Files {
+		folder.files[file.Name] = File(file)
+	}
+	for _, sub := range fc.Desc.ChildList.Folders {
+		folder.folders[sub.Name] = sub.Id
+	}
+	return nil
+}
+
+// Return the destination folder at a relative path, creating it and its
+// parents if needed. The lock must be held
+func (imp *importer) folder(p string) (*importFolder, error) {
+	if p == "." {
+		p = ""
+	}
+	if folder, ok := imp.folders[p]; ok {
+		return folder, nil
+	}
+
+	parent, err := imp.folder(path.Dir(p))
+	if err != nil {
+		return nil, err
+	}
+	err = imp.list(parent)
+	if err != nil {
+		return nil, err
+	}
+
+	name := path.Base(p)
+	id, ok := parent.folders[name]
+	if !ok {
+		if _, ok := parent.files[name]; ok {
+			return nil, errors.New("A file exists with the folder name " + name)
+		}
+
+		created, err := CreateFolderClient(imp.client, parent.id, name)
+		if err != nil {
+			return nil, err
+		}
+		id = created.Desc.Id
+		parent.folders[name] = id
+		imp.report.FoldersCreated++
+	}
+
+	folder := &importFolder{id: id}
+	imp.folders[p] = folder
+	return folder, nil
+}
+
+// Return a name which is free in the folder, the lock must be held
+func freeName(folder *importFolder, name string) string {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, i, ext)
+		_, isFile := folder.files[candidate]
+		_, isFolder := folder.folders[candidate]
+		if !isFile && !isFolder {
+			return candidate
+		}
+	}
+}
+
+// Decide where a file entry goes, reserving its name
+// Returns a nil client if the entry is skipped
+func (imp *importer) place(p string) (*FileClient, *importFolder, ImportResult, error) {
+	imp.mu.Lock()
+	defer imp.mu.Unlock()
+
+	dir, name := path.Split(p)
+	result := ImportResult{ImportedPath: p, Status: ImportCreated}
+	folder, err := imp.folder(strings.TrimSuffix(dir, "/"))
+	if err == nil {
+		err = imp.list(folder)
+	}
+	if err != nil {
+		return nil, nil, result, err
+	}
+
+	existing, exists := folder.files[name]
+	if _, ok := folder.folders[name]; ok {
+		exists = true
+	}
+	if exists {
+		switch {
+		case imp.opts.Conflict == ImportSkip:
+			result.Status = ImportSkipped
+			result.FileId, result.Etag, result.Size = existing.Id, existing.Etag, existing.Size
+			return nil, folder, result, nil
+		case imp.opts.Conflict == ImportRename:
+			name = freeName(folder, name)
+			result.ImportedPath = path.Join(dir, name)
+			result.Status = ImportRenamed
+		case existing.Id == "":
+			// A folder, or a file reserved by an earlier entry of the archive
+			return nil, folder, result, errors.New("Unable to overwrite " + p)
+		default:
+			result.Status = ImportOverwritten
+			folder.files[name] = File{Name: name}
+			return &FileClient{APIClient: imp.client, Desc: existing}, folder, result, nil
+		}
+	}
+
+	// Reserve the name until the file is created
+	folder.files[name] = File{Name: name}
+	return &FileClient{Desc: File{Name: name, Parent: folder.id}}, folder, result, nil
+}
+
+func (imp *importer) importFile(e importEntry) {
+	if e.release != nil {
+		defer e.release()
+	}
+
+	f, folder, result, err := imp.place(e.path)
+	if err != nil || f == nil {
+		if err != nil {
+			result.Status, result.Err = ImportFailed, err
+		}
+		imp.setResult(e.index, result)
+		return
+	}
+
+	name := path.Base(result.ImportedPath)
+	content, err := e.open()
+	if err == nil {
+		err = imp.upload(f, name, content)
+		content.Close()
+	}
+	if err != nil {
+		if api.IsStatus(err, http.StatusPreconditionFailed) {
+			err = errors.New("The file was modified during the import")
+		}
+		result.Status, result.Err = ImportFailed, err
+		imp.setResult(e.index, result)
+		return
+	}
+
+	imp.mu.Lock()
+	folder.files[name] = f.Desc
+	imp.mu.Unlock()
+
+	result.FileId, result.Etag, result.Size = f.Desc.Id, f.Desc.Etag, f.Desc.Size
+	imp.setResult(e.index, result)
+}
+
+// Upload the content of an entry, creating the file unless it exists
+func (imp *importer) upload(f *FileClient, name string, content io.Reader) error {
+	if f.APIClient == nil {
+		created, err := CreateFileClient(imp.client, f.Desc.Parent, name)
+		if err != nil {
+			return err
+		}
+		*f = *created
+	}
+	return f.putContent(name, content, PutOptions{})
+}
@@ -0,0 +1,226 @@
+package aerofssdk
+
+// Optional end-to-end verification of file transfers
+// Content is hashed while it is streamed, the resulting length and ETag are
+// compared against the appliance and, for uploads, a sample of the content is
+// downloaded again and compared with what was sent
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// Hash algorithms computed in addition to SHA-256
+const (
+	HashMD5 = 1 << iota
+	HashCRC32C
+)
+
+// Default number of bytes re-downloaded from the start and end of an upload
+const DEFAULT_SAMPLE_SIZE = 64 * 1024
+
+// Verification options
+type VerifyOptions struct {
+	// Additional hashes to compute, ie. HashMD5|HashCRC32C
+	Hashes int
+
+	// Number of bytes re-downloaded from the start and end of an uploaded
+	// file, defaults to DEFAULT_SAMPLE_SIZE. A negative value disables sampling
+	SampleSize int
+
+	// If set, the transferred content must match this digest. Empty hashes and
+	// a zero size are not compared
+	Expected *Digest
+}
+
+// The length and hex encoded hashes of transferred content
+type Digest struct {
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	MD5    string `json:"md5,omitempty"`
+	CRC32C string `json:"crc32c,omitempty"`
+}
+
+// The error returned when transferred content fails verification
+type ErrIntegrity struct {
+	FileId string
+
+	// The property which did not match, ie. "size", "sha256" or "etag"
+	Property string
+	Expected string
+	Actual   string
+}
+
+func (e *ErrIntegrity) Error() string {
+	return fmt.Sprintf("Integrity check failed for file %s : %s is %s, expected %s",
+		e.FileId, e.Property, e.Actual, e.Expected)
+}
+
+// A writer computing a Digest and retaining samples of the written content
+type digester struct {
+	size   int64
+	sha    hash.Hash
+	md5    hash.Hash
+	crc32c hash.Hash
+
+	sampleSize int
+	head       []byte
+	tail       []byte
+}
+
+func newDigester(opts VerifyOptions) *digester {
+	d := digester{sha: sha256.New(), sampleSize: opts.SampleSize}
+	if opts.Hashes&HashMD5 != 0 {
+		d.md5 = md5.New()
+	}
+	if opts.Hashes&HashCRC32C != 0 {
+		d.crc32c = crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	}
+	if d.sampleSize == 0 {
+		d.sampleSize = DEFAULT_SAMPLE_SIZE
+	}
+	return &d
+}
+
+func (d *digester) Write(p []byte) (int, error) {
+	d.size += int64(len(p))
+	for _, h := range []hash.Hash{d.sha, d.md5, d.crc32c} {
+		if h != nil {
+			h.Write(p)
+		}
+	}
+
+	if d.sampleSize > 0 {
+		if missing := d.sampleSize - len(d.head); missing > 0 {
+			if missing > len(p) {
+				missing = len(p)
+			}
+			d.head = append(d.head, p[:missing]...)
+		}
+		d.tail = append(d.tail, p...)
+		if len(d.tail) > d.sampleSize {
+			d.tail = d.tail[len(d.tail)-d.sampleSize:]
+		}
+	}
+	return len(p), nil
+}
+
+func (d *digester) digest() *Digest {
+	digest := Digest{Size: d.size, SHA256: hex.EncodeToString(d.sha.Sum(nil))}
+	if d.md5 != nil {
+		digest.MD5 = hex.EncodeToString(d.md5.Sum(nil))
+	}
+	if d.crc32c != nil {
+		digest.CRC32C = hex.EncodeToString(d.crc32c.Sum(nil))
+	}
+	return &digest
+}
+
+// Compare a computed digest with the expected one
+func (d *Digest) compare(fileId string, expected *Digest) error {
+	if expected == nil {
+		return nil
+	}
+
+	size := ""
+	if expected.Size != 0 {
+		size = fmt.Sprint(expected.Size)
+	}
+	pairs := [][3]string{
+		{"size", size, fmt.Sprint(d.Size)},
+		{"sha256", expected.SHA256, d.SHA256},
+		{"md5", expected.MD5, d.MD5},
+		{"crc32c", expected.CRC32C, d.CRC32C},
+	}
+	for _, p := range pairs {
+		if p[1] != "" && p[1] != p[2] {
+			return &ErrIntegrity{FileId: fileId, Property: p[0], Expected: p[1], Actual: p[2]}
+		}
+	}
+	return nil
+}
+
+// Upload new content and verify it
+// The size of the new content must match the number of bytes sent, the ETag
+// must have changed and the sampled ranges must download identically
+func (f *FileClient) UploadVerified(content io.Reader, opts VerifyOptions) (*Digest, error) {
+	oldEtag := f.Desc.Etag
+	d := newDigester(opts)
+
+	err := f.UploadFile(io.TeeReader(content, d))
+	if err != nil {
+		return nil, err
+	}
+	return d.digest(), f.verifyUpload(oldEtag, d, opts)
+}
+
+// Verify the metadata and sampled content of a completed upload
+// The client must contain the metadata retrieved after the upload
+func (f *FileClient) verifyUpload(oldEtag string, d *digester, opts VerifyOptions) error {
+	digest := d.digest()
+	if int64(f.Desc.Size) != digest.Size {
+		return &ErrIntegrity{FileId: f.Desc.Id, Property: "size",
+			Expected: fmt.Sprint(digest.Size), Actual: fmt.Sprint(f.Desc.Size)}
+	}
+	// Uploading empty content to an empty file may not create a new version
+	unchanged := oldEtag != "" && f.Desc.Etag == oldEtag && digest.Size > 0
+	if f.Desc.Etag == "" || unchanged {
+		return &ErrIntegrity{FileId: f.Desc.Id, Property: "etag",
+			Expected: "a new ETag", Actual: fmt.Sprintf("%q", f.Desc.Etag)}
+	}
+
+	err := digest.compare(f.Desc.Id, opts.Expected)
+	if err != nil || len(d.head) == 0 {
+		return err
+	}
+
+	samples := map[int][]byte{0: d.head, f.Desc.Size - len(d.tail): d.tail}
+	for start, sample := range samples {
+		body, _, err := f.APIClient.GetFileContent(f.Desc.Id, "", start,
+			start+len(sample)-1, []string{})
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(body, sample) {
+			return &ErrIntegrity{FileId: f.Desc.Id, Property: "content",
+				Expected: fmt.Sprintf("bytes %d-%d as uploaded", start, start+len(sample)-1),
+				Actual:   "different content"}
+		}
+	}
+	return nil
+}
+
+// Download the file and verify it
+// The number of bytes received must match the size of the file and the ETag
+// must not have changed during the download
+func (f *FileClient) DownloadVerified(w io.Writer, opts VerifyOptions) (*Digest, error) {
+	oldEtag := f.Desc.Etag
+	d := newDigester(VerifyOptions{Hashes: opts.Hashes, SampleSize: -1})
+
+	err := f.Download(io.MultiWriter(w, d))
+	if err != nil {
+		return nil, err
+	}
+
+	digest := d.digest()
+	if digest.Size != int64(f.Desc.Size) {
+		return digest, &ErrIntegrity{FileId: f.Desc.Id, Property: "size",
+			Expected: fmt.Sprint(f.Desc.Size), Actual: fmt.Sprint(digest.Size)}
+	}
+
+	err = f.LoadMetadata()
+	if err != nil {
+		return digest, err
+	}
+	if oldEtag != "" && f.Desc.Etag != oldEtag {
+		return digest, &ErrIntegrity{FileId: f.Desc.Id, Property: "etag",
+			Expected: oldEtag, Actual: f.Desc.Etag}
+	}
+	return digest, digest.compare(f.Desc.Id, opts.Expected)
+}
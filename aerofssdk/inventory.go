@@ -0,0 +1,288 @@
+package aerofssdk
+
+// Enumeration of an organization : its users, groups, shared folders with
+// their ACLs and trees, and the root folders of users with a token
+
+import (
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	"time"
+)
+
+// Everything enumerated by an inventory
+type Catalog struct {
+	Created string `json:"created"`
+
+	// The hostname of the Appliance which was enumerated
+	Host string `json:"host"`
+
+	Users    []UserRecord  `json:"users"`
+	Groups   []GroupRecord `json:"groups"`
+	Shares   []ShareRecord `json:"shares"`
+	Roots    []RootRecord  `json:"roots"`
+	Failures []Failure     `json:"failures"`
+}
+
+type UserRecord struct {
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+
+	// Pending invitations to shared folders
+	Invitations []api.Invitation `json:"invitations"`
+}
+
+type GroupRecord struct {
+	Id      string   `json:"id"`
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
+
+// A shared folder, its ACL and its tree
+type ShareRecord struct {
+	Id       string                `json:"id"`
+	Name     string                `json:"name"`
+	External bool                  `json:"is_external"`
+	Members  []api.SFMember        `json:"members"`
+	Groups   []api.SFGroupMember   `json:"groups"`
+	Pending  []api.SFPendingMember `json:"pending"`
+	Files    []FileRecord          `json:"files"`
+}
+
+// The tree of a user's root folder, excluding shared folders
+type RootRecord struct {
+	Email string       `json:"email"`
+	Files []FileRecord `json:"files"`
+}
+
+// A file or folder of a tree
+type FileRecord struct {
+	// Slash-separated path relative to the root of the tree
+	Path         string `json:"path"`
+	IsDir        bool   `json:"is_dir,omitempty"`
+	Id           string `json:"id"`
+	Etag         string `json:"etag,omitempty"`
+	Size         int    `json:"size,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Mime         string `json:"mime_type,omitempty"`
+
+	// The SHA-256 of the content, only set when the content was retrieved
+	Hash string `json:"hash,omitempty"`
+}
+
+// Options for Inventory
+type InventoryOptions struct {
+	// OAuth tokens of the users whose root folders are enumerated, by email.
+	// An admin token can read shared folders but not users' root folders
+	UserTokens map[string]string
+
+	// Users and groups are listed in pages of this size, DEFAULT_PAGE_SIZE
+	// if 0
+	PageSize int
+
+	// Called with every file and its record, to retrieve its content or
+	// complete the record, may be nil
+	File func(f *FileClient, record *FileRecord) error
+
+	// Called with progress messages, may be nil
+	Log func(format string, args ...interface{})
+}
+
+type inventory struct {
+	client  *api.Client
+	opts    InventoryOptions
+	catalog *Catalog
+}
+
+// Enumerate the users, groups, shared folders with their ACLs and trees, and
+// the root folders of users with a token, using an admin token
+// Items which fail are recorded in the catalog, an error is only returned if
+// the enumeration could not proceed
+func Inventory(c *api.Client, opts InventoryOptions) (*Catalog, error) {
+	if opts.PageSize <= 0 {
+		opts.PageSize = DEFAULT_PAGE_SIZE
+	}
+	inv := inventory{client: c, opts: opts,
+		catalog: &Catalog{Host: c.Host,
+			Created:  time.Now().UTC().Format(time.RFC3339),
+			Users:    []UserRecord{},
+			Groups:   []GroupRecord{},
+			Shares:   []ShareRecord{},
+			Roots:    []RootRecord{},
+			Failures: []Failure{}}}
+
+	err := inv.users()
+	if err != nil {
+		return nil, err
+	}
+	err = inv.groups()
+	if err != nil {
+		return nil, err
+	}
+	inv.shares()
+	inv.roots()
+	return inv.catalog, nil
+}
+
+func (inv *inventory) log(format string, args ...interface{}) {
+	if inv.opts.Log != nil {
+		inv.opts.Log(format, args...)
+	}
+}
+
+func (inv *inventory) fail(item string, err error) {
+	inv.log("%s : %s", item, err)
+	inv.catalog.Failures = append(inv.catalog.Failures, Failure{Item: item, Error: err.Error()})
+}
+
+func (inv *inventory) users() error {
+	users, err := ListAllUsers(inv.client, inv.opts.PageSize)
+	if err != nil {
+		return err
+	}
+	inv.log("Enumerating %d users", len(users))
+
+	for _, u := range users {
+		record := UserRecord{Email: u.Email, FirstName: u.FirstName,
+			LastName: u.LastName, Invitations: u.Invitations}
+
+		// Listed users may not include their invitations
+		if record.Invitations == nil {
+			uc, err := GetUserClient(inv.client, u.Email)
+			if err != nil {
+				inv.fail("user "+u.Email, err)
+			} else {
+				record.Invitations = uc.Desc.Invitations
+			}
+		}
+		inv.catalog.Users = append(inv.catalog.Users, record)
+	}
+	return nil
+}
+
+func (inv *inventory) groups() error {
+	groups, err := ListAllGroups(inv.client, inv.opts.PageSize)
+	if err != nil {
+		return err
+	}
+
+	for _, g := range groups {
+		record := GroupRecord{Id: g.Id, Name: g.Name, Members: []string{}}
+		members := g.Members
+		if members == nil {
+			gc, err := NewGroupClient(inv.client, g.Id)
+			if err != nil {
+				inv.fail("group "+g.Name, err)
+			} else {
+				members = gc.Desc.Members
+			}
+		}
+		for _, m := range members {
+			record.Members = append(record.Members, m.Email)
+		}
+		inv.catalog.Groups = append(inv.catalog.Groups, record)
+	}
+	inv.log("Enumerated %d groups", len(inv.catalog.Groups))
+	return nil
+}
+
+// Enumerate every shared folder any user is a member of, once
+func (inv *inventory) shares() {
+	seen := map[string]bool{}
+	for _, u := range inv.catalog.Users {
+		shares, err := ListSharedFolders(inv.client, u.Email, []string{})
+		if err != nil {
+			inv.fail("shares of "+u.Email, err)
+			continue
+		}
+
+		for _, s := range shares {
+			if seen[s.Id] {
+				continue
+			}
+			seen[s.Id] = true
+
+			sf, err := GetSharedFolderClient(inv.client, s.Id, []string{})
+			if err != nil {
+				inv.fail("share "+s.Name, err)
+				continue
+			}
+
+			inv.log("Enumerating shared folder %s", sf.Desc.Name)
+			record := ShareRecord{Id: sf.Desc.Id, Name: sf.Desc.Name,
+				External: sf.Desc.External, Members: sf.Desc.Members,
+				Groups: sf.Desc.Groups, Pending: sf.Desc.Pending}
+			record.Files = inv.tree(inv.client, ShareRootFolderId(sf.Desc.Id), "share "+sf.Desc.Name)
+			inv.catalog.Shares = append(inv.catalog.Shares, record)
+		}
+	}
+}
+
+// Enumerate the root folders of the users with a token
+func (inv *inventory) roots() {
+	for _, u := range inv.catalog.Users {
+		token, ok := inv.opts.UserTokens[u.Email]
+		if !ok {
+			continue
+		}
+
+		c, err := api.NewClient(token, inv.client.Host)
+		if err != nil {
+			inv.fail("root of "+u.Email, err)
+			continue
+		}
+		inv.log("Enumerating root folder of %s", u.Email)
+		inv.catalog.Roots = append(inv.catalog.Roots, RootRecord{Email: u.Email,
+			Files: inv.tree(c, "root", "root of "+u.Email)})
+	}
+}
+
+// Enumerate a folder tree, shared folders within it are left out as they are
+// enumerated on their own
+func (inv *inventory) tree(c *api.Client, folderId, item string) []FileRecord {
+	files := []FileRecord{}
+	root := FolderClient{APIClient: c, Desc: Folder{Id: folderId}}
+	root.Walk(func(entry TreeEntry, err error) error {
+		if err != nil {
+			inv.fail(fmt.Sprintf("%s: %s", item, entry.Path), err)
+			return nil
+		}
+
+		if entry.IsDir {
+			if entry.Folder.IsShared {
+				return SkipFolder
+			}
+			files = append(files, FileRecord{Path: entry.Path, IsDir: true, Id: entry.Folder.Id})
+			return nil
+		}
+
+		record, err := inv.file(c, entry)
+		if err != nil {
+			inv.fail(fmt.Sprintf("%s: %s", item, entry.Path), err)
+			return nil
+		}
+		files = append(files, record)
+		return nil
+	})
+	return files
+}
+
+func (inv *inventory) file(c *api.Client, entry TreeEntry) (FileRecord, error) {
+	f := FileClient{APIClient: c, Desc: entry.File}
+	if f.Desc.Etag == "" {
+		err := f.LoadMetadata()
+		if err != nil {
+			return FileRecord{}, err
+		}
+	}
+
+	record := FileRecord{Path: entry.Path, Id: f.Desc.Id, Etag: f.Desc.Etag,
+		Size: f.Desc.Size, LastModified: f.Desc.LastModified, Mime: f.Desc.Mime}
+	if inv.opts.File != nil {
+		err := inv.opts.File(&f, &record)
+		if err != nil {
+			return FileRecord{}, err
+		}
+	}
+	return record, nil
+}
@@ -0,0 +1,82 @@
+package aerofssdk
+
+import (
+	"encoding/json"
+	"errors"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+)
+
+// An Invitation object represents an invitation of a user to a shared folder,
+// as seen by the invited user
+
+// Invitation, Client wrapper
+type InvitationClient struct {
+	APIClient *api.Client
+	Email     string
+	Desc      Invitation
+}
+
+// Invitation descriptor
+type Invitation api.Invitation
+
+// Retrieve the pending invitations of a user
+func ListInvitations(c *api.Client, email string) ([]Invitation, error) {
+	body, _, err := c.ListSFInvitations(email)
+	if err != nil {
+		return nil, err
+	}
+	invitations := []Invitation{}
+	err = json.Unmarshal(body, &invitations)
+	if err != nil {
+		return nil, errors.New("Unable to unmarshal the list of retrieved Invitations")
+	}
+	return invitations, nil
+}
+
+// Return an existing InvitationClient given the invited user and the shared
+// folder
+func GetInvitationClient(c *api.Client, email, sid string) (*InvitationClient, error) {
+	client := InvitationClient{APIClient: c, Email: email, Desc: Invitation{Sid: sid}}
+	err := client.Load()
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// Retrieve up to date fields for the Invitation
+func (i *InvitationClient) Load() error {
+	body, _, err := i.APIClient.ViewPendingSFInvitation(i.Email, i.Desc.Sid)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(body, &i.Desc)
+	if err != nil {
+		return errors.New("Unable to unmarshal retrieved Invitation")
+	}
+	return nil
+}
+
+// Accept the invitation and return the shared folder joined
+// An external shared folder is synced outside of the root folder of the user
+func (i *InvitationClient) Accept(external bool) (*SharedFolder, error) {
+	flag := 0
+	if external {
+		flag = 1
+	}
+	body, _, err := i.APIClient.AcceptSFInvitation(i.Email, i.Desc.Sid, flag)
+	if err != nil {
+		return nil, err
+	}
+	sf := SharedFolder{}
+	err = json.Unmarshal(body, &sf)
+	if err != nil {
+		return nil, errors.New("Unable to unmarshal the accepted SharedFolder")
+	}
+	return &sf, nil
+}
+
+// Ignore the invitation, the user is not invited anymore
+func (i *InvitationClient) Ignore() error {
+	return i.APIClient.IgnoreSFInvitation(i.Email, i.Desc.Sid)
+}
@@ -0,0 +1,77 @@
+package aerofssdk
+
+import (
+	"encoding/json"
+	"errors"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+)
+
+// An Invitee object represents a person invited to sign up to the Appliance,
+// who has not created an account yet
+
+// Invitee, Client wrapper
+type InviteeClient struct {
+	APIClient *api.Client
+	Desc      Invitee
+}
+
+// Invitee descriptor
+type Invitee api.Invitee
+
+// Return an existing InviteeClient given the invited email
+func GetInviteeClient(c *api.Client, email string) (*InviteeClient, error) {
+	client := InviteeClient{APIClient: c, Desc: Invitee{EmailTo: email}}
+	err := client.Load()
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// Invite a person to sign up and return a client for the invitee
+// The invitation is sent from the given email, which must be a user's
+func CreateInviteeClient(c *api.Client, emailTo, emailFrom string) (*InviteeClient, error) {
+	body, _, err := c.CreateInvitee(emailTo, emailFrom)
+	if err != nil {
+		return nil, err
+	}
+	client := InviteeClient{APIClient: c}
+	err = json.Unmarshal(body, &client.Desc)
+	if err != nil {
+		return nil, errors.New("Unable to unmarshal the created Invitee")
+	}
+	return &client, nil
+}
+
+// Retrieve up to date fields for the Invitee
+func (i *InviteeClient) Load() error {
+	body, _, err := i.APIClient.GetInvitee(i.Desc.EmailTo)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(body, &i.Desc)
+	if err != nil {
+		return errors.New("Unable to unmarshal the retrieved Invitee")
+	}
+	return nil
+}
+
+// Revoke the invitation, its signup code no longer works
+func (i *InviteeClient) Delete() error {
+	return i.APIClient.DeleteInvitee(i.Desc.EmailTo)
+}
+
+// Send the invitation again by revoking and recreating it, which issues a new
+// signup code
+func (i *InviteeClient) Resend() error {
+	err := i.Delete()
+	if err != nil {
+		return err
+	}
+	created, err := CreateInviteeClient(i.APIClient, i.Desc.EmailTo, i.Desc.EmailFrom)
+	if err != nil {
+		return err
+	}
+	i.Desc = created.Desc
+	return nil
+}
@@ -0,0 +1,76 @@
+package aerofssdk
+
+// Files and folders resolved from paths, as served by the file protocol
+// gateways
+
+import (
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	"net/http"
+	"os"
+	"time"
+)
+
+// A file or folder resolved from a path, along with its parent folder
+type Node struct {
+	Dir bool
+
+	// The identifier of the parent folder, empty for the root folder
+	ParentId string
+
+	Folder Folder
+	File   File
+}
+
+func (n *Node) Id() string {
+	if n.Dir {
+		return n.Folder.Id
+	}
+	return n.File.Id
+}
+
+// Implements os.FileInfo from the metadata of a node, Sys returns the node
+type NodeInfo struct {
+	Node *Node
+}
+
+func (fi *NodeInfo) Name() string {
+	if fi.Node.Dir {
+		return fi.Node.Folder.Name
+	}
+	return fi.Node.File.Name
+}
+
+func (fi *NodeInfo) Size() int64 {
+	if fi.Node.Dir {
+		return 0
+	}
+	return int64(fi.Node.File.Size)
+}
+
+func (fi *NodeInfo) Mode() os.FileMode {
+	if fi.Node.Dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+func (fi *NodeInfo) ModTime() time.Time {
+	modTime, _ := time.Parse(time.RFC3339, fi.Node.File.LastModified)
+	return modTime
+}
+
+func (fi *NodeInfo) IsDir() bool      { return fi.Node.Dir }
+func (fi *NodeInfo) Sys() interface{} { return fi.Node }
+
+// Map API errors onto the errors of the os package
+func OSError(err error) error {
+	switch {
+	case api.IsStatus(err, http.StatusNotFound):
+		return os.ErrNotExist
+	case api.IsStatus(err, http.StatusForbidden), api.IsStatus(err, http.StatusPreconditionFailed):
+		return os.ErrPermission
+	case api.IsStatus(err, http.StatusConflict):
+		return os.ErrExist
+	}
+	return err
+}
@@ -0,0 +1,407 @@
+package aerofssdk
+
+// Offboarding a departing user : their shared folders are handed over to a
+// successor, their access is revoked and their account deleted, with a report
+// of every step which can be signed with a secret key
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The steps of an offboarding
+const (
+	OffboardArchiveRoot      = "archive_root"
+	OffboardTransferManage   = "transfer_manage"
+	OffboardLeaveShare       = "leave_share"
+	OffboardLeaveGroup       = "leave_group"
+	OffboardIgnoreInvitation = "ignore_invitation"
+	OffboardDeleteInvitee    = "delete_invitee"
+	OffboardDisablePassword  = "disable_password"
+	OffboardDisableTwoFactor = "disable_two_factor"
+	OffboardDeleteUser       = "delete_user"
+)
+
+// Options for Offboard
+type OffboardOptions struct {
+	// The user MANAGE is transferred to on shared folders the departing user
+	// is the only manager of. Offboarding fails if such folders exist and no
+	// successor is given
+	Successor string
+
+	// The root folder of the user is archived to this writer if it is not nil.
+	// Reading a root folder requires an OAuth token of the user
+	Archive       io.Writer
+	ArchiveFormat ArchiveFormat
+	UserToken     string
+
+	// Only report the steps, nothing is changed
+	DryRun bool
+
+	// The person signing off the offboarding, recorded in the report
+	ApprovedBy string
+
+	// Called with progress messages, may be nil
+	Log func(format string, args ...interface{})
+}
+
+type OffboardStatus int
+
+const (
+	OffboardPlanned OffboardStatus = iota
+	OffboardDone
+	OffboardSkipped
+	OffboardFailed
+)
+
+func (s OffboardStatus) String() string {
+	switch s {
+	case OffboardPlanned:
+		return "planned"
+	case OffboardDone:
+		return "done"
+	case OffboardSkipped:
+		return "skipped"
+	}
+	return "failed"
+}
+
+func (s OffboardStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s *OffboardStatus) UnmarshalJSON(data []byte) error {
+	name := ""
+	err := json.Unmarshal(data, &name)
+	if err != nil {
+		return err
+	}
+	for _, status := range []OffboardStatus{OffboardPlanned, OffboardDone, OffboardSkipped, OffboardFailed} {
+		if status.String() == name {
+			*s = status
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown offboarding status %q", name)
+}
+
+// A step of an offboarding, the target is a shared folder, a group or an
+// email depending on the action
+type OffboardStep struct {
+	Action string         `json:"action"`
+	Target string         `json:"target"`
+	Status OffboardStatus `json:"status"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// A shared folder of the departing user
+type OffboardShare struct {
+	Sid         string            `json:"sid"`
+	Name        string            `json:"name"`
+	Permissions api.PermissionSet `json:"permissions"`
+
+	// Whether nobody else manages the shared folder
+	SoleManager bool `json:"sole_manager"`
+}
+
+// What an offboarding found and did
+type OffboardReport struct {
+	Email      string          `json:"email"`
+	Successor  string          `json:"successor,omitempty"`
+	ApprovedBy string          `json:"approved_by,omitempty"`
+	DryRun     bool            `json:"dry_run"`
+	Started    string          `json:"started"`
+	Finished   string          `json:"finished"`
+	Devices    []Device        `json:"devices"`
+	Shares     []OffboardShare `json:"shares"`
+	Groups     []string        `json:"groups"`
+	Steps      []OffboardStep  `json:"steps"`
+
+	// The HMAC-SHA256 of the report without its signature, set by Sign
+	Signature string `json:"signature,omitempty"`
+}
+
+// Return the steps which failed
+func (r *OffboardReport) Failed() []OffboardStep {
+	failed := []OffboardStep{}
+	for _, s := range r.Steps {
+		if s.Status == OffboardFailed {
+			failed = append(failed, s)
+		}
+	}
+	return failed
+}
+
+func (r *OffboardReport) mac(key []byte) []byte {
+	unsigned := *r
+	unsigned.Signature = ""
+	data, _ := json.Marshal(unsigned)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// Sign the report with a secret key, so modifications by anyone without the
+// key can be detected
+func (r *OffboardReport) Sign(key []byte) error {
+	if len(key) == 0 {
+		return errors.New("A key is required to sign the report")
+	}
+	r.Signature = hex.EncodeToString(r.mac(key))
+	return nil
+}
+
+// Return whether the report was signed with the key and is unchanged since
+func (r *OffboardReport) Verify(key []byte) bool {
+	signature, err := hex.DecodeString(r.Signature)
+	if len(key) == 0 || err != nil || len(signature) == 0 {
+		return false
+	}
+	return hmac.Equal(signature, r.mac(key))
+}
+
+type offboarding struct {
+	c      *api.Client
+	email  string
+	opts   OffboardOptions
+	report *OffboardReport
+}
+
+func (o *offboarding) log(format string, args ...interface{}) {
+	if o.opts.Log != nil {
+		o.opts.Log(format, args...)
+	}
+}
+
+// Run a step, or only record it in a dry run
+func (o *offboarding) step(action, target string, fn func() error) bool {
+	s := OffboardStep{Action: action, Target: target, Status: OffboardPlanned}
+	if !o.opts.DryRun {
+		err := fn()
+		s.Status = OffboardDone
+		if err != nil {
+			s.Status, s.Error = OffboardFailed, err.Error()
+		}
+	}
+	if s.Error != "" {
+		o.log("%s %s : %s, %s", action, target, s.Status, s.Error)
+	} else {
+		o.log("%s %s : %s", action, target, s.Status)
+	}
+	o.report.Steps = append(o.report.Steps, s)
+	return s.Status != OffboardFailed
+}
+
+func (o *offboarding) skip(action, target, reason string) {
+	o.log("%s %s : skipped, %s", action, target, reason)
+	o.report.Steps = append(o.report.Steps, OffboardStep{Action: action, Target: target,
+		Status: OffboardSkipped, Error: reason})
+}
+
+// Offboard a departing user, using an admin token
+// The user's devices, shared folders and groups are listed first. Unless it is
+// a dry run, the root folder is then archived if asked to, MANAGE is
+// transferred to the successor on the shared folders only the user manages,
+// the user leaves every shared folder and group, their invitations are
+// dropped, their password and two-factor authentication disabled, and the
+// user deleted. The user is only deleted if every previous step succeeded.
+// An error is returned, along with the report so far, if the offboarding
+// cannot proceed safely
+func Offboard(c *api.Client, email string, opts OffboardOptions) (*OffboardReport, error) {
+	o := offboarding{c: c, email: email, opts: opts, report: &OffboardReport{
+		Email: email, Successor: opts.Successor, ApprovedBy: opts.ApprovedBy, DryRun: opts.DryRun,
+		Started: time.Now().UTC().Format(time.RFC3339), Devices: []Device{},
+		Shares: []OffboardShare{}, Groups: []string{}, Steps: []OffboardStep{}}}
+	defer func() {
+		o.report.Finished = time.Now().UTC().Format(time.RFC3339)
+	}()
+
+	err := o.inventory()
+	if err != nil {
+		return o.report, err
+	}
+	if opts.Archive != nil && !o.step(OffboardArchiveRoot, email, o.archive) {
+		return o.report, errors.New("Unable to archive the root folder, nothing was changed")
+	}
+
+	// Every shared folder is handed over before the user leaves any
+	for _, sf := range o.report.Shares {
+		if !sf.SoleManager {
+			continue
+		}
+		sid := sf.Sid
+		if !o.step(OffboardTransferManage, sf.Name, func() error { return o.transfer(sid, sf.Permissions) }) {
+			return o.report, errors.New("Unable to transfer MANAGE to the successor, the user keeps access")
+		}
+	}
+	for _, sf := range o.report.Shares {
+		sid := sf.Sid
+		o.step(OffboardLeaveShare, sf.Name, func() error {
+			_, _, err := c.RemoveSFMember(sid, email, nil)
+			return err
+		})
+	}
+	for _, g := range o.groups() {
+		gid := g.Id
+		o.step(OffboardLeaveGroup, g.Name, func() error {
+			return ignoreStatus(c.RemoveMember(gid, email), http.StatusNotFound)
+		})
+	}
+
+	invitations, err := ListInvitations(c, email)
+	if err != nil {
+		return o.report, fmt.Errorf("Unable to list invitations : %s", err)
+	}
+	for _, inv := range invitations {
+		sid := inv.Sid
+		o.step(OffboardIgnoreInvitation, inv.Name, func() error { return c.IgnoreSFInvitation(email, sid) })
+	}
+	o.step(OffboardDeleteInvitee, email, func() error {
+		return ignoreStatus(c.DeleteInvitee(email), http.StatusNotFound)
+	})
+	o.step(OffboardDisablePassword, email, func() error { return c.DisablePassword(email) })
+	o.step(OffboardDisableTwoFactor, email, func() error {
+		return ignoreStatus(c.DisableTwoFactorAuth(email), http.StatusNotFound)
+	})
+
+	if failed := len(o.report.Failed()); failed > 0 {
+		o.skip(OffboardDeleteUser, email, fmt.Sprintf("%d steps failed", failed))
+		return o.report, nil
+	}
+	o.step(OffboardDeleteUser, email, func() error { return c.DeleteUser(email) })
+	return o.report, nil
+}
+
+func ignoreStatus(err error, status int) error {
+	if api.IsStatus(err, status) {
+		return nil
+	}
+	return err
+}
+
+// List the devices and shared folders of the user, and check the shared
+// folders only the user manages can be handed over
+func (o *offboarding) inventory() error {
+	if _, err := GetUserClient(o.c, o.email); err != nil {
+		return fmt.Errorf("Unable to retrieve %s : %s", o.email, err)
+	}
+	if o.opts.Successor != "" {
+		if strings.EqualFold(o.opts.Successor, o.email) {
+			return errors.New("The successor cannot be the departing user")
+		}
+		if _, err := GetUserClient(o.c, o.opts.Successor); err != nil {
+			return fmt.Errorf("Unable to retrieve the successor %s : %s", o.opts.Successor, err)
+		}
+	}
+
+	devices, err := ListDevices(o.c, o.email)
+	if err != nil {
+		return fmt.Errorf("Unable to list devices : %s", err)
+	}
+	o.report.Devices = devices
+
+	shares, err := ListSharedFolders(o.c, o.email, nil)
+	if err != nil {
+		return fmt.Errorf("Unable to list shared folders : %s", err)
+	}
+	orphans := []string{}
+	for _, sf := range shares {
+		share, err := o.share(sf)
+		if err != nil {
+			return fmt.Errorf("%s : %s", sf.Name, err)
+		}
+		if share.SoleManager && o.opts.Successor == "" {
+			orphans = append(orphans, sf.Name)
+		}
+		o.report.Shares = append(o.report.Shares, *share)
+	}
+	if len(orphans) > 0 {
+		return fmt.Errorf("Only %s manages %s, a successor is required", o.email, strings.Join(orphans, ", "))
+	}
+	return nil
+}
+
+// Return the permissions of the user on a shared folder, and whether nobody
+// else manages it, directly or through a group
+func (o *offboarding) share(sf SharedFolder) (*OffboardShare, error) {
+	share := OffboardShare{Sid: sf.Id, Name: sf.Name, Permissions: api.PermissionSet{}}
+	members, err := ListSFMember(o.c, sf.Id, nil)
+	if err != nil {
+		return nil, err
+	}
+	others := false
+	for _, m := range members {
+		if strings.EqualFold(m.Email, o.email) {
+			share.Permissions = m.Permissions
+		} else if m.Permissions.Contains(api.PermissionManage) {
+			others = true
+		}
+	}
+	groups, err := ListSFGroupMembers(o.c, sf.Id)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		others = others || g.Permissions.Contains(api.PermissionManage)
+	}
+	share.SoleManager = share.Permissions.Contains(api.PermissionManage) && !others
+	return &share, nil
+}
+
+// Grant MANAGE to the successor, along with the permissions of the departing
+// user
+func (o *offboarding) transfer(sid string, permissions api.PermissionSet) error {
+	permissions = permissions.Union(api.NewPermissionSet(api.PermissionManage))
+	member, err := GetSFMemberClient(o.c, sid, o.opts.Successor, nil)
+	if api.IsStatus(err, http.StatusNotFound) {
+		_, err = CreateSFMemberClient(o.c, sid, o.opts.Successor, permissions)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	return member.UpdatePermissions(member.Desc.Permissions.Union(permissions))
+}
+
+// Return the groups of the user
+func (o *offboarding) groups() []Group {
+	groups := []Group{}
+	all, err := ListAllGroups(o.c, DEFAULT_PAGE_SIZE)
+	if err != nil {
+		o.report.Steps = append(o.report.Steps, OffboardStep{Action: OffboardLeaveGroup,
+			Status: OffboardFailed, Error: "Unable to list groups : " + err.Error()})
+		return groups
+	}
+	for _, g := range all {
+		members, err := ListGroupMembers(o.c, g.Id)
+		if err != nil {
+			o.report.Steps = append(o.report.Steps, OffboardStep{Action: OffboardLeaveGroup,
+				Target: g.Name, Status: OffboardFailed, Error: err.Error()})
+			continue
+		}
+		for _, m := range members {
+			if strings.EqualFold(m.Email, o.email) {
+				groups = append(groups, g)
+				o.report.Groups = append(o.report.Groups, g.Name)
+			}
+		}
+	}
+	return groups
+}
+
+func (o *offboarding) archive() error {
+	if o.opts.UserToken == "" {
+		return errors.New("Archiving a root folder requires a token of the user")
+	}
+	root := FolderClient{APIClient: o.c.WithToken(o.opts.UserToken), Desc: Folder{Id: "root"}}
+	return root.Archive(o.opts.Archive, o.opts.ArchiveFormat)
+}
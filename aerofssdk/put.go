@@ -0,0 +1,175 @@
+package aerofssdk
+
+import (
+	"bufio"
+	"errors"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// How PutFile treats an existing file with the same name
+type OverwritePolicy int
+
+const (
+	// Replace the existing file, guarded by the ETag it has when looked up
+	Overwrite OverwritePolicy = iota
+
+	// Fail with ErrFileExists
+	FailIfExists
+
+	// Replace the existing file only if its ETag is PutOptions.IfMatch
+	OverwriteIfMatch
+)
+
+// Returned by PutFile when a file exists and may not be overwritten
+var ErrFileExists = errors.New("A file with the given name already exists")
+
+// Options for PutFile
+type PutOptions struct {
+	Overwrite OverwritePolicy
+
+	// The ETag an existing file must have when using OverwriteIfMatch
+	IfMatch string
+
+	// The MIME type of the content. If empty, it is detected from the file
+	// extension or else the first bytes of the content
+	MimeType string
+
+	// Create missing folders when the parent is given as a path
+	CreateParents bool
+
+	// If set, the upload is verified and an ErrIntegrity returned on mismatch
+	Verify *VerifyOptions
+}
+
+// Upload content to a file in a single call
+// The parent is either a folder identifier or a path starting with "/"
+// relative to the user's root folder. The file is created if it does not
+// exist, otherwise it is overwritten according to the overwrite policy. The
+// returned client contains the metadata and ETag of the new content
+func PutFile(c *api.Client, parent, name string, content io.Reader, opts PutOptions) (*FileClient, error) {
+	folder, err := resolveParent(c, parent, opts.CreateParents)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := folder.childFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var f *FileClient
+	switch {
+	case existing == nil:
+		f, err = CreateFileClient(c, folder.Desc.Id, name)
+		if err != nil {
+			return nil, err
+		}
+	case opts.Overwrite == FailIfExists:
+		return nil, ErrFileExists
+	case opts.Overwrite == OverwriteIfMatch:
+		if opts.IfMatch == "" {
+			return nil, errors.New("An ETag is required to overwrite the file")
+		}
+		f = &FileClient{APIClient: c, Desc: *existing}
+		f.Desc.Etag = opts.IfMatch
+	default:
+		f = &FileClient{APIClient: c, Desc: *existing}
+	}
+	return f, f.putContent(name, content, opts)
+}
+
+// Replace the content of the file, guarded by the ETag in its metadata
+func (f *FileClient) putContent(name string, content io.Reader, opts PutOptions) error {
+	c := f.APIClient
+	if f.Desc.Etag == "" {
+		err := f.LoadMetadata()
+		if err != nil {
+			return err
+		}
+	}
+
+	var d *digester
+	if opts.Verify != nil {
+		d = newDigester(*opts.Verify)
+		content = io.TeeReader(content, d)
+	}
+
+	reader := bufio.NewReader(content)
+	mimeType := opts.MimeType
+	if mimeType == "" {
+		mimeType = detectMimeType(name, reader)
+	}
+
+	oldEtag := f.Desc.Etag
+	uploadId, err := c.GetFileUploadId(f.Desc.Id, []string{f.Desc.Etag})
+	if err != nil {
+		return err
+	}
+
+	err = c.UploadFileWithType(f.Desc.Id, uploadId, mimeType, reader,
+		[]string{f.Desc.Etag})
+	if err != nil {
+		return err
+	}
+
+	err = f.LoadMetadata()
+	if err != nil {
+		return err
+	}
+
+	if d != nil {
+		err = f.verifyUpload(oldEtag, d, *opts.Verify)
+	}
+	return err
+}
+
+// Return the MIME type of a file from its extension or else its content
+func detectMimeType(name string, content *bufio.Reader) string {
+	mimeType := mime.TypeByExtension(path.Ext(name))
+	if mimeType != "" {
+		return mimeType
+	}
+
+	// Peek returns the available bytes along with an error for short content
+	head, _ := content.Peek(512)
+	return http.DetectContentType(head)
+}
+
+// Return the folder a parent identifier or path refers to
+func resolveParent(c *api.Client, parent string, create bool) (*FolderClient, error) {
+	if !strings.HasPrefix(parent, "/") {
+		return &FolderClient{APIClient: c, Desc: Folder{Id: parent}}, nil
+	}
+
+	root := &FolderClient{APIClient: c, Desc: Folder{Id: "root"}}
+	if create {
+		return root.MkdirAll(parent)
+	}
+	return root.Subfolder(parent)
+}
+
+// Return the file with the given name in the folder, nil if none exists
+func (f *FolderClient) childFile(name string) (*File, error) {
+	err := f.LoadChildren()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sub := range f.Desc.ChildList.Folders {
+		if sub.Name == name {
+			return nil, errors.New("A folder exists with the file name " + name)
+		}
+	}
+	for _, file := range f.Desc.ChildList.Files {
+		if file.Name == name {
+			existing := File(file)
+			return &existing, nil
+		}
+	}
+	return nil, nil
+}
@@ -1,5 +1,12 @@
 package aerofssdk
 
+import (
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+)
+
+// The number of users or groups listed per request by default
+const DEFAULT_PAGE_SIZE = 100
+
 // A descriptor for a response from an AeroFS Appliance when an HTTP {4,5}XX
 // code is received
 type AeroError struct {
@@ -8,4 +15,12 @@ type AeroError struct {
 	HttpCode int
 }
 
-var SFPermissions []string = []string{"WRITE", "MANAGE"}
+// Every permission a shared folder member can hold
+var SFPermissions api.PermissionSet = api.NewPermissionSet(api.Permissions...)
+
+// An item which an operation over many items failed to process, reported
+// rather than stopping at the first failure
+type Failure struct {
+	Item  string `json:"item"`
+	Error string `json:"error"`
+}
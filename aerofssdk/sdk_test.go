@@ -1,9 +1,14 @@
 package aerofssdk
 
 import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
 	"fmt"
 	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
@@ -22,10 +27,13 @@ func TestMain(m *testing.M) {
 	AdminToken = os.Getenv("ADMINTOKEN")
 	AppHost = os.Getenv("APPHOST")
 
-	// Perform teardown
-	err := rmUsers()
-	if err != nil {
-		os.Exit(1)
+	// Perform teardown, unless no Appliance is configured so the tests using
+	// a fake server can run on their own
+	if AppHost != "" {
+		err := rmUsers()
+		if err != nil {
+			os.Exit(1)
+		}
 	}
 	os.Exit(m.Run())
 }
@@ -128,3 +136,381 @@ func TestGetFolder(t *testing.T) {
 	f.LoadMetadata()
 	t.Log(*f)
 }
+
+// Create a nested path, copy it and remove both trees
+func TestRecursiveFolderOperations(t *testing.T) {
+	c, _ := api.NewClient(UserToken, AppHost)
+	root, e := NewFolderClient(c, "root", []string{})
+	if e != nil {
+		t.Fatalf("Unable to retrieve the root folder : %s", e)
+	}
+
+	name := fmt.Sprintf("tree%d", rand.Intn(10000))
+	leaf, e := root.MkdirAll(name + "/a/b/c")
+	if e != nil {
+		t.Fatalf("Unable to create nested folders : %s", e)
+	}
+	t.Logf("Created %s/a/b/c with id %s", name, leaf.Desc.Id)
+
+	top, e := root.MkdirAll(name)
+	if e != nil {
+		t.Fatalf("Unable to retrieve existing folder : %s", e)
+	}
+	treeCopy, e := top.CopyTree("root", name+"_copy")
+	if e != nil {
+		t.Fatalf("Unable to copy folder tree : %s", e)
+	}
+
+	for _, f := range []*FolderClient{top, treeCopy} {
+		f.LoadMetadata()
+		entries, e := f.RemoveAll(true)
+		if e != nil || len(entries) != 4 {
+			t.Fatalf("Unexpected dry-run listing %v : %v", entries, e)
+		}
+		_, e = f.RemoveAll(false)
+		if e != nil {
+			t.Fatalf("Unable to remove folder tree : %s", e)
+		}
+	}
+}
+
+// Upload a new file by path, then overwrite it
+func TestPutFile(t *testing.T) {
+	c, _ := api.NewClient(UserToken, AppHost)
+	dir := fmt.Sprintf("/put%d/nested", rand.Intn(10000))
+	opts := PutOptions{CreateParents: true}
+
+	f, e := PutFile(c, dir, "hello.txt", strings.NewReader("Hello"), opts)
+	if e != nil {
+		t.Fatalf("Unable to upload a new file : %s", e)
+	}
+	if f.Desc.Size != 5 || f.Desc.Etag == "" {
+		t.Fatalf("Unexpected metadata for uploaded file %v", f.Desc)
+	}
+
+	opts.Overwrite = FailIfExists
+	_, e = PutFile(c, dir, "hello.txt", strings.NewReader("Bye"), opts)
+	if e != ErrFileExists {
+		t.Fatalf("Expected ErrFileExists, got %v", e)
+	}
+
+	opts.Overwrite = OverwriteIfMatch
+	opts.IfMatch = f.Desc.Etag
+	updated, e := PutFile(c, dir, "hello.txt", strings.NewReader("Goodbye"), opts)
+	if e != nil {
+		t.Fatalf("Unable to overwrite the file : %s", e)
+	}
+	if updated.Desc.Etag == f.Desc.Etag || updated.Desc.Size != 7 {
+		t.Fatalf("Overwritten file has unexpected metadata %v", updated.Desc)
+	}
+}
+
+// Upload and download a file with integrity verification
+func TestVerifiedTransfer(t *testing.T) {
+	c, _ := api.NewClient(UserToken, AppHost)
+	content := strings.Repeat("Speak, friend, and enter. ", 100000)
+	opts := VerifyOptions{Hashes: HashMD5 | HashCRC32C}
+
+	name := fmt.Sprintf("verified%d.txt", rand.Intn(10000))
+	f, e := PutFile(c, "root", name, strings.NewReader(content), PutOptions{Verify: &opts})
+	if e != nil {
+		t.Fatalf("Unable to upload verified file : %s", e)
+	}
+
+	buffer := new(bytes.Buffer)
+	digest, e := f.DownloadVerified(buffer, opts)
+	if e != nil {
+		t.Fatalf("Unable to download verified file : %s", e)
+	}
+	if buffer.String() != content || digest.Size != int64(len(content)) {
+		t.Fatalf("Downloaded content differs from the upload")
+	}
+
+	opts.Expected = &Digest{SHA256: digest.SHA256}
+	if _, e = f.DownloadVerified(new(bytes.Buffer), opts); e != nil {
+		t.Fatalf("Unable to download with an expected SHA-256 : %s", e)
+	}
+
+	opts.Expected = &Digest{SHA256: "0000"}
+	_, e = f.DownloadVerified(new(bytes.Buffer), opts)
+	if ie, ok := e.(*ErrIntegrity); !ok || ie.Property != "sha256" {
+		t.Fatalf("Expected an ErrIntegrity on sha256, got %v", e)
+	}
+	f.Delete()
+}
+
+// Archive a folder tree as zip, filtering by pattern
+func TestArchive(t *testing.T) {
+	c, _ := api.NewClient(UserToken, AppHost)
+	dir := fmt.Sprintf("/archive%d", rand.Intn(10000))
+	opts := PutOptions{CreateParents: true}
+	PutFile(c, dir, "a.txt", strings.NewReader("Alpha"), opts)
+	PutFile(c, dir+"/sub", "b.txt", strings.NewReader("Beta"), opts)
+	PutFile(c, dir+"/sub", "c.log", strings.NewReader("Gamma"), opts)
+
+	root := FolderClient{APIClient: c, Desc: Folder{Id: "root"}}
+	folder, e := root.Subfolder(dir)
+	if e != nil {
+		t.Fatalf("Unable to find archived folder : %s", e)
+	}
+
+	buffer := new(bytes.Buffer)
+	e = folder.ArchiveWithOptions(buffer, Zip, ArchiveOptions{Exclude: []string{"*.log"}})
+	if e != nil {
+		t.Fatalf("Unable to archive folder : %s", e)
+	}
+
+	reader, e := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if e != nil {
+		t.Fatalf("Unable to read archive : %s", e)
+	}
+	names := []string{}
+	for _, f := range reader.File {
+		names = append(names, f.Name)
+	}
+	expected := "a.txt sub/ sub/b.txt " + ARCHIVE_MANIFEST_NAME
+	if strings.Join(names, " ") != expected {
+		t.Fatalf("Unexpected archive entries %v", names)
+	}
+	folder.RemoveAll(false)
+}
+
+// Import a zip archive, then import it again under each conflict policy
+func TestImport(t *testing.T) {
+	c, _ := api.NewClient(UserToken, AppHost)
+	buffer := new(bytes.Buffer)
+	archive := zip.NewWriter(buffer)
+	for name, content := range map[string]string{"a.txt": "Alpha", "sub/b.txt": "Beta"} {
+		w, _ := archive.Create(name)
+		w.Write([]byte(content))
+	}
+	archive.Close()
+
+	folder, e := CreateFolderClient(c, "root", fmt.Sprintf("import%d", rand.Intn(10000)))
+	if e != nil {
+		t.Fatalf("Unable to create destination folder : %s", e)
+	}
+	defer folder.RemoveAll(false)
+
+	policies := []ImportConflictPolicy{ImportSkip, ImportSkip, ImportRename, ImportOverwrite}
+	expected := []ImportStatus{ImportCreated, ImportSkipped, ImportRenamed, ImportOverwritten}
+	for i, policy := range policies {
+		report, e := folder.Import(bytes.NewReader(buffer.Bytes()), Zip,
+			ImportOptions{Conflict: policy})
+		if e != nil {
+			t.Fatalf("Unable to import archive : %s", e)
+		}
+		if report.Count(expected[i]) != 2 || len(report.Failed()) != 0 {
+			t.Fatalf("Import %d : unexpected report %v", i, report.Files)
+		}
+	}
+}
+
+// Share a folder with a group and invite a user, then change and revoke both
+func TestSharedFolderGroupsAndInvitations(t *testing.T) {
+	c, _ := api.NewClient(AdminToken, AppHost)
+	suffix := rand.Intn(10000)
+	sf, e := CreateSharedFolderClient(c, fmt.Sprintf("groupshare%d", suffix))
+	if e != nil {
+		t.Fatalf("Unable to create shared folder : %s", e)
+	}
+	group, e := CreateGroupClient(c, fmt.Sprintf("group%d", suffix))
+	if e != nil {
+		t.Fatalf("Unable to create group : %s", e)
+	}
+	defer group.Delete()
+
+	editor, _ := api.RoleEditor.Permissions()
+	sfg, e := sf.AddGroup(group.Desc.Id, editor)
+	if e != nil {
+		t.Fatalf("Unable to share with group : %s", e)
+	}
+	e = sfg.UpdatePermissions(SFPermissions)
+	if e != nil {
+		t.Fatalf("Unable to update group permissions : %s", e)
+	}
+	e = sfg.Load()
+	if e != nil || !sfg.Desc.Permissions.Equal(SFPermissions) {
+		t.Fatalf("Unexpected group member %v : %v", sfg.Desc, e)
+	}
+
+	email := fmt.Sprintf("invitee%d@example.com", suffix)
+	pending, e := sf.Invite(email, editor, "Welcome")
+	if e != nil {
+		t.Fatalf("Unable to invite user : %s", e)
+	}
+	e = pending.UpdatePermissions(SFPermissions)
+	if e != nil || pending.Desc.Note != "Welcome" {
+		t.Fatalf("Unable to update invitation permissions : %v", e)
+	}
+	list, e := sf.ListPending()
+	if e != nil || len(list) != 1 || !list[0].Permissions.Equal(SFPermissions) {
+		t.Fatalf("Unexpected pending members %v : %v", list, e)
+	}
+
+	if e = pending.Remove(); e != nil {
+		t.Fatalf("Unable to revoke invitation : %s", e)
+	}
+	if e = sfg.Remove(); e != nil {
+		t.Fatalf("Unable to remove group : %s", e)
+	}
+	groups, e := sf.ListGroups()
+	if e != nil || len(groups) != 0 {
+		t.Fatalf("Unexpected groups %v : %v", groups, e)
+	}
+}
+
+func TestOffboard(t *testing.T) {
+	c, _ := api.NewClient(AdminToken, AppHost)
+	suffix := rand.Intn(10000)
+	leaver, e := CreateUserClient(c, fmt.Sprintf("leaver%d@example.com", suffix), "Bilbo", "Baggins")
+	if e != nil {
+		t.Fatalf("Unable to create user : %s", e)
+	}
+	successor, e := CreateUserClient(c, fmt.Sprintf("successor%d@example.com", suffix), "Frodo", "Baggins")
+	if e != nil {
+		t.Fatalf("Unable to create user : %s", e)
+	}
+	defer successor.Delete()
+
+	sf, e := CreateSharedFolderClient(c, fmt.Sprintf("offboard%d", suffix))
+	if e != nil {
+		t.Fatalf("Unable to create shared folder : %s", e)
+	}
+	owner, _ := api.RoleOwner.Permissions()
+	if _, e = sf.AddMember(leaver.Desc.Email, owner); e != nil {
+		t.Fatalf("Unable to add member : %s", e)
+	}
+	group, e := CreateGroupClient(c, fmt.Sprintf("offboard%d", suffix))
+	if e != nil {
+		t.Fatalf("Unable to create group : %s", e)
+	}
+	defer group.Delete()
+	if _, _, e = c.AddGroupMember(group.Desc.Id, leaver.Desc.Email); e != nil {
+		t.Fatalf("Unable to add group member : %s", e)
+	}
+
+	// A dry run changes nothing
+	report, e := Offboard(c, leaver.Desc.Email, OffboardOptions{Successor: successor.Desc.Email, DryRun: true})
+	if e != nil {
+		t.Fatalf("Unable to plan offboarding : %s", e)
+	}
+	if len(report.Shares) != 1 || len(report.Groups) != 1 || len(report.Failed()) != 0 {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	for _, s := range report.Steps {
+		if s.Status != OffboardPlanned {
+			t.Errorf("Unexpected step in a dry run %+v", s)
+		}
+	}
+	if _, e = GetUserClient(c, leaver.Desc.Email); e != nil {
+		t.Fatalf("The user was deleted by a dry run")
+	}
+
+	report, e = Offboard(c, leaver.Desc.Email, OffboardOptions{Successor: successor.Desc.Email,
+		ApprovedBy: "admin@example.com"})
+	if e != nil || len(report.Failed()) != 0 {
+		t.Fatalf("Unable to offboard : %v %+v", e, report.Failed())
+	}
+	if _, e = GetUserClient(c, leaver.Desc.Email); e == nil {
+		t.Errorf("The user was not deleted")
+	}
+	members, e := ListGroupMembers(c, group.Desc.Id)
+	if e != nil || len(members) != 0 {
+		t.Errorf("Unexpected group members %v : %v", members, e)
+	}
+	key := []byte("offboarding key")
+	if e = report.Sign(key); e != nil {
+		t.Fatal(e)
+	}
+	if !report.Verify(key) {
+		t.Errorf("Unable to verify a signed report")
+	}
+	if report.Verify([]byte("another key")) {
+		t.Errorf("Expected a report to fail verification with another key")
+	}
+	report.ApprovedBy = "someone else"
+	if report.Verify(key) {
+		t.Errorf("Expected a modified report to fail verification")
+	}
+}
+
+// An Appliance serving a folder tree, recording the deletions
+type fakeTree struct {
+	children map[string]api.Children
+	deleted  []string
+	locked   map[string]bool
+
+	// Whether a folder was loaded after the first deletion
+	lateLoad bool
+}
+
+func (f *fakeTree) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1.3/"), "/")
+	switch {
+	case r.Method == "DELETE" && f.locked[parts[1]]:
+		w.WriteHeader(http.StatusPreconditionFailed)
+	case r.Method == "DELETE" && r.Header.Get("If-Match") == "":
+		w.WriteHeader(http.StatusBadRequest)
+	case r.Method == "DELETE":
+		f.deleted = append(f.deleted, parts[1])
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) == 3 && parts[2] == "children":
+		json.NewEncoder(w).Encode(f.children[parts[1]])
+	default:
+		f.lateLoad = f.lateLoad || len(f.deleted) > 0
+		w.Header().Set("ETag", `"`+parts[1]+`"`)
+		json.NewEncoder(w).Encode(api.Folder{Id: parts[1]})
+	}
+}
+
+// Delete a tree, contents first and the folder last
+func TestRemoveAllOrder(t *testing.T) {
+	fake := &fakeTree{locked: map[string]bool{}, children: map[string]api.Children{
+		"root": {Files: []api.File{{Id: "a", Name: "a", Etag: "ea"}}, Folders: []api.Folder{{Id: "b", Name: "b"}}},
+		"b":    {Files: []api.File{{Id: "c", Name: "c", Etag: "ec"}}},
+	}}
+	ts := httptest.NewTLSServer(fake)
+	defer ts.Close()
+	c, _ := api.NewClient("token", strings.TrimPrefix(ts.URL, "https://"))
+	c.SetHTTPClient(ts.Client())
+	root := FolderClient{APIClient: c, Desc: Folder{Id: "root"}}
+
+	if _, e := root.RemoveAll(false); e != nil {
+		t.Fatalf("Unable to remove the tree : %s", e)
+	}
+	if strings.Join(fake.deleted, " ") != "c b a root" {
+		t.Errorf("Unexpected order of deletions %v", fake.deleted)
+	}
+	if fake.lateLoad {
+		t.Errorf("Folder ETags were loaded after the walk")
+	}
+
+	// A file which fails to delete keeps the folder
+	fake.deleted, fake.locked["a"] = nil, true
+	_, e := root.RemoveAll(false)
+	treeErr, ok := e.(*TreeError)
+	if !ok || len(treeErr.Failures) != 2 || treeErr.Failures[1].Path != "" {
+		t.Fatalf("Unexpected error %v", e)
+	}
+	if strings.Join(fake.deleted, " ") != "c b" {
+		t.Errorf("Unexpected deletions %v", fake.deleted)
+	}
+}
+
+// Compare digests, ignoring what is not expected
+func TestDigestCompare(t *testing.T) {
+	actual := &Digest{Size: 3, SHA256: "abc", MD5: "def"}
+	for _, expected := range []*Digest{nil, {}, {SHA256: "abc"}, {Size: 3, MD5: "def"}} {
+		if e := actual.compare("file", expected); e != nil {
+			t.Errorf("Unexpected error for %+v : %s", expected, e)
+		}
+	}
+	for property, expected := range map[string]*Digest{"size": {Size: 4, SHA256: "abc"},
+		"sha256": {SHA256: "abd"}, "md5": {MD5: "deg"}} {
+		e, ok := actual.compare("file", expected).(*ErrIntegrity)
+		if !ok || e.Property != property {
+			t.Errorf("Expected a %s mismatch for %+v, got %v", property, expected, e)
+		}
+	}
+}
@@ -3,7 +3,11 @@ package aerofssdk
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	"net/http"
+	"sort"
+	"strings"
 )
 
 // SharedFolder, client wrapper
@@ -31,6 +35,48 @@ func ListSharedFolders(c *api.Client, sid string, etags []string) ([]SharedFolde
 	return sfs, nil
 }
 
+// Return the identifier of the root folder of a shared folder, the share
+// identifier followed by the identifier of the root object
+func ShareRootFolderId(sid string) string {
+	return sid + strings.Repeat("0", 32)
+}
+
+// Return the SIDs of the shared folders with the given names, looking them up
+// among the shared folders of every user
+// A name may match no shared folder, or several
+func FindSharedFolders(c *api.Client, names []string) (map[string][]string, error) {
+	byName := map[string]map[string]bool{}
+	for _, name := range names {
+		byName[name] = map[string]bool{}
+	}
+
+	users, err := ListAllUsers(c, DEFAULT_PAGE_SIZE)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		shares, err := ListSharedFolders(c, u.Email, nil)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to list the shared folders of %s : %s", u.Email, err)
+		}
+		for _, sf := range shares {
+			if found, ok := byName[sf.Name]; ok {
+				found[sf.Id] = true
+			}
+		}
+	}
+
+	sids := map[string][]string{}
+	for name, found := range byName {
+		sids[name] = []string{}
+		for sid := range found {
+			sids[name] = append(sids[name], sid)
+		}
+		sort.Strings(sids[name])
+	}
+	return sids, nil
+}
+
 // Retrieve an existing shared folder
 func GetSharedFolderClient(c *api.Client, sid string, etags []string) (*SharedFolderClient, error) {
 	body, header, err := c.ListSharedFolderMetadata(sid, etags)
@@ -62,9 +108,13 @@ func CreateSharedFolderClient(c *api.Client, name string) (*SharedFolderClient,
 	return &sfClient, nil
 }
 
-// Synchronize the shared folder fields with the backend
-func (sfClient *SharedFolderClient) load() error {
+// Synchronize the shared folder fields with the backend, nothing is retrieved
+// if the shared folder is unchanged
+func (sfClient *SharedFolderClient) Load() error {
 	body, header, err := sfClient.APIClient.ListSharedFolderMetadata(sfClient.Desc.Id, []string{sfClient.Etag})
+	if api.IsStatus(err, http.StatusNotModified) {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
@@ -76,3 +126,34 @@ func (sfClient *SharedFolderClient) load() error {
 	sfClient.Etag = header.Get("ETag")
 	return nil
 }
+
+// List the members of the shared folder
+func (sfClient *SharedFolderClient) ListMembers() ([]SFMember, error) {
+	return ListSFMember(sfClient.APIClient, sfClient.Desc.Id, nil)
+}
+
+// List the groups the shared folder is shared with
+func (sfClient *SharedFolderClient) ListGroups() ([]SFGroupMember, error) {
+	return ListSFGroupMembers(sfClient.APIClient, sfClient.Desc.Id)
+}
+
+// List the pending invitations to the shared folder
+func (sfClient *SharedFolderClient) ListPending() ([]SFPendingMember, error) {
+	return ListSFPendingMembers(sfClient.APIClient, sfClient.Desc.Id)
+}
+
+// Add a user to the shared folder
+func (sfClient *SharedFolderClient) AddMember(email string, permissions api.PermissionSet) (*SFMemberClient, error) {
+	return CreateSFMemberClient(sfClient.APIClient, sfClient.Desc.Id, email, permissions)
+}
+
+// Share the shared folder with every member of a group
+func (sfClient *SharedFolderClient) AddGroup(gid string, permissions api.PermissionSet) (*SFGroupMemberClient, error) {
+	return CreateSFGroupMemberClient(sfClient.APIClient, sfClient.Desc.Id, gid, permissions)
+}
+
+// Invite a user to the shared folder
+func (sfClient *SharedFolderClient) Invite(email string, permissions api.PermissionSet,
+	note string) (*SFPendingMemberClient, error) {
+	return CreateSFPendingMemberClient(sfClient.APIClient, sfClient.Desc.Id, email, permissions, note)
+}
@@ -0,0 +1,115 @@
+package aerofssdk
+
+import (
+	"encoding/json"
+	"errors"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	"net/http"
+)
+
+// An SFGroupMember object represents a group a shared folder is shared with
+// Every member of the group holds the permissions of the group on the shared
+// folder
+
+// SFGroupMember, Client wrapper
+type SFGroupMemberClient struct {
+	APIClient *api.Client
+	Desc      SFGroupMember
+	Etag      string
+}
+
+// SharedFolderGroupMember descriptor
+type SFGroupMember api.SFGroupMember
+
+// Retrieve the groups a shared folder is shared with
+func ListSFGroupMembers(c *api.Client, sid string) ([]SFGroupMember, error) {
+	body, _, err := c.ListSFGroups(sid)
+	if err != nil {
+		return nil, err
+	}
+	groups := []SFGroupMember{}
+	err = json.Unmarshal(body, &groups)
+	if err != nil {
+		return nil, errors.New("Unable to unmarshal the list of retrieved SharedFolder groups")
+	}
+	for i := range groups {
+		groups[i].Sid = sid
+	}
+	return groups, nil
+}
+
+// Return an existing SFGroupMemberClient given its shared folder and group
+func GetSFGroupMemberClient(c *api.Client, sid, gid string, etags []string) (*SFGroupMemberClient, error) {
+	body, header, err := c.GetSFGroups(sid, gid, etags)
+	if err != nil {
+		return nil, err
+	}
+	client := SFGroupMemberClient{APIClient: c, Desc: SFGroupMember{Sid: sid, Id: gid}}
+	err = client.reserialize(body, header)
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// Share a shared folder with a group and return a client for the new group
+// member
+func CreateSFGroupMemberClient(c *api.Client, sid, gid string, permissions api.PermissionSet) (*SFGroupMemberClient, error) {
+	body, header, err := c.AddGroupToSharedFolder(sid, gid, permissions)
+	if err != nil {
+		return nil, err
+	}
+	client := SFGroupMemberClient{APIClient: c, Desc: SFGroupMember{Sid: sid, Id: gid}}
+	err = client.reserialize(body, header)
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+func (sfg *SFGroupMemberClient) reserialize(buffer []byte, header *http.Header) error {
+	err := json.Unmarshal(buffer, &sfg.Desc)
+	if err != nil {
+		return errors.New("Unable to unmarshal retrieved SFGroupMember")
+	}
+	sfg.Etag = header.Get("ETag")
+	return nil
+}
+
+// Retrieve up to date fields for the SFGroupMember, nothing is retrieved if
+// the group member is unchanged
+func (sfg *SFGroupMemberClient) Load() error {
+	body, header, err := sfg.APIClient.GetSFGroups(sfg.Desc.Sid, sfg.Desc.Id, etagList(sfg.Etag))
+	if api.IsStatus(err, http.StatusNotModified) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return sfg.reserialize(body, header)
+}
+
+// Update the permissions of the group, fails if the group member changed since
+// it was last retrieved
+func (sfg *SFGroupMemberClient) UpdatePermissions(newPermissions api.PermissionSet) error {
+	body, header, err := sfg.APIClient.SetSFGroupPermissions(sfg.Desc.Sid, sfg.Desc.Id,
+		newPermissions, etagList(sfg.Etag))
+	if err != nil {
+		return err
+	}
+	return sfg.reserialize(body, header)
+}
+
+// Remove the group from the shared folder, fails if the group member changed
+// since it was last retrieved
+func (sfg *SFGroupMemberClient) Remove() error {
+	return sfg.APIClient.RemoveSFGroup(sfg.Desc.Sid, sfg.Desc.Id, etagList(sfg.Etag))
+}
+
+// Return a list of the ETag, empty if there is none
+func etagList(etag string) []string {
+	if etag == "" {
+		return []string{}
+	}
+	return []string{etag}
+}
@@ -33,8 +33,8 @@ func ListSFMember(c *api.Client, sid string, etags []string) ([]SFMember, error)
 	if err != nil {
 		return nil, errors.New("Unable to demarshal the list of retrieved SharedFolder members")
 	}
-	for _, v := range sfmembers {
-		v.Sid = sid
+	for i := range sfmembers {
+		sfmembers[i].Sid = sid
 	}
 	return sfmembers, nil
 }
@@ -54,6 +54,21 @@ func GetSFMemberClient(c *api.Client, sid, email string, etags []string) (*SFMem
 	return &sfmClient, nil
 }
 
+// Add a user to a shared folder with the given permissions and return a client
+// for the new member
+func CreateSFMemberClient(c *api.Client, sid, email string, permissions api.PermissionSet) (*SFMemberClient, error) {
+	body, header, err := c.AddSFMember(sid, email, permissions)
+	if err != nil {
+		return nil, err
+	}
+	sfmClient := SFMemberClient{APIClient: c, Desc: SFMember{Sid: sid, Email: email}}
+	err = sfmClient.reserialize(body, header)
+	if err != nil {
+		return nil, err
+	}
+	return &sfmClient, nil
+}
+
 // Given a buffer of bytes representing an SFMember Descriptor, load the data
 // into the client
 func (sfm *SFMemberClient) reserialize(buffer []byte, header *http.Header) error {
@@ -67,7 +82,7 @@ func (sfm *SFMemberClient) reserialize(buffer []byte, header *http.Header) error
 
 // Update a SFMember's permissions
 // TODO : Does it make sense for a user to modify their own?
-func (sfm *SFMemberClient) UpdatePermissions(newPermissions []string) error {
+func (sfm *SFMemberClient) UpdatePermissions(newPermissions api.PermissionSet) error {
 	body, header, err := sfm.APIClient.SetSFMemberPermissions(sfm.Desc.Sid, sfm.Desc.Email,
 		newPermissions, []string{sfm.Etag})
 	if err != nil {
@@ -0,0 +1,114 @@
+package aerofssdk
+
+import (
+	"encoding/json"
+	"errors"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	"net/http"
+)
+
+// An SFPendingMember object represents a user invited to a shared folder who
+// has not accepted the invitation yet
+
+// SFPendingMember, Client wrapper
+type SFPendingMemberClient struct {
+	APIClient *api.Client
+	Desc      SFPendingMember
+	Etag      string
+}
+
+// SharedFolderPendingMember descriptor
+type SFPendingMember api.SFPendingMember
+
+// Retrieve the pending invitations to a shared folder
+func ListSFPendingMembers(c *api.Client, sid string) ([]SFPendingMember, error) {
+	body, _, err := c.ListSFPendingMembers(sid, nil)
+	if err != nil {
+		return nil, err
+	}
+	pending := []SFPendingMember{}
+	err = json.Unmarshal(body, &pending)
+	if err != nil {
+		return nil, errors.New("Unable to unmarshal the list of retrieved SharedFolder pending members")
+	}
+	for i := range pending {
+		pending[i].Sid = sid
+	}
+	return pending, nil
+}
+
+// Return an existing SFPendingMemberClient given its shared folder and email
+func GetSFPendingMemberClient(c *api.Client, sid, email string, etags []string) (*SFPendingMemberClient, error) {
+	body, header, err := c.GetSFPendingMember(sid, email, etags)
+	if err != nil {
+		return nil, err
+	}
+	client := SFPendingMemberClient{APIClient: c, Desc: SFPendingMember{Sid: sid, Email: email}}
+	err = client.reserialize(body, header)
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// Invite a user to a shared folder and return a client for the invitation
+func CreateSFPendingMemberClient(c *api.Client, sid, email string, permissions api.PermissionSet,
+	note string) (*SFPendingMemberClient, error) {
+	body, header, err := c.InviteSFMember(sid, email, permissions, note)
+	if err != nil {
+		return nil, err
+	}
+	client := SFPendingMemberClient{APIClient: c, Desc: SFPendingMember{Sid: sid, Email: email}}
+	err = client.reserialize(body, header)
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+func (sfp *SFPendingMemberClient) reserialize(buffer []byte, header *http.Header) error {
+	err := json.Unmarshal(buffer, &sfp.Desc)
+	if err != nil {
+		return errors.New("Unable to unmarshal retrieved SFPendingMember")
+	}
+	sfp.Etag = header.Get("ETag")
+	return nil
+}
+
+// Retrieve up to date fields for the SFPendingMember, nothing is retrieved if
+// the invitation is unchanged
+func (sfp *SFPendingMemberClient) Load() error {
+	body, header, err := sfp.APIClient.GetSFPendingMember(sfp.Desc.Sid, sfp.Desc.Email, etagList(sfp.Etag))
+	if api.IsStatus(err, http.StatusNotModified) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return sfp.reserialize(body, header)
+}
+
+// Change the permissions the invitee will hold once they accept
+// Invitations cannot be modified, the invitation is revoked, unless it changed
+// since it was last retrieved, and sent again with the same note
+func (sfp *SFPendingMemberClient) UpdatePermissions(newPermissions api.PermissionSet) error {
+	err := newPermissions.Validate()
+	if err != nil {
+		return err
+	}
+	err = sfp.Remove()
+	if err != nil {
+		return err
+	}
+	body, header, err := sfp.APIClient.InviteSFMember(sfp.Desc.Sid, sfp.Desc.Email, newPermissions,
+		sfp.Desc.Note)
+	if err != nil {
+		return err
+	}
+	return sfp.reserialize(body, header)
+}
+
+// Revoke the invitation, fails if it changed since it was last retrieved
+func (sfp *SFPendingMemberClient) Remove() error {
+	return sfp.APIClient.RemoveSFPendingMember(sfp.Desc.Sid, sfp.Desc.Email, etagList(sfp.Etag))
+}
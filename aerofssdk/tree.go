@@ -0,0 +1,337 @@
+package aerofssdk
+
+// Recursive operations on folder trees
+// The API has no recursive or copy routes, these are composed of individual
+// requests and report the items which failed rather than stopping at the
+// first failure
+
+import (
+	"errors"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	"io"
+	"path"
+	"strings"
+)
+
+// Returned by a WalkFunc to skip the contents of the visited folder
+var SkipFolder = errors.New("Skip this folder")
+
+// A file or folder visited while walking a tree
+type TreeEntry struct {
+	// Slash-separated path relative to the walked folder
+	Path   string
+	IsDir  bool
+	Folder Folder
+	File   File
+}
+
+// Called for every entry of a tree. If a folder cannot be listed, the function
+// is called with the folder and the error, returning nil continues the walk
+type WalkFunc func(entry TreeEntry, err error) error
+
+// A failure of a single item of a recursive operation
+type PathError struct {
+	Path string
+	Err  error
+}
+
+// The error returned when some items of a recursive operation failed
+type TreeError struct {
+	Failures []PathError
+}
+
+func (e *TreeError) Error() string {
+	msgs := []string{}
+	for _, f := range e.Failures {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", f.Path, f.Err))
+	}
+	return fmt.Sprintf("%d items failed: %s", len(e.Failures), strings.Join(msgs, "; "))
+}
+
+func (e *TreeError) add(p string, err error) {
+	e.Failures = append(e.Failures, PathError{p, err})
+}
+
+// Return the TreeError if any failures were recorded
+func (e *TreeError) errOrNil() error {
+	if len(e.Failures) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Visit every file and folder below the folder, files of a folder are visited
+// before its subfolders
+func (f *FolderClient) Walk(fn WalkFunc) error {
+	err := walkFolder(f.APIClient, f.Desc, "", fn)
+	if err == SkipFolder {
+		return nil
+	}
+	return err
+}
+
+func walkFolder(c *api.Client, folder Folder, prefix string, fn WalkFunc) error {
+	fc := FolderClient{APIClient: c, Desc: Folder{Id: folder.Id}}
+	err := fc.LoadChildren()
+	if err != nil {
+		return fn(TreeEntry{Path: prefix, IsDir: true, Folder: folder}, err)
+	}
+
+	for _, file := range fc.Desc.ChildList.Files {
+		err = fn(TreeEntry{Path: path.Join(prefix, file.Name), File: File(file)}, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, sub := range fc.Desc.ChildList.Folders {
+		subPath := path.Join(prefix, sub.Name)
+		err = fn(TreeEntry{Path: subPath, IsDir: true, Folder: Folder(sub)}, nil)
+		if err == SkipFolder {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		err = walkFolder(c, Folder(sub), subPath, fn)
+		if err != nil && err != SkipFolder {
+			return err
+		}
+	}
+	return nil
+}
+
+// Return the subfolder with the given name, nil if none exists
+func (f *FolderClient) childFolder(name string) (*FolderClient, error) {
+	err := f.LoadChildren()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range f.Desc.ChildList.Files {
+		if file.Name == name {
+			return nil, errors.New("A file exists with the folder name " + name)
+		}
+	}
+	for _, sub := range f.Desc.ChildList.Folders {
+		if sub.Name == name {
+			return &FolderClient{APIClient: f.APIClient, Desc: Folder(sub)}, nil
+		}
+	}
+	return nil, nil
+}
+
+// Return the folder at a slash-separated path relative to this folder,
+// creating any missing folders along the way
+func (f *FolderClient) MkdirAll(relPath string) (*FolderClient, error) {
+	current := f
+	for _, name := range strings.Split(relPath, "/") {
+		if name == "" || name == "." {
+			continue
+		}
+
+		next, err := current.childFolder(name)
+		if err != nil {
+			return nil, err
+		}
+		if next == nil {
+			next, err = CreateFolderClient(f.APIClient, current.Desc.Id, name)
+			if err != nil {
+				return nil, err
+			}
+		}
+		current = next
+	}
+	return current, nil
+}
+
+// Return the existing folder at a slash-separated path relative to this folder
+func (f *FolderClient) Subfolder(relPath string) (*FolderClient, error) {
+	current := f
+	for _, name := range strings.Split(relPath, "/") {
+		if name == "" || name == "." {
+			continue
+		}
+
+		next, err := current.childFolder(name)
+		if err != nil {
+			return nil, err
+		}
+		if next == nil {
+			return nil, errors.New("The folder " + relPath + " does not exist")
+		}
+		current = next
+	}
+	return current, nil
+}
+
+// Delete the folder and its contents
+// Every file is deleted individually, guarded by the ETag it was listed with,
+// before the folders containing it. A folder is guarded by the ETag it had
+// before its contents were listed, and only deleted once all of its contents
+// were, so a file modified concurrently is never removed. If dryRun is set,
+// the entries which would be deleted are returned without deleting anything.
+// The folder itself is the last entry, with the empty path
+func (f *FolderClient) RemoveAll(dryRun bool) ([]TreeEntry, error) {
+	// Folder ETags are not part of the list of children, they are loaded as
+	// the folders are visited, before their contents are listed
+	root := TreeEntry{IsDir: true, Folder: f.Desc}
+	etag := func(folder *Folder) error {
+		fc := FolderClient{APIClient: f.APIClient, Desc: Folder{Id: folder.Id}}
+		err := fc.LoadMetadata()
+		folder.Etag = fc.Desc.Etag
+		return err
+	}
+	if !dryRun {
+		if err := etag(&root.Folder); err != nil {
+			return nil, err
+		}
+	}
+
+	entries := []TreeEntry{}
+	err := f.Walk(func(entry TreeEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch {
+		case dryRun:
+		case entry.IsDir:
+			err = etag(&entry.Folder)
+		case entry.File.Etag == "":
+			// Older appliances omit the ETag from the list of children
+			fc := FileClient{APIClient: f.APIClient, Desc: entry.File}
+			err = fc.LoadMetadata()
+			entry.File = fc.Desc
+		}
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	entries = append(entries, root)
+
+	if dryRun {
+		return entries, nil
+	}
+
+	// Entries are visited parents first, delete them in reverse, then the folder
+	// itself unless some of its contents failed to delete
+	treeErr := TreeError{}
+	failed := map[string]bool{}
+	for i := len(entries) - 2; i >= 0; i-- {
+		entry := entries[i]
+		if failed[entry.Path] {
+			treeErr.add(entry.Path, errors.New("Not deleted as its contents failed to delete"))
+		} else if err := removeEntry(f.APIClient, entry); err != nil {
+			treeErr.add(entry.Path, err)
+		} else {
+			continue
+		}
+
+		// Keep every folder containing the failed entry
+		for p := entry.Path; p != ""; {
+			p = parentPath(p)
+			failed[p] = true
+		}
+	}
+	if failed[""] {
+		treeErr.add(root.Path, errors.New("Not deleted as its contents failed to delete"))
+	} else if err := removeEntry(f.APIClient, root); err != nil {
+		treeErr.add(root.Path, err)
+	}
+	return entries, treeErr.errOrNil()
+}
+
+func removeEntry(c *api.Client, entry TreeEntry) error {
+	if entry.IsDir {
+		fc := FolderClient{APIClient: c, Desc: entry.Folder}
+		return fc.Delete()
+	}
+	fc := FileClient{APIClient: c, Desc: entry.File}
+	return fc.Delete()
+}
+
+// Copy the file into a folder under a new name
+// The API has no copy route, the content is streamed from a download into an
+// upload without being staged
+func (f *FileClient) Copy(parentId, name string) (*FileClient, error) {
+	dest, err := CreateFileClient(f.APIClient, parentId, name)
+	if err != nil {
+		return nil, err
+	}
+	if dest.Desc.Etag == "" {
+		if err = dest.LoadMetadata(); err != nil {
+			return nil, err
+		}
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(f.Download(writer))
+	}()
+
+	err = dest.UploadFile(reader)
+	reader.Close()
+	if err != nil {
+		return nil, err
+	}
+	return dest, nil
+}
+
+// Copy the folder and its contents into a folder under a new name
+// The returned client refers to the new folder. Files which fail to copy are
+// reported in a TreeError and do not stop the rest of the copy
+func (f *FolderClient) CopyTree(parentId, name string) (*FolderClient, error) {
+	dest, err := CreateFolderClient(f.APIClient, parentId, name)
+	if err != nil {
+		return nil, err
+	}
+
+	treeErr := TreeError{}
+	folders := map[string]string{"": dest.Desc.Id}
+	err = f.Walk(func(entry TreeEntry, err error) error {
+		if err != nil {
+			treeErr.add(entry.Path, err)
+			return nil
+		}
+
+		parentId, ok := folders[parentPath(entry.Path)]
+		if !ok {
+			return nil
+		}
+		if entry.IsDir {
+			sub, err := CreateFolderClient(f.APIClient, parentId, entry.Folder.Name)
+			if err != nil {
+				treeErr.add(entry.Path, err)
+				return SkipFolder
+			}
+			folders[entry.Path] = sub.Desc.Id
+			return nil
+		}
+
+		src := FileClient{APIClient: f.APIClient, Desc: entry.File}
+		_, err = src.Copy(parentId, entry.File.Name)
+		if err != nil {
+			treeErr.add(entry.Path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return dest, err
+	}
+	return dest, treeErr.errOrNil()
+}
+
+// Return the parent of a slash-separated relative path, "" for the top level
+func parentPath(p string) string {
+	parent := path.Dir(p)
+	if parent == "." {
+		return ""
+	}
+	return parent
+}
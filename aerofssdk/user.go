@@ -64,6 +64,32 @@ func ListUsers(client *api.Client, limit int) (*[]User, error) {
 	return &userResp.Users, nil
 }
 
+// Get every existing user descriptor, following the pagination of the user
+// list with pages of the given size
+func ListAllUsers(client *api.Client, pageSize int) ([]User, error) {
+	users := []User{}
+	var after *string
+	for {
+		body, _, err := client.ListUsers(pageSize, after, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		userResp := userListResponse{}
+		err = json.Unmarshal(body, &userResp)
+		if err != nil {
+			return nil, errors.New("Unable to unmarshal a retrieved list of users")
+		}
+		users = append(users, userResp.Users...)
+
+		if !userResp.HasMore || len(userResp.Users) == 0 {
+			return users, nil
+		}
+		last := userResp.Users[len(userResp.Users)-1].Email
+		after = &last
+	}
+}
+
 // Create a new user and return a UserClient tied to the APIClient argument
 func CreateUserClient(client *api.Client, email, firstName, lastName string) (*UserClient, error) {
 	body, _, err := client.CreateUser(email, firstName, lastName)
@@ -100,6 +126,17 @@ func (u *UserClient) changePassword(password string) error {
 	return u.APIClient.ChangePassword(u.Desc.Email, password)
 }
 
+// Return whether two-factor authentication is enforced for the user
+func (u *UserClient) TwoFactorStatus() (*api.TwoFactorStatus, error) {
+	return u.APIClient.CheckTwoFactorAuth(u.Desc.Email)
+}
+
+// Disable password login, the user can only sign in through an identity
+// provider afterwards
+func (u *UserClient) DisablePassword() error {
+	return u.APIClient.DisablePassword(u.Desc.Email)
+}
+
 // Disable two-factor authentication
 func (u *UserClient) DisableTwoFactorAuth() error {
 	return u.APIClient.DisableTwoFactorAuth(u.Desc.Email)
@@ -0,0 +1,74 @@
+package aerofssearch
+
+// Extraction of the text of file contents
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/ledongthuc/pdf"
+	"io/ioutil"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// The kinds of content text can be extracted from
+const (
+	noText = iota
+	plainText
+	pdfText
+)
+
+// Return the kind of content of a file from its MIME type or extension
+func textKind(name, mime string) int {
+	mime = strings.ToLower(strings.TrimSpace(strings.Split(mime, ";")[0]))
+	switch mime {
+	case "text/plain", "text/markdown", "text/x-markdown":
+		return plainText
+	case "application/pdf":
+		return pdfText
+	}
+
+	switch strings.ToLower(path.Ext(name)) {
+	case ".txt", ".text", ".md", ".markdown":
+		return plainText
+	case ".pdf":
+		return pdfText
+	}
+	return noText
+}
+
+// Return the text of content of the given kind
+func extractText(kind int, content []byte) (string, error) {
+	switch kind {
+	case plainText:
+		if !utf8.Valid(content) {
+			return "", errors.New("The content is not valid UTF-8 text")
+		}
+		return string(content), nil
+	case pdfText:
+		return extractPDF(content)
+	}
+	return "", nil
+}
+
+// The PDF parser panics on some malformed documents
+func extractPDF(content []byte) (text string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Unable to parse PDF : %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return "", err
+	}
+	plain, err := reader.GetPlainText()
+	if err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadAll(plain)
+	return string(data), err
+}
@@ -0,0 +1,240 @@
+package aerofssearch
+
+// A local search index of the metadata and text of AeroFS files
+// The index is stored in a single bolt database file with three buckets:
+//   documents : tree "\x00" file ID -> JSON Document
+//   postings  : term "\x00" tree "\x00" file ID -> number of occurrences
+//   terms     : tree "\x00" file ID -> JSON list of the terms of the document
+// Documents are keyed by tree as the same file is reachable from the trees of
+// every member of its shared folder. The terms of a document are kept so it
+// can be removed from the postings when it changes
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	bolt "go.etcd.io/bbolt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	documentsBucket = []byte("documents")
+	postingsBucket  = []byte("postings")
+	termsBucket     = []byte("terms")
+)
+
+// Occurrences in names and paths rank higher than in the content
+const (
+	NAME_WEIGHT = 4
+	PATH_WEIGHT = 2
+)
+
+// Terms shorter or longer than this are not indexed
+const (
+	MIN_TERM_LENGTH = 2
+	MAX_TERM_LENGTH = 64
+)
+
+// The metadata of an indexed file
+type Document struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+
+	// The tree the file was indexed from and its slash-separated path in it
+	Tree string `json:"tree"`
+	Path string `json:"path"`
+
+	// The name of the shared folder the file is in, if any
+	Share string `json:"share,omitempty"`
+
+	Mime         string `json:"mime_type"`
+	Size         int    `json:"size"`
+	LastModified string `json:"last_modified"`
+	Etag         string `json:"etag"`
+
+	// Whether the text of the content is indexed
+	HasText bool   `json:"has_text"`
+	Indexed string `json:"indexed"`
+}
+
+// Return the last modification time, the zero time if it cannot be parsed
+func (d Document) Modified() time.Time {
+	t, _ := time.Parse(time.RFC3339, d.LastModified)
+	return t
+}
+
+// An index stored in a local file, safe for concurrent use
+type Index struct {
+	db *bolt.DB
+}
+
+// Open the index stored in a file, creating it if missing
+// The file is locked while the index is open
+func Open(fileName string) (*Index, error) {
+	db, err := bolt.Open(fileName, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{documentsBucket, postingsBucket, termsBucket} {
+			_, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Index{db: db}, nil
+}
+
+func (ix *Index) Close() error {
+	return ix.db.Close()
+}
+
+// Split text into lower case terms of letters and digits
+func Tokenize(text string) []string {
+	terms := []string{}
+	for _, field := range strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		length := utf8.RuneCountInString(field)
+		if length < MIN_TERM_LENGTH || length > MAX_TERM_LENGTH {
+			continue
+		}
+		terms = append(terms, strings.ToLower(field))
+	}
+	return terms
+}
+
+// Count the weighted occurrences of the terms of a document
+func documentTerms(doc Document, text string) map[string]uint32 {
+	counts := map[string]uint32{}
+	for _, term := range Tokenize(doc.Name) {
+		counts[term] += NAME_WEIGHT
+	}
+	for _, term := range Tokenize(doc.Path) {
+		counts[term] += PATH_WEIGHT
+	}
+	for _, term := range Tokenize(text) {
+		counts[term]++
+	}
+	return counts
+}
+
+func documentKey(tree, id string) string {
+	return tree + "\x00" + id
+}
+
+func postingKey(term, key string) []byte {
+	return []byte(term + "\x00" + key)
+}
+
+// Return the document of a tree with the given file ID, nil if it is not
+// indexed
+func (ix *Index) Get(tree, id string) (*Document, error) {
+	var doc *Document
+	err := ix.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(documentsBucket).Get([]byte(documentKey(tree, id)))
+		if data == nil {
+			return nil
+		}
+		doc = &Document{}
+		return json.Unmarshal(data, doc)
+	})
+	return doc, err
+}
+
+// Add or replace the document of a tree and the text of its content
+func (ix *Index) Put(doc Document, text string) error {
+	doc.Indexed = time.Now().UTC().Format(time.RFC3339)
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	counts := documentTerms(doc, text)
+	terms := make([]string, 0, len(counts))
+	for term := range counts {
+		terms = append(terms, term)
+	}
+	termData, err := json.Marshal(terms)
+	if err != nil {
+		return err
+	}
+
+	key := documentKey(doc.Tree, doc.Id)
+	return ix.db.Update(func(tx *bolt.Tx) error {
+		err := deleteDocument(tx, key)
+		if err != nil {
+			return err
+		}
+
+		postings := tx.Bucket(postingsBucket)
+		for term, count := range counts {
+			value := make([]byte, 4)
+			binary.BigEndian.PutUint32(value, count)
+			err = postings.Put(postingKey(term, key), value)
+			if err != nil {
+				return err
+			}
+		}
+		err = tx.Bucket(termsBucket).Put([]byte(key), termData)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(documentsBucket).Put([]byte(key), data)
+	})
+}
+
+// Remove the document of a tree from the index, nothing is done if it is not
+// indexed
+func (ix *Index) Delete(tree, id string) error {
+	return ix.db.Update(func(tx *bolt.Tx) error {
+		return deleteDocument(tx, documentKey(tree, id))
+	})
+}
+
+func deleteDocument(tx *bolt.Tx, key string) error {
+	data := tx.Bucket(termsBucket).Get([]byte(key))
+	if data != nil {
+		terms := []string{}
+		err := json.Unmarshal(data, &terms)
+		if err != nil {
+			return err
+		}
+		postings := tx.Bucket(postingsBucket)
+		for _, term := range terms {
+			err = postings.Delete(postingKey(term, key))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err := tx.Bucket(termsBucket).Delete([]byte(key))
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(documentsBucket).Delete([]byte(key))
+}
+
+// Call a function with every document, in order of tree then file ID
+func (ix *Index) Documents(fn func(doc Document) error) error {
+	return ix.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(documentsBucket).ForEach(func(k, v []byte) error {
+			doc := Document{}
+			err := json.Unmarshal(v, &doc)
+			if err != nil {
+				return err
+			}
+			return fn(doc)
+		})
+	})
+}
@@ -0,0 +1,180 @@
+package aerofssearch
+
+// Queries of the index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	bolt "go.etcd.io/bbolt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The number of results returned by default
+const DEFAULT_LIMIT = 50
+
+// A search, every non-empty criterion must match
+type Query struct {
+	// Terms which must all occur in the name, path or text of a file, a term
+	// ending with "*" matches every term starting with it
+	Text string
+
+	// A case-insensitive substring of the file name
+	Name string
+
+	// A prefix of the MIME type, ie. "image/"
+	Mime string
+
+	// The tree and the shared folder the file belongs to
+	Tree  string
+	Share string
+
+	// Bounds of the size in bytes, unbounded if 0
+	MinSize int
+	MaxSize int
+
+	// Bounds of the last modification time, unbounded if zero
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+
+	// The maximum number of results, DEFAULT_LIMIT if 0
+	Limit int
+}
+
+// A matching document, results are sorted by decreasing score then path
+type Result struct {
+	Document
+	Score int `json:"score"`
+}
+
+// Return whether the metadata of a document matches the query
+func (q *Query) matches(doc Document) bool {
+	switch {
+	case q.Name != "" && !strings.Contains(strings.ToLower(doc.Name), strings.ToLower(q.Name)):
+		return false
+	case q.Mime != "" && !strings.HasPrefix(doc.Mime, q.Mime):
+		return false
+	case q.Tree != "" && doc.Tree != q.Tree:
+		return false
+	case q.Share != "" && doc.Share != q.Share:
+		return false
+	case q.MinSize > 0 && doc.Size < q.MinSize:
+		return false
+	case q.MaxSize > 0 && doc.Size > q.MaxSize:
+		return false
+	case !q.ModifiedAfter.IsZero() && !doc.Modified().After(q.ModifiedAfter):
+		return false
+	case !q.ModifiedBefore.IsZero() && !doc.Modified().Before(q.ModifiedBefore):
+		return false
+	}
+	return true
+}
+
+// Return the keys of the documents containing a term, or a term with the given
+// prefix, with the number of occurrences
+func termPostings(tx *bolt.Tx, term string) map[string]int {
+	prefix := strings.HasSuffix(term, "*")
+	term = strings.TrimSuffix(term, "*")
+	seek := []byte(term)
+	if !prefix {
+		seek = append(seek, 0)
+	}
+
+	keys := map[string]int{}
+	c := tx.Bucket(postingsBucket).Cursor()
+	for k, v := c.Seek(seek); k != nil && bytes.HasPrefix(k, seek); k, v = c.Next() {
+		i := bytes.IndexByte(k, 0)
+		keys[string(k[i+1:])] += int(binary.BigEndian.Uint32(v))
+	}
+	return keys
+}
+
+// Parse the terms of a query, keeping the "*" of prefix terms
+func queryTerms(text string) []string {
+	terms := []string{}
+	for _, word := range strings.Fields(text) {
+		prefix := strings.HasSuffix(word, "*")
+		tokens := Tokenize(word)
+		for i, token := range tokens {
+			if prefix && i == len(tokens)-1 {
+				token += "*"
+			}
+			terms = append(terms, token)
+		}
+	}
+	return terms
+}
+
+// Return the documents matching a query
+func (ix *Index) Search(q Query) ([]Result, error) {
+	if q.Limit <= 0 {
+		q.Limit = DEFAULT_LIMIT
+	}
+	results := []Result{}
+
+	err := ix.db.View(func(tx *bolt.Tx) error {
+		documents := tx.Bucket(documentsBucket)
+		add := func(data []byte, score int) error {
+			doc := Document{}
+			err := json.Unmarshal(data, &doc)
+			if err != nil {
+				return err
+			}
+			if q.matches(doc) {
+				results = append(results, Result{doc, score})
+			}
+			return nil
+		}
+
+		terms := queryTerms(q.Text)
+		if len(terms) == 0 {
+			return documents.ForEach(func(k, v []byte) error {
+				return add(v, 0)
+			})
+		}
+
+		// Intersect the postings of every term
+		scores := termPostings(tx, terms[0])
+		for _, term := range terms[1:] {
+			postings := termPostings(tx, term)
+			for key, score := range scores {
+				if count, ok := postings[key]; ok {
+					scores[key] = score + count
+				} else {
+					delete(scores, key)
+				}
+			}
+		}
+
+		for key, score := range scores {
+			data := documents.Get([]byte(key))
+			if data == nil {
+				continue
+			}
+			err := add(data, score)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if results[i].Tree != results[j].Tree {
+			return results[i].Tree < results[j].Tree
+		}
+		return results[i].Path < results[j].Path
+	})
+	if len(results) > q.Limit {
+		results = results[:q.Limit]
+	}
+	return results, nil
+}
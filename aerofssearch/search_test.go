@@ -0,0 +1,193 @@
+package aerofssearch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestIndex(t *testing.T) (*Index, func()) {
+	dir, err := ioutil.TempDir("", "aerofssearch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix, err := Open(filepath.Join(dir, "index.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ix, func() {
+		ix.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func populate(t *testing.T, ix *Index) {
+	docs := []struct {
+		doc  Document
+		text string
+	}{
+		{Document{Id: "f1", Name: "route.md", Tree: "root", Path: "Maps/route.md", Share: "Maps",
+			Mime: "text/markdown", Size: 300, LastModified: "2014-03-25T12:00:00Z"},
+			"The road to Mordor passes Minas Morgul"},
+		{Document{Id: "f2", Name: "gate.png", Tree: "root", Path: "Maps/gate.png", Share: "Maps",
+			Mime: "image/png", Size: 90000, LastModified: "2013-09-22T12:00:00Z"}, ""},
+		{Document{Id: "f3", Name: "recipes.txt", Tree: "root", Path: "recipes.txt",
+			Mime: "text/plain", Size: 40, LastModified: "2015-01-01T00:00:00Z"},
+			"Coneys stewed with herbs, no road food"},
+	}
+	for _, d := range docs {
+		err := ix.Put(d.doc, d.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func ids(results []Result) []string {
+	ids := []string{}
+	for _, r := range results {
+		ids = append(ids, r.Id)
+	}
+	return ids
+}
+
+func expectResults(t *testing.T, ix *Index, q Query, expected ...string) {
+	results, err := ix.Search(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual := ids(results)
+	if len(actual) != len(expected) {
+		t.Errorf("Query %+v : expected %v, got %v", q, expected, actual)
+		return
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Errorf("Query %+v : expected %v, got %v", q, expected, actual)
+			return
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	terms := Tokenize("Minas-Tirith, the WHITE city (2015) à l'Ouest a")
+	expected := []string{"minas", "tirith", "the", "white", "city", "2015", "ouest"}
+	if len(terms) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, terms)
+	}
+	for i := range expected {
+		if terms[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, terms)
+		}
+	}
+}
+
+func TestSearchText(t *testing.T) {
+	ix, cleanup := newTestIndex(t)
+	defer cleanup()
+	populate(t, ix)
+
+	expectResults(t, ix, Query{Text: "mordor"}, "f1")
+	expectResults(t, ix, Query{Text: "road"}, "f1", "f3")
+	expectResults(t, ix, Query{Text: "road herbs"}, "f3")
+	expectResults(t, ix, Query{Text: "mor*"}, "f1")
+	expectResults(t, ix, Query{Text: "balrog"})
+
+	// Names rank above paths and content, equal scores are sorted by path
+	expectResults(t, ix, Query{Text: "maps"}, "f2", "f1")
+	expectResults(t, ix, Query{Text: "rout* road"}, "f1")
+	expectResults(t, ix, Query{Text: "recipes road"}, "f3")
+}
+
+func TestSearchMetadata(t *testing.T) {
+	ix, cleanup := newTestIndex(t)
+	defer cleanup()
+	populate(t, ix)
+
+	expectResults(t, ix, Query{Mime: "text/"}, "f1", "f3")
+	expectResults(t, ix, Query{Name: "GATE"}, "f2")
+	expectResults(t, ix, Query{Share: "Maps", MinSize: 1000}, "f2")
+	expectResults(t, ix, Query{MaxSize: 100}, "f3")
+	expectResults(t, ix, Query{ModifiedAfter: time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC)}, "f1", "f3")
+	expectResults(t, ix, Query{ModifiedBefore: time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC)}, "f2")
+	expectResults(t, ix, Query{Text: "road", Share: "Maps"}, "f1")
+	expectResults(t, ix, Query{Limit: 1, Mime: "text/"}, "f1")
+}
+
+func TestReplaceAndDelete(t *testing.T) {
+	ix, cleanup := newTestIndex(t)
+	defer cleanup()
+	populate(t, ix)
+
+	err := ix.Put(Document{Id: "f1", Name: "route.md", Tree: "root", Path: "Maps/route.md",
+		Etag: "e2"}, "The road to Isengard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectResults(t, ix, Query{Text: "mordor"})
+	expectResults(t, ix, Query{Text: "isengard"}, "f1")
+
+	doc, err := ix.Get("root", "f1")
+	if err != nil || doc == nil || doc.Etag != "e2" {
+		t.Errorf("Expected the replaced document, got %+v", doc)
+	}
+
+	err = ix.Delete("root", "f1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectResults(t, ix, Query{Text: "isengard"})
+	if doc, _ = ix.Get("root", "f1"); doc != nil {
+		t.Errorf("The document was not deleted")
+	}
+}
+
+// The same file indexed from two trees is kept once per tree
+func TestSameFileInTwoTrees(t *testing.T) {
+	ix, cleanup := newTestIndex(t)
+	defer cleanup()
+	populate(t, ix)
+
+	err := ix.Put(Document{Id: "f1", Name: "route.md", Tree: "root:sam", Path: "Maps/route.md",
+		Share: "Maps"}, "The road to Mordor passes Minas Morgul")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectResults(t, ix, Query{Text: "mordor"}, "f1", "f1")
+	expectResults(t, ix, Query{Text: "mordor", Tree: "root:sam"}, "f1")
+
+	err = ix.Delete("root", "f1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectResults(t, ix, Query{Text: "mordor", Tree: "root:sam"}, "f1")
+	if doc, _ := ix.Get("root:sam", "f1"); doc == nil || doc.Tree != "root:sam" {
+		t.Errorf("Expected the document of the other tree, got %+v", doc)
+	}
+}
+
+func TestTextKind(t *testing.T) {
+	cases := []struct {
+		name, mime string
+		kind       int
+	}{
+		{"notes.md", "", plainText},
+		{"notes", "text/plain; charset=utf-8", plainText},
+		{"book.PDF", "application/octet-stream", pdfText},
+		{"ring.png", "image/png", noText},
+	}
+	for _, c := range cases {
+		if kind := textKind(c.name, c.mime); kind != c.kind {
+			t.Errorf("%s %s : expected %d, got %d", c.name, c.mime, c.kind, kind)
+		}
+	}
+
+	if _, err := extractText(plainText, []byte{0xff, 0xfe}); err == nil {
+		t.Errorf("Invalid UTF-8 must not be indexed as text")
+	}
+	if _, err := extractText(pdfText, []byte("not a pdf")); err == nil {
+		t.Errorf("Expected an error for an invalid PDF")
+	}
+}
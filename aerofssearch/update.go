@@ -0,0 +1,196 @@
+package aerofssearch
+
+// Updating the index from a folder tree
+// A file whose ETag is unchanged since it was indexed is left alone, so only
+// new and modified files are downloaded for text extraction
+
+import (
+	"bytes"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"path"
+)
+
+// Files larger than this are indexed without their text by default
+const DEFAULT_MAX_TEXT_SIZE = 8 * 1024 * 1024
+
+// Options for Update
+type UpdateOptions struct {
+	// The name the tree is indexed under, the folder identifier if empty
+	Tree string
+
+	// The name of the shared folder the tree is the root of, if any
+	Share string
+
+	// Download plain text, Markdown and PDF files to index their text
+	ExtractText bool
+
+	// Files larger than this are indexed without their text,
+	// DEFAULT_MAX_TEXT_SIZE if 0
+	MaxTextSize int
+
+	// Called with progress messages, may be nil
+	Log func(format string, args ...interface{})
+}
+
+// What an update did
+type UpdateReport struct {
+	Added     int
+	Updated   int
+	Unchanged int
+	Removed   int
+	Failures  []sdk.Failure
+}
+
+// Bring the documents of a tree up to date with a folder
+// Files no longer in the folder are removed from the index, unless part of the
+// folder could not be listed
+func (ix *Index) Update(c *api.Client, folderId string, opts UpdateOptions) (*UpdateReport, error) {
+	if opts.Tree == "" {
+		opts.Tree = folderId
+	}
+	if opts.MaxTextSize <= 0 {
+		opts.MaxTextSize = DEFAULT_MAX_TEXT_SIZE
+	}
+	report := UpdateReport{Failures: []sdk.Failure{}}
+	fail := func(item string, err error) {
+		if opts.Log != nil {
+			opts.Log("%s : %s", item, err)
+		}
+		report.Failures = append(report.Failures, sdk.Failure{Item: item, Error: err.Error()})
+	}
+
+	// Shared folders below the root, by path
+	shares := map[string]string{"": opts.Share}
+	shareOf := func(p string) string {
+		for dir := path.Dir(p); ; dir = path.Dir(dir) {
+			if dir == "." || dir == "/" {
+				dir = ""
+			}
+			if share, ok := shares[dir]; ok && share != "" {
+				return share
+			}
+			if dir == "" {
+				return ""
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	complete := true
+	root := sdk.FolderClient{APIClient: c, Desc: sdk.Folder{Id: folderId}}
+	err := root.Walk(func(entry sdk.TreeEntry, err error) error {
+		item := opts.Tree + ": " + entry.Path
+		switch {
+		case err != nil:
+			complete = false
+			fail(item, err)
+			return nil
+		case entry.IsDir:
+			if entry.Folder.IsShared {
+				shares[entry.Path] = entry.Folder.Name
+			}
+			return nil
+		}
+
+		seen[entry.File.Id] = true
+		status, err := ix.updateFile(c, entry, shareOf(entry.Path), opts)
+		switch {
+		case err != nil:
+			fail(item, err)
+		case status == added:
+			report.Added++
+		case status == updated:
+			report.Updated++
+		default:
+			report.Unchanged++
+		}
+		return nil
+	})
+	if err != nil {
+		return &report, err
+	}
+	if !complete {
+		return &report, nil
+	}
+
+	stale := []string{}
+	err = ix.Documents(func(doc Document) error {
+		if doc.Tree == opts.Tree && !seen[doc.Id] {
+			stale = append(stale, doc.Id)
+		}
+		return nil
+	})
+	if err != nil {
+		return &report, err
+	}
+	for _, id := range stale {
+		err = ix.Delete(opts.Tree, id)
+		if err != nil {
+			return &report, err
+		}
+		report.Removed++
+	}
+	return &report, nil
+}
+
+const (
+	unchanged = iota
+	added
+	updated
+)
+
+// Index a file unless its ETag is unchanged
+func (ix *Index) updateFile(c *api.Client, entry sdk.TreeEntry, share string, opts UpdateOptions) (int, error) {
+	f := sdk.FileClient{APIClient: c, Desc: entry.File}
+	if f.Desc.Etag == "" {
+		err := f.LoadMetadata()
+		if err != nil {
+			return unchanged, err
+		}
+	}
+
+	existing, err := ix.Get(opts.Tree, f.Desc.Id)
+	if err != nil {
+		return unchanged, err
+	}
+	if existing != nil && existing.Etag == f.Desc.Etag &&
+		existing.Path == entry.Path && existing.Share == share {
+		return unchanged, nil
+	}
+
+	doc := Document{Id: f.Desc.Id, Name: f.Desc.Name, Tree: opts.Tree, Path: entry.Path,
+		Share: share, Mime: f.Desc.Mime, Size: f.Desc.Size,
+		LastModified: f.Desc.LastModified, Etag: f.Desc.Etag}
+	if doc.Name == "" {
+		doc.Name = path.Base(entry.Path)
+	}
+
+	// A file whose text cannot be extracted is still indexed by its metadata,
+	// without an ETag if the download failed so the next update retries it
+	text := ""
+	kind := textKind(doc.Name, doc.Mime)
+	if opts.ExtractText && kind != noText && doc.Size <= opts.MaxTextSize {
+		content := bytes.Buffer{}
+		err = f.Download(&content)
+		if err != nil {
+			doc.Etag = ""
+		} else {
+			text, err = extractText(kind, content.Bytes())
+		}
+		if err != nil && opts.Log != nil {
+			opts.Log("%s: %s : unable to extract text : %s", opts.Tree, entry.Path, err)
+		}
+		doc.HasText = err == nil
+	}
+
+	err = ix.Put(doc, text)
+	if err != nil {
+		return unchanged, fmt.Errorf("Unable to index : %s", err)
+	}
+	if existing == nil {
+		return added, nil
+	}
+	return updated, nil
+}
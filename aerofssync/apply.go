@@ -0,0 +1,270 @@
+package aerofssync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// Performs the planned actions and records their outcome in the manifest
+type applier struct {
+	syncer   *Syncer
+	local    map[string]localEntry
+	remote   map[string]remoteEntry
+	manifest *Manifest
+
+	// Identifiers of remote folders, including those created by this run
+	folders map[string]string
+}
+
+// Perform the actions in an order which guarantees that parent folders exist
+// before their contents are created and are deleted after their contents
+func (a *applier) apply(actions []Action) {
+	phases := [][]ActionType{
+		{RenameLocal},
+		{CreateRemoteFolder, CreateLocalFolder},
+		{Upload, Download, Track, Forget},
+	}
+	for _, phase := range phases {
+		for i := range actions {
+			for _, t := range phase {
+				if actions[i].Type == t {
+					actions[i].Err = a.perform(&actions[i])
+				}
+			}
+		}
+	}
+
+	// Deletions are performed in reverse, a folder is kept if any of its
+	// contents failed to delete on the same side
+	failed := map[ActionType]map[string]bool{DeleteRemote: {}, DeleteLocal: {}}
+	for i := len(actions) - 1; i >= 0; i-- {
+		act := &actions[i]
+		if act.Type != DeleteRemote && act.Type != DeleteLocal {
+			continue
+		}
+		if failed[act.Type][act.Path] {
+			act.Err = ErrNotEmpty
+		} else {
+			act.Err = a.perform(act)
+		}
+		if act.Err == nil {
+			continue
+		}
+		for p := path.Dir(act.Path); p != "."; p = path.Dir(p) {
+			failed[act.Type][p] = true
+		}
+	}
+}
+
+func (a *applier) perform(act *Action) error {
+	switch act.Type {
+	case Upload:
+		return a.upload(act)
+	case Download:
+		return a.download(act)
+	case CreateRemoteFolder:
+		return a.createRemoteFolder(act)
+	case CreateLocalFolder:
+		err := os.MkdirAll(a.localPath(act.Path), 0755)
+		if err == nil {
+			a.manifest.Entries[act.Path] = Entry{IsDir: true, Id: act.Id}
+		}
+		return err
+	case DeleteRemote:
+		return a.deleteRemote(act)
+	case DeleteLocal:
+		err := os.Remove(a.localPath(act.Path))
+		if err == nil || os.IsNotExist(err) {
+			delete(a.manifest.Entries, act.Path)
+			return nil
+		}
+		return err
+	case RenameLocal:
+		return os.Rename(a.localPath(act.Source), a.localPath(act.Path))
+	case Track:
+		a.track(act.Path, act.Id, act.Etag)
+	case Forget:
+		delete(a.manifest.Entries, act.Path)
+	}
+	return nil
+}
+
+// Return the local filesystem path of a relative path
+func (a *applier) localPath(rel string) string {
+	return filepath.Join(a.syncer.LocalDir, filepath.FromSlash(rel))
+}
+
+// Return the identifier of the remote folder containing a relative path
+func (a *applier) parentId(rel string) (string, error) {
+	parent := path.Dir(rel)
+	if parent == "." {
+		parent = ""
+	}
+	id, ok := a.folders[parent]
+	if !ok {
+		return "", errors.New("The remote parent folder does not exist")
+	}
+	return id, nil
+}
+
+// Record the state of a path which is identical on both sides
+func (a *applier) track(rel, id, etag string) {
+	l := a.local[rel]
+	if l.IsDir {
+		a.manifest.Entries[rel] = Entry{IsDir: true, Id: id}
+		return
+	}
+	a.manifest.Entries[rel] = Entry{Id: id, Etag: etag, Size: l.Size,
+		ModTime: l.ModTime, Hash: l.Hash}
+}
+
+func (a *applier) createRemoteFolder(act *Action) error {
+	parentId, err := a.parentId(act.Path)
+	if err != nil {
+		return err
+	}
+
+	folder, err := sdk.CreateFolderClient(a.syncer.APIClient, parentId, path.Base(act.Path))
+	if err != nil {
+		return err
+	}
+
+	a.folders[act.Path] = folder.Desc.Id
+	a.manifest.Entries[act.Path] = Entry{IsDir: true, Id: folder.Desc.Id}
+	return nil
+}
+
+// Upload a local file through the chunked upload path
+// Existing files are only overwritten if their ETag still matches
+func (a *applier) upload(act *Action) error {
+	source := act.Source
+	if source == "" {
+		source = act.Path
+	}
+
+	file, err := os.Open(a.localPath(source))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var fc *sdk.FileClient
+	if act.Id != "" {
+		fc = &sdk.FileClient{APIClient: a.syncer.APIClient,
+			Desc: sdk.File{Id: act.Id, Etag: act.Etag}}
+	} else {
+		parentId, err := a.parentId(act.Path)
+		if err != nil {
+			return err
+		}
+		fc, err = sdk.CreateFileClient(a.syncer.APIClient, parentId, path.Base(act.Path))
+		if err != nil {
+			return err
+		}
+		if fc.Desc.Etag == "" {
+			err = fc.LoadMetadata()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	hash := sha256.New()
+	err = fc.UploadFile(io.TeeReader(file, hash))
+	if api.IsStatus(err, http.StatusPreconditionFailed) {
+		return ErrConflict
+	} else if err != nil {
+		return err
+	}
+
+	// The local version was uploaded under another name, the conflict is
+	// resolved by recording both versions of the original path as synchronized
+	if source != act.Path {
+		r := a.remote[source]
+		a.track(source, r.Id, r.Etag)
+		return nil
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	a.manifest.Entries[act.Path] = Entry{Id: fc.Desc.Id, Etag: fc.Desc.Etag,
+		Size: info.Size(), ModTime: info.ModTime(),
+		Hash: hex.EncodeToString(hash.Sum(nil))}
+	return nil
+}
+
+// Download a remote file into a temporary file which then replaces the local
+// file, its modification time is set to that of the remote file
+func (a *applier) download(act *Action) error {
+	r := a.remote[act.Path]
+	target := a.localPath(act.Path)
+	tmpName := target + TMP_SUFFIX
+
+	file, err := os.Create(tmpName)
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	fc := sdk.FileClient{APIClient: a.syncer.APIClient,
+		Desc: sdk.File{Id: r.Id, Etag: r.Etag, Size: r.Size}}
+	err = fc.Download(io.MultiWriter(file, hash))
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	lastModified, err := time.Parse(time.RFC3339, r.LastModified)
+	if err == nil {
+		os.Chtimes(tmpName, lastModified, lastModified)
+	}
+
+	err = os.Rename(tmpName, target)
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+	a.manifest.Entries[act.Path] = Entry{Id: r.Id, Etag: r.Etag,
+		Size: info.Size(), ModTime: info.ModTime(),
+		Hash: hex.EncodeToString(hash.Sum(nil))}
+	return nil
+}
+
+// Delete a remote file or folder guarded by the ETag it was scanned with
+func (a *applier) deleteRemote(act *Action) error {
+	var err error
+	if act.IsDir {
+		err = a.syncer.APIClient.DeleteFolder(act.Id, []string{act.Etag})
+	} else {
+		err = a.syncer.APIClient.DeleteFile(act.Id, []string{act.Etag})
+	}
+
+	switch {
+	case err == nil, api.IsStatus(err, http.StatusNotFound):
+		delete(a.manifest.Entries, act.Path)
+		return nil
+	case api.IsStatus(err, http.StatusPreconditionFailed):
+		return ErrConflict
+	}
+	return err
+}
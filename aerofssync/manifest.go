@@ -0,0 +1,73 @@
+package aerofssync
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// The state of a path after it was last synchronized
+type Entry struct {
+	IsDir bool `json:"is_dir,omitempty"`
+
+	// The AeroFS file or folder identifier
+	Id string `json:"id"`
+
+	// The ETag of the remote file
+	Etag string `json:"etag,omitempty"`
+
+	// The size, modification time and SHA-256 of the local file
+	Size    int64     `json:"size,omitempty"`
+	ModTime time.Time `json:"mtime,omitempty"`
+	Hash    string    `json:"sha256,omitempty"`
+}
+
+// The record of every synchronized path, keyed by its slash-separated path
+// relative to the synchronized directory
+type Manifest struct {
+	FolderId string           `json:"folder_id"`
+	Entries  map[string]Entry `json:"entries"`
+}
+
+// Read the manifest at a given location
+// An empty manifest is returned if none exists or it belongs to another folder
+func LoadManifest(fileName, folderId string) (*Manifest, error) {
+	empty := &Manifest{FolderId: folderId, Entries: map[string]Entry{}}
+
+	data, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return empty, nil
+	} else if err != nil {
+		return nil, errors.New("Unable to read the synchronization manifest")
+	}
+
+	m := Manifest{}
+	err = json.Unmarshal(data, &m)
+	if err != nil {
+		return nil, errors.New("Unable to unmarshal the synchronization manifest")
+	}
+
+	if m.FolderId != folderId || m.Entries == nil {
+		return empty, nil
+	}
+	return &m, nil
+}
+
+// Write the manifest to a given location
+// The manifest is written to a temporary file first so an interrupted run
+// never leaves a truncated manifest behind
+func (m *Manifest) Save(fileName string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return errors.New("Unable to marshal the synchronization manifest")
+	}
+
+	tmpName := fileName + ".tmp"
+	err = ioutil.WriteFile(tmpName, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpName, fileName)
+}
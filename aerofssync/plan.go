@@ -0,0 +1,273 @@
+package aerofssync
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The operation performed on a single path
+type ActionType int
+
+const (
+	// Upload a local file, creating the remote file if it does not exist
+	Upload ActionType = iota
+
+	// Download a remote file
+	Download
+
+	CreateRemoteFolder
+	CreateLocalFolder
+	DeleteRemote
+	DeleteLocal
+
+	// Rename a local file, used to keep both versions of a conflict
+	RenameLocal
+
+	// A path changed on both sides which the conflict policy left untouched
+	Conflict
+
+	// Record a path which is identical on both sides in the manifest
+	Track
+
+	// Remove a path deleted on both sides from the manifest
+	Forget
+)
+
+var actionNames = []string{"upload", "download", "create remote folder",
+	"create local folder", "delete remote", "delete local", "rename local",
+	"conflict", "track", "forget"}
+
+func (t ActionType) String() string {
+	if int(t) < len(actionNames) {
+		return actionNames[t]
+	}
+	return fmt.Sprintf("ActionType(%d)", int(t))
+}
+
+// A single step of a synchronization run
+type Action struct {
+	Type  ActionType
+	IsDir bool
+
+	// The slash-separated path relative to the synchronized directory
+	Path string
+
+	// The local file an Upload reads or a RenameLocal moves, if not Path
+	Source string
+
+	// The identifier and expected ETag of the remote path, if it exists
+	Id   string
+	Etag string
+
+	// The error encountered when performing the action
+	Err error
+}
+
+func (a Action) String() string {
+	if a.Source != "" && a.Source != a.Path {
+		return fmt.Sprintf("%s %s -> %s", a.Type, a.Source, a.Path)
+	}
+	return fmt.Sprintf("%s %s", a.Type, a.Path)
+}
+
+// Compute the actions which reconcile the local and remote trees given the
+// state recorded by the previous run
+func plan(local map[string]localEntry, remote map[string]remoteEntry, m *Manifest, opts Options, now time.Time) []Action {
+	paths := map[string]bool{}
+	for p := range local {
+		paths[p] = true
+	}
+	for p := range remote {
+		paths[p] = true
+	}
+	for p := range m.Entries {
+		paths[p] = true
+	}
+	sorted := []string{}
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return pathLess(sorted[i], sorted[j])
+	})
+
+	actions := []Action{}
+	for _, p := range sorted {
+		l, lok := local[p]
+		r, rok := remote[p]
+		e, eok := m.Entries[p]
+
+		switch {
+		case lok && rok && l.IsDir != r.IsDir:
+			actions = append(actions, Action{Type: Conflict, Path: p})
+		case (lok && l.IsDir) || (rok && r.IsDir) || (!lok && !rok && e.IsDir):
+			actions = append(actions, planFolder(p, lok, r, rok, e, eok)...)
+		default:
+			actions = append(actions, planFile(p, l, lok, r, rok, e, eok, opts, now)...)
+		}
+	}
+
+	return filterMode(keepParents(actions), opts.Mode)
+}
+
+func planFolder(p string, lok bool, r remoteEntry, rok bool, e Entry, eok bool) []Action {
+	switch {
+	case lok && rok && (!eok || e.Id != r.Id):
+		return []Action{{Type: Track, IsDir: true, Path: p, Id: r.Id}}
+	case lok && !rok && eok:
+		return []Action{{Type: DeleteLocal, IsDir: true, Path: p}}
+	case lok && !rok:
+		return []Action{{Type: CreateRemoteFolder, IsDir: true, Path: p}}
+	case !lok && rok && eok:
+		return []Action{{Type: DeleteRemote, IsDir: true, Path: p, Id: r.Id, Etag: r.Etag}}
+	case !lok && rok:
+		return []Action{{Type: CreateLocalFolder, IsDir: true, Path: p, Id: r.Id}}
+	case !lok && !rok:
+		return []Action{{Type: Forget, IsDir: true, Path: p}}
+	}
+	return nil
+}
+
+func planFile(p string, l localEntry, lok bool, r remoteEntry, rok bool, e Entry, eok bool, opts Options, now time.Time) []Action {
+	localChanged := lok != eok || (lok && l.Hash != e.Hash)
+	remoteChanged := rok != eok || (rok && r.Etag != e.Etag)
+
+	upload := Action{Type: Upload, Path: p, Id: r.Id, Etag: r.Etag}
+	download := Action{Type: Download, Path: p, Id: r.Id, Etag: r.Etag}
+	deleteRemote := Action{Type: DeleteRemote, Path: p, Id: r.Id, Etag: r.Etag}
+	deleteLocal := Action{Type: DeleteLocal, Path: p}
+
+	switch {
+	case !localChanged && !remoteChanged:
+		// Record a new modification time so the file is not hashed again
+		if lok && (l.Size != e.Size || !l.ModTime.Equal(e.ModTime)) {
+			return []Action{{Type: Track, Path: p, Id: r.Id, Etag: r.Etag}}
+		}
+		return nil
+	case localChanged && !remoteChanged && lok:
+		return []Action{upload}
+	case localChanged && !remoteChanged:
+		return []Action{deleteRemote}
+	case remoteChanged && !localChanged && rok:
+		return []Action{download}
+	case remoteChanged && !localChanged:
+		return []Action{deleteLocal}
+	case !lok && !rok:
+		return []Action{{Type: Forget, Path: p}}
+	case !eok && lok && rok && sameFile(l, r):
+		return []Action{{Type: Track, Path: p, Id: r.Id, Etag: r.Etag}}
+	}
+
+	// Both sides changed since the last run
+	switch opts.Conflicts {
+	case PreferLocal:
+		if lok {
+			return []Action{upload}
+		}
+		return []Action{deleteRemote}
+	case PreferRemote:
+		if rok {
+			return []Action{download}
+		}
+		return []Action{deleteLocal}
+	case KeepBoth:
+		// The surviving version of a modified, deleted path is restored
+		if !rok {
+			return []Action{upload}
+		} else if !lok {
+			return []Action{download}
+		}
+
+		copyPath := conflictName(p, now)
+		switch opts.Mode {
+		case Push:
+			return []Action{{Type: Upload, Path: copyPath, Source: p}}
+		case Pull:
+			return []Action{{Type: RenameLocal, Path: copyPath, Source: p}, download}
+		default:
+			return []Action{{Type: RenameLocal, Path: copyPath, Source: p},
+				{Type: Upload, Path: copyPath}, download}
+		}
+	}
+	return []Action{{Type: Conflict, Path: p, Id: r.Id, Etag: r.Etag}}
+}
+
+// Order paths so that the contents of a folder directly follow it
+func pathLess(a, b string) bool {
+	return strings.Replace(a, "/", "\x00", -1) < strings.Replace(b, "/", "\x00", -1)
+}
+
+// Files which were never synchronized are assumed to be identical if their
+// size and modification time are the same
+func sameFile(l localEntry, r remoteEntry) bool {
+	lastModified, err := time.Parse(time.RFC3339, r.LastModified)
+	if err != nil {
+		return false
+	}
+	return l.Size == int64(r.Size) && l.ModTime.Truncate(time.Second).Equal(lastModified.Truncate(time.Second))
+}
+
+// Return the name a conflicting local file is kept under
+func conflictName(p string, now time.Time) string {
+	ext := path.Ext(p)
+	base := strings.TrimSuffix(p, ext)
+	return fmt.Sprintf("%s (conflict %s)%s", base, now.Format("2006-01-02 150405"), ext)
+}
+
+// A folder deleted on one side is only removed from the other if every path
+// within it is also removed. Otherwise the folder is recreated on the side it
+// was deleted from, or left in place if its contents are in conflict
+func keepParents(actions []Action) []Action {
+	result := []Action{}
+	for i, a := range actions {
+		if !a.IsDir || (a.Type != DeleteLocal && a.Type != DeleteRemote) {
+			result = append(result, a)
+			continue
+		}
+
+		removable, recreate := true, false
+		for _, child := range actions[i+1:] {
+			if !strings.HasPrefix(child.Path, a.Path+"/") {
+				break
+			}
+			switch child.Type {
+			case a.Type, Forget:
+			case Upload, CreateRemoteFolder, Download, CreateLocalFolder, RenameLocal:
+				removable = false
+				recreate = true
+			default:
+				removable = false
+			}
+		}
+
+		switch {
+		case removable:
+			result = append(result, a)
+		case recreate && a.Type == DeleteLocal:
+			result = append(result, Action{Type: CreateRemoteFolder, IsDir: true, Path: a.Path})
+		case recreate:
+			result = append(result, Action{Type: CreateLocalFolder, IsDir: true, Path: a.Path, Id: a.Id})
+		}
+	}
+	return result
+}
+
+// Drop the actions which modify the side of the synchronization the mode does
+// not propagate changes to
+func filterMode(actions []Action, mode Mode) []Action {
+	result := []Action{}
+	for _, a := range actions {
+		remoteSide := a.Type == Upload || a.Type == CreateRemoteFolder || a.Type == DeleteRemote
+		localSide := a.Type == Download || a.Type == CreateLocalFolder ||
+			a.Type == DeleteLocal || a.Type == RenameLocal
+
+		if (mode == Pull && remoteSide) || (mode == Push && localSide) {
+			continue
+		}
+		result = append(result, a)
+	}
+	return result
+}
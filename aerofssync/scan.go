@@ -0,0 +1,155 @@
+package aerofssync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Suffix of the temporary files content is downloaded into
+const TMP_SUFFIX = ".aerofs-tmp"
+
+// A file or directory within the local tree
+type localEntry struct {
+	IsDir   bool
+	Size    int64
+	ModTime time.Time
+	Hash    string
+}
+
+// A file or folder within the AeroFS tree
+type remoteEntry struct {
+	IsDir        bool
+	Id           string
+	Etag         string
+	Size         int
+	LastModified string
+}
+
+// Walk the local directory and return its entries keyed by relative path
+// Files whose size and modification time match the manifest reuse the
+// recorded hash rather than being read again
+func scanLocal(root, manifestPath string, m *Manifest) (map[string]localEntry, error) {
+	entries := map[string]localEntry{}
+	manifestPath = filepath.Clean(manifestPath)
+
+	err := filepath.Walk(root, func(fileName string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, fileName)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		switch {
+		case info.IsDir():
+			entries[rel] = localEntry{IsDir: true, ModTime: info.ModTime()}
+			return nil
+		case !info.Mode().IsRegular():
+			return nil
+		case filepath.Clean(fileName) == manifestPath,
+			filepath.Clean(fileName) == manifestPath+".tmp",
+			strings.HasSuffix(fileName, TMP_SUFFIX):
+			return nil
+		}
+
+		entry := localEntry{Size: info.Size(), ModTime: info.ModTime()}
+		prev, ok := m.Entries[rel]
+		if ok && prev.Size == entry.Size && prev.ModTime.Equal(entry.ModTime) {
+			entry.Hash = prev.Hash
+		} else {
+			entry.Hash, err = hashFile(fileName)
+			if err != nil {
+				return err
+			}
+		}
+		entries[rel] = entry
+		return nil
+	})
+
+	return entries, err
+}
+
+// Compute the hex encoded SHA-256 of a local file
+func hashFile(fileName string) (string, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Recursively list an AeroFS folder and return its entries keyed by relative
+// path
+func scanRemote(c *api.Client, folderId string) (map[string]remoteEntry, error) {
+	entries := map[string]remoteEntry{}
+	err := scanRemoteFolder(c, folderId, "", entries)
+	return entries, err
+}
+
+func scanRemoteFolder(c *api.Client, folderId, prefix string, entries map[string]remoteEntry) error {
+	// The children are listed with the metadata so the folder's ETag matches
+	// the listed contents
+	folder := sdk.FolderClient{APIClient: c, Desc: sdk.Folder{Id: folderId},
+		OnDemand: []string{"children"}}
+	err := folder.LoadMetadata()
+	if err != nil {
+		return err
+	}
+	if prefix != "" {
+		entries[prefix] = remoteEntry{IsDir: true, Id: folderId, Etag: folder.Desc.Etag}
+	}
+
+	for _, f := range folder.Desc.ChildList.Files {
+		// Older appliances omit the ETag from the list of children
+		if f.Etag == "" {
+			fc, err := sdk.NewFileClient(c, f.Id, []string{})
+			if err != nil {
+				return err
+			}
+			f = api.File(fc.Desc)
+		}
+		entries[path.Join(prefix, f.Name)] = remoteEntry{
+			Id:           f.Id,
+			Etag:         f.Etag,
+			Size:         f.Size,
+			LastModified: f.LastModified,
+		}
+	}
+
+	for _, f := range folder.Desc.ChildList.Folders {
+		err = scanRemoteFolder(c, f.Id, path.Join(prefix, f.Name), entries)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Return the identifiers of all remote folders keyed by relative path, the
+// synchronized folder itself has the empty path
+func remoteFolders(remote map[string]remoteEntry, folderId string) map[string]string {
+	folders := map[string]string{"": folderId}
+	for rel, r := range remote {
+		if r.IsDir {
+			folders[rel] = r.Id
+		}
+	}
+	return folders
+}
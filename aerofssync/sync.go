@@ -0,0 +1,147 @@
+package aerofssync
+
+// A Syncer mirrors a local directory with a folder on an AeroFS Appliance
+// Each run compares both trees against the manifest recorded by the previous
+// run, so only paths that changed on either side are transferred
+
+import (
+	"errors"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	"path/filepath"
+	"time"
+)
+
+// The name of the manifest file stored in the synchronized directory when no
+// other location is configured
+const MANIFEST_NAME = ".aerofs-sync.json"
+
+// The direction changes are propagated in
+type Mode int
+
+const (
+	// Local changes are applied to the AeroFS folder
+	Push Mode = iota
+
+	// Changes to the AeroFS folder are applied locally
+	Pull
+
+	// Changes are propagated in both directions
+	TwoWay
+)
+
+// How a path modified on both sides since the last run is resolved
+type ConflictPolicy int
+
+const (
+	// Leave both versions untouched and report the conflict
+	SkipConflicts ConflictPolicy = iota
+
+	// Overwrite the remote version with the local one
+	PreferLocal
+
+	// Overwrite the local version with the remote one
+	PreferRemote
+
+	// Keep the local version under a new name, "<name> (conflict <time>)"
+	KeepBoth
+)
+
+// Returned for an action whose If-Match precondition failed because the remote
+// path was modified after it was scanned
+var ErrConflict = errors.New("Remote path changed since it was last retrieved")
+
+// Returned for the deletion of a folder which was kept because some of its
+// contents failed to delete
+var ErrNotEmpty = errors.New("Not deleted as its contents failed to delete")
+
+// Synchronization options
+type Options struct {
+	Mode      Mode
+	Conflicts ConflictPolicy
+
+	// Location of the manifest, defaults to MANIFEST_NAME in the local directory
+	ManifestPath string
+
+	// Compute and return the actions without performing them
+	DryRun bool
+}
+
+// Syncer, mirrors LocalDir with the AeroFS folder FolderId
+type Syncer struct {
+	APIClient *api.Client
+	LocalDir  string
+	FolderId  string
+	Options   Options
+}
+
+// The outcome of a synchronization run
+type Report struct {
+	Actions []Action
+}
+
+// Return the actions which failed
+func (r *Report) Failed() []Action {
+	failed := []Action{}
+	for _, a := range r.Actions {
+		if a.Err != nil {
+			failed = append(failed, a)
+		}
+	}
+	return failed
+}
+
+// Return the conflicts which were not resolved by the conflict policy
+func (r *Report) Conflicts() []Action {
+	conflicts := []Action{}
+	for _, a := range r.Actions {
+		if a.Type == Conflict || a.Err == ErrConflict {
+			conflicts = append(conflicts, a)
+		}
+	}
+	return conflicts
+}
+
+// Construct a Syncer for a local directory and an AeroFS folder identifier
+func NewSyncer(c *api.Client, localDir, folderId string, opts Options) *Syncer {
+	if opts.ManifestPath == "" {
+		opts.ManifestPath = filepath.Join(localDir, MANIFEST_NAME)
+	}
+	return &Syncer{APIClient: c, LocalDir: localDir, FolderId: folderId, Options: opts}
+}
+
+// Perform a single synchronization run
+// Errors for individual paths are recorded in the report, an error is only
+// returned if either tree or the manifest could not be read
+func (s *Syncer) Run() (*Report, error) {
+	manifest, err := LoadManifest(s.Options.ManifestPath, s.FolderId)
+	if err != nil {
+		return nil, err
+	}
+
+	local, err := scanLocal(s.LocalDir, s.Options.ManifestPath, manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := scanRemote(s.APIClient, s.FolderId)
+	if err != nil {
+		return nil, err
+	}
+
+	actions := plan(local, remote, manifest, s.Options, time.Now())
+	report := Report{Actions: actions}
+	if s.Options.DryRun {
+		return &report, nil
+	}
+
+	a := applier{
+		syncer:   s,
+		local:    local,
+		remote:   remote,
+		manifest: manifest,
+		folders:  remoteFolders(remote, s.FolderId),
+	}
+	a.apply(report.Actions)
+
+	return &report, manifest.Save(s.Options.ManifestPath)
+}
@@ -0,0 +1,162 @@
+package aerofssync
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// These tests exercise the planner and local actions, and do not require an
+// AeroFS Appliance
+
+var now = time.Date(2015, 7, 1, 12, 0, 0, 0, time.UTC)
+
+// Return the types of a list of actions keyed by path
+func actionTypes(actions []Action) map[string]ActionType {
+	types := map[string]ActionType{}
+	for _, a := range actions {
+		types[a.Path] = a.Type
+	}
+	return types
+}
+
+// A manifest describing a single synchronized file "a/b.txt"
+func syncedManifest() *Manifest {
+	return &Manifest{FolderId: "root", Entries: map[string]Entry{
+		"a":       {IsDir: true, Id: "f1"},
+		"a/b.txt": {Id: "f2", Etag: "e1", Size: 3, ModTime: now, Hash: "h1"},
+	}}
+}
+
+func syncedTrees() (map[string]localEntry, map[string]remoteEntry) {
+	local := map[string]localEntry{
+		"a":       {IsDir: true},
+		"a/b.txt": {Size: 3, ModTime: now, Hash: "h1"},
+	}
+	remote := map[string]remoteEntry{
+		"a":       {IsDir: true, Id: "f1"},
+		"a/b.txt": {Id: "f2", Etag: "e1", Size: 3},
+	}
+	return local, remote
+}
+
+func TestPlanUnchanged(t *testing.T) {
+	local, remote := syncedTrees()
+	actions := plan(local, remote, syncedManifest(), Options{Mode: TwoWay}, now)
+	if len(actions) != 0 {
+		t.Fatalf("Expected no actions, got %v", actions)
+	}
+}
+
+func TestPlanLocalChange(t *testing.T) {
+	local, remote := syncedTrees()
+	local["a/b.txt"] = localEntry{Size: 4, ModTime: now, Hash: "h2"}
+	local["a/c"] = localEntry{IsDir: true}
+
+	types := actionTypes(plan(local, remote, syncedManifest(), Options{Mode: TwoWay}, now))
+	if types["a/b.txt"] != Upload || types["a/c"] != CreateRemoteFolder {
+		t.Fatalf("Unexpected actions %v", types)
+	}
+
+	// Pull mode ignores local changes
+	actions := plan(local, remote, syncedManifest(), Options{Mode: Pull}, now)
+	if len(actions) != 0 {
+		t.Fatalf("Expected no actions in pull mode, got %v", actions)
+	}
+}
+
+func TestPlanRemoteDelete(t *testing.T) {
+	local, remote := syncedTrees()
+	delete(remote, "a")
+	delete(remote, "a/b.txt")
+
+	actions := plan(local, remote, syncedManifest(), Options{Mode: TwoWay}, now)
+	types := actionTypes(actions)
+	if types["a"] != DeleteLocal || types["a/b.txt"] != DeleteLocal {
+		t.Fatalf("Unexpected actions %v", actions)
+	}
+}
+
+// A folder deleted remotely is recreated if a local file within it changed
+func TestPlanRemoteDeleteWithLocalChange(t *testing.T) {
+	local, remote := syncedTrees()
+	delete(remote, "a")
+	delete(remote, "a/b.txt")
+	local["a/b.txt"] = localEntry{Size: 4, ModTime: now, Hash: "h2"}
+
+	opts := Options{Mode: TwoWay, Conflicts: PreferLocal}
+	types := actionTypes(plan(local, remote, syncedManifest(), opts, now))
+	if types["a"] != CreateRemoteFolder || types["a/b.txt"] != Upload {
+		t.Fatalf("Unexpected actions %v", types)
+	}
+}
+
+func TestPlanConflicts(t *testing.T) {
+	local, remote := syncedTrees()
+	local["a/b.txt"] = localEntry{Size: 4, ModTime: now, Hash: "h2"}
+	remote["a/b.txt"] = remoteEntry{Id: "f2", Etag: "e2", Size: 5}
+
+	policies := map[ConflictPolicy]ActionType{
+		SkipConflicts: Conflict,
+		PreferLocal:   Upload,
+		PreferRemote:  Download,
+		KeepBoth:      Download,
+	}
+	for policy, expected := range policies {
+		opts := Options{Mode: TwoWay, Conflicts: policy}
+		actions := plan(local, remote, syncedManifest(), opts, now)
+		types := actionTypes(actions)
+		if types["a/b.txt"] != expected {
+			t.Fatalf("Policy %d : expected %s, got %v", policy, expected, actions)
+		}
+		if policy == KeepBoth && types[conflictName("a/b.txt", now)] != Upload {
+			t.Fatalf("Conflicting local file was not kept : %v", actions)
+		}
+	}
+}
+
+// Files present on both sides before the first run are matched by size and
+// modification time
+func TestPlanFirstRun(t *testing.T) {
+	local, remote := syncedTrees()
+	remote["a/b.txt"] = remoteEntry{Id: "f2", Etag: "e1", Size: 3,
+		LastModified: now.Format(time.RFC3339)}
+	empty := &Manifest{FolderId: "root", Entries: map[string]Entry{}}
+
+	types := actionTypes(plan(local, remote, empty, Options{Mode: TwoWay}, now))
+	if types["a"] != Track || types["a/b.txt"] != Track {
+		t.Fatalf("Unexpected actions %v", types)
+	}
+}
+
+// A folder is kept when some of its contents failed to delete
+func TestApplyKeepsParentOfFailedDelete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aerofssync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The untracked file prevents "a/c" from being removed
+	err = os.MkdirAll(filepath.Join(dir, "a", "c"), 0755)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "a", "c", "untracked"), []byte("x"), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := applier{syncer: &Syncer{LocalDir: dir},
+		manifest: &Manifest{Entries: map[string]Entry{}}}
+	actions := []Action{
+		{Type: DeleteLocal, IsDir: true, Path: "a"},
+		{Type: DeleteLocal, IsDir: true, Path: "a/c"},
+	}
+	a.apply(actions)
+
+	if actions[1].Err == nil || actions[0].Err != ErrNotEmpty {
+		t.Fatalf("Unexpected outcomes %v, %v", actions[1].Err, actions[0].Err)
+	}
+}
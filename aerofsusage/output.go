@@ -0,0 +1,154 @@
+package aerofsusage
+
+// Text, JSON and CSV output of a report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// The tables of a report which can be written as CSV
+var CSV_TABLES = []string{"folders", "shares", "owners", "mime_types", "largest", "oldest", "empty_folders"}
+
+// Format a number of bytes with a binary unit, ie. "1.5 GiB"
+func FormatSize(size int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d B", size)
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
+
+// Name a folder by its tree and path
+func folderName(tree, p string) string {
+	return strings.TrimSuffix(tree+"/"+p, "/")
+}
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// Write the report as aligned tables, folders are limited to the top entries
+func (r *Report) WriteText(w io.Writer, top int) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	section := func(title string) {
+		fmt.Fprintf(tw, "\n%s\t\t\t\n", title)
+	}
+
+	fmt.Fprintf(tw, "Total\t%s\t%d files\t\n", FormatSize(r.Size), r.Files)
+
+	section("Folders")
+	for i, f := range r.Folders {
+		if top > 0 && i == top {
+			break
+		}
+		fmt.Fprintf(tw, "%s\t%d files\t%s\t\n", FormatSize(f.Size), f.Files, folderName(f.Tree, f.Path))
+	}
+
+	if len(r.Shares) > 0 {
+		section("Shared folders")
+		for _, s := range r.Shares {
+			fmt.Fprintf(tw, "%s\t%d files\t%s (%s)\t\n", FormatSize(s.Size), s.Files, s.Name,
+				strings.Join(s.Owners, ", "))
+		}
+	}
+
+	if len(r.Owners) > 0 {
+		section("Owners")
+		for _, o := range r.Owners {
+			fmt.Fprintf(tw, "%s\t%d files\t%s\t\n", FormatSize(o.Size), o.Files, o.Email)
+		}
+	}
+
+	section("MIME types")
+	for _, m := range r.MimeTypes {
+		fmt.Fprintf(tw, "%s\t%d files\t%s\t\n", FormatSize(m.Size), m.Files, m.Mime)
+	}
+
+	section("Largest files")
+	for _, f := range r.Largest {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t\n", FormatSize(int64(f.Size)), f.LastModified, folderName(f.Tree, f.Path))
+	}
+
+	section("Oldest files")
+	for _, f := range r.Oldest {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t\n", FormatSize(int64(f.Size)), f.LastModified, folderName(f.Tree, f.Path))
+	}
+
+	section("Empty folders")
+	for _, f := range r.EmptyFolders {
+		fmt.Fprintf(tw, "\t\t%s\t\n", folderName(f.Tree, f.Path))
+	}
+
+	for _, f := range r.Failures {
+		fmt.Fprintf(tw, "\nunable to list %s : %s\t\t\t\n", f.Item, f.Error)
+	}
+	return tw.Flush()
+}
+
+// Write one table of the report as CSV with a header row, the table is one of
+// CSV_TABLES
+func (r *Report) WriteCSV(w io.Writer, table string) error {
+	rows := [][]string{}
+	files := func(entries []FileEntry) {
+		rows = append(rows, []string{"tree", "path", "id", "size", "last_modified", "mime_type"})
+		for _, f := range entries {
+			rows = append(rows, []string{f.Tree, f.Path, f.Id, fmt.Sprint(f.Size), f.LastModified, f.Mime})
+		}
+	}
+
+	switch table {
+	case "folders":
+		rows = append(rows, []string{"tree", "path", "size", "files"})
+		for _, f := range r.Folders {
+			rows = append(rows, []string{f.Tree, f.Path, fmt.Sprint(f.Size), fmt.Sprint(f.Files)})
+		}
+	case "shares":
+		rows = append(rows, []string{"id", "name", "owners", "size", "files"})
+		for _, s := range r.Shares {
+			rows = append(rows, []string{s.Id, s.Name, strings.Join(s.Owners, " "),
+				fmt.Sprint(s.Size), fmt.Sprint(s.Files)})
+		}
+	case "owners":
+		rows = append(rows, []string{"email", "size", "files"})
+		for _, o := range r.Owners {
+			rows = append(rows, []string{o.Email, fmt.Sprint(o.Size), fmt.Sprint(o.Files)})
+		}
+	case "mime_types":
+		rows = append(rows, []string{"mime_type", "size", "files"})
+		for _, m := range r.MimeTypes {
+			rows = append(rows, []string{m.Mime, fmt.Sprint(m.Size), fmt.Sprint(m.Files)})
+		}
+	case "largest":
+		files(r.Largest)
+	case "oldest":
+		files(r.Oldest)
+	case "empty_folders":
+		rows = append(rows, []string{"tree", "path"})
+		for _, f := range r.EmptyFolders {
+			rows = append(rows, []string{f.Tree, f.Path})
+		}
+	default:
+		return errors.New("Unknown table " + table)
+	}
+
+	cw := csv.NewWriter(w)
+	cw.WriteAll(rows)
+	return cw.Error()
+}
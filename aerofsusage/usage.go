@@ -0,0 +1,343 @@
+package aerofsusage
+
+// Storage usage of AeroFS folder trees, aggregated per folder, shared folder,
+// owner and MIME type
+
+import (
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The number of largest and oldest files reported by default
+const DEFAULT_TOP = 20
+
+// Options for the analysis
+type Options struct {
+	// The number of largest and oldest files reported, DEFAULT_TOP if 0
+	Top int
+
+	// Folders deeper than this are aggregated into their ancestors without
+	// being reported, all folders are reported if 0
+	MaxDepth int
+
+	// Tokens of the users whose root folders are analyzed by Analyze, by email
+	UserTokens map[string]string
+
+	// Called with progress messages, may be nil
+	Log func(format string, args ...interface{})
+}
+
+// The size and number of files below an item
+type Usage struct {
+	Size  int64 `json:"size"`
+	Files int   `json:"files"`
+}
+
+func (u *Usage) add(size int) {
+	u.Size += int64(size)
+	u.Files++
+}
+
+// A folder and everything below it
+type FolderUsage struct {
+	// The tree the folder belongs to and its slash-separated path in it, the
+	// root of the tree has an empty path
+	Tree string `json:"tree"`
+	Path string `json:"path"`
+	Usage
+}
+
+type ShareUsage struct {
+	Id     string   `json:"id"`
+	Name   string   `json:"name"`
+	Owners []string `json:"owners"`
+	Usage
+}
+
+type OwnerUsage struct {
+	Email string `json:"email"`
+	Usage
+}
+
+type MimeUsage struct {
+	Mime string `json:"mime_type"`
+	Usage
+}
+
+type FileEntry struct {
+	Tree         string `json:"tree"`
+	Path         string `json:"path"`
+	Id           string `json:"id"`
+	Size         int    `json:"size"`
+	LastModified string `json:"last_modified"`
+	Mime         string `json:"mime_type"`
+}
+
+type FolderEntry struct {
+	Tree string `json:"tree"`
+	Path string `json:"path"`
+}
+
+// The result of an analysis, lists are sorted by decreasing size or age
+type Report struct {
+	Generated string `json:"generated"`
+	Usage
+
+	Folders      []FolderUsage `json:"folders"`
+	Shares       []ShareUsage  `json:"shares"`
+	Owners       []OwnerUsage  `json:"owners"`
+	MimeTypes    []MimeUsage   `json:"mime_types"`
+	Largest      []FileEntry   `json:"largest"`
+	Oldest       []FileEntry   `json:"oldest"`
+	EmptyFolders []FolderEntry `json:"empty_folders"`
+	Failures     []sdk.Failure `json:"failures"`
+}
+
+// Accumulates the entries of trees into a report
+type analyzer struct {
+	opts   Options
+	report Report
+
+	folders  map[string]*FolderUsage
+	owners   map[string]*Usage
+	mime     map[string]*Usage
+	files    []FileEntry
+	children map[string]int
+}
+
+func newAnalyzer(opts Options) *analyzer {
+	if opts.Top <= 0 {
+		opts.Top = DEFAULT_TOP
+	}
+	return &analyzer{opts: opts,
+		report:   Report{Failures: []sdk.Failure{}},
+		folders:  map[string]*FolderUsage{},
+		owners:   map[string]*Usage{},
+		mime:     map[string]*Usage{},
+		files:    []FileEntry{},
+		children: map[string]int{}}
+}
+
+func folderKey(tree, p string) string {
+	return tree + "\x00" + p
+}
+
+func parentDir(p string) string {
+	dir := path.Dir(p)
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+func depth(p string) int {
+	if p == "" {
+		return 0
+	}
+	return strings.Count(p, "/") + 1
+}
+
+// Record a folder so it is reported even if it stays empty
+func (a *analyzer) addFolder(tree, p string) {
+	key := folderKey(tree, p)
+	if _, ok := a.folders[key]; ok {
+		return
+	}
+	a.folders[key] = &FolderUsage{Tree: tree, Path: p}
+	if p != "" {
+		a.children[folderKey(tree, parentDir(p))]++
+	}
+}
+
+// Record a file in its folder and every ancestor, and for each owner of the
+// tree it belongs to
+func (a *analyzer) addFile(tree string, owners []string, f FileEntry) {
+	a.report.add(f.Size)
+	a.files = append(a.files, f)
+	a.children[folderKey(tree, parentDir(f.Path))]++
+
+	for dir := parentDir(f.Path); ; dir = parentDir(dir) {
+		a.addFolder(tree, dir)
+		a.folders[folderKey(tree, dir)].add(f.Size)
+		if dir == "" {
+			break
+		}
+	}
+
+	for _, email := range owners {
+		if _, ok := a.owners[email]; !ok {
+			a.owners[email] = &Usage{}
+		}
+		a.owners[email].add(f.Size)
+	}
+
+	mime := f.Mime
+	if mime == "" {
+		mime = "unknown"
+	}
+	if _, ok := a.mime[mime]; !ok {
+		a.mime[mime] = &Usage{}
+	}
+	a.mime[mime].add(f.Size)
+}
+
+// Add the records of a tree from a catalog
+func (a *analyzer) addRecords(tree string, owners []string, records []sdk.FileRecord) Usage {
+	usage := Usage{}
+	a.addFolder(tree, "")
+	for _, r := range records {
+		if r.IsDir {
+			a.addFolder(tree, r.Path)
+			continue
+		}
+		usage.add(r.Size)
+		a.addFile(tree, owners, FileEntry{Tree: tree, Path: r.Path, Id: r.Id,
+			Size: r.Size, LastModified: r.LastModified, Mime: r.Mime})
+	}
+	return usage
+}
+
+// Walk a tree, failures to list folders are reported and the walk continues
+func (a *analyzer) walk(c *api.Client, folderId, tree string) {
+	a.addFolder(tree, "")
+	root := sdk.FolderClient{APIClient: c, Desc: sdk.Folder{Id: folderId}}
+	err := root.Walk(func(entry sdk.TreeEntry, err error) error {
+		switch {
+		case err != nil:
+			a.report.Failures = append(a.report.Failures,
+				sdk.Failure{Item: tree + ": " + entry.Path, Error: err.Error()})
+		case entry.IsDir:
+			a.addFolder(tree, entry.Path)
+		default:
+			a.addFile(tree, nil, FileEntry{Tree: tree, Path: entry.Path,
+				Id: entry.File.Id, Size: entry.File.Size,
+				LastModified: entry.File.LastModified, Mime: entry.File.Mime})
+		}
+		return nil
+	})
+	if err != nil {
+		a.report.Failures = append(a.report.Failures, sdk.Failure{Item: tree, Error: err.Error()})
+	}
+}
+
+// Return the members of a share with the MANAGE permission
+func shareOwners(members []api.SFMember) []string {
+	owners := []string{}
+	for _, m := range members {
+		if m.Permissions.Contains(api.PermissionManage) {
+			owners = append(owners, m.Email)
+		}
+	}
+	sort.Strings(owners)
+	return owners
+}
+
+// Parse a last_modified timestamp, unparseable ones sort as the newest
+func modified(f FileEntry) time.Time {
+	t, err := time.Parse(time.RFC3339, f.LastModified)
+	if err != nil {
+		return time.Unix(1<<62, 0)
+	}
+	return t
+}
+
+// Sort the aggregates and select the largest and oldest files
+func (a *analyzer) finish() *Report {
+	r := &a.report
+	r.Generated = time.Now().UTC().Format(time.RFC3339)
+
+	r.Folders = []FolderUsage{}
+	r.EmptyFolders = []FolderEntry{}
+	for key, f := range a.folders {
+		if a.opts.MaxDepth == 0 || depth(f.Path) <= a.opts.MaxDepth {
+			r.Folders = append(r.Folders, *f)
+		}
+		if a.children[key] == 0 {
+			r.EmptyFolders = append(r.EmptyFolders, FolderEntry{Tree: f.Tree, Path: f.Path})
+		}
+	}
+	sort.Slice(r.Folders, func(i, j int) bool {
+		if r.Folders[i].Size != r.Folders[j].Size {
+			return r.Folders[i].Size > r.Folders[j].Size
+		}
+		return folderKey(r.Folders[i].Tree, r.Folders[i].Path) < folderKey(r.Folders[j].Tree, r.Folders[j].Path)
+	})
+	sort.Slice(r.EmptyFolders, func(i, j int) bool {
+		return folderKey(r.EmptyFolders[i].Tree, r.EmptyFolders[i].Path) <
+			folderKey(r.EmptyFolders[j].Tree, r.EmptyFolders[j].Path)
+	})
+
+	sort.Slice(r.Shares, func(i, j int) bool { return r.Shares[i].Size > r.Shares[j].Size })
+
+	r.Owners = []OwnerUsage{}
+	for email, u := range a.owners {
+		r.Owners = append(r.Owners, OwnerUsage{email, *u})
+	}
+	sort.Slice(r.Owners, func(i, j int) bool {
+		if r.Owners[i].Size != r.Owners[j].Size {
+			return r.Owners[i].Size > r.Owners[j].Size
+		}
+		return r.Owners[i].Email < r.Owners[j].Email
+	})
+
+	r.MimeTypes = []MimeUsage{}
+	for mime, u := range a.mime {
+		r.MimeTypes = append(r.MimeTypes, MimeUsage{mime, *u})
+	}
+	sort.Slice(r.MimeTypes, func(i, j int) bool {
+		if r.MimeTypes[i].Size != r.MimeTypes[j].Size {
+			return r.MimeTypes[i].Size > r.MimeTypes[j].Size
+		}
+		return r.MimeTypes[i].Mime < r.MimeTypes[j].Mime
+	})
+
+	top := a.opts.Top
+	if top > len(a.files) {
+		top = len(a.files)
+	}
+	sort.SliceStable(a.files, func(i, j int) bool { return a.files[i].Size > a.files[j].Size })
+	r.Largest = append([]FileEntry{}, a.files[:top]...)
+	sort.SliceStable(a.files, func(i, j int) bool { return modified(a.files[i]).Before(modified(a.files[j])) })
+	r.Oldest = append([]FileEntry{}, a.files[:top]...)
+	return r
+}
+
+// Analyze the tree below a folder, the root folder of the token's user if the
+// identifier is "root". Per-owner usage is not computed
+func AnalyzeFolder(c *api.Client, folderId string, opts Options) *Report {
+	a := newAnalyzer(opts)
+	a.report.Shares = []ShareUsage{}
+	a.walk(c, folderId, folderId)
+	return a.finish()
+}
+
+// Analyze the shared folders and root folders recorded in a catalog, either
+// a backup or an inventory. Each share counts towards all its owners
+func AnalyzeCatalog(catalog *sdk.Catalog, opts Options) *Report {
+	a := newAnalyzer(opts)
+	a.report.Failures = append(a.report.Failures, catalog.Failures...)
+	a.report.Shares = []ShareUsage{}
+	for _, s := range catalog.Shares {
+		owners := shareOwners(s.Members)
+		usage := a.addRecords("share:"+s.Name, owners, s.Files)
+		a.report.Shares = append(a.report.Shares, ShareUsage{s.Id, s.Name, owners, usage})
+	}
+	for _, r := range catalog.Roots {
+		a.addRecords("root:"+r.Email, []string{r.Email}, r.Files)
+	}
+	return a.finish()
+}
+
+// Analyze every shared folder of the organization with an admin token, and
+// the root folders of the users with a token
+func Analyze(c *api.Client, opts Options) (*Report, error) {
+	catalog, err := sdk.Inventory(c, sdk.InventoryOptions{UserTokens: opts.UserTokens, Log: opts.Log})
+	if err != nil {
+		return nil, err
+	}
+	return AnalyzeCatalog(catalog, opts), nil
+}
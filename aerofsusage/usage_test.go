@@ -0,0 +1,116 @@
+package aerofsusage
+
+import (
+	"bytes"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"strings"
+	"testing"
+)
+
+func testCatalog() *sdk.Catalog {
+	return &sdk.Catalog{
+		Shares: []sdk.ShareRecord{{
+			Id:   "s1",
+			Name: "Maps",
+			Members: []api.SFMember{
+				{Email: "frodo@shire.me", Permissions: api.PermissionSet{"WRITE", "MANAGE"}},
+				{Email: "sam@shire.me", Permissions: api.PermissionSet{"WRITE"}},
+			},
+			Files: []sdk.FileRecord{
+				{Path: "Mordor", IsDir: true},
+				{Path: "Mordor/Doom", IsDir: true},
+				{Path: "Mordor/Doom/route.png", Size: 3000, Mime: "image/png",
+					LastModified: "2014-03-25T12:00:00Z"},
+				{Path: "Mordor/gate.txt", Size: 100, Mime: "text/plain",
+					LastModified: "2013-09-22T12:00:00Z"},
+				{Path: "Rivendell", IsDir: true},
+			},
+		}},
+		Roots: []sdk.RootRecord{{Email: "sam@shire.me", Files: []sdk.FileRecord{
+			{Path: "recipes.txt", Size: 20, Mime: "text/plain", LastModified: "2015-01-01T00:00:00Z"},
+		}}},
+	}
+}
+
+func TestAnalyzeCatalog(t *testing.T) {
+	r := AnalyzeCatalog(testCatalog(), Options{Top: 2})
+
+	if r.Size != 3120 || r.Files != 3 {
+		t.Errorf("Expected 3120 bytes in 3 files, got %d in %d", r.Size, r.Files)
+	}
+
+	sizes := map[string]int64{}
+	for _, f := range r.Folders {
+		sizes[folderName(f.Tree, f.Path)] = f.Size
+	}
+	expected := map[string]int64{"share:Maps": 3100, "share:Maps/Mordor": 3100,
+		"share:Maps/Mordor/Doom": 3000, "share:Maps/Rivendell": 0, "root:sam@shire.me": 20}
+	for name, size := range expected {
+		if sizes[name] != size {
+			t.Errorf("Expected %d bytes in %s, got %d", size, name, sizes[name])
+		}
+	}
+
+	if len(r.Shares) != 1 || r.Shares[0].Size != 3100 || strings.Join(r.Shares[0].Owners, ",") != "frodo@shire.me" {
+		t.Errorf("Unexpected shares %+v", r.Shares)
+	}
+	if len(r.Owners) != 2 || r.Owners[0].Email != "frodo@shire.me" || r.Owners[1].Size != 20 {
+		t.Errorf("Unexpected owners %+v", r.Owners)
+	}
+	if len(r.MimeTypes) != 2 || r.MimeTypes[0].Mime != "image/png" || r.MimeTypes[1].Files != 2 {
+		t.Errorf("Unexpected MIME types %+v", r.MimeTypes)
+	}
+
+	if len(r.Largest) != 2 || r.Largest[0].Path != "Mordor/Doom/route.png" || r.Largest[1].Path != "Mordor/gate.txt" {
+		t.Errorf("Unexpected largest files %+v", r.Largest)
+	}
+	if len(r.Oldest) != 2 || r.Oldest[0].Path != "Mordor/gate.txt" || r.Oldest[1].Path != "Mordor/Doom/route.png" {
+		t.Errorf("Unexpected oldest files %+v", r.Oldest)
+	}
+
+	if len(r.EmptyFolders) != 1 || r.EmptyFolders[0].Path != "Rivendell" {
+		t.Errorf("Unexpected empty folders %+v", r.EmptyFolders)
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	r := AnalyzeCatalog(testCatalog(), Options{MaxDepth: 1})
+	for _, f := range r.Folders {
+		if depth(f.Path) > 1 {
+			t.Errorf("Folder %s is deeper than the maximum depth", f.Path)
+		}
+	}
+	if r.Size != 3120 {
+		t.Errorf("Deep folders must still count towards the total")
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	r := AnalyzeCatalog(testCatalog(), Options{})
+	for _, table := range CSV_TABLES {
+		buffer := bytes.Buffer{}
+		err := r.WriteCSV(&buffer, table)
+		if err != nil || buffer.Len() == 0 {
+			t.Errorf("Unable to write table %s : %v", table, err)
+		}
+	}
+
+	buffer := bytes.Buffer{}
+	r.WriteCSV(&buffer, "owners")
+	if buffer.String() != "email,size,files\nfrodo@shire.me,3100,2\nsam@shire.me,20,1\n" {
+		t.Errorf("Unexpected owners table %q", buffer.String())
+	}
+	if r.WriteCSV(&buffer, "palantir") == nil {
+		t.Errorf("Expected an error for an unknown table")
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	cases := map[int64]string{0: "0 B", 1023: "1023 B", 1536: "1.5 KiB", 5 << 30: "5.0 GiB"}
+	for size, expected := range cases {
+		if FormatSize(size) != expected {
+			t.Errorf("Expected %s for %d, got %s", expected, size, FormatSize(size))
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package aerofswatch
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// A file or folder as seen by a single poll
+type Node struct {
+	Id       string `json:"id"`
+	ParentId string `json:"parent"`
+	Name     string `json:"name"`
+	IsDir    bool   `json:"is_dir,omitempty"`
+
+	// The slash-separated path relative to the watched folder
+	Path string `json:"path"`
+
+	// The file ETag, or for folders the ETag of its metadata and children
+	Etag string `json:"etag"`
+
+	Size         int    `json:"size,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// The state of a watched folder tree, nodes are keyed by identifier so moves
+// and renames can be told apart from deletions
+type Snapshot struct {
+	FolderId string          `json:"folder_id"`
+	Etag     string          `json:"etag"`
+	Nodes    map[string]Node `json:"nodes"`
+}
+
+func newSnapshot(folderId string) *Snapshot {
+	return &Snapshot{FolderId: folderId, Nodes: map[string]Node{}}
+}
+
+// Read a persisted snapshot, nil is returned if none exists
+func LoadSnapshot(fileName string) (*Snapshot, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.New("Unable to read the persisted snapshot")
+	}
+
+	s := Snapshot{}
+	err = json.Unmarshal(data, &s)
+	if err != nil || s.Nodes == nil {
+		return nil, errors.New("Unable to unmarshal the persisted snapshot")
+	}
+	return &s, nil
+}
+
+// Persist the snapshot, replacing any previous one atomically
+func (s *Snapshot) Save(fileName string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return errors.New("Unable to marshal the snapshot")
+	}
+
+	tmpName := fileName + ".tmp"
+	err = ioutil.WriteFile(tmpName, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpName, fileName)
+}
+
+// Return the direct children of every folder in the snapshot
+func (s *Snapshot) children() map[string][]Node {
+	children := map[string][]Node{}
+	for _, n := range s.Nodes {
+		children[n.ParentId] = append(children[n.ParentId], n)
+	}
+	return children
+}
+
+// Compute the events which transform one snapshot into another
+func Diff(old, new *Snapshot) []Event {
+	events := []Event{}
+	for id, n := range new.Nodes {
+		o, ok := old.Nodes[id]
+		switch {
+		case !ok:
+			events = append(events, Event{Type: Created, Node: n})
+			continue
+		case o.Path != n.Path:
+			events = append(events, Event{Type: Moved, Node: n, OldPath: o.Path})
+		}
+
+		if !n.IsDir && (o.Etag != n.Etag || o.Size != n.Size) {
+			events = append(events, Event{Type: Modified, Node: n})
+		}
+	}
+
+	for id, o := range old.Nodes {
+		if _, ok := new.Nodes[id]; !ok {
+			events = append(events, Event{Type: Deleted, Node: o})
+		}
+	}
+
+	sort.Sort(byPath(events))
+	return events
+}
+
+// Events are ordered by type, then path
+type byPath []Event
+
+func (e byPath) Len() int      { return len(e) }
+func (e byPath) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+func (e byPath) Less(i, j int) bool {
+	if e[i].Type != e[j].Type {
+		return e[i].Type < e[j].Type
+	}
+	return e[i].Path < e[j].Path
+}
@@ -0,0 +1,266 @@
+package aerofswatch
+
+// The AeroFS API does not push notifications of changes, a Watcher polls a
+// folder tree instead. Every folder is retrieved conditionally on its ETag so
+// unchanged folders cost a single "304 Not Modified" response
+
+import (
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"path"
+	"sync"
+	"time"
+)
+
+// Default polling parameters
+const (
+	DEFAULT_INTERVAL     = 30 * time.Second
+	DEFAULT_MAX_INTERVAL = 10 * time.Minute
+)
+
+// The kind of change observed between two polls
+type EventType int
+
+const (
+	Created EventType = iota
+	Modified
+	Moved
+	Deleted
+)
+
+var eventNames = []string{"created", "modified", "moved", "deleted"}
+
+func (t EventType) String() string {
+	if int(t) < len(eventNames) {
+		return eventNames[t]
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// A change to a file or folder, the Node describes its new state or for
+// deletions its last known state
+type Event struct {
+	Type EventType
+	Node
+
+	// The previous path of a moved or renamed node
+	OldPath string
+}
+
+func (e Event) String() string {
+	if e.Type == Moved {
+		return fmt.Sprintf("%s %s -> %s", e.Type, e.OldPath, e.Path)
+	}
+	return fmt.Sprintf("%s %s", e.Type, e.Path)
+}
+
+// Polling options
+type Options struct {
+	// Delay between polls, defaults to DEFAULT_INTERVAL
+	Interval time.Duration
+
+	// The upper bound of the delay when backing off, defaults to
+	// DEFAULT_MAX_INTERVAL
+	MaxInterval time.Duration
+
+	// A poll taking longer than this is considered slow and doubles the delay
+	// before the next one. Defaults to half of Interval
+	SlowThreshold time.Duration
+
+	// If set, the last snapshot is persisted here after every poll and loaded
+	// on construction, so changes made while not running are reported
+	SnapshotPath string
+}
+
+// Watcher, polls a folder tree and emits the changes it observes
+type Watcher struct {
+	APIClient *api.Client
+	FolderId  string
+	Options   Options
+
+	// Changes are sent on Events, failed polls on Errors. Both must be drained
+	// while the watcher is running
+	Events chan Event
+	Errors chan error
+
+	snapshot *Snapshot
+	stop     chan struct{}
+	done     sync.WaitGroup
+}
+
+// Construct a Watcher for a folder, loading its persisted snapshot if any
+func NewWatcher(c *api.Client, folderId string, opts Options) (*Watcher, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = DEFAULT_INTERVAL
+	}
+	if opts.MaxInterval < opts.Interval {
+		opts.MaxInterval = DEFAULT_MAX_INTERVAL
+		if opts.MaxInterval < opts.Interval {
+			opts.MaxInterval = opts.Interval
+		}
+	}
+	if opts.SlowThreshold <= 0 {
+		opts.SlowThreshold = opts.Interval / 2
+	}
+
+	w := Watcher{APIClient: c, FolderId: folderId, Options: opts,
+		Events: make(chan Event, 64),
+		Errors: make(chan error, 1),
+		stop:   make(chan struct{}),
+	}
+
+	if opts.SnapshotPath != "" {
+		s, err := LoadSnapshot(opts.SnapshotPath)
+		if err != nil {
+			return nil, err
+		}
+		if s != nil && s.FolderId == folderId {
+			w.snapshot = s
+		}
+	}
+	return &w, nil
+}
+
+// Return the most recent snapshot, nil if the folder has not been polled
+func (w *Watcher) Snapshot() *Snapshot {
+	return w.snapshot
+}
+
+// Retrieve the current state of the tree and return the changes since the
+// previous poll. The first poll without a persisted snapshot returns no events
+func (w *Watcher) Poll() ([]Event, error) {
+	old := w.snapshot
+	if old == nil {
+		old = newSnapshot(w.FolderId)
+	}
+
+	current := newSnapshot(w.FolderId)
+	root := Node{Id: w.FolderId, IsDir: true, Etag: old.Etag}
+	etag, err := w.pollFolder(root, old, old.children(), current)
+	if err != nil {
+		return nil, err
+	}
+	current.Etag = etag
+
+	events := []Event{}
+	if w.snapshot != nil {
+		events = Diff(w.snapshot, current)
+	}
+	w.snapshot = current
+
+	if w.Options.SnapshotPath != "" {
+		err = current.Save(w.Options.SnapshotPath)
+	}
+	return events, err
+}
+
+// Add a folder's children to the new snapshot and recurse into its
+// subfolders. The previous children are reused if the folder is unchanged
+// Returns the current ETag of the folder
+func (w *Watcher) pollFolder(folder Node, old *Snapshot, oldChildren map[string][]Node, current *Snapshot) (string, error) {
+	fc := sdk.FolderClient{APIClient: w.APIClient,
+		Desc:     sdk.Folder{Id: folder.Id, Etag: folder.Etag},
+		OnDemand: []string{"children"}}
+
+	modified := true
+	var err error
+	if folder.Etag == "" {
+		err = fc.LoadMetadata()
+	} else {
+		modified, err = fc.LoadMetadataIfModified()
+	}
+	if err != nil {
+		return "", err
+	}
+
+	children := oldChildren[folder.Id]
+	if modified {
+		children = []Node{}
+		for _, f := range fc.Desc.ChildList.Files {
+			children = append(children, Node{Id: f.Id, Name: f.Name, Etag: f.Etag,
+				Size: f.Size, LastModified: f.LastModified})
+		}
+		for _, f := range fc.Desc.ChildList.Folders {
+			n := Node{Id: f.Id, Name: f.Name, IsDir: true}
+			// Keep the previous ETag so the subfolder is retrieved conditionally
+			if prev, ok := old.Nodes[f.Id]; ok && prev.IsDir {
+				n.Etag = prev.Etag
+			}
+			children = append(children, n)
+		}
+	}
+
+	for _, n := range children {
+		n.ParentId = folder.Id
+		n.Path = path.Join(folder.Path, n.Name)
+		if n.IsDir {
+			n.Etag, err = w.pollFolder(n, old, oldChildren, current)
+			if err != nil {
+				return "", err
+			}
+		}
+		current.Nodes[n.Id] = n
+	}
+	return fc.Desc.Etag, nil
+}
+
+// Poll the folder in the background until Stop is called
+func (w *Watcher) Start() {
+	w.done.Add(1)
+	go w.run()
+}
+
+// Stop polling and close the Events and Errors channels, the watcher cannot
+// be started again
+func (w *Watcher) Stop() {
+	close(w.stop)
+	w.done.Wait()
+	close(w.Events)
+	close(w.Errors)
+}
+
+func (w *Watcher) run() {
+	defer w.done.Done()
+	interval := w.Options.Interval
+
+	for {
+		start := time.Now()
+		events, err := w.Poll()
+		if err != nil {
+			select {
+			case w.Errors <- err:
+			case <-w.stop:
+				return
+			}
+		}
+		for _, e := range events {
+			select {
+			case w.Events <- e:
+			case <-w.stop:
+				return
+			}
+		}
+
+		interval = w.nextInterval(interval, time.Since(start), err)
+		select {
+		case <-time.After(interval):
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// Double the delay when a poll fails or the appliance is slow to respond,
+// return to the configured interval once it recovers
+func (w *Watcher) nextInterval(interval, elapsed time.Duration, err error) time.Duration {
+	if err == nil && elapsed <= w.Options.SlowThreshold {
+		return w.Options.Interval
+	}
+
+	interval *= 2
+	if interval > w.Options.MaxInterval {
+		interval = w.Options.MaxInterval
+	}
+	return interval
+}
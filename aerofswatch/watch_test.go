@@ -0,0 +1,76 @@
+package aerofswatch
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// These tests do not require an AeroFS Appliance
+
+func TestDiff(t *testing.T) {
+	old := newSnapshot("root")
+	old.Nodes = map[string]Node{
+		"d1": {Id: "d1", Path: "docs", IsDir: true},
+		"f1": {Id: "f1", Path: "docs/a.txt", Etag: "e1"},
+		"f2": {Id: "f2", Path: "docs/b.txt", Etag: "e1"},
+		"f3": {Id: "f3", Path: "c.txt", Etag: "e1"},
+	}
+
+	new := newSnapshot("root")
+	new.Nodes = map[string]Node{
+		"d1": {Id: "d1", Path: "docs", IsDir: true, Etag: "changed"},
+		"f1": {Id: "f1", Path: "docs/a.txt", Etag: "e2"},
+		"f2": {Id: "f2", Path: "b.txt", Etag: "e1"},
+		"f4": {Id: "f4", Path: "docs/d.txt", Etag: "e1"},
+	}
+
+	events := Diff(old, new)
+	expected := []string{"created docs/d.txt", "modified docs/a.txt",
+		"moved docs/b.txt -> b.txt", "deleted c.txt"}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, events)
+	}
+	for i, e := range events {
+		if e.String() != expected[i] {
+			t.Fatalf("Expected %v, got %v", expected, events)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	w, err := NewWatcher(nil, "root", Options{Interval: time.Second, MaxInterval: 3 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failure := errors.New("503 Service Unavailable")
+	interval := w.nextInterval(time.Second, 0, failure)
+	if interval != 2*time.Second {
+		t.Fatalf("Expected the interval to double, got %s", interval)
+	}
+	interval = w.nextInterval(interval, 0, failure)
+	if interval != 3*time.Second {
+		t.Fatalf("Expected the interval to be capped, got %s", interval)
+	}
+	interval = w.nextInterval(interval, time.Second, nil)
+	if interval != 3*time.Second {
+		t.Fatalf("Expected a slow poll to keep backing off, got %s", interval)
+	}
+	interval = w.nextInterval(interval, 0, nil)
+	if interval != time.Second {
+		t.Fatalf("Expected the interval to reset, got %s", interval)
+	}
+}
+
+// A watcher which was never started can be stopped
+func TestStopWithoutStart(t *testing.T) {
+	w, err := NewWatcher(nil, "root", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Stop()
+	if _, ok := <-w.Events; ok {
+		t.Errorf("Expected the Events channel to be closed")
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+// The entrypoint for aerogroupsync, reconciling AeroFS groups with a directory
+// export
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	groupsync "github.com/aerofs/aerofs-sdk-golang/aerofsgroupsync"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+// Global logger
+var logger = log.New(os.Stderr, "", log.LstdFlags)
+
+const USAGE = `Usage : AEROFS_TOKEN=<admin token> ./aerogroupsync -host <appliance> -source <groups.ldif|groups.csv|groups.json> [options]
+
+Options :
+  -apply              apply the changes, they are only printed otherwise
+  -delete-orphans     delete the groups which are not in the source
+  -max-remove <n>     refuse to remove more than n percent of the current members, 10 by default
+  -report <file>      where the report of applied changes is written as JSON`
+
+func exit(err error) {
+	fmt.Println(err)
+	os.Exit(1)
+}
+
+func main() {
+	host := flag.String("host", "", "hostname of the AeroFS Appliance")
+	sourceFile := flag.String("source", "", "LDIF, CSV or JSON file of the group memberships")
+	apply := flag.Bool("apply", false, "apply the changes")
+	deleteOrphans := flag.Bool("delete-orphans", false, "delete groups which are not in the source")
+	maxRemove := flag.Float64("max-remove", groupsync.DEFAULT_MAX_REMOVE_PERCENT, "percent of current members a run may remove")
+	reportFile := flag.String("report", "", "file the report is written to as JSON")
+	flag.Parse()
+
+	token := os.Getenv("AEROFS_TOKEN")
+	if *host == "" || *sourceFile == "" || token == "" || *maxRemove <= 0 {
+		fmt.Println(USAGE)
+		os.Exit(1)
+	}
+	c, _ := api.NewClient(token, *host)
+
+	source, err := groupsync.ReadFile(*sourceFile)
+	if err != nil {
+		exit(err)
+	}
+	for _, w := range source.Warnings {
+		logger.Println(w)
+	}
+	logger.Printf("Read %d groups with %d members", len(source.Groups), source.Members())
+
+	plan, err := groupsync.MakePlan(c, source, groupsync.Options{DeleteOrphans: *deleteOrphans})
+	if err != nil {
+		exit(err)
+	}
+	plan.WriteText(os.Stdout)
+
+	if !*apply {
+		if err = plan.CheckLimit(*maxRemove); err != nil {
+			fmt.Printf("%s, it would not be applied\n", err)
+		}
+		return
+	}
+
+	report, err := groupsync.Apply(c, plan, groupsync.ApplyOptions{MaxRemovePercent: *maxRemove,
+		Log: logger.Printf})
+	if err != nil {
+		exit(err)
+	}
+	fmt.Printf("Applied %d changes, %d failed.\n", len(report.Applied), len(report.Failures))
+	if *reportFile != "" {
+		data, _ := json.MarshalIndent(report, "", "  ")
+		if err = ioutil.WriteFile(*reportFile, data, 0600); err != nil {
+			exit(err)
+		}
+	}
+	if len(report.Failures) > 0 {
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+// The entrypoint for aeroinvite, inviting people to sign up in bulk and
+// following up on their invitations
+
+import (
+	"flag"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	invite "github.com/aerofs/aerofs-sdk-golang/aerofsinvite"
+	"log"
+	"os"
+	"time"
+)
+
+// Global logger
+var logger = log.New(os.Stderr, "", log.LstdFlags)
+
+const USAGE = `Usage : AEROFS_TOKEN=<admin token> ./aeroinvite -host <appliance> [options] invite|maintain|report
+
+Commands :
+  invite                  invite the people listed with -list to sign up
+  maintain                record sign ups, then re-send or revoke stale invitations
+  report                  record sign ups and report the conversion of invitations
+
+Options :
+  -store <invites.json>   the local record of invitations, aeroinvite.json by default
+  -list <emails.csv>      the people to invite, one email per line or the first CSV column
+  -inviter <email>        the user invitations are sent from, required to invite
+  -resend-days <n>        re-send invitations last sent more than n days ago, 7 by default
+  -max-sends <n>          send an invitation n times at most, 3 by default
+  -expire-days <n>        revoke invitations first sent more than n days ago, 30 by default
+  -format text|json|csv   the format of the report written to stdout, text by default
+  -dry-run                report what would be done, the store is left unchanged`
+
+func exit(err error) {
+	fmt.Println(err)
+	os.Exit(1)
+}
+
+func main() {
+	host := flag.String("host", "", "hostname of the AeroFS Appliance")
+	storeFile := flag.String("store", "aeroinvite.json", "local record of invitations")
+	listFile := flag.String("list", "", "emails of the people to invite")
+	inviter := flag.String("inviter", "", "user invitations are sent from")
+	resendDays := flag.Int("resend-days", 7, "re-send invitations last sent more than n days ago")
+	maxSends := flag.Int("max-sends", 3, "number of times an invitation is sent at most")
+	expireDays := flag.Int("expire-days", 30, "revoke invitations first sent more than n days ago")
+	format := flag.String("format", "text", "text, json or csv")
+	dryRun := flag.Bool("dry-run", false, "report what would be done")
+	flag.Parse()
+
+	token := os.Getenv("AEROFS_TOKEN")
+	command := flag.Arg(0)
+	if *host == "" || token == "" || flag.NArg() != 1 ||
+		(*format != "text" && *format != "json" && *format != "csv") ||
+		(command == "invite" && (*listFile == "" || *inviter == "")) {
+		fmt.Println(USAGE)
+		os.Exit(1)
+	}
+	c, _ := api.NewClient(token, *host)
+
+	store, err := invite.OpenStore(*storeFile)
+	if err != nil {
+		exit(err)
+	}
+	opts := invite.Options{Inviter: *inviter, DryRun: *dryRun, Log: logger.Printf}
+
+	switch command {
+	case "invite":
+		f, err := os.Open(*listFile)
+		if err != nil {
+			exit(err)
+		}
+		emails, err := invite.ReadList(f)
+		f.Close()
+		if err != nil {
+			exit(err)
+		}
+		invite.Invite(c, store, emails, opts)
+
+	case "maintain":
+		day := 24 * time.Hour
+		_, err = invite.Maintain(c, store, invite.MaintainOptions{Options: opts,
+			ResendAfter: time.Duration(*resendDays) * day, MaxSends: *maxSends,
+			ExpireAfter: time.Duration(*expireDays) * day})
+		if err != nil {
+			exit(err)
+		}
+
+	case "report":
+		report, err := invite.Conversions(c, store, opts)
+		if err != nil {
+			exit(err)
+		}
+		switch *format {
+		case "json":
+			err = report.WriteJSON(os.Stdout)
+		case "csv":
+			err = report.WriteCSV(os.Stdout)
+		default:
+			report.WriteText(os.Stdout)
+		}
+		if err != nil {
+			exit(err)
+		}
+
+	default:
+		fmt.Println(USAGE)
+		os.Exit(1)
+	}
+
+	if !*dryRun {
+		err = store.Save()
+		if err != nil {
+			exit(err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+// The entrypoint for aeromigrate, migrating an AeroFS organization from one
+// Appliance to another
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	migrate "github.com/aerofs/aerofs-sdk-golang/aerofsmigrate"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+// Global logger
+var logger = log.New(os.Stderr, "", log.LstdFlags)
+
+const USAGE = `Usage : ./aeromigrate <command> -config <config.json> [options]
+
+Commands :
+  plan    [-out <plan.json>]   print the steps of the migration, or save them
+  run     [-plan <plan.json>]  apply a saved plan, or a new one
+  verify  [-plan <plan.json>]  compare the migrated files on both Appliances`
+
+// An Appliance and an admin OAuth token for it
+type Appliance struct {
+	Host  string `json:"host"`
+	Token string `json:"token"`
+}
+
+type Config struct {
+	Source      Appliance `json:"source"`
+	Destination Appliance `json:"destination"`
+
+	// Destination emails by source email
+	EmailMap map[string]string `json:"email_map"`
+
+	// Tokens of users whose root folders are migrated, by source email
+	UserTokens map[string]migrate.UserTokens `json:"user_tokens"`
+
+	Checkpoint  string `json:"checkpoint"`
+	Concurrency int    `json:"concurrency"`
+}
+
+func readJSON(fileName string, v interface{}) error {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return fmt.Errorf("Unable to unmarshal %s : %s", fileName, err)
+	}
+	return nil
+}
+
+func exit(err error) {
+	fmt.Println(err)
+	os.Exit(1)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println(USAGE)
+		os.Exit(1)
+	}
+
+	flags := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	configFile := flags.String("config", "", "JSON configuration of the migration")
+	planFile := flags.String("plan", "", "plan to run or verify, a new one if empty")
+	outFile := flags.String("out", "", "file the plan is saved to as JSON")
+	flags.Parse(os.Args[2:])
+
+	if *configFile == "" {
+		fmt.Println(USAGE)
+		os.Exit(1)
+	}
+	config := Config{}
+	err := readJSON(*configFile, &config)
+	if err != nil {
+		exit(err)
+	}
+
+	source, _ := api.NewClient(config.Source.Token, config.Source.Host)
+	destination, _ := api.NewClient(config.Destination.Token, config.Destination.Host)
+	m := migrate.NewMigrator(source, destination, migrate.Options{
+		EmailMap:       config.EmailMap,
+		UserTokens:     config.UserTokens,
+		Concurrency:    config.Concurrency,
+		CheckpointPath: config.Checkpoint,
+		Log:            logger.Printf})
+
+	plan := &migrate.Plan{}
+	if *planFile != "" && os.Args[1] != "plan" {
+		err = readJSON(*planFile, plan)
+	} else {
+		plan, err = m.Plan()
+	}
+	if err != nil {
+		exit(err)
+	}
+
+	switch os.Args[1] {
+	case "plan":
+		if *outFile == "" {
+			plan.WriteText(os.Stdout)
+			return
+		}
+		data, _ := json.MarshalIndent(plan, "", "  ")
+		err = ioutil.WriteFile(*outFile, data, 0600)
+		if err != nil {
+			exit(err)
+		}
+
+	case "run":
+		report, err := m.Run(plan)
+		if report != nil {
+			data, _ := json.MarshalIndent(report, "", "  ")
+			fmt.Println(string(data))
+		}
+		if err != nil {
+			exit(err)
+		}
+
+	case "verify":
+		report, err := m.Verify(plan)
+		if err != nil {
+			exit(err)
+		}
+		data, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(data))
+		if len(report.Mismatches) > 0 {
+			os.Exit(2)
+		}
+
+	default:
+		fmt.Println(USAGE)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+// The entrypoint for aeroprovision, creating AeroFS users in bulk from CSV or
+// JSON
+
+import (
+	"flag"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	provision "github.com/aerofs/aerofs-sdk-golang/aerofsprovision"
+	"log"
+	"os"
+	"strings"
+)
+
+// Global logger
+var logger = log.New(os.Stderr, "", log.LstdFlags)
+
+const USAGE = `Usage : AEROFS_TOKEN=<admin token> ./aeroprovision -host <appliance> -rows <users.csv|users.json> [options]
+
+Options :
+  -report <report.json|report.csv>  where the per-row report is written, stdout as JSON by default
+  -retry <report.json>              only provision rows which failed or are missing from a report
+  -inviter <email>                  the email sign up invitations are sent from
+  -concurrency <n>                  the number of rows provisioned at once`
+
+func exit(err error) {
+	fmt.Println(err)
+	os.Exit(1)
+}
+
+func main() {
+	host := flag.String("host", "", "hostname of the AeroFS Appliance")
+	rowsFile := flag.String("rows", "", "CSV or JSON file of the users to provision")
+	reportFile := flag.String("report", "", "file the report is written to, as JSON or CSV")
+	retryFile := flag.String("retry", "", "report of a previous run, only failed rows are retried")
+	inviter := flag.String("inviter", "", "email sign up invitations are sent from")
+	concurrency := flag.Int("concurrency", provision.DEFAULT_CONCURRENCY, "number of rows provisioned at once")
+	flag.Parse()
+
+	token := os.Getenv("AEROFS_TOKEN")
+	if *host == "" || *rowsFile == "" || token == "" {
+		fmt.Println(USAGE)
+		os.Exit(1)
+	}
+	c, _ := api.NewClient(token, *host)
+
+	rows, err := provision.ReadFile(*rowsFile)
+	if err != nil {
+		exit(err)
+	}
+	if *retryFile != "" {
+		f, err := os.Open(*retryFile)
+		if err != nil {
+			exit(err)
+		}
+		previous, err := provision.ReadReport(f)
+		f.Close()
+		if err != nil {
+			exit(err)
+		}
+		rows = provision.Retry(rows, previous)
+		logger.Printf("Retrying %d rows", len(rows))
+	}
+
+	report, err := provision.Provision(c, rows, provision.Options{Concurrency: *concurrency,
+		Inviter: *inviter, Log: logger.Printf})
+	if err != nil {
+		exit(err)
+	}
+
+	err = writeReport(report, *reportFile)
+	if err != nil {
+		exit(err)
+	}
+
+	counts := report.Counts()
+	logger.Printf("%d created, %d updated, %d invited, %d unchanged, %d failed",
+		counts[provision.CREATED], counts[provision.UPDATED], counts[provision.INVITED],
+		counts[provision.UNCHANGED], counts[provision.FAILED])
+	if counts[provision.FAILED] > 0 {
+		os.Exit(2)
+	}
+}
+
+// Write the report to stdout as JSON, or to a file as CSV or JSON depending on
+// its extension
+func writeReport(report *provision.Report, fileName string) error {
+	if fileName == "" {
+		return report.WriteJSON(os.Stdout)
+	}
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if strings.HasSuffix(strings.ToLower(fileName), ".csv") {
+		return report.WriteCSV(f)
+	}
+	return report.WriteJSON(f)
+}
@@ -0,0 +1,300 @@
+package main
+
+// AWS Signature Version 4 verification of S3 requests
+// Only the Authorization header form is supported, presigned URLs are not
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SIGV4_ALGORITHM   = "AWS4-HMAC-SHA256"
+	UNSIGNED_PAYLOAD  = "UNSIGNED-PAYLOAD"
+	STREAMING_PAYLOAD = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+
+	// Requests signed further than this from the current time are rejected
+	MAX_CLOCK_SKEW = 15 * time.Minute
+)
+
+// The SHA-256 of an empty payload
+var emptyHash = hex.EncodeToString(sha256Sum(nil))
+
+var (
+	errMissingAuth      = errors.New("Missing or unsupported Authorization header")
+	errUnknownAccessKey = errors.New("The access key is not known")
+	errSignature        = errors.New("The request signature does not match")
+	errSkewed           = errors.New("The request time is too skewed")
+	errPayloadHash      = errors.New("The payload does not match x-amz-content-sha256")
+)
+
+// The parsed Authorization header of a request
+type credential struct {
+	accessKey     string
+	scope         string
+	signedHeaders []string
+	signature     string
+}
+
+// The result of a successful verification, required to verify the chunk
+// signatures of a streaming payload
+type signature struct {
+	key        *AccessKey
+	amzDate    string
+	scope      string
+	signingKey []byte
+	seed       string
+}
+
+func sha256Sum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// Parse "AWS4-HMAC-SHA256 Credential=<key>/<scope>, SignedHeaders=<h1;h2>, Signature=<hex>"
+func parseAuthorization(header string) (*credential, error) {
+	if !strings.HasPrefix(header, SIGV4_ALGORITHM+" ") {
+		return nil, errMissingAuth
+	}
+
+	cred := credential{}
+	for _, field := range strings.Split(header[len(SIGV4_ALGORITHM)+1:], ",") {
+		kv := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(kv) != 2 {
+			return nil, errMissingAuth
+		}
+		switch kv[0] {
+		case "Credential":
+			parts := strings.SplitN(kv[1], "/", 2)
+			if len(parts) != 2 {
+				return nil, errMissingAuth
+			}
+			cred.accessKey, cred.scope = parts[0], parts[1]
+		case "SignedHeaders":
+			cred.signedHeaders = strings.Split(kv[1], ";")
+		case "Signature":
+			cred.signature = kv[1]
+		}
+	}
+
+	if cred.accessKey == "" || cred.signature == "" || len(cred.signedHeaders) == 0 {
+		return nil, errMissingAuth
+	}
+	return &cred, nil
+}
+
+// URI-encode a string as specified by SigV4, every byte except the unreserved
+// characters is encoded. Slashes are kept when encoding a path
+func uriEncode(s string, keepSlash bool) string {
+	buffer := bytes.Buffer{}
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~', keepSlash && b == '/':
+			buffer.WriteByte(b)
+		default:
+			fmt.Fprintf(&buffer, "%%%02X", b)
+		}
+	}
+	return buffer.String()
+}
+
+// Construct the canonical request of SigV4
+func canonicalRequest(r *http.Request, signedHeaders []string, payloadHash string) string {
+	query := r.URL.Query()
+	keys := []string{}
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	params := []string{}
+	for _, k := range keys {
+		values := append([]string{}, query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			params = append(params, uriEncode(k, false)+"="+uriEncode(v, false))
+		}
+	}
+
+	headers := []string{}
+	for _, h := range signedHeaders {
+		value := strings.Join(r.Header[http.CanonicalHeaderKey(h)], ",")
+		if h == "host" {
+			value = r.Host
+		}
+		headers = append(headers, h+":"+strings.Join(strings.Fields(value), " ")+"\n")
+	}
+
+	uri := r.URL.Path
+	if uri == "" {
+		uri = "/"
+	}
+
+	return strings.Join([]string{
+		r.Method,
+		uriEncode(uri, true),
+		strings.Join(params, "&"),
+		strings.Join(headers, ""),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+}
+
+// Derive the SigV4 signing key of a secret for a "<date>/<region>/s3/aws4_request" scope
+func signingKey(secret, scope string) []byte {
+	key := []byte("AWS4" + secret)
+	for _, part := range strings.Split(scope, "/") {
+		key = hmacSHA256(key, part)
+	}
+	return key
+}
+
+// Verify the signature of a request against the configured access keys
+func verifyRequest(r *http.Request, keys map[string]*AccessKey, now time.Time) (*signature, error) {
+	cred, err := parseAuthorization(r.Header.Get("Authorization"))
+	if err != nil {
+		return nil, err
+	}
+	key, ok := keys[cred.accessKey]
+	if !ok {
+		return nil, errUnknownAccessKey
+	}
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	signedAt, err := time.Parse("20060102T150405Z", amzDate)
+	if err != nil {
+		return nil, errMissingAuth
+	}
+	if skew := now.Sub(signedAt); skew > MAX_CLOCK_SKEW || skew < -MAX_CLOCK_SKEW {
+		return nil, errSkewed
+	}
+
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		payloadHash = UNSIGNED_PAYLOAD
+	}
+
+	canonical := canonicalRequest(r, cred.signedHeaders, payloadHash)
+	stringToSign := strings.Join([]string{SIGV4_ALGORITHM, amzDate, cred.scope,
+		hex.EncodeToString(sha256Sum([]byte(canonical)))}, "\n")
+	sigKey := signingKey(key.SecretKey, cred.scope)
+	expected := hex.EncodeToString(hmacSHA256(sigKey, stringToSign))
+
+	if !hmac.Equal([]byte(expected), []byte(cred.signature)) {
+		return nil, errSignature
+	}
+	return &signature{key: key, amzDate: amzDate, scope: cred.scope,
+		signingKey: sigKey, seed: cred.signature}, nil
+}
+
+// Return a reader of the request payload which fails if the payload does not
+// match what was signed
+func (s *signature) payload(r *http.Request) io.Reader {
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	switch {
+	case payloadHash == STREAMING_PAYLOAD:
+		return &chunkedReader{sig: s, reader: bufio.NewReader(r.Body), prevSignature: s.seed}
+	case payloadHash == "" || payloadHash == UNSIGNED_PAYLOAD:
+		return r.Body
+	}
+	return &hashingReader{reader: r.Body, hash: sha256.New(), expected: payloadHash}
+}
+
+// Compares the SHA-256 of everything read with the signed payload hash
+type hashingReader struct {
+	reader   io.Reader
+	hash     hash.Hash
+	expected string
+}
+
+func (h *hashingReader) Read(p []byte) (int, error) {
+	n, err := h.reader.Read(p)
+	h.hash.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(h.hash.Sum(nil)) != h.expected {
+		return n, errPayloadHash
+	}
+	return n, err
+}
+
+// Decodes an "aws-chunked" payload, verifying the signature of every chunk
+// Each chunk is "<hex size>;chunk-signature=<signature>\r\n<data>\r\n" and
+// the payload ends with a chunk of size 0
+type chunkedReader struct {
+	sig           *signature
+	reader        *bufio.Reader
+	prevSignature string
+	chunk         []byte
+	done          bool
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	for len(c.chunk) == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		err := c.nextChunk()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, c.chunk)
+	c.chunk = c.chunk[n:]
+	return n, nil
+}
+
+func (c *chunkedReader) nextChunk() error {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return errors.New("Malformed aws-chunked payload")
+	}
+
+	header := strings.SplitN(strings.TrimSpace(line), ";chunk-signature=", 2)
+	if len(header) != 2 {
+		return errors.New("Malformed aws-chunked payload")
+	}
+	size, err := strconv.ParseInt(header[0], 16, 64)
+	if err != nil || size < 0 || size > 64*1024*1024 {
+		return errors.New("Malformed aws-chunked payload")
+	}
+
+	data := make([]byte, size+2)
+	_, err = io.ReadFull(c.reader, data)
+	if err != nil || !bytes.HasSuffix(data, []byte("\r\n")) {
+		return errors.New("Malformed aws-chunked payload")
+	}
+	data = data[:size]
+
+	stringToSign := strings.Join([]string{SIGV4_ALGORITHM + "-PAYLOAD", c.sig.amzDate,
+		c.sig.scope, c.prevSignature, emptyHash,
+		hex.EncodeToString(sha256Sum(data))}, "\n")
+	expected := hex.EncodeToString(hmacSHA256(c.sig.signingKey, stringToSign))
+	if !hmac.Equal([]byte(expected), []byte(header[1])) {
+		return errSignature
+	}
+
+	c.prevSignature = header[1]
+	c.chunk = data
+	c.done = size == 0
+	return nil
+}
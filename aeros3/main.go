@@ -0,0 +1,197 @@
+package main
+
+// The entrypoint for aeros3, a gateway exposing AeroFS folders through a
+// subset of the Amazon S3 API for tools which only speak S3
+
+import (
+	"encoding/json"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Global logger
+var logger = log.New(os.Stderr, "", log.LstdFlags|log.Lshortfile)
+
+// Which folders of a user are exposed as buckets
+const (
+	// Every folder in the user's root folder
+	BUCKETS_FOLDERS = "folders"
+
+	// Only shared folders in the user's root folder
+	BUCKETS_SHARES = "shares"
+)
+
+// An S3 access key pair and the AeroFS OAuth token requests signed with it
+// are performed with
+type AccessKey struct {
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+	Token     string `json:"token"`
+}
+
+// The gateway configuration file
+type Config struct {
+	// <host>:<port> to serve the S3 API on
+	Listen string `json:"listen"`
+
+	// The hostname of the AeroFS Appliance
+	Host string `json:"host"`
+
+	// BUCKETS_FOLDERS or BUCKETS_SHARES
+	Buckets string `json:"buckets"`
+
+	// Directory parts of multipart uploads received out of order are spooled to
+	SpoolDir string `json:"spool_dir"`
+
+	Keys []*AccessKey `json:"keys"`
+}
+
+// Read a configuration file
+func loadConfig(fileName string) (*Config, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	config := Config{Listen: "localhost:9000", Buckets: BUCKETS_FOLDERS, SpoolDir: os.TempDir()}
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to unmarshal configuration : %s", err)
+	}
+
+	if config.Host == "" || len(config.Keys) == 0 {
+		return nil, fmt.Errorf("The configuration requires a host and at least one key")
+	}
+	if config.Buckets != BUCKETS_FOLDERS && config.Buckets != BUCKETS_SHARES {
+		return nil, fmt.Errorf("Unknown bucket mode %q", config.Buckets)
+	}
+	return &config, nil
+}
+
+// The S3 gateway
+type gateway struct {
+	config *Config
+	keys   map[string]*AccessKey
+
+	// AeroFS clients, one per access key
+	mu      sync.Mutex
+	clients map[string]*api.Client
+
+	uploads *uploadTable
+}
+
+func newGateway(config *Config) *gateway {
+	g := gateway{config: config,
+		keys:    map[string]*AccessKey{},
+		clients: map[string]*api.Client{},
+		uploads: newUploadTable(config.SpoolDir),
+	}
+	for _, k := range config.Keys {
+		g.keys[k.AccessKey] = k
+	}
+	return &g
+}
+
+// Return the AeroFS client of an access key
+func (g *gateway) client(key *AccessKey) *api.Client {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	c, ok := g.clients[key.AccessKey]
+	if !ok {
+		c, _ = api.NewClient(key.Token, g.config.Host)
+		g.clients[key.AccessKey] = c
+	}
+	return c
+}
+
+// An authenticated S3 request
+type s3Request struct {
+	*http.Request
+	sig    *signature
+	client *api.Client
+	bucket string
+	key    string
+}
+
+// Authenticate the request and route it to the operation it names
+// Only path-style requests, "/<bucket>/<key>", are supported
+func (g *gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sig, err := verifyRequest(r, g.keys, time.Now())
+	if err != nil {
+		code := "SignatureDoesNotMatch"
+		switch err {
+		case errUnknownAccessKey:
+			code = "InvalidAccessKeyId"
+		case errSkewed:
+			code = "RequestTimeTooSkewed"
+		case errMissingAuth:
+			code = "AccessDenied"
+		}
+		writeError(w, r, http.StatusForbidden, code, err.Error())
+		return
+	}
+
+	req := s3Request{Request: r, sig: sig, client: g.client(sig.key)}
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	req.bucket = parts[0]
+	if len(parts) == 2 {
+		req.key = parts[1]
+	}
+
+	query := r.URL.Query()
+	_, uploads := query["uploads"]
+	uploadId := query.Get("uploadId")
+
+	switch {
+	case req.bucket == "" && r.Method == "GET":
+		g.listBuckets(w, &req)
+	case req.key == "" && r.Method == "GET":
+		g.listObjects(w, &req)
+	case req.key == "" && r.Method == "HEAD":
+		g.headBucket(w, &req)
+	case req.key == "" && r.Method == "PUT":
+		g.createBucket(w, &req)
+	case req.key == "":
+		writeError(w, r, http.StatusNotImplemented, "NotImplemented", "Unsupported bucket operation")
+	case r.Method == "POST" && uploads:
+		g.createMultipartUpload(w, &req)
+	case r.Method == "PUT" && uploadId != "":
+		g.uploadPart(w, &req, uploadId)
+	case r.Method == "POST" && uploadId != "":
+		g.completeMultipartUpload(w, &req, uploadId)
+	case r.Method == "DELETE" && uploadId != "":
+		g.abortMultipartUpload(w, &req, uploadId)
+	case r.Method == "GET", r.Method == "HEAD":
+		g.getObject(w, &req)
+	case r.Method == "PUT":
+		g.putObject(w, &req)
+	case r.Method == "DELETE":
+		g.deleteObject(w, &req)
+	default:
+		writeError(w, r, http.StatusNotImplemented, "NotImplemented", "Unsupported object operation")
+	}
+}
+
+func main() {
+	if len(os.Args[1:]) != 1 {
+		fmt.Println("Usage : ./aeros3 <config.json>")
+		os.Exit(1)
+	}
+
+	config, err := loadConfig(os.Args[1])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	logger.Printf("Serving AeroFS Appliance %s as S3 at %s", config.Host, config.Listen)
+	logger.Fatal(http.ListenAndServe(config.Listen, newGateway(config)))
+}
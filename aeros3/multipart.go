@@ -0,0 +1,475 @@
+package main
+
+// Multipart uploads mapped onto the AeroFS chunked upload protocol
+// Every part is spooled to disk until its payload is verified, then parts are
+// forwarded in ascending order as AeroFS chunks as soon as they follow the
+// parts already sent. Part numbers may have gaps: once MAX_WAITING_PARTS parts
+// wait for a lower numbered one, the gap is assumed to be final and the lowest
+// waiting part is forwarded, a part numbered below it is then rejected
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+)
+
+// The largest part number S3 accepts
+const MAX_PART_NUMBER = 10000
+
+// The number of parts spooled while waiting for a lower numbered part, which
+// bounds the gap in arrival order tolerated by concurrent clients
+const MAX_WAITING_PARTS = 16
+
+var (
+	errNoSuchUpload = errors.New("The specified multipart upload does not exist")
+	errPartSent     = errors.New("The part was already transferred and cannot be replaced")
+	errPartSkipped  = errors.New("A part with a higher number was already transferred")
+	errInvalidPart  = errors.New("One or more of the specified parts could not be found")
+)
+
+// A part received from the client
+type uploadPart struct {
+	number    int
+	size      int
+	etag      string
+	spoolPath string
+}
+
+// The state of one multipart upload
+type multipartUpload struct {
+	id     string
+	bucket string
+	key    string
+	client *api.Client
+
+	// The AeroFS file and upload identifier content is sent to
+	fileId   string
+	uploadId string
+
+	// The ETag the file had when the upload was created, empty if the file
+	// was created for the upload
+	etag string
+
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	// Set while a goroutine forwards parts to AeroFS
+	busy bool
+
+	// The first failure forwarding a part, which fails the upload
+	err error
+
+	// Parts forwarded to AeroFS, in order, and the number of bytes they hold
+	sent   []uploadPart
+	offset int
+
+	// Parts waiting for the preceding ones
+	spooled map[int]uploadPart
+}
+
+// The multipart uploads in progress
+type uploadTable struct {
+	mu       sync.Mutex
+	uploads  map[string]*multipartUpload
+	spoolDir string
+}
+
+func newUploadTable(spoolDir string) *uploadTable {
+	return &uploadTable{uploads: map[string]*multipartUpload{}, spoolDir: spoolDir}
+}
+
+// Return an upload, which must belong to the bucket and key of the request
+func (t *uploadTable) get(req *s3Request, id string) (*multipartUpload, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	u, ok := t.uploads[id]
+	if !ok || u.bucket != req.bucket || u.key != req.key || u.client != req.client {
+		return nil, errNoSuchUpload
+	}
+	return u, nil
+}
+
+func (t *uploadTable) remove(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.uploads, id)
+}
+
+func newUploadId() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Write a part to the spool directory, computing its ETag
+func (t *uploadTable) spool(number int, r io.Reader) (uploadPart, error) {
+	f, err := ioutil.TempFile(t.spoolDir, "aeros3-part-")
+	if err != nil {
+		return uploadPart{}, err
+	}
+	defer f.Close()
+
+	h := md5.New()
+	n, err := io.Copy(io.MultiWriter(f, h), r)
+	if err != nil {
+		os.Remove(f.Name())
+		return uploadPart{}, err
+	}
+	return uploadPart{number: number, size: int(n), spoolPath: f.Name(),
+		etag: `"` + hex.EncodeToString(h.Sum(nil)) + `"`}, nil
+}
+
+// Send a spooled part to AeroFS as chunks starting at offset
+func (u *multipartUpload) send(part uploadPart, offset int) error {
+	f, err := os.Open(part.spoolPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	chunk := make([]byte, api.CHUNKSIZE)
+	for {
+		n, err := io.ReadFull(f, chunk)
+		if n > 0 {
+			_, e := u.client.UploadFileChunk(u.fileId, u.uploadId, chunk[:n], offset, offset+n-1)
+			if e != nil {
+				return e
+			}
+			offset += n
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// Return the number of the last part sent, 0 if none was, the lock must be
+// held
+func (u *multipartUpload) lastSent() int {
+	if len(u.sent) == 0 {
+		return 0
+	}
+	return u.sent[len(u.sent)-1].number
+}
+
+// Return the spooled part to forward next, the lock must be held
+// This is the part following the last one sent, or the lowest numbered part if
+// too many are waiting for a gap to be filled
+func (u *multipartUpload) next() (uploadPart, bool) {
+	part, ok := u.spooled[u.lastSent()+1]
+	if ok || len(u.spooled) <= MAX_WAITING_PARTS {
+		return part, ok
+	}
+	for n, p := range u.spooled {
+		if !ok || n < part.number {
+			part, ok = p, true
+		}
+	}
+	return part, ok
+}
+
+// Forward the spooled parts which follow the parts already sent
+// Returns immediately if another goroutine is forwarding parts
+func (u *multipartUpload) drain() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.busy {
+		return
+	}
+	u.busy = true
+
+	for u.err == nil {
+		part, ok := u.next()
+		if !ok {
+			break
+		}
+		offset := u.offset
+
+		u.mu.Unlock()
+		err := u.send(part, offset)
+		u.mu.Lock()
+
+		if err != nil {
+			u.err = err
+			break
+		}
+		delete(u.spooled, part.number)
+		os.Remove(part.spoolPath)
+		u.sent = append(u.sent, part)
+		u.offset += part.size
+	}
+
+	u.busy = false
+	u.cond.Broadcast()
+}
+
+// Wait for parts being forwarded, the lock must be held
+func (u *multipartUpload) wait() {
+	for u.busy {
+		u.cond.Wait()
+	}
+}
+
+// Remove the spooled parts, the lock must be held
+func (u *multipartUpload) cleanup() {
+	for n, part := range u.spooled {
+		os.Remove(part.spoolPath)
+		delete(u.spooled, n)
+	}
+}
+
+func (g *gateway) createMultipartUpload(w http.ResponseWriter, req *s3Request) {
+	bucket, err := g.bucketFolder(req)
+	if err != nil {
+		writeAPIError(w, req.Request, err)
+		return
+	}
+
+	dir, name := path.Split(req.key)
+	folder, err := bucket.MkdirAll(dir)
+	if err != nil {
+		writeAPIError(w, req.Request, err)
+		return
+	}
+
+	u := multipartUpload{id: newUploadId(), bucket: req.bucket, key: req.key,
+		client: req.client, spooled: map[int]uploadPart{}}
+	u.cond = sync.NewCond(&u.mu)
+
+	existing, err := g.lookupObject(req)
+	switch {
+	case err == errNoSuchKey:
+		f, err := sdk.CreateFileClient(req.client, folder.Desc.Id, name)
+		if err != nil {
+			writeAPIError(w, req.Request, err)
+			return
+		}
+		u.fileId = f.Desc.Id
+	case err != nil:
+		writeAPIError(w, req.Request, err)
+		return
+	case req.Header.Get("If-None-Match") == "*":
+		writeAPIError(w, req.Request, sdk.ErrFileExists)
+		return
+	default:
+		u.fileId = existing.Desc.Id
+		u.etag = existing.Desc.Etag
+	}
+
+	etags := []string{}
+	if u.etag != "" {
+		etags = append(etags, u.etag)
+	}
+	u.uploadId, err = req.client.GetFileUploadId(u.fileId, etags)
+	if err != nil {
+		writeAPIError(w, req.Request, err)
+		return
+	}
+
+	g.uploads.mu.Lock()
+	g.uploads.uploads[u.id] = &u
+	g.uploads.mu.Unlock()
+
+	writeXML(w, http.StatusOK, initiateMultipartUploadResult{Xmlns: S3_NAMESPACE,
+		Bucket: req.bucket, Key: req.key, UploadId: u.id})
+}
+
+// Return an error if a part can no longer be uploaded, the lock must be held
+func (u *multipartUpload) checkNumber(number int) error {
+	for _, part := range u.sent {
+		if part.number == number {
+			return errPartSent
+		}
+	}
+	if number < u.lastSent() {
+		return errPartSkipped
+	}
+	return nil
+}
+
+func (g *gateway) uploadPart(w http.ResponseWriter, req *s3Request, uploadId string) {
+	u, err := g.uploads.get(req, uploadId)
+	if err != nil {
+		writeError(w, req.Request, http.StatusNotFound, "NoSuchUpload", err.Error())
+		return
+	}
+
+	number, err := strconv.Atoi(req.URL.Query().Get("partNumber"))
+	if err != nil || number < 1 || number > MAX_PART_NUMBER {
+		writeError(w, req.Request, http.StatusBadRequest, "InvalidArgument", "Invalid partNumber")
+		return
+	}
+
+	u.mu.Lock()
+	err = u.checkNumber(number)
+	u.mu.Unlock()
+	if err != nil {
+		writeError(w, req.Request, http.StatusBadRequest, "InvalidPart", err.Error())
+		return
+	}
+
+	part, err := g.uploads.spool(number, req.sig.payload(req.Request))
+	if err != nil {
+		writeAPIError(w, req.Request, err)
+		return
+	}
+
+	u.mu.Lock()
+	if err = u.checkNumber(number); err != nil {
+		u.mu.Unlock()
+		os.Remove(part.spoolPath)
+		writeError(w, req.Request, http.StatusBadRequest, "InvalidPart", err.Error())
+		return
+	}
+	if previous, ok := u.spooled[number]; ok {
+		os.Remove(previous.spoolPath)
+	}
+	u.spooled[number] = part
+	u.mu.Unlock()
+
+	u.drain()
+	u.mu.Lock()
+	err = u.err
+	u.mu.Unlock()
+	if err != nil {
+		writeAPIError(w, req.Request, err)
+		return
+	}
+	w.Header().Set("ETag", part.etag)
+	w.WriteHeader(http.StatusOK)
+}
+
+// Complete an upload with the parts the client lists, which must start with
+// the parts already sent to AeroFS. The remaining listed parts are sent in the
+// order given, skipping unlisted ones
+func (g *gateway) completeMultipartUpload(w http.ResponseWriter, req *s3Request, uploadId string) {
+	u, err := g.uploads.get(req, uploadId)
+	if err != nil {
+		writeError(w, req.Request, http.StatusNotFound, "NoSuchUpload", err.Error())
+		return
+	}
+
+	var body completeMultipartUpload
+	err = xml.NewDecoder(req.sig.payload(req.Request)).Decode(&body)
+	if err != nil || len(body.Parts) == 0 {
+		writeError(w, req.Request, http.StatusBadRequest, "MalformedXML",
+			"The request body does not list the uploaded parts")
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.wait()
+	if u.err != nil {
+		writeAPIError(w, req.Request, u.err)
+		return
+	}
+
+	previous := 0
+	for i, p := range body.Parts {
+		if p.PartNumber <= previous {
+			writeError(w, req.Request, http.StatusBadRequest, "InvalidPartOrder",
+				"The parts must be listed in ascending order")
+			return
+		}
+		previous = p.PartNumber
+
+		var part uploadPart
+		var ok bool
+		if i < len(u.sent) {
+			part, ok = u.sent[i], u.sent[i].number == p.PartNumber
+		} else {
+			part, ok = u.spooled[p.PartNumber]
+		}
+		if !ok || part.etag != quoteEtag(p.ETag) {
+			writeError(w, req.Request, http.StatusBadRequest, "InvalidPart", errInvalidPart.Error())
+			return
+		}
+	}
+	if len(body.Parts) < len(u.sent) {
+		writeError(w, req.Request, http.StatusBadRequest, "InvalidPart", errInvalidPart.Error())
+		return
+	}
+
+	// The lock is held for the rest of the upload, other requests wait
+	for _, p := range body.Parts[len(u.sent):] {
+		part := u.spooled[p.PartNumber]
+		err = u.send(part, u.offset)
+		if err != nil {
+			u.err = err
+			writeAPIError(w, req.Request, err)
+			return
+		}
+		delete(u.spooled, part.number)
+		os.Remove(part.spoolPath)
+		u.sent = append(u.sent, part)
+		u.offset += part.size
+	}
+
+	etags := []string{}
+	if u.etag != "" {
+		etags = append(etags, u.etag)
+	}
+	header, err := u.client.FinishFileUpload(u.fileId, u.uploadId, u.offset, etags)
+	if err != nil {
+		writeAPIError(w, req.Request, err)
+		return
+	}
+	u.cleanup()
+	g.uploads.remove(u.id)
+
+	etag := header.Get("ETag")
+	if etag == "" {
+		f := sdk.FileClient{APIClient: u.client, Desc: sdk.File{Id: u.fileId}}
+		if f.LoadMetadata() == nil {
+			etag = f.Desc.Etag
+		}
+	}
+	writeXML(w, http.StatusOK, completeMultipartUploadResult{Xmlns: S3_NAMESPACE,
+		Location: fmt.Sprintf("/%s/%s", u.bucket, u.key), Bucket: u.bucket, Key: u.key,
+		ETag: quoteEtag(etag)})
+}
+
+// Abort an upload, a file created for it is deleted
+func (g *gateway) abortMultipartUpload(w http.ResponseWriter, req *s3Request, uploadId string) {
+	u, err := g.uploads.get(req, uploadId)
+	if err != nil {
+		writeError(w, req.Request, http.StatusNotFound, "NoSuchUpload", err.Error())
+		return
+	}
+	g.uploads.remove(u.id)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.wait()
+	u.cleanup()
+
+	// Deleting a file requires its current ETag
+	if u.etag == "" {
+		f := sdk.FileClient{APIClient: u.client, Desc: sdk.File{Id: u.fileId}}
+		err = f.LoadMetadata()
+		if err == nil {
+			err = f.Delete()
+		}
+		if err != nil && !api.IsStatus(err, http.StatusNotFound) {
+			writeAPIError(w, req.Request, err)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errNoSuchBucket = errors.New("The specified bucket does not exist")
+	errNoSuchKey    = errors.New("The specified key does not exist")
+)
+
+// The ETag of empty content, returned for folder markers
+const EMPTY_ETAG = `"d41d8cd98f00b204e9800998ecf8427e"`
+
+// Write the S3 error corresponding to an API or gateway error
+func writeAPIError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case err == errNoSuchBucket:
+		writeError(w, r, http.StatusNotFound, "NoSuchBucket", err.Error())
+	case err == errNoSuchKey:
+		writeError(w, r, http.StatusNotFound, "NoSuchKey", err.Error())
+	case err == sdk.ErrFileExists, api.IsStatus(err, http.StatusPreconditionFailed):
+		writeError(w, r, http.StatusPreconditionFailed, "PreconditionFailed", err.Error())
+	case api.IsStatus(err, http.StatusForbidden), api.IsStatus(err, http.StatusUnauthorized):
+		writeError(w, r, http.StatusForbidden, "AccessDenied", err.Error())
+	case err == errPayloadHash:
+		writeError(w, r, http.StatusBadRequest, "XAmzContentSHA256Mismatch", err.Error())
+	case err == errSignature:
+		writeError(w, r, http.StatusForbidden, "SignatureDoesNotMatch", err.Error())
+	default:
+		logger.Printf("%s %s : %s", r.Method, r.URL.Path, err)
+		writeError(w, r, http.StatusInternalServerError, "InternalError", err.Error())
+	}
+}
+
+// S3 ETags are quoted strings
+func quoteEtag(etag string) string {
+	if strings.HasPrefix(etag, `"`) {
+		return etag
+	}
+	return `"` + etag + `"`
+}
+
+// Return whether an If-Match or If-None-Match header lists an ETag
+func etagListed(header, etag string) bool {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || quoteEtag(v) == quoteEtag(etag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Format an AeroFS timestamp as S3 does in XML responses
+func formatTime(lastModified, layout string) string {
+	t, err := time.Parse(time.RFC3339, lastModified)
+	if err != nil {
+		return ""
+	}
+	return t.UTC().Format(layout)
+}
+
+// Return the folders exposed as buckets
+func (g *gateway) buckets(c *api.Client) ([]api.Folder, error) {
+	root := sdk.FolderClient{APIClient: c, Desc: sdk.Folder{Id: "root"}}
+	err := root.LoadChildren()
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := []api.Folder{}
+	for _, f := range root.Desc.ChildList.Folders {
+		if g.config.Buckets == BUCKETS_FOLDERS || f.IsShared {
+			buckets = append(buckets, f)
+		}
+	}
+	return buckets, nil
+}
+
+// Return the folder of the requested bucket
+func (g *gateway) bucketFolder(req *s3Request) (*sdk.FolderClient, error) {
+	buckets, err := g.buckets(req.client)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range buckets {
+		if f.Name == req.bucket {
+			return &sdk.FolderClient{APIClient: req.client, Desc: sdk.Folder(f)}, nil
+		}
+	}
+	return nil, errNoSuchBucket
+}
+
+// Return the file of the requested key
+func (g *gateway) lookupObject(req *s3Request) (*sdk.FileClient, error) {
+	bucket, err := g.bucketFolder(req)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, name := path.Split(req.key)
+	folder, err := bucket.Subfolder(dir)
+	if err != nil {
+		return nil, errNoSuchKey
+	}
+
+	err = folder.LoadChildren()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range folder.Desc.ChildList.Files {
+		if f.Name == name {
+			fc := sdk.FileClient{APIClient: req.client, Desc: sdk.File(f)}
+			if fc.Desc.Etag == "" {
+				err = fc.LoadMetadata()
+			}
+			return &fc, err
+		}
+	}
+	return nil, errNoSuchKey
+}
+
+func (g *gateway) listBuckets(w http.ResponseWriter, req *s3Request) {
+	buckets, err := g.buckets(req.client)
+	if err != nil {
+		writeAPIError(w, req.Request, err)
+		return
+	}
+
+	result := listAllMyBucketsResult{Xmlns: S3_NAMESPACE,
+		Owner: owner{ID: req.sig.key.AccessKey, DisplayName: req.sig.key.AccessKey}}
+	for _, f := range buckets {
+		// AeroFS does not record when a folder was created
+		result.Buckets = append(result.Buckets, bucketEntry{Name: f.Name,
+			CreationDate: "1970-01-01T00:00:00.000Z"})
+	}
+	writeXML(w, http.StatusOK, result)
+}
+
+func (g *gateway) headBucket(w http.ResponseWriter, req *s3Request) {
+	_, err := g.bucketFolder(req)
+	if err != nil {
+		writeAPIError(w, req.Request, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Buckets can only be created as top-level folders
+func (g *gateway) createBucket(w http.ResponseWriter, req *s3Request) {
+	if g.config.Buckets != BUCKETS_FOLDERS {
+		writeError(w, req.Request, http.StatusNotImplemented, "NotImplemented",
+			"Buckets cannot be created when serving shared folders")
+		return
+	}
+	if _, err := g.bucketFolder(req); err == nil {
+		writeError(w, req.Request, http.StatusConflict, "BucketAlreadyOwnedByYou",
+			"The bucket already exists")
+		return
+	}
+
+	_, err := sdk.CreateFolderClient(req.client, "root", req.bucket)
+	if err != nil {
+		writeAPIError(w, req.Request, err)
+		return
+	}
+	w.Header().Set("Location", "/"+req.bucket)
+	w.WriteHeader(http.StatusOK)
+}
+
+// ListObjectsV2, the version 1 parameters "marker" and "max-keys" are
+// accepted too. Folders outside of the prefix, or entirely within a common
+// prefix, are not listed
+func (g *gateway) listObjects(w http.ResponseWriter, req *s3Request) {
+	bucket, err := g.bucketFolder(req)
+	if err != nil {
+		writeAPIError(w, req.Request, err)
+		return
+	}
+
+	query := req.URL.Query()
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	maxKeys := 1000
+	if v := query.Get("max-keys"); v != "" {
+		maxKeys, err = strconv.Atoi(v)
+		if err != nil || maxKeys < 0 {
+			writeError(w, req.Request, http.StatusBadRequest, "InvalidArgument", "Invalid max-keys")
+			return
+		}
+	}
+
+	startAfter := query.Get("start-after")
+	if v := query.Get("marker"); v != "" {
+		startAfter = v
+	}
+	if token := query.Get("continuation-token"); token != "" {
+		decoded, err := base64.URLEncoding.DecodeString(token)
+		if err != nil {
+			writeError(w, req.Request, http.StatusBadRequest, "InvalidArgument", "Invalid continuation-token")
+			return
+		}
+		startAfter = string(decoded)
+	}
+
+	objects := map[string]objectEntry{}
+	prefixes := map[string]bool{}
+	err = bucket.Walk(func(entry sdk.TreeEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		key := entry.Path
+		if entry.IsDir {
+			key += "/"
+			if !strings.HasPrefix(key, prefix) && !strings.HasPrefix(prefix, key) {
+				return sdk.SkipFolder
+			}
+		} else if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		if delimiter != "" && strings.HasPrefix(key, prefix) {
+			rest := key[len(prefix):]
+			if i := strings.Index(rest, delimiter); i >= 0 {
+				prefixes[prefix+rest[:i+len(delimiter)]] = true
+				if entry.IsDir {
+					return sdk.SkipFolder
+				}
+				return nil
+			}
+		}
+
+		if !entry.IsDir {
+			objects[key] = objectEntry{Key: key, Size: entry.File.Size,
+				ETag:         quoteEtag(entry.File.Etag),
+				LastModified: formatTime(entry.File.LastModified, "2006-01-02T15:04:05.000Z"),
+				StorageClass: "STANDARD"}
+		}
+		return nil
+	})
+	if err != nil {
+		writeAPIError(w, req.Request, err)
+		return
+	}
+
+	keys := []string{}
+	for k := range objects {
+		keys = append(keys, k)
+	}
+	for p := range prefixes {
+		keys = append(keys, p)
+	}
+	sort.Strings(keys)
+
+	result := listBucketResult{Xmlns: S3_NAMESPACE, Name: req.bucket, Prefix: prefix,
+		Delimiter: delimiter, MaxKeys: maxKeys, StartAfter: query.Get("start-after"),
+		ContinuationToken: query.Get("continuation-token")}
+	for _, k := range keys {
+		if k <= startAfter {
+			continue
+		}
+		if result.KeyCount == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+
+		if entry, ok := objects[k]; ok {
+			result.Contents = append(result.Contents, entry)
+		} else {
+			result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{k})
+		}
+		result.KeyCount++
+		result.NextContinuationToken = base64.URLEncoding.EncodeToString([]byte(k))
+	}
+	if !result.IsTruncated {
+		result.NextContinuationToken = ""
+	}
+	writeXML(w, http.StatusOK, result)
+}
+
+// Parse a single "bytes=<start>-<end>" range of content of a given size
+func parseRange(header string, size int) (int, int, error) {
+	spec := strings.TrimPrefix(header, "bytes=")
+	bounds := strings.Split(spec, "-")
+	if spec == header || len(bounds) != 2 || strings.Contains(spec, ",") {
+		return 0, 0, errors.New("Unsupported range")
+	}
+
+	var start, end int
+	var err error
+	switch {
+	case bounds[0] == "":
+		suffix, err := strconv.Atoi(bounds[1])
+		if err != nil || suffix <= 0 {
+			return 0, 0, errors.New("Invalid range")
+		}
+		start, end = size-suffix, size-1
+		if start < 0 {
+			start = 0
+		}
+	case bounds[1] == "":
+		start, err = strconv.Atoi(bounds[0])
+		end = size - 1
+	default:
+		start, err = strconv.Atoi(bounds[0])
+		if err == nil {
+			end, err = strconv.Atoi(bounds[1])
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+
+	if err != nil || start > end || start >= size {
+		return 0, 0, errors.New("Invalid range")
+	}
+	return start, end, nil
+}
+
+// GetObject and HeadObject
+func (g *gateway) getObject(w http.ResponseWriter, req *s3Request) {
+	f, err := g.lookupObject(req)
+	if err != nil {
+		writeAPIError(w, req.Request, err)
+		return
+	}
+
+	etag := quoteEtag(f.Desc.Etag)
+	if v := req.Header.Get("If-Match"); v != "" && !etagListed(v, etag) {
+		writeError(w, req.Request, http.StatusPreconditionFailed, "PreconditionFailed", "ETag does not match")
+		return
+	}
+	if v := req.Header.Get("If-None-Match"); v != "" && etagListed(v, etag) {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	mimeType := f.Desc.Mime
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("Accept-Ranges", "bytes")
+	if lastModified := formatTime(f.Desc.LastModified, http.TimeFormat); lastModified != "" {
+		w.Header().Set("Last-Modified", lastModified)
+	}
+
+	start, end, status := 0, f.Desc.Size-1, http.StatusOK
+	if v := req.Header.Get("Range"); v != "" && f.Desc.Size > 0 {
+		start, end, err = parseRange(v, f.Desc.Size)
+		if err != nil {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", f.Desc.Size))
+			writeError(w, req.Request, http.StatusRequestedRangeNotSatisfiable,
+				"InvalidRange", err.Error())
+			return
+		}
+		status = http.StatusPartialContent
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, f.Desc.Size))
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(end-start+1))
+	w.WriteHeader(status)
+	if req.Method == "HEAD" {
+		return
+	}
+
+	// Stream the range in CHUNKSIZE pieces, each conditional on the ETag
+	for offset := start; offset <= end; offset += api.CHUNKSIZE {
+		last := offset + api.CHUNKSIZE - 1
+		if last > end {
+			last = end
+		}
+
+		body, err := f.ReadRange(offset, last)
+		if err != nil {
+			// The status was already sent, abort the response
+			logger.Printf("GET %s : %s", req.URL.Path, err)
+			panic(http.ErrAbortHandler)
+		}
+		w.Write(body)
+	}
+}
+
+// Resolve the If-Match and If-None-Match headers of a request modifying an
+// object into PutOptions
+func putOptions(req *s3Request, existing *sdk.FileClient) (sdk.PutOptions, error) {
+	opts := sdk.PutOptions{MimeType: req.Header.Get("Content-Type")}
+
+	if v := req.Header.Get("If-None-Match"); v == "*" {
+		opts.Overwrite = sdk.FailIfExists
+	}
+	if v := req.Header.Get("If-Match"); v != "" {
+		if existing == nil || !etagListed(v, existing.Desc.Etag) {
+			return opts, sdk.ErrFileExists
+		}
+		opts.Overwrite = sdk.OverwriteIfMatch
+		opts.IfMatch = existing.Desc.Etag
+	}
+	return opts, nil
+}
+
+// PutObject, missing folders along the key are created. A key ending in "/"
+// creates a folder
+func (g *gateway) putObject(w http.ResponseWriter, req *s3Request) {
+	bucket, err := g.bucketFolder(req)
+	if err != nil {
+		writeAPIError(w, req.Request, err)
+		return
+	}
+
+	dir, name := path.Split(req.key)
+	folder, err := bucket.MkdirAll(dir)
+	if err != nil {
+		writeAPIError(w, req.Request, err)
+		return
+	}
+	if name == "" {
+		w.Header().Set("ETag", EMPTY_ETAG)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	existing, err := g.lookupObject(req)
+	if err != nil && err != errNoSuchKey {
+		writeAPIError(w, req.Request, err)
+		return
+	}
+	opts, err := putOptions(req, existing)
+	if err != nil {
+		writeAPIError(w, req.Request, err)
+		return
+	}
+
+	f, err := sdk.PutFile(req.client, folder.Desc.Id, name, req.sig.payload(req.Request), opts)
+	if err != nil {
+		writeAPIError(w, req.Request, err)
+		return
+	}
+	w.Header().Set("ETag", quoteEtag(f.Desc.Etag))
+	w.WriteHeader(http.StatusOK)
+}
+
+// DeleteObject, guarded by the current ETag of the object or that given in
+// If-Match. Deleting a missing key succeeds as it does on S3
+func (g *gateway) deleteObject(w http.ResponseWriter, req *s3Request) {
+	f, err := g.lookupObject(req)
+	if err == errNoSuchKey {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	} else if err != nil {
+		writeAPIError(w, req.Request, err)
+		return
+	}
+
+	if v := req.Header.Get("If-Match"); v != "" && !etagListed(v, f.Desc.Etag) {
+		writeError(w, req.Request, http.StatusPreconditionFailed, "PreconditionFailed", "ETag does not match")
+		return
+	}
+
+	err = f.Delete()
+	if err != nil && !api.IsStatus(err, http.StatusNotFound) {
+		writeAPIError(w, req.Request, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
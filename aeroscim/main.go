@@ -0,0 +1,71 @@
+package main
+
+// The entrypoint for aeroscim, a SCIM 2.0 endpoint provisioning AeroFS users
+// and groups from an identity provider
+
+import (
+	"flag"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	scim "github.com/aerofs/aerofs-sdk-golang/aerofsscim"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Global logger
+var logger = log.New(os.Stderr, "", log.LstdFlags)
+
+const USAGE = `Usage : AEROFS_TOKEN=<admin token> SCIM_TOKEN=<secret> ./aeroscim -host <appliance> [options]
+
+Options :
+  -listen <address>        the address to listen on, :8443 by default
+  -cert <cert.pem>         the TLS certificate to serve, plain HTTP without it
+  -key <key.pem>           the key of the TLS certificate
+  -path <path>             the base path of the endpoint, /scim/v2 by default
+  -base-url <url>          the public URL of the endpoint, used in resource locations
+  -delete-on-deactivate    delete users the identity provider deactivates`
+
+func exit(err error) {
+	fmt.Println(err)
+	os.Exit(1)
+}
+
+func main() {
+	host := flag.String("host", "", "hostname of the AeroFS Appliance")
+	listen := flag.String("listen", ":8443", "address to listen on")
+	cert := flag.String("cert", "", "TLS certificate file")
+	key := flag.String("key", "", "TLS key file")
+	path := flag.String("path", "/scim/v2", "base path of the endpoint")
+	baseURL := flag.String("base-url", "", "public URL of the endpoint")
+	deleteOnDeactivate := flag.Bool("delete-on-deactivate", false, "delete deactivated users")
+	flag.Parse()
+
+	token := os.Getenv("AEROFS_TOKEN")
+	scimToken := os.Getenv("SCIM_TOKEN")
+	if *host == "" || token == "" || scimToken == "" || (*cert == "") != (*key == "") {
+		fmt.Println(USAGE)
+		os.Exit(1)
+	}
+	c, _ := api.NewClient(token, *host)
+
+	server := scim.NewServer(c, scimToken)
+	server.BaseURL = *baseURL
+	server.DeleteOnDeactivate = *deleteOnDeactivate
+	server.Log = logger.Printf
+
+	prefix := "/" + strings.Trim(*path, "/")
+	mux := http.NewServeMux()
+	mux.Handle(prefix+"/", http.StripPrefix(prefix, server))
+
+	var err error
+	if *cert != "" {
+		logger.Printf("Serving SCIM on https://%s%s", *listen, prefix)
+		err = http.ListenAndServeTLS(*listen, *cert, *key, mux)
+	} else {
+		logger.Printf("Serving SCIM on http://%s%s, without TLS the bearer token is sent in the clear", *listen, prefix)
+		err = http.ListenAndServe(*listen, mux)
+	}
+	exit(err)
+}
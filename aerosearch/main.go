@@ -0,0 +1,166 @@
+package main
+
+// The entrypoint for aerosearch, indexing AeroFS folders into a local search
+// index and querying it
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	search "github.com/aerofs/aerofs-sdk-golang/aerofssearch"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// Global logger
+var logger = log.New(os.Stderr, "", log.LstdFlags)
+
+const USAGE = `Usage :
+  AEROFS_TOKEN=<token> ./aerosearch index -host <appliance> [-folder <id or /path>] [options]
+  AEROFS_TOKEN=<admin token> ./aerosearch index -host <appliance> -all [options]
+  ./aerosearch query [-mime <prefix>] [-share <name>] [-name <substring>] [-json] <terms>
+
+Options :
+  -index <file>        the index file, aerofs.index by default
+  -text                index the text of plain text, Markdown and PDF files
+  -interval <duration> keep updating the index at this interval, ie. 15m`
+
+func exit(err error) {
+	fmt.Println(err)
+	os.Exit(1)
+}
+
+// A folder to index and the tree name it is indexed under
+type source struct {
+	folderId string
+	opts     search.UpdateOptions
+}
+
+// Return every shared folder of the organization
+func allShares(c *api.Client) ([]source, error) {
+	users, err := sdk.ListAllUsers(c, sdk.DEFAULT_PAGE_SIZE)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := []source{}
+	seen := map[string]bool{}
+	for _, u := range users {
+		shares, err := sdk.ListSharedFolders(c, u.Email, []string{})
+		if err != nil {
+			logger.Printf("Unable to list the shared folders of %s : %s", u.Email, err)
+			continue
+		}
+		for _, s := range shares {
+			if seen[s.Id] {
+				continue
+			}
+			seen[s.Id] = true
+			sources = append(sources, source{sdk.ShareRootFolderId(s.Id),
+				search.UpdateOptions{Tree: "share:" + s.Id, Share: s.Name}})
+		}
+	}
+	return sources, nil
+}
+
+func update(ix *search.Index, c *api.Client, sources []source, text bool) {
+	for _, s := range sources {
+		s.opts.ExtractText = text
+		s.opts.Log = logger.Printf
+		report, err := ix.Update(c, s.folderId, s.opts)
+		if err != nil {
+			logger.Printf("Unable to index %s : %s", s.opts.Tree, err)
+			continue
+		}
+		logger.Printf("%s : %d added, %d updated, %d unchanged, %d removed, %d failures",
+			s.opts.Tree, report.Added, report.Updated, report.Unchanged, report.Removed,
+			len(report.Failures))
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println(USAGE)
+		os.Exit(1)
+	}
+
+	flags := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	indexFile := flags.String("index", "aerofs.index", "the index file")
+	host := flags.String("host", "", "hostname of the AeroFS Appliance")
+	folder := flags.String("folder", "root", "identifier or path of the folder to index")
+	all := flags.Bool("all", false, "index every shared folder of the organization")
+	text := flags.Bool("text", false, "index the text of plain text, Markdown and PDF files")
+	interval := flags.Duration("interval", 0, "keep updating the index at this interval")
+	mime := flags.String("mime", "", "prefix of the MIME type of results")
+	share := flags.String("share", "", "name of the shared folder of results")
+	name := flags.String("name", "", "substring of the name of results")
+	limit := flags.Int("limit", search.DEFAULT_LIMIT, "maximum number of results")
+	asJSON := flags.Bool("json", false, "print results as JSON")
+	flags.Parse(os.Args[2:])
+
+	ix, err := search.Open(*indexFile)
+	if err != nil {
+		exit(err)
+	}
+	defer ix.Close()
+
+	switch os.Args[1] {
+	case "index":
+		token := os.Getenv("AEROFS_TOKEN")
+		if *host == "" || token == "" {
+			fmt.Println(USAGE)
+			os.Exit(1)
+		}
+		c, _ := api.NewClient(token, *host)
+
+		for {
+			sources := []source{}
+			if *all {
+				sources, err = allShares(c)
+				if err != nil {
+					exit(err)
+				}
+			} else {
+				folderId := *folder
+				if strings.HasPrefix(folderId, "/") {
+					root := sdk.FolderClient{APIClient: c, Desc: sdk.Folder{Id: "root"}}
+					f, err := root.Subfolder(folderId)
+					if err != nil {
+						exit(err)
+					}
+					folderId = f.Desc.Id
+				}
+				sources = append(sources, source{folderId, search.UpdateOptions{Tree: *folder}})
+			}
+
+			update(ix, c, sources, *text)
+			if *interval == 0 {
+				return
+			}
+			time.Sleep(*interval)
+		}
+
+	case "query":
+		results, err := ix.Search(search.Query{Text: strings.Join(flags.Args(), " "),
+			Mime: *mime, Share: *share, Name: *name, Limit: *limit})
+		if err != nil {
+			exit(err)
+		}
+		if *asJSON {
+			data, _ := json.MarshalIndent(results, "", "  ")
+			fmt.Println(string(data))
+			return
+		}
+		for _, r := range results {
+			fmt.Printf("%s/%s\t%d bytes\t%s\t%s\n", r.Tree, r.Path, r.Size, r.LastModified, r.Mime)
+		}
+
+	default:
+		fmt.Println(USAGE)
+		os.Exit(1)
+	}
+}
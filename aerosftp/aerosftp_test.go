@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"io"
+	"os"
+	"testing"
+)
+
+// A write handle streaming into a buffer instead of an upload
+func newTestWriteHandle() (*writeHandle, *bytes.Buffer) {
+	reader, writer := io.Pipe()
+	h := &writeHandle{pipe: writer, pending: map[int64][]byte{}, done: make(chan error, 1)}
+	buffer := &bytes.Buffer{}
+	go func() {
+		_, err := io.Copy(buffer, reader)
+		h.done <- err
+	}()
+	return h, buffer
+}
+
+func TestWriteOutOfOrder(t *testing.T) {
+	h, buffer := newTestWriteHandle()
+	for _, offset := range []int64{6, 3, 0, 9} {
+		n, err := h.WriteAt([]byte("abcdefghijkl")[offset:offset+3], offset)
+		if n != 3 || err != nil {
+			t.Fatalf("Write at %d : %d, %v", offset, n, err)
+		}
+	}
+	if err := h.Close(); err != nil {
+		t.Fatalf("Unable to close : %s", err)
+	}
+	if buffer.String() != "abcdefghijkl" {
+		t.Errorf("Unexpected content %q", buffer.String())
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	h, _ := newTestWriteHandle()
+	h.WriteAt([]byte("abc"), 0)
+	if _, err := h.WriteAt([]byte("a"), 1); err != errRewrite {
+		t.Errorf("Expected rewrite error, got %v", err)
+	}
+
+	h.WriteAt([]byte("xyz"), 10)
+	if err := h.Close(); err != errHole {
+		t.Errorf("Expected an error closing with a gap, got %v", err)
+	}
+}
+
+func TestListerAt(t *testing.T) {
+	list := listerAt{}
+	for _, name := range []string{"a", "b", "c"} {
+		list = append(list, &sdk.NodeInfo{Node: &sdk.Node{File: sdk.File{Name: name}}})
+	}
+
+	entries := make([]os.FileInfo, 2)
+	n, err := list.ListAt(entries, 0)
+	if n != 2 || err != nil {
+		t.Errorf("First page : %d, %v", n, err)
+	}
+	n, err = list.ListAt(entries, 2)
+	if n != 1 || err != io.EOF || entries[0].Name() != "c" {
+		t.Errorf("Last page : %d, %v", n, err)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"io"
+	"os"
+	"sync"
+)
+
+// The most content of a file written out of order held in memory
+const MAX_PENDING = 64 * 1024 * 1024
+
+var (
+	errRewrite = errors.New("Content can only be written once, from the start of the file")
+	errPending = errors.New("Too much content written out of order")
+	errHole    = errors.New("The content written has gaps")
+)
+
+// The entries of a listing
+type listerAt []os.FileInfo
+
+func (l listerAt) ListAt(entries []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+
+	n := copy(entries, l[offset:])
+	if offset+int64(n) == int64(len(l)) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Reads a file in CHUNKSIZE byte-ranges, each conditional on the ETag the
+// file had when opened so a concurrent modification fails the read
+type readHandle struct {
+	file sdk.FileClient
+
+	// The most recently retrieved range
+	mu          sync.Mutex
+	buffer      []byte
+	bufferStart int64
+}
+
+func (h *readHandle) ReadAt(p []byte, offset int64) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	size := int64(h.file.Desc.Size)
+	read := 0
+	for read < len(p) {
+		current := offset + int64(read)
+		if current >= size {
+			return read, io.EOF
+		}
+
+		bufferEnd := h.bufferStart + int64(len(h.buffer))
+		if current < h.bufferStart || current >= bufferEnd {
+			err := h.fill(current)
+			if err != nil {
+				return read, err
+			}
+		}
+		read += copy(p[read:], h.buffer[current-h.bufferStart:])
+	}
+	return read, nil
+}
+
+// Retrieve the range starting at an offset
+func (h *readHandle) fill(offset int64) error {
+	size := int64(h.file.Desc.Size)
+	end := offset + api.CHUNKSIZE - 1
+	if end >= size {
+		end = size - 1
+	}
+
+	body, err := h.file.ReadRange(int(offset), int(end))
+	if err != nil {
+		return sdk.OSError(err)
+	}
+
+	h.buffer = body
+	h.bufferStart = offset
+	return nil
+}
+
+// Streams written content into an upload through a pipe
+// SFTP clients may pipeline writes so they can arrive out of order, writes
+// ahead of the content streamed so far are held in memory until the gap is
+// filled
+type writeHandle struct {
+	mu      sync.Mutex
+	pipe    *io.PipeWriter
+	offset  int64
+	pending map[int64][]byte
+	held    int
+	err     error
+	done    chan error
+}
+
+// Start an upload replacing the content of a file
+func newWriteHandle(c *api.Client, fileId, mimeType string, etags []string) (*writeHandle, error) {
+	uploadId, err := c.GetFileUploadId(fileId, etags)
+	if err != nil {
+		return nil, sdk.OSError(err)
+	}
+
+	reader, writer := io.Pipe()
+	h := &writeHandle{pipe: writer, pending: map[int64][]byte{}, done: make(chan error, 1)}
+	go func() {
+		err := c.UploadFileWithType(fileId, uploadId, mimeType, reader, etags)
+		reader.CloseWithError(err)
+		h.done <- err
+	}()
+	return h, nil
+}
+
+func (h *writeHandle) WriteAt(p []byte, offset int64) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	n := len(p)
+	if h.err != nil {
+		return 0, h.err
+	}
+	if offset < h.offset {
+		return 0, errRewrite
+	}
+	if offset > h.offset {
+		if _, ok := h.pending[offset]; ok || h.held+n > MAX_PENDING {
+			return 0, errPending
+		}
+		h.pending[offset] = append([]byte{}, p...)
+		h.held += n
+		return n, nil
+	}
+
+	for {
+		_, err := h.pipe.Write(p)
+		if err != nil {
+			h.err = sdk.OSError(err)
+			return 0, h.err
+		}
+		h.offset += int64(len(p))
+
+		next, ok := h.pending[h.offset]
+		if !ok {
+			break
+		}
+		delete(h.pending, h.offset)
+		h.held -= len(next)
+		p = next
+	}
+	return n, nil
+}
+
+// Complete the upload
+func (h *writeHandle) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.err == nil && len(h.pending) > 0 {
+		h.err = errHole
+	}
+	if h.err != nil {
+		h.pipe.CloseWithError(h.err)
+		<-h.done
+		return h.err
+	}
+
+	h.pipe.Close()
+	return sdk.OSError(<-h.done)
+}
+
+// Abort the upload, called by the sftp package when a transfer fails
+func (h *writeHandle) TransferError(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.err == nil {
+		h.err = err
+	}
+}
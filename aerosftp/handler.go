@@ -0,0 +1,274 @@
+package main
+
+// SFTP request handlers mapping paths of the user's root folder onto the
+// AeroFS API
+
+import (
+	"errors"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	"github.com/pkg/sftp"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"strings"
+)
+
+// Serves the SFTP requests of one session, as the user of an OAuth token
+type handler struct {
+	client *api.Client
+}
+
+func newHandlers(c *api.Client) sftp.Handlers {
+	h := &handler{client: c}
+	return sftp.Handlers{FileGet: h, FilePut: h, FileCmd: h, FileList: h}
+}
+
+// Return the children of a folder
+func (h *handler) children(folderId string) (*api.Children, error) {
+	f := sdk.FolderClient{APIClient: h.client, Desc: sdk.Folder{Id: folderId}}
+	err := f.LoadChildren()
+	if err != nil {
+		return nil, sdk.OSError(err)
+	}
+	return &f.Desc.ChildList, nil
+}
+
+// Resolve a path, "/" being the user's root folder
+func (h *handler) lookup(p string) (*sdk.Node, error) {
+	n := &sdk.Node{Dir: true, Folder: sdk.Folder{Id: "root", Name: "/"}}
+	for _, name := range strings.Split(path.Clean("/"+p), "/") {
+		if name == "" {
+			continue
+		}
+		if !n.Dir {
+			return nil, os.ErrNotExist
+		}
+
+		children, err := h.children(n.Folder.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		var next *sdk.Node
+		for _, f := range children.Folders {
+			if f.Name == name {
+				next = &sdk.Node{Dir: true, ParentId: n.Folder.Id, Folder: sdk.Folder(f)}
+			}
+		}
+		for _, f := range children.Files {
+			if f.Name == name {
+				next = &sdk.Node{ParentId: n.Folder.Id, File: sdk.File(f)}
+			}
+		}
+		if next == nil {
+			return nil, os.ErrNotExist
+		}
+		n = next
+	}
+
+	// Listings may omit the ETag which guards modifications
+	if !n.Dir && n.File.Etag == "" {
+		f := sdk.FileClient{APIClient: h.client, Desc: n.File}
+		err := f.LoadMetadata()
+		if err != nil {
+			return nil, sdk.OSError(err)
+		}
+		n.File = f.Desc
+	}
+	return n, nil
+}
+
+// Resolve the folder a new entry is created in
+func (h *handler) lookupParent(p string) (*sdk.Node, string, error) {
+	dir, name := path.Split(path.Clean("/" + p))
+	parent, err := h.lookup(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	if !parent.Dir || name == "" {
+		return nil, "", os.ErrNotExist
+	}
+	return parent, name, nil
+}
+
+func (h *handler) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	n, err := h.lookup(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+	if n.Dir {
+		return nil, errors.New("Is a folder")
+	}
+	return &readHandle{file: sdk.FileClient{APIClient: h.client, Desc: n.File}}, nil
+}
+
+// Files are always written from the start and replace the existing content,
+// appending or writing into the middle of a file is not supported
+func (h *handler) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	flags := r.Pflags()
+	if flags.Append {
+		return nil, sftp.ErrSSHFxOpUnsupported
+	}
+
+	parent, name, err := h.lookupParent(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	etags := []string{}
+	var fileId string
+	existing, err := h.lookup(r.Filepath)
+	switch {
+	case err == nil && existing.Dir:
+		return nil, errors.New("Is a folder")
+	case err == nil && flags.Excl:
+		return nil, os.ErrExist
+	case err == nil:
+		fileId = existing.File.Id
+		etags = append(etags, existing.File.Etag)
+	case os.IsNotExist(err):
+		f, err := sdk.CreateFileClient(h.client, parent.Folder.Id, name)
+		if err != nil {
+			return nil, sdk.OSError(err)
+		}
+		fileId = f.Desc.Id
+	default:
+		return nil, err
+	}
+
+	mimeType := mime.TypeByExtension(path.Ext(name))
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	return newWriteHandle(h.client, fileId, mimeType, etags)
+}
+
+func (h *handler) Filecmd(r *sftp.Request) error {
+	switch r.Method {
+	case "Setstat":
+		// Permissions and times are not stored by AeroFS, accept them so
+		// clients preserving attributes do not fail the transfer
+		return nil
+	case "Mkdir":
+		return h.mkdir(r.Filepath)
+	case "Rename":
+		return h.rename(r.Filepath, r.Target)
+	case "Rmdir":
+		return h.remove(r.Filepath, true)
+	case "Remove":
+		return h.remove(r.Filepath, false)
+	}
+	return sftp.ErrSSHFxOpUnsupported
+}
+
+func (h *handler) mkdir(p string) error {
+	if _, err := h.lookup(p); err == nil {
+		return os.ErrExist
+	}
+	parent, name, err := h.lookupParent(p)
+	if err != nil {
+		return err
+	}
+	_, err = sdk.CreateFolderClient(h.client, parent.Folder.Id, name)
+	return sdk.OSError(err)
+}
+
+// Move a file or folder, the target must not exist
+func (h *handler) rename(source, target string) error {
+	n, err := h.lookup(source)
+	if err != nil {
+		return err
+	}
+	if n.Dir && n.Folder.Id == "root" {
+		return os.ErrPermission
+	}
+	if _, err := h.lookup(target); err == nil {
+		return os.ErrExist
+	}
+	parent, name, err := h.lookupParent(target)
+	if err != nil {
+		return err
+	}
+
+	if n.Dir {
+		etag, err := h.folderEtag(n)
+		if err != nil {
+			return sdk.OSError(err)
+		}
+		_, _, err = h.client.MoveFolder(n.Folder.Id, parent.Folder.Id, name, []string{etag})
+		return sdk.OSError(err)
+	}
+	_, _, err = h.client.MoveFile(n.File.Id, parent.Folder.Id, name, []string{n.File.Etag})
+	return sdk.OSError(err)
+}
+
+// Remove a file, or an empty folder
+func (h *handler) remove(p string, isDir bool) error {
+	n, err := h.lookup(p)
+	if err != nil {
+		return err
+	}
+	if n.Dir != isDir || n.Folder.Id == "root" {
+		return sftp.ErrSSHFxFailure
+	}
+
+	if !isDir {
+		return sdk.OSError(h.client.DeleteFile(n.File.Id, []string{n.File.Etag}))
+	}
+
+	// The ETag is loaded first so the folder is not deleted if contents are
+	// added after it was found empty
+	etag, err := h.folderEtag(n)
+	if err != nil {
+		return sdk.OSError(err)
+	}
+	children, err := h.children(n.Folder.Id)
+	if err != nil {
+		return err
+	}
+	if len(children.Folders) > 0 || len(children.Files) > 0 {
+		return errors.New("Folder is not empty")
+	}
+	return sdk.OSError(h.client.DeleteFolder(n.Folder.Id, []string{etag}))
+}
+
+// Return the ETag of a folder, which is not part of the list of children
+func (h *handler) folderEtag(n *sdk.Node) (string, error) {
+	folder := sdk.FolderClient{APIClient: h.client, Desc: n.Folder}
+	err := folder.LoadMetadata()
+	return folder.Desc.Etag, err
+}
+
+func (h *handler) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	n, err := h.lookup(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	switch r.Method {
+	case "Stat":
+		return listerAt{&sdk.NodeInfo{Node: n}}, nil
+	case "List":
+		if !n.Dir {
+			return nil, errors.New("Not a folder")
+		}
+		children, err := h.children(n.Folder.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		list := listerAt{}
+		for _, f := range children.Folders {
+			list = append(list, &sdk.NodeInfo{Node: &sdk.Node{Dir: true,
+				ParentId: n.Folder.Id, Folder: sdk.Folder(f)}})
+		}
+		for _, f := range children.Files {
+			list = append(list, &sdk.NodeInfo{Node: &sdk.Node{
+				ParentId: n.Folder.Id, File: sdk.File(f)}})
+		}
+		return list, nil
+	}
+	return nil, sftp.ErrSSHFxOpUnsupported
+}
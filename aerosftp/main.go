@@ -0,0 +1,197 @@
+package main
+
+// The entrypoint for aerosftp, an SFTP server exposing the root folder of
+// AeroFS users to clients which only speak SFTP
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	api "github.com/aerofs/aerofs-sdk-golang/aerofsapi"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+)
+
+// Global logger
+var logger = log.New(os.Stderr, "", log.LstdFlags|log.Lshortfile)
+
+// A public key allowed to log in and the AeroFS OAuth token its sessions are
+// served with
+type User struct {
+	// An authorized_keys line
+	PublicKey string `json:"public_key"`
+
+	// The SSH user name the key must log in as, any if empty
+	Name string `json:"name"`
+
+	Token string `json:"token"`
+}
+
+// The server configuration file
+type Config struct {
+	// <host>:<port> to serve SFTP on
+	Listen string `json:"listen"`
+
+	// The hostname of the AeroFS Appliance
+	Host string `json:"host"`
+
+	// Path of the PEM encoded private host key
+	HostKey string `json:"host_key"`
+
+	Users []*User `json:"users"`
+}
+
+// Read a configuration file
+func loadConfig(fileName string) (*Config, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	config := Config{Listen: "localhost:2022"}
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to unmarshal configuration : %s", err)
+	}
+
+	if config.Host == "" || config.HostKey == "" || len(config.Users) == 0 {
+		return nil, errors.New("The configuration requires a host, a host key and at least one user")
+	}
+	return &config, nil
+}
+
+// The SFTP server
+type server struct {
+	config    *Config
+	sshConfig *ssh.ServerConfig
+
+	// Users by the fingerprint of their key
+	users map[string]*User
+}
+
+func newServer(config *Config) (*server, error) {
+	s := server{config: config, users: map[string]*User{}}
+	for _, u := range config.Users {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(u.PublicKey))
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse public key %q : %s", u.PublicKey, err)
+		}
+		s.users[ssh.FingerprintSHA256(key)] = u
+	}
+
+	data, err := ioutil.ReadFile(config.HostKey)
+	if err != nil {
+		return nil, err
+	}
+	hostKey, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse host key : %s", err)
+	}
+
+	s.sshConfig = &ssh.ServerConfig{PublicKeyCallback: s.authenticate}
+	s.sshConfig.AddHostKey(hostKey)
+	return &s, nil
+}
+
+// Accept a public key listed in the configuration, the fingerprint is kept in
+// the permissions to find the user once the connection is established
+func (s *server) authenticate(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	fingerprint := ssh.FingerprintSHA256(key)
+	u, ok := s.users[fingerprint]
+	if !ok || (u.Name != "" && u.Name != conn.User()) {
+		return nil, errors.New("Unknown public key")
+	}
+	return &ssh.Permissions{Extensions: map[string]string{"fingerprint": fingerprint}}, nil
+}
+
+func (s *server) serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handleConn(conn)
+	}
+}
+
+// Serve the "sftp" subsystem on every session channel of a connection
+func (s *server) handleConn(conn net.Conn) {
+	sshConn, channels, requests, err := ssh.NewServerConn(conn, s.sshConfig)
+	if err != nil {
+		logger.Printf("%s : %s", conn.RemoteAddr(), err)
+		return
+	}
+	defer sshConn.Close()
+	go ssh.DiscardRequests(requests)
+
+	u := s.users[sshConn.Permissions.Extensions["fingerprint"]]
+	c, err := api.NewClient(u.Token, s.config.Host)
+	if err != nil {
+		logger.Println(err)
+		return
+	}
+	logger.Printf("%s logged in as %s", conn.RemoteAddr(), sshConn.User())
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "Only session channels are supported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			logger.Println(err)
+			continue
+		}
+
+		go func() {
+			defer channel.Close()
+			for req := range requests {
+				// The payload of a subsystem request is the length-prefixed name
+				isSFTP := req.Type == "subsystem" && len(req.Payload) > 4 &&
+					string(req.Payload[4:]) == "sftp"
+				req.Reply(isSFTP, nil)
+				if !isSFTP {
+					continue
+				}
+
+				server := sftp.NewRequestServer(channel, newHandlers(c))
+				err := server.Serve()
+				if err != nil && err != io.EOF {
+					logger.Printf("%s : %s", conn.RemoteAddr(), err)
+				}
+				server.Close()
+				return
+			}
+		}()
+	}
+}
+
+func main() {
+	if len(os.Args[1:]) != 1 {
+		fmt.Println("Usage : ./aerosftp <config.json>")
+		os.Exit(1)
+	}
+
+	config, err := loadConfig(os.Args[1])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	s, err := newServer(config)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	listener, err := net.Listen("tcp", config.Listen)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	logger.Printf("Serving AeroFS Appliance %s over SFTP at %s", config.Host, config.Listen)
+	logger.Fatal(s.serve(listener))
+}
@@ -1,16 +1,38 @@
 package main
 
 import (
+	"crypto/rand"
+	"fmt"
 	"github.com/aerofs/aerofs-sdk-golang/aerofsapi"
 	sdk "github.com/aerofs/aerofs-sdk-golang/aerofssdk"
+	search "github.com/aerofs/aerofs-sdk-golang/aerofssearch"
+	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
 	"html/template"
 	"net/http"
+	"sync"
 )
 
 // Non-persistent datastore for session information
 // For persistence, use an actual DB or FileSystemStore
-var store = sessions.NewCookieStore([]byte("UNIQUEID"))
+// Cookies are signed with a key generated at startup, so the email stored in a
+// session cannot be forged
+var store = sessions.NewCookieStore(sessionKey())
+
+func sessionKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// Return the email of the signed in user, as verified with the Appliance when
+// the token was issued
+func sessionEmail(session *sessions.Session) (string, bool) {
+	email, ok := session.Values["email"].(string)
+	return email, ok && email != ""
+}
 
 // A default handler at the root of the website
 // Redirect the user to either signin or the homepage depending on if
@@ -44,9 +66,10 @@ func loginSubmitHandler(w http.ResponseWriter, r *http.Request) {
 	// Get new session
 	session, _ := store.Get(r, "session-name")
 
-	// Assumes a valid email was given
+	// The email entered is not trusted, the email of the user is retrieved
+	// from the Appliance once the token is issued
 	r.ParseForm()
-	session.Values["email"] = r.Form.Get("email")
+	delete(session.Values, "email")
 
 	// Redirect User to AeroFS Appliance to retrieve Authorization Code
 	ac, err := aerofsapi.NewAuthClient(appConfig,
@@ -58,7 +81,7 @@ func loginSubmitHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	aeroUrl := ac.GetAuthorizationUrl()
-	logger.Printf("Sending user %s to the AeroFS Appliance at %s", session.Values["email"], aeroUrl)
+	logger.Printf("Sending user %s to the AeroFS Appliance at %s", r.Form.Get("email"), aeroUrl)
 	session.Save(r, w)
 	http.Redirect(w, r, aeroUrl, 301)
 }
@@ -144,6 +167,122 @@ func yourFilesHandler(w http.ResponseWriter, r *http.Request) {
 	session.Save(r, w)
 }
 
+// Download a folder as a zip archive, streamed as it is retrieved
+func archiveHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := store.Get(r, "session-name")
+	token := session.Values["token"].(string)
+
+	ac, err := aerofsapi.NewAuthClient(appConfig, "", "", []string{})
+	a, _ := aerofsapi.NewClient(token, ac.AeroUrl)
+
+	folder, err := sdk.NewFolderClient(a, mux.Vars(r)["id"], []string{})
+	if err != nil {
+		logger.Println("Unable to retrieve folder client for folder.")
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	name := folder.Desc.Name
+	if name == "" {
+		name = "AeroFS"
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".zip"))
+
+	// The response has started, failures can only be logged
+	err = folder.Archive(w, sdk.Zip)
+	if err != nil {
+		logger.Printf("Unable to archive folder %s : %s", folder.Desc.Id, err)
+	}
+}
+
+// Users whose root folder is being indexed
+var indexing = map[string]bool{}
+var indexingLock sync.Mutex
+
+// The search results of a user and whether their files are being indexed
+type searchPage struct {
+	Query    string
+	Mime     string
+	Indexing bool
+	Results  []search.Result
+}
+
+// Search the indexed files of the user, each user only sees their own files
+func searchHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := store.Get(r, "session-name")
+	email, ok := sessionEmail(session)
+	if !ok {
+		http.Redirect(w, r, "/login", 303)
+		return
+	}
+
+	t, err := template.ParseFiles("templates/search.tmpl")
+	if err != nil {
+		logger.Println("Unable to retrieve template file")
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	page := searchPage{Query: r.URL.Query().Get("q"), Mime: r.URL.Query().Get("mime")}
+	indexingLock.Lock()
+	page.Indexing = indexing[email]
+	indexingLock.Unlock()
+
+	if page.Query != "" || page.Mime != "" {
+		page.Results, err = searchIndex.Search(search.Query{Text: page.Query,
+			Mime: page.Mime, Tree: "root:" + email})
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	}
+	t.Execute(w, page)
+	session.Save(r, w)
+}
+
+// Start indexing the root folder of the user in the background
+// Unchanged files are skipped, so indexing again only retrieves what changed
+func searchIndexHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := store.Get(r, "session-name")
+	token := session.Values["token"].(string)
+	email, ok := sessionEmail(session)
+	if !ok {
+		http.Redirect(w, r, "/login", 303)
+		return
+	}
+
+	ac, err := aerofsapi.NewAuthClient(appConfig, "", "", []string{})
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	a, _ := aerofsapi.NewClient(token, ac.AeroUrl)
+
+	indexingLock.Lock()
+	started := !indexing[email]
+	indexing[email] = true
+	indexingLock.Unlock()
+
+	if started {
+		go func() {
+			report, err := searchIndex.Update(a, "root", search.UpdateOptions{
+				Tree: "root:" + email, ExtractText: true, Log: logger.Printf})
+			if err != nil {
+				logger.Printf("Unable to index the files of %s : %s", email, err)
+			} else {
+				logger.Printf("Indexed the files of %s : %d added, %d updated, %d removed",
+					email, report.Added, report.Updated, report.Removed)
+			}
+
+			indexingLock.Lock()
+			delete(indexing, email)
+			indexingLock.Unlock()
+		}()
+	}
+	http.Redirect(w, r, "/search", 303)
+}
+
 // Receive a Token after user accepts permissions
 // Redirect to the devices page
 func tokenization(rw http.ResponseWriter, req *http.Request) {
@@ -156,14 +295,24 @@ func tokenization(rw http.ResponseWriter, req *http.Request) {
 	// disregard state
 	code := req.URL.Query().Get("code")
 	token, _, err := ac.GetAccessToken(code)
-	logger.Print("New activated user ...")
-	logger.Printf("\tEmail : %s | Code : %s | Token : %s",
-		session.Values["email"], code, token)
 	if err != nil {
 		logger.Println("Unable to get correct access token")
+		http.Error(rw, err.Error(), 500)
+		return
+	}
+
+	// Identify the user by their token, per-user data is keyed by this email
+	info, err := ac.GetTokenInfo(token)
+	if err != nil {
+		logger.Printf("Unable to verify the user of the token : %s", err)
+		http.Error(rw, "Unable to verify the user of the token", 401)
+		return
 	}
+	logger.Print("New activated user ...")
+	logger.Printf("\tEmail : %s | Code : %s", info.Email(), code)
 
 	session.Values["token"] = token
+	session.Values["email"] = info.Email()
 	session.Save(req, rw)
 	http.Redirect(rw, req, "http://"+hostName+"/devices", 301)
 }
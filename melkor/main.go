@@ -4,6 +4,7 @@ package main
 
 import (
 	"fmt"
+	search "github.com/aerofs/aerofs-sdk-golang/aerofssearch"
 	"github.com/gorilla/mux"
 	"log"
 	"net/http"
@@ -19,6 +20,12 @@ var hostName string
 
 var appConfig string
 
+// The search index of the files of signed in users
+var searchIndex *search.Index
+
+// The file the search index is stored in
+const SEARCH_INDEX = "melkor.index"
+
 func main() {
 
 	// Parse CLI arguments
@@ -39,6 +46,12 @@ func main() {
 	}
 	logger.Print("Melkor beginning startup...")
 
+	searchIndex, err = search.Open(SEARCH_INDEX)
+	if err != nil {
+		fmt.Println("Unable to open the search index")
+		os.Exit(1)
+	}
+
 	// Set Handlers
 	router := mux.NewRouter()
 
@@ -56,6 +69,9 @@ func main() {
 	router.HandleFunc("/devices", yourDevicesHandler).Methods("GET")
 	router.HandleFunc("/files", yourFilesHandler).Methods("GET")
 	router.HandleFunc("/totalusers", totalUsersHandler).Methods("GET")
+	router.HandleFunc("/archive/{id}", archiveHandler).Methods("GET")
+	router.HandleFunc("/search", searchHandler).Methods("GET")
+	router.HandleFunc("/search/index", searchIndexHandler).Methods("POST")
 	http.Handle("/", router)
 
 	http.ListenAndServe(hostName, nil)